@@ -15,6 +15,7 @@ type Config struct {
 	Database DatabaseConfig `yaml:"database"`
 	Redis    RedisConfig    `yaml:"redis"`
 	Email    EmailConfig    `yaml:"email"`
+	Push     PushConfig     `yaml:"push"`
 	Auth     AuthConfig     `yaml:"auth"`
 	Media    MediaConfig    `yaml:"media"`
 	Limits   LimitsConfig   `yaml:"limits"`
@@ -95,10 +96,12 @@ type MediaConfig struct {
 // LimitsConfig contains various size and count limits.
 type LimitsConfig struct {
 	MaxMessageSize      int `yaml:"max_message_size"`
-	MaxSubscriberCount  int `yaml:"max_subscriber_count"`
+	MaxSubscriberCount  int `yaml:"max_subscriber_count"` // Max members per room (rooms may set a lower cap)
 	EditWindowMinutes   int `yaml:"edit_window_minutes"`
 	UnsendWindowMinutes int `yaml:"unsend_window_minutes"`
 	MaxEditCount        int `yaml:"max_edit_count"`
+	MaxPinnedMessages   int `yaml:"max_pinned_messages"` // Max pinned messages per conversation
+	MaxReactionEmojis   int `yaml:"max_reaction_emojis"` // Max distinct reaction emojis per message
 
 	// Rate limiting (per session/user)
 	RateLimitMessages  int `yaml:"rate_limit_messages"`  // Max messages per second
@@ -152,6 +155,69 @@ type EmailVerificationConfig struct {
 	TokenExpiryHours int `yaml:"token_expiry_hours"`
 }
 
+// PushConfig contains mobile push notification settings.
+// IMPORTANT: Push is DISABLED by default. A notification on the lock screen
+// can reveal the chat to whoever holds the phone, so alerts carry no message
+// content unless show_preview is set.
+type PushConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Alert text used for every message
+	// Default: no title, body "You have a new message"
+	Title string `yaml:"title"`
+	Body  string `yaml:"body"`
+
+	// ShowPreview replaces the body with the start of the message text.
+	// Default: false
+	ShowPreview bool `yaml:"show_preview"`
+
+	// MaxAttempts is how many times delivery is tried before giving up.
+	// Default: 5
+	MaxAttempts int `yaml:"max_attempts"`
+
+	APNs    APNsConfig    `yaml:"apns"`
+	FCM     FCMConfig     `yaml:"fcm"`
+	WebPush WebPushConfig `yaml:"webpush"`
+}
+
+// APNsConfig contains Apple Push Notification service settings
+// (token-based authentication with a .p8 signing key).
+type APNsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	KeyFile string `yaml:"key_file"`
+	KeyID   string `yaml:"key_id"`
+	TeamID  string `yaml:"team_id"`
+	// App bundle ID
+	Topic string `yaml:"topic"`
+	// Sandbox uses the development APNs environment
+	Sandbox bool `yaml:"sandbox"`
+	// Endpoint overrides the APNs URL (e.g., a local stand-in for testing)
+	Endpoint string `yaml:"endpoint"`
+}
+
+// FCMConfig contains Firebase Cloud Messaging settings.
+type FCMConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Service account JSON key from the Firebase console
+	CredentialsFile string `yaml:"credentials_file"`
+	// Endpoint overrides the FCM URL (e.g., a local stand-in for testing)
+	Endpoint string `yaml:"endpoint"`
+}
+
+// WebPushConfig contains Web Push (VAPID) settings for browser clients.
+type WebPushConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Generate with: mvchat2 -generate-keys
+	VAPIDPublicKey  string `yaml:"vapid_public_key"`
+	VAPIDPrivateKey string `yaml:"vapid_private_key"`
+	// Contact for push service operators (mailto: or https: URL)
+	Subject string `yaml:"subject"`
+	// AllowInsecure accepts http:// subscription endpoints and private or
+	// loopback hosts (e.g., a local push service stand-in for testing).
+	// Never enable in production.
+	AllowInsecure bool `yaml:"allow_insecure"`
+}
+
 // Load reads and parses a YAML config file.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -294,6 +360,12 @@ func (c *Config) applyDefaults() {
 	if c.Limits.MaxEditCount == 0 {
 		c.Limits.MaxEditCount = 10
 	}
+	if c.Limits.MaxPinnedMessages == 0 {
+		c.Limits.MaxPinnedMessages = 50
+	}
+	if c.Limits.MaxReactionEmojis == 0 {
+		c.Limits.MaxReactionEmojis = 20
+	}
 	if c.Limits.RateLimitMessages == 0 {
 		c.Limits.RateLimitMessages = 30 // 30 messages per second
 	}
@@ -314,6 +386,15 @@ func (c *Config) applyDefaults() {
 	if c.Email.Verification.TokenExpiryHours == 0 {
 		c.Email.Verification.TokenExpiryHours = 24 // 24 hours
 	}
+
+	// Push defaults
+	// NOTE: Push is DISABLED by default and alerts are content-free
+	if c.Push.Body == "" {
+		c.Push.Body = "You have a new message"
+	}
+	if c.Push.MaxAttempts == 0 {
+		c.Push.MaxAttempts = 5
+	}
 }
 
 // knownInsecureKeys contains default keys that must not be used in production.
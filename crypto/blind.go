@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// blindIndexLabel separates the blind index key from other uses of the AES key.
+	blindIndexLabel = "mvchat2 blind index v1"
+	// blindTokenSize is the length of a stored token hash in bytes.
+	blindTokenSize = 16
+	// minTokenLength and maxTokenLength bound indexed words, in runes.
+	minTokenLength = 2
+	maxTokenLength = 64
+	// MaxIndexTokens is the most distinct words indexed per message.
+	MaxIndexTokens = 500
+)
+
+// deriveKey derives a purpose-specific key from key material.
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// Tokenize splits text into lowercase words for the blind index.
+// Words are runs of letters and digits; duplicates and words outside
+// the indexed length range are dropped. At most MaxIndexTokens are returned.
+func Tokenize(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		n := utf8.RuneCountInString(word)
+		if n < minTokenLength || n > maxTokenLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+		if len(tokens) == MaxIndexTokens {
+			break
+		}
+	}
+	return tokens
+}
+
+// BlindTokens returns the keyed hashes of the words in text. Equal words
+// hash equally under the same key, so the server can match search terms
+// without storing the words themselves.
+func (e *Encryptor) BlindTokens(text string) [][]byte {
+	words := Tokenize(text)
+	tokens := make([][]byte, 0, len(words))
+	for _, word := range words {
+		mac := hmac.New(sha256.New, e.indexKey)
+		mac.Write([]byte(word))
+		tokens = append(tokens, mac.Sum(nil)[:blindTokenSize])
+	}
+	return tokens
+}
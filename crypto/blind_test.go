@@ -0,0 +1,51 @@
+package crypto
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Court date: Monday, 9am!", []string{"court", "date", "monday", "9am"}},
+		{"call call CALL", []string{"call"}},
+		{"a b c de", []string{"de"}},
+		{"Café über straße", []string{"café", "über", "straße"}},
+		{"hotline 555-0100", []string{"hotline", "555", "0100"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBlindTokens(t *testing.T) {
+	key1, _ := GenerateKey()
+	key2, _ := GenerateKey()
+	enc1, _ := NewEncryptor(key1)
+	enc2, _ := NewEncryptor(key2)
+
+	a := enc1.BlindTokens("Shelter address")
+	b := enc1.BlindTokens("address of the SHELTER")
+	if len(a) != 2 || len(b) != 4 {
+		t.Fatalf("unexpected token counts: %d, %d", len(a), len(b))
+	}
+	if !bytes.Equal(a[0], b[3]) || !bytes.Equal(a[1], b[0]) {
+		t.Error("expected equal words to hash equally")
+	}
+	if bytes.Contains(a[0], []byte("shelter")) {
+		t.Error("token contains the word")
+	}
+
+	other := enc2.BlindTokens("shelter")
+	if bytes.Equal(a[0], other[0]) {
+		t.Error("expected different keys to produce different tokens")
+	}
+}
@@ -18,7 +18,8 @@ var (
 
 // Encryptor handles AES-GCM encryption/decryption.
 type Encryptor struct {
-	gcm cipher.AEAD
+	gcm      cipher.AEAD
+	indexKey []byte // HMAC key for blind index tokens, derived from the AES key
 }
 
 // NewEncryptor creates a new Encryptor with the given key.
@@ -38,7 +39,7 @@ func NewEncryptor(key []byte) (*Encryptor, error) {
 		return nil, err
 	}
 
-	return &Encryptor{gcm: gcm}, nil
+	return &Encryptor{gcm: gcm, indexKey: deriveKey(key, blindIndexLabel)}, nil
 }
 
 // NewEncryptorFromBase64 creates a new Encryptor from a base64-encoded key.
@@ -13,6 +13,8 @@ import (
 	"github.com/scalecode-solutions/mvchat2/config"
 	"github.com/scalecode-solutions/mvchat2/crypto"
 	"github.com/scalecode-solutions/mvchat2/email"
+	"github.com/scalecode-solutions/mvchat2/push"
+	"github.com/scalecode-solutions/mvchat2/redis"
 	"github.com/scalecode-solutions/mvchat2/store"
 )
 
@@ -75,12 +77,28 @@ func (h *Handlers) broadcastToConv(ctx context.Context, convID uuid.UUID, info *
 	h.hub.SendToUsers(memberIDs, &ServerMessage{Info: info}, skipSession)
 }
 
-// isOnline safely checks if a user is online (handles nil hub for testing).
-func (h *Handlers) isOnline(userID uuid.UUID) bool {
-	if h.hub == nil {
-		return false
+// maxRoomMembers returns the server-wide room member limit (0 = unlimited).
+func (h *Handlers) maxRoomMembers() int {
+	if h.cfg == nil {
+		return 0
+	}
+	return h.cfg.Limits.MaxSubscriberCount
+}
+
+// maxPinnedMessages returns the per-conversation pin limit (0 = unlimited).
+func (h *Handlers) maxPinnedMessages() int {
+	if h.cfg == nil {
+		return 0
+	}
+	return h.cfg.Limits.MaxPinnedMessages
+}
+
+// maxReactionEmojis returns the per-message distinct emoji limit (0 = unlimited).
+func (h *Handlers) maxReactionEmojis() int {
+	if h.cfg == nil {
+		return 0
 	}
-	return h.hub.IsOnline(userID)
+	return h.cfg.Limits.MaxReactionEmojis
 }
 
 // Handlers holds dependencies for request handlers.
@@ -92,11 +110,19 @@ type Handlers struct {
 	email        *email.Service
 	inviteTokens *crypto.InviteTokenGenerator
 	cfg          *config.Config
+	slowMode     *SlowModeTracker
+	typing       *TypingTracker
+	push         *push.Service
+	webPush      *push.WebPush
 }
 
 // NewHandlers creates a new Handlers instance.
 func NewHandlers(db store.Store, a *auth.Auth, hub *Hub, enc *crypto.Encryptor, emailSvc *email.Service, inviteTokens *crypto.InviteTokenGenerator, cfg *config.Config) *Handlers {
-	return &Handlers{
+	var redisClient *redis.Client
+	if hub != nil {
+		redisClient = hub.redis
+	}
+	h := &Handlers{
 		db:           db,
 		auth:         a,
 		hub:          hub,
@@ -104,7 +130,10 @@ func NewHandlers(db store.Store, a *auth.Auth, hub *Hub, enc *crypto.Encryptor,
 		email:        emailSvc,
 		inviteTokens: inviteTokens,
 		cfg:          cfg,
+		slowMode:     NewSlowModeTracker(redisClient),
 	}
+	h.typing = NewTypingTracker(redisClient, h.sendTyping)
+	return h
 }
 
 // HandleLogin processes login requests.
@@ -176,8 +205,10 @@ func (h *Handlers) handleBasicLogin(ctx context.Context, s SessionInterface, msg
 		}
 	}
 
-	// Update last seen
-	h.db.UpdateUserLastSeen(ctx, user.ID, s.UserAgent())
+	// Update last seen, unless the user is invisible
+	if !invisible(user.Presence) {
+		h.db.UpdateUserLastSeen(ctx, user.ID, s.UserAgent())
+	}
 
 	params := map[string]any{
 		"user":          user.ID.String(),
@@ -194,6 +225,21 @@ func (h *Handlers) handleBasicLogin(ctx context.Context, s SessionInterface, msg
 	if user.Lang != nil {
 		params["lang"] = *user.Lang
 	}
+	if user.HideReadReceipts {
+		params["readReceipts"] = false
+	}
+	if user.NotifyDefault != "" {
+		params["notify"] = user.NotifyDefault
+	}
+	if user.QuietHours != nil {
+		params["quietHours"] = quietHoursResponse(user.QuietHours)
+	}
+	if user.Presence != nil {
+		params["presence"] = presenceResponse(user.Presence)
+	}
+	if user.PresencePrivacy != nil {
+		params["presencePrivacy"] = presencePrivacyResponse(user.PresencePrivacy)
+	}
 	s.Send(CtrlSuccess(msg.ID, CodeOK, params))
 }
 
@@ -223,8 +269,10 @@ func (h *Handlers) handleTokenLogin(ctx context.Context, s SessionInterface, msg
 		}
 	}
 
-	// Update last seen
-	h.db.UpdateUserLastSeen(ctx, user.ID, s.UserAgent())
+	// Update last seen, unless the user is invisible
+	if !invisible(user.Presence) {
+		h.db.UpdateUserLastSeen(ctx, user.ID, s.UserAgent())
+	}
 
 	// Generate new token (refresh)
 	token, expiresAt, err := h.auth.GenerateToken(user.ID)
@@ -248,6 +296,21 @@ func (h *Handlers) handleTokenLogin(ctx context.Context, s SessionInterface, msg
 	if user.Lang != nil {
 		params["lang"] = *user.Lang
 	}
+	if user.HideReadReceipts {
+		params["readReceipts"] = false
+	}
+	if user.NotifyDefault != "" {
+		params["notify"] = user.NotifyDefault
+	}
+	if user.QuietHours != nil {
+		params["quietHours"] = quietHoursResponse(user.QuietHours)
+	}
+	if user.Presence != nil {
+		params["presence"] = presenceResponse(user.Presence)
+	}
+	if user.PresencePrivacy != nil {
+		params["presencePrivacy"] = presencePrivacyResponse(user.PresencePrivacy)
+	}
 	s.Send(CtrlSuccess(msg.ID, CodeOK, params))
 }
 
@@ -508,6 +571,59 @@ func (h *Handlers) handleUpdateAccount(ctx context.Context, s SessionInterface,
 		}
 	}
 
+	// Update read receipt sharing if provided
+	if acc.ReadReceipts != nil {
+		if err := h.db.UpdateUserReadReceipts(ctx, s.UserID(), *acc.ReadReceipts); err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update read receipts"))
+			return
+		}
+	}
+
+	// Update default notification level if provided
+	if acc.Notify != nil {
+		if !validNotifyLevel(*acc.Notify) {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid notify level"))
+			return
+		}
+		if err := h.db.UpdateUserNotifyDefault(ctx, s.UserID(), *acc.Notify); err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update notify level"))
+			return
+		}
+	}
+
+	// Update quiet hours if provided
+	var quiet *store.QuietHours
+	if acc.QuietHours != nil {
+		var err error
+		quiet, err = parseQuietHours(acc.QuietHours)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, err.Error()))
+			return
+		}
+		if err := h.db.UpdateUserQuietHours(ctx, s.UserID(), quiet); err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update quiet hours"))
+			return
+		}
+	}
+
+	// Update presence privacy if provided
+	var privacy *store.PresencePrivacy
+	if acc.PresencePrivacy != nil {
+		var err error
+		privacy, err = parsePresencePrivacy(acc.PresencePrivacy, s.UserID())
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, err.Error()))
+			return
+		}
+		if err := h.db.UpdateUserPresencePrivacy(ctx, s.UserID(), privacy); err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update presence privacy"))
+			return
+		}
+		if h.hub != nil && h.hub.presence != nil {
+			h.hub.presence.PrivacyChanged(s.UserID())
+		}
+	}
+
 	// Build response with what was updated
 	response := map[string]any{}
 	if acc.Desc != nil && acc.Desc.Public != nil {
@@ -522,6 +638,22 @@ func (h *Handlers) handleUpdateAccount(ctx context.Context, s SessionInterface,
 	if acc.Lang != nil {
 		response["lang"] = *acc.Lang
 	}
+	if acc.ReadReceipts != nil {
+		response["readReceipts"] = *acc.ReadReceipts
+	}
+	if acc.Notify != nil {
+		response["notify"] = *acc.Notify
+	}
+	if acc.QuietHours != nil {
+		if quiet != nil {
+			response["quietHours"] = quietHoursResponse(quiet)
+		} else {
+			response["quietHours"] = nil
+		}
+	}
+	if acc.PresencePrivacy != nil {
+		response["presencePrivacy"] = presencePrivacyResponse(privacy)
+	}
 	s.Send(CtrlSuccess(msg.ID, CodeOK, response))
 }
 
@@ -543,12 +675,29 @@ func (h *Handlers) handleSearch(s SessionInterface, msg *ClientMessage) {
 
 	ctx, cancel := handlerCtx()
 	defer cancel()
+
+	switch search.What {
+	case "", "users":
+	case "messages":
+		h.searchMessages(ctx, s, msg, search)
+		return
+	default:
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "unknown what"))
+		return
+	}
+
 	users, err := h.db.SearchUsers(ctx, search.Query, search.Limit)
 	if err != nil {
 		s.Send(CtrlError(msg.ID, CodeInternalError, "search failed"))
 		return
 	}
 
+	userIDs := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+	visible := h.presenceAudience(ctx, s.UserID(), userIDs)
+
 	// Convert to response format
 	results := make([]map[string]any, 0, len(users))
 	for _, user := range users {
@@ -556,16 +705,12 @@ func (h *Handlers) handleSearch(s SessionInterface, msg *ClientMessage) {
 		if user.ID == s.UserID() {
 			continue
 		}
-		online := false
-		if h.hub != nil {
-			online = h.hub.IsOnline(user.ID)
-		}
-		results = append(results, map[string]any{
-			"id":       user.ID.String(),
-			"public":   user.Public,
-			"online":   online,
-			"lastSeen": user.LastSeen,
-		})
+		item := map[string]any{
+			"id":     user.ID.String(),
+			"public": user.Public,
+		}
+		h.userPresence(ctx, item, &user, visible[user.ID])
+		results = append(results, item)
 	}
 
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
@@ -30,8 +30,8 @@ func (h *Handlers) handleContact(s SessionInterface, msg *ClientMessage) {
 		h.handleAddContact(ctx, s, msg, contact.Add)
 	case contact.Remove != "":
 		h.handleRemoveContact(ctx, s, msg, contact.Remove)
-	case contact.User != "" && contact.Nickname != nil:
-		h.handleUpdateContactNickname(ctx, s, msg, contact.User, contact.Nickname)
+	case contact.User != "" && (contact.Nickname != nil || contact.BypassQuiet != nil):
+		h.handleUpdateContact(ctx, s, msg, contact.User, contact.Nickname, contact.BypassQuiet)
 	default:
 		s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid contact request"))
 	}
@@ -67,6 +67,7 @@ func (h *Handlers) handleAddContact(ctx context.Context, s SessionInterface, msg
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to add contact"))
 		return
 	}
+	h.presenceChanged(s.UserID(), contactID)
 
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
 		"user":   contactID.String(),
@@ -86,23 +87,39 @@ func (h *Handlers) handleRemoveContact(ctx context.Context, s SessionInterface,
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to remove contact"))
 		return
 	}
+	h.presenceChanged(s.UserID(), contactID)
 
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
 		"user": contactID.String(),
 	}))
 }
 
-func (h *Handlers) handleUpdateContactNickname(ctx context.Context, s SessionInterface, msg *ClientMessage, userIDStr string, nickname *string) {
+func (h *Handlers) handleUpdateContact(ctx context.Context, s SessionInterface, msg *ClientMessage, userIDStr string, nickname *string, bypassQuiet *bool) {
 	contactID, err := uuid.Parse(userIDStr)
 	if err != nil {
 		s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid user id"))
 		return
 	}
 
-	err = h.db.UpdateContactNickname(ctx, s.UserID(), contactID, nickname)
-	if err != nil {
-		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update nickname"))
-		return
+	// Quiet hours bypass only applies to existing contacts
+	if bypassQuiet != nil {
+		updated, err := h.db.SetContactBypassQuiet(ctx, s.UserID(), contactID, *bypassQuiet)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update contact"))
+			return
+		}
+		if !updated {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "contact not found"))
+			return
+		}
+	}
+
+	if nickname != nil {
+		err = h.db.UpdateContactNickname(ctx, s.UserID(), contactID, nickname)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update nickname"))
+			return
+		}
 	}
 
 	response := map[string]any{
@@ -111,5 +128,8 @@ func (h *Handlers) handleUpdateContactNickname(ctx context.Context, s SessionInt
 	if nickname != nil {
 		response["nickname"] = *nickname
 	}
+	if bypassQuiet != nil {
+		response["bypassQuiet"] = *bypassQuiet
+	}
 	s.Send(CtrlSuccess(msg.ID, CodeOK, response))
 }
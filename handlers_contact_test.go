@@ -16,6 +16,7 @@ import (
 type testSession struct {
 	id       string
 	userID   uuid.UUID
+	deviceID string
 	messages []*ServerMessage
 	mu       sync.Mutex
 }
@@ -37,6 +38,8 @@ func (s *testSession) UserID() uuid.UUID { return s.userID }
 
 func (s *testSession) UserAgent() string { return "test-agent/1.0" }
 
+func (s *testSession) DeviceID() string { return s.deviceID }
+
 func (s *testSession) IsAuthenticated() bool { return s.userID != uuid.Nil }
 
 func (s *testSession) RequireAuth(msgID string) bool {
@@ -323,7 +326,7 @@ func TestHandleUpdateContactNickname_Success(t *testing.T) {
 		},
 	}
 
-	h.handleUpdateContactNickname(context.Background(), sess, msg, contactID.String(), &nickname)
+	h.handleUpdateContact(context.Background(), sess, msg, contactID.String(), &nickname, nil)
 
 	if !updateCalled {
 		t.Error("expected UpdateContactNickname to be called")
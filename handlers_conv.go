@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/irido"
 	"github.com/scalecode-solutions/mvchat2/store"
 )
 
@@ -72,20 +76,26 @@ func (h *Handlers) handleStartDM(ctx context.Context, s SessionInterface, msg *C
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to create dm"))
 		return
 	}
+	if created {
+		h.presenceJoined(conv.ID, s.UserID(), otherUserID)
+	}
 
 	code := CodeOK
 	if created {
 		code = CodeCreated
 	}
 
+	userItem := map[string]any{
+		"id":     otherUser.ID.String(),
+		"public": otherUser.Public,
+	}
+	visible := h.presenceAudience(ctx, s.UserID(), []uuid.UUID{otherUser.ID})
+	h.userPresence(ctx, userItem, otherUser, visible[otherUser.ID])
+
 	s.Send(CtrlSuccess(msg.ID, code, map[string]any{
 		"conv":    conv.ID.String(),
 		"created": created,
-		"user": map[string]any{
-			"id":     otherUser.ID.String(),
-			"public": otherUser.Public,
-			"online": h.isOnline(otherUser.ID),
-		},
+		"user":    userItem,
 	}))
 }
 
@@ -138,13 +148,15 @@ func (h *Handlers) handleManageDM(ctx context.Context, s SessionInterface, msg *
 	// Build settings update
 	settings := store.MemberSettings{
 		Favorite: dm.Favorite,
-		Muted:    dm.Muted,
 		Blocked:  dm.Blocked,
 		Private:  dm.Private,
 	}
+	if !notifySettings(s, msg.ID, &settings, dm.Muted, dm.MutedUntil, dm.Notify) {
+		return
+	}
 
 	// Check if any updates provided
-	if settings.Favorite == nil && settings.Muted == nil && settings.Blocked == nil && settings.Private == nil {
+	if settings.Favorite == nil && settings.Muted == nil && settings.Notify == nil && settings.Blocked == nil && settings.Private == nil {
 		s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
 			"conv": convID.String(),
 		}))
@@ -156,6 +168,13 @@ func (h *Handlers) handleManageDM(ctx context.Context, s SessionInterface, msg *
 		return
 	}
 
+	// Blocking stops presence flowing through the DM
+	if settings.Blocked != nil {
+		if other, _ := h.db.GetDMOtherUser(ctx, convID, s.UserID()); other != nil {
+			h.presenceChanged(s.UserID(), other.ID)
+		}
+	}
+
 	// Return the updated settings
 	response := map[string]any{
 		"conv": convID.String(),
@@ -163,9 +182,7 @@ func (h *Handlers) handleManageDM(ctx context.Context, s SessionInterface, msg *
 	if settings.Favorite != nil {
 		response["favorite"] = *settings.Favorite
 	}
-	if settings.Muted != nil {
-		response["muted"] = *settings.Muted
-	}
+	notifySettingsResponse(response, settings)
 	if settings.Blocked != nil {
 		response["blocked"] = *settings.Blocked
 	}
@@ -205,6 +222,8 @@ func (h *Handlers) handleRoom(s SessionInterface, msg *ClientMessage) {
 		h.handleKickFromRoom(ctx, s, msg, room)
 	case "update":
 		h.handleUpdateRoom(ctx, s, msg, room)
+	case "settings":
+		h.handleRoomSettings(ctx, s, msg, room)
 	default:
 		s.Send(CtrlError(msg.ID, CodeBadRequest, "unknown room action"))
 	}
@@ -221,6 +240,7 @@ func (h *Handlers) handleCreateRoom(ctx context.Context, s SessionInterface, msg
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to create room"))
 		return
 	}
+	h.presenceJoined(conv.ID, s.UserID())
 
 	s.Send(CtrlSuccess(msg.ID, CodeCreated, map[string]any{
 		"conv":   conv.ID.String(),
@@ -265,11 +285,21 @@ func (h *Handlers) handleInviteToRoom(ctx context.Context, s SessionInterface, m
 		return
 	}
 
-	// Add member
-	if err := h.db.AddRoomMember(ctx, convID, targetUserID, "member"); err != nil {
+	// Add member (member limit is enforced by the store)
+	if err := h.db.AddRoomMember(ctx, convID, targetUserID, "member", h.maxRoomMembers()); err != nil {
+		if errors.Is(err, store.ErrRoomFull) {
+			params := map[string]any{"conv": convID.String()}
+			if conv, _ := h.db.GetConversationByID(ctx, convID); conv != nil {
+				params["memberCount"] = conv.MemberCount
+				params["maxMembers"] = h.effectiveMaxMembers(conv)
+			}
+			s.Send(CtrlErrorWithParams(msg.ID, CodeConflict, "room is full", params))
+			return
+		}
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to add member"))
 		return
 	}
+	h.presenceJoined(convID, targetUserID)
 
 	now := time.Now().UTC()
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
@@ -315,6 +345,7 @@ func (h *Handlers) handleLeaveRoom(ctx context.Context, s SessionInterface, msg
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to leave room"))
 		return
 	}
+	h.presenceLeft(convID, s.UserID())
 
 	now := time.Now().UTC()
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
@@ -382,6 +413,7 @@ func (h *Handlers) handleKickFromRoom(ctx context.Context, s SessionInterface, m
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to kick member"))
 		return
 	}
+	h.presenceLeft(convID, targetUserID)
 
 	now := time.Now().UTC()
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
@@ -480,6 +512,67 @@ func (h *Handlers) handleUpdateRoom(ctx context.Context, s SessionInterface, msg
 		return
 	}
 
+	// Handle member limit update
+	if room.MaxMembers != nil {
+		maxMembers := *room.MaxMembers
+		global := h.maxRoomMembers()
+		if maxMembers < 0 || maxMembers == 1 || (global > 0 && maxMembers > global) {
+			s.Send(CtrlErrorWithParams(msg.ID, CodeBadRequest, "invalid member limit", map[string]any{
+				"maxAllowed": global,
+			}))
+			return
+		}
+
+		if err := h.db.UpdateConversationMaxMembers(ctx, convID, maxMembers); err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update member limit"))
+			return
+		}
+
+		now := time.Now().UTC()
+		s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+			"conv":       convID.String(),
+			"maxMembers": maxMembers,
+		}))
+
+		// Broadcast to members
+		h.broadcastToConv(ctx, convID, &MsgServerInfo{
+			ConversationID: convID.String(),
+			From:           s.UserID().String(),
+			What:           "room_updated",
+			Ts:             now,
+		}, "")
+		return
+	}
+
+	// Handle slow mode update
+	if room.SlowMode != nil {
+		if !validSlowModeIntervals[*room.SlowMode] {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid slow mode value"))
+			return
+		}
+
+		if err := h.db.UpdateConversationSlowMode(ctx, convID, *room.SlowMode); err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update slow mode"))
+			return
+		}
+
+		now := time.Now().UTC()
+		s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+			"conv":     convID.String(),
+			"slowMode": *room.SlowMode,
+		}))
+
+		// Broadcast to members
+		h.broadcastToConv(ctx, convID, &MsgServerInfo{
+			ConversationID: convID.String(),
+			From:           s.UserID().String(),
+			What:           "slowmode_updated",
+			SlowMode:       room.SlowMode,
+			Ts:             now,
+		}, "")
+		return
+	}
+
 	// Get new public data
 	var public json.RawMessage
 	if room.Desc != nil {
@@ -507,6 +600,51 @@ func (h *Handlers) handleUpdateRoom(ctx context.Context, s SessionInterface, msg
 	}, s.ID())
 }
 
+// handleRoomSettings updates the requester's own notification settings for
+// a room. Any member may change them.
+func (h *Handlers) handleRoomSettings(ctx context.Context, s SessionInterface, msg *ClientMessage, room *MsgClientRoom) {
+	convID, ok := parseUUID(s, msg.ID, room.ID, "room id")
+	if !ok {
+		return
+	}
+
+	if !h.requireMember(ctx, s, msg.ID, convID) {
+		return
+	}
+
+	var settings store.MemberSettings
+	if !notifySettings(s, msg.ID, &settings, room.Muted, room.MutedUntil, room.Notify) {
+		return
+	}
+
+	response := map[string]any{
+		"conv": convID.String(),
+	}
+	if settings.Muted == nil && settings.Notify == nil {
+		s.Send(CtrlSuccess(msg.ID, CodeOK, response))
+		return
+	}
+
+	if err := h.db.UpdateMemberSettings(ctx, convID, s.UserID(), settings); err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update"))
+		return
+	}
+
+	notifySettingsResponse(response, settings)
+	s.Send(CtrlSuccess(msg.ID, CodeOK, response))
+}
+
+// effectiveMaxMembers returns the member limit that applies to a room:
+// the room's own cap when set and lower than the server-wide limit.
+// Returns 0 when no limit applies.
+func (h *Handlers) effectiveMaxMembers(conv *store.Conversation) int {
+	limit := h.maxRoomMembers()
+	if conv.MaxMembers > 0 && (limit <= 0 || conv.MaxMembers < limit) {
+		limit = conv.MaxMembers
+	}
+	return limit
+}
+
 // HandleGet processes get requests (conversations, messages, members).
 func (h *Handlers) HandleGet(s *Session, msg *ClientMessage) {
 	h.handleGet(s, msg)
@@ -528,7 +666,7 @@ func (h *Handlers) handleGet(s SessionInterface, msg *ClientMessage) {
 
 	switch get.What {
 	case "conversations":
-		h.handleGetConversations(ctx, s, msg)
+		h.handleGetConversations(ctx, s, msg, get)
 	case "conversation":
 		h.handleGetConversation(ctx, s, msg, get)
 	case "messages":
@@ -543,6 +681,20 @@ func (h *Handlers) handleGet(s SessionInterface, msg *ClientMessage) {
 		h.handleGetUser(ctx, s, msg, get)
 	case "mentions":
 		h.handleGetMentions(ctx, s, msg, get)
+	case "thread":
+		h.handleGetThread(ctx, s, msg, get)
+	case "pins":
+		h.handleGetPins(ctx, s, msg, get)
+	case "poll":
+		h.handleGetPoll(ctx, s, msg, get)
+	case "scheduled":
+		h.handleGetScheduled(ctx, s, msg, get)
+	case "saved":
+		h.handleGetSaved(ctx, s, msg, get)
+	case "reactions":
+		h.handleGetReactions(ctx, s, msg, get)
+	case "status":
+		h.handleGetStatus(ctx, s, msg, get)
 	default:
 		s.Send(CtrlError(msg.ID, CodeBadRequest, "unknown what"))
 	}
@@ -555,6 +707,12 @@ func (h *Handlers) handleGetContacts(ctx context.Context, s SessionInterface, ms
 		return
 	}
 
+	contactIDs := make([]uuid.UUID, len(contacts))
+	for i, c := range contacts {
+		contactIDs[i] = c.ContactID
+	}
+	visible := h.presenceAudience(ctx, s.UserID(), contactIDs)
+
 	results := make([]map[string]any, 0, len(contacts))
 	for _, c := range contacts {
 		// Get contact's user info
@@ -568,12 +726,12 @@ func (h *Handlers) handleGetContacts(ctx context.Context, s SessionInterface, ms
 		if c.Nickname != nil {
 			item["nickname"] = *c.Nickname
 		}
+		if c.BypassQuiet {
+			item["bypassQuiet"] = true
+		}
 		if user != nil {
 			item["public"] = user.Public
-			item["online"] = h.isOnline(c.ContactID)
-			if user.LastSeen != nil {
-				item["lastSeen"] = user.LastSeen
-			}
+			h.userPresence(ctx, item, user, visible[c.ContactID])
 		}
 		results = append(results, item)
 	}
@@ -600,13 +758,15 @@ func (h *Handlers) handleGetUser(ctx context.Context, s SessionInterface, msg *C
 		return
 	}
 
+	item := map[string]any{
+		"id":     user.ID.String(),
+		"public": user.Public,
+	}
+	visible := h.presenceAudience(ctx, s.UserID(), []uuid.UUID{user.ID})
+	h.userPresence(ctx, item, user, visible[user.ID])
+
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
-		"user": map[string]any{
-			"id":       user.ID.String(),
-			"public":   user.Public,
-			"online":   h.isOnline(user.ID),
-			"lastSeen": user.LastSeen,
-		},
+		"user": item,
 	}))
 }
 
@@ -641,8 +801,8 @@ func (h *Handlers) handleGetMentions(ctx context.Context, s SessionInterface, ms
 				item["content"] = m.Content
 			}
 		}
-		if m.Head != nil {
-			item["head"] = m.Head
+		if head := clientHead(m.Head); head != nil {
+			item["head"] = head
 		}
 		results = append(results, item)
 	}
@@ -690,9 +850,9 @@ func (h *Handlers) handleGetConversation(ctx context.Context, s SessionInterface
 
 	if member != nil {
 		item["readSeq"] = member.ReadSeq
-		item["unread"] = conv.LastSeq - member.ReadSeq
+		item["unread"] = h.unreadCount(ctx, convID, conv.LastSeq, member.ReadSeq, get.Threads)
 		item["favorite"] = member.Favorite
-		item["muted"] = member.Muted
+		notifySettingsItem(item, member.Muted, member.MutedUntil, member.Notify)
 		if member.Private != nil {
 			item["private"] = member.Private
 		}
@@ -706,26 +866,28 @@ func (h *Handlers) handleGetConversation(ctx context.Context, s SessionInterface
 		item["disappearingTTL"] = *conv.DisappearingTTL
 	}
 
-	if conv.PinnedMessageID != nil {
-		seq, _ := h.db.GetPinnedMessageSeq(ctx, convID)
-		if seq != nil {
-			item["pinnedSeq"] = *seq
-			item["pinnedAt"] = conv.PinnedAt
-			if conv.PinnedBy != nil {
-				item["pinnedBy"] = conv.PinnedBy.String()
-			}
+	// Top pinned message info
+	if conv.PinnedSeq != nil {
+		item["pinnedSeq"] = *conv.PinnedSeq
+		item["pinnedAt"] = conv.PinnedAt
+		if conv.PinnedBy != nil {
+			item["pinnedBy"] = conv.PinnedBy.String()
 		}
 	}
+	if conv.PinCount > 0 {
+		item["pinCount"] = conv.PinCount
+	}
 
 	if conv.Type == "dm" {
 		otherUser, _ := h.db.GetDMOtherUser(ctx, convID, s.UserID())
 		if otherUser != nil {
-			item["user"] = map[string]any{
-				"id":       otherUser.ID.String(),
-				"public":   otherUser.Public,
-				"online":   h.isOnline(otherUser.ID),
-				"lastSeen": otherUser.LastSeen,
+			userItem := map[string]any{
+				"id":     otherUser.ID.String(),
+				"public": otherUser.Public,
 			}
+			visible := h.presenceAudience(ctx, s.UserID(), []uuid.UUID{otherUser.ID})
+			h.userPresence(ctx, userItem, otherUser, visible[otherUser.ID])
+			item["user"] = userItem
 		}
 	} else if conv.Type == "room" {
 		item["public"] = conv.Public
@@ -736,39 +898,64 @@ func (h *Handlers) handleGetConversation(ctx context.Context, s SessionInterface
 		item["noScreenshots"] = true
 	}
 
+	// Slow mode interval
+	if conv.SlowMode > 0 {
+		item["slowMode"] = conv.SlowMode
+	}
+
+	// Member count and limit
+	item["memberCount"] = conv.MemberCount
+	if conv.Type == "room" {
+		if limit := h.effectiveMaxMembers(conv); limit > 0 {
+			item["maxMembers"] = limit
+		}
+	}
+
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
 		"conversation": item,
 	}))
 }
 
-func (h *Handlers) handleGetConversations(ctx context.Context, s SessionInterface, msg *ClientMessage) {
+func (h *Handlers) handleGetConversations(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
 	convs, err := h.db.GetUserConversations(ctx, s.UserID())
 	if err != nil {
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get conversations"))
 		return
 	}
 
+	var dmUsers []uuid.UUID
+	for _, c := range convs {
+		if c.Type == "dm" && c.OtherUser != nil {
+			dmUsers = append(dmUsers, c.OtherUser.ID)
+		}
+	}
+	visible := h.presenceAudience(ctx, s.UserID(), dmUsers)
+
 	results := make([]map[string]any, 0, len(convs))
 	for _, c := range convs {
+		unread := c.LastSeq - c.ReadSeq
+		if get.Threads && unread > 0 {
+			unread = withoutReplies(unread, c.UnreadReplies)
+		}
 		item := map[string]any{
 			"id":       c.Conversation.ID.String(),
 			"type":     c.Type,
 			"lastSeq":  c.LastSeq,
 			"readSeq":  c.ReadSeq,
-			"unread":   c.LastSeq - c.ReadSeq,
+			"unread":   unread,
 			"favorite": c.Favorite,
-			"muted":    c.Muted,
 		}
+		notifySettingsItem(item, c.Muted, c.MutedUntil, c.Notify)
 		if c.LastMsgAt != nil {
 			item["lastMsgAt"] = c.LastMsgAt
 		}
 		if c.Type == "dm" && c.OtherUser != nil {
-			item["user"] = map[string]any{
-				"id":       c.OtherUser.ID.String(),
-				"public":   c.OtherUser.Public,
-				"online":   h.isOnline(c.OtherUser.ID),
-				"lastSeen": c.OtherUser.LastSeen,
+			userItem := map[string]any{
+				"id":     c.OtherUser.ID.String(),
+				"public": c.OtherUser.Public,
 			}
+			h.userPresence(ctx, userItem, c.OtherUser, visible[c.OtherUser.ID])
+			item["user"] = userItem
 		} else if c.Type == "room" {
 			item["public"] = c.Public
 		}
@@ -776,7 +963,7 @@ func (h *Handlers) handleGetConversations(ctx context.Context, s SessionInterfac
 		if c.DisappearingTTL != nil {
 			item["disappearingTTL"] = *c.DisappearingTTL
 		}
-		// Pinned message info
+		// Top pinned message info
 		if c.PinnedSeq != nil {
 			item["pinnedSeq"] = *c.PinnedSeq
 			if c.PinnedAt != nil {
@@ -786,10 +973,24 @@ func (h *Handlers) handleGetConversations(ctx context.Context, s SessionInterfac
 				item["pinnedBy"] = c.PinnedBy.String()
 			}
 		}
+		if c.PinCount > 0 {
+			item["pinCount"] = c.PinCount
+		}
 		// No-screenshots flag
 		if c.NoScreenshots {
 			item["noScreenshots"] = true
 		}
+		// Slow mode interval
+		if c.SlowMode > 0 {
+			item["slowMode"] = c.SlowMode
+		}
+		// Member count and limit
+		item["memberCount"] = c.MemberCount
+		if c.Type == "room" {
+			if limit := h.effectiveMaxMembers(&c.Conversation); limit > 0 {
+				item["maxMembers"] = limit
+			}
+		}
 		results = append(results, item)
 	}
 
@@ -827,37 +1028,60 @@ func (h *Handlers) handleGetMessages(ctx context.Context, s SessionInterface, ms
 		return
 	}
 
-	results := make([]map[string]any, 0, len(messages))
-	for _, m := range messages {
-		item := map[string]any{
-			"seq":  m.Seq,
-			"from": m.FromUserID.String(),
-			"ts":   m.CreatedAt,
-		}
-		if m.DeletedAt != nil {
-			item["deleted"] = true
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"messages": h.messageItems(ctx, s.UserID(), messages),
+	}))
+}
+
+// clientHead returns a stored message head without the fields only the
+// server uses, or nil if nothing is left.
+func clientHead(head json.RawMessage) json.RawMessage {
+	if !bytes.Contains(head, []byte(`"scheduled"`)) {
+		return head
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(head, &fields); err != nil {
+		return head
+	}
+	delete(fields, "scheduled")
+	if len(fields) == 0 {
+		return nil
+	}
+	head, _ = json.Marshal(fields)
+	return head
+}
+
+// messageItem builds the response representation of a stored message,
+// decrypting its content unless it was deleted.
+func (h *Handlers) messageItem(m *store.Message) map[string]any {
+	item := map[string]any{
+		"seq":  m.Seq,
+		"from": m.FromUserID.String(),
+		"ts":   m.CreatedAt,
+	}
+	if m.DeletedAt != nil {
+		item["deleted"] = true
+	} else {
+		// Decrypt content
+		plaintext, err := h.encryptor.Decrypt(m.Content)
+		if err == nil {
+			item["content"] = plaintext
 		} else {
-			// Decrypt content
-			plaintext, err := h.encryptor.Decrypt(m.Content)
-			if err == nil {
-				item["content"] = plaintext
-			} else {
-				item["content"] = m.Content // Fallback for unencrypted messages
-			}
-		}
-		if m.Head != nil {
-			item["head"] = m.Head
+			item["content"] = m.Content // Fallback for unencrypted messages
 		}
-		// View-once indicator
-		if m.ViewOnce {
-			item["viewOnce"] = true
-		}
-		results = append(results, item)
 	}
-
-	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
-		"messages": results,
-	}))
+	if head := clientHead(m.Head); head != nil {
+		item["head"] = head
+	}
+	// View-once indicator
+	if m.ViewOnce {
+		item["viewOnce"] = true
+	}
+	// Thread reply indicator
+	if m.ThreadSeq != nil {
+		item["thread"] = *m.ThreadSeq
+	}
+	return item
 }
 
 func (h *Handlers) handleGetMembers(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
@@ -881,16 +1105,18 @@ func (h *Handlers) handleGetMembers(ctx context.Context, s SessionInterface, msg
 		return
 	}
 
+	visible := h.presenceAudience(ctx, s.UserID(), memberIDs)
+
 	results := make([]map[string]any, 0, len(memberIDs))
 	for _, uid := range memberIDs {
 		user, _ := h.db.GetUserByID(ctx, uid)
 		if user != nil {
-			results = append(results, map[string]any{
-				"id":       user.ID.String(),
-				"public":   user.Public,
-				"online":   h.isOnline(user.ID),
-				"lastSeen": user.LastSeen,
-			})
+			item := map[string]any{
+				"id":     user.ID.String(),
+				"public": user.Public,
+			}
+			h.userPresence(ctx, item, user, visible[uid])
+			results = append(results, item)
 		}
 	}
 
@@ -922,11 +1148,15 @@ func (h *Handlers) handleGetReceipts(ctx context.Context, s SessionInterface, ms
 
 	results := make([]map[string]any, 0, len(receipts))
 	for _, r := range receipts {
-		results = append(results, map[string]any{
+		item := map[string]any{
 			"user":    r.UserID.String(),
-			"readSeq": r.ReadSeq,
 			"recvSeq": r.RecvSeq,
-		})
+		}
+		// Users who turned off read receipts only report delivery
+		if !r.HideReadReceipts || r.UserID == s.UserID() {
+			item["readSeq"] = r.ReadSeq
+		}
+		results = append(results, item)
 	}
 
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
@@ -953,6 +1183,11 @@ func (h *Handlers) handleSend(s SessionInterface, msg *ClientMessage) {
 	ctx, cancel := handlerCtx()
 	defer cancel()
 
+	if send.SendAt != nil {
+		h.scheduleSend(ctx, s, msg, send)
+		return
+	}
+
 	convID, ok := parseUUID(s, msg.ID, send.ConversationID, "conv id")
 	if !ok {
 		return
@@ -988,11 +1223,111 @@ func (h *Handlers) handleSend(s SessionInterface, msg *ClientMessage) {
 		}
 	}
 
+	if send.Urgent && send.Silent {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "message cannot be both urgent and silent"))
+		return
+	}
+
+	// Urgent messages get through recipients' quiet hours
+	if send.Urgent {
+		allowed, err := h.canSendUrgent(ctx, conv, member, s.UserID())
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+		if !allowed {
+			s.Send(CtrlError(msg.ID, CodeForbidden, "urgent not allowed"))
+			return
+		}
+	}
+
+	// Resolve thread root (replies to a thread reply go to the same thread)
+	threadRoot := 0
+	if send.Thread > 0 {
+		if send.ViewOnce {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "view-once messages cannot be thread replies"))
+			return
+		}
+		root, err := h.db.GetMessageBySeq(ctx, convID, send.Thread)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+		if root != nil && root.ThreadSeq != nil {
+			root, err = h.db.GetMessageBySeq(ctx, convID, *root.ThreadSeq)
+			if err != nil {
+				s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+				return
+			}
+		}
+		if root == nil || root.DeletedAt != nil || root.Seq <= member.ClearSeq {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "thread root not found"))
+			return
+		}
+		threadRoot = root.Seq
+	}
+
+	// Validate and normalize content
+	doc := h.normalizeContent(ctx, s, msg, convID, send.Content)
+	if doc == nil {
+		return
+	}
+
+	// Polls live in the main timeline and need a future deadline if any
+	var poll *store.Poll
+	if doc.Poll != nil {
+		if threadRoot > 0 || send.ViewOnce {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "polls cannot be thread replies or view-once"))
+			return
+		}
+		if doc.Poll.ClosesAt != nil && !doc.Poll.ClosesAt.After(time.Now()) {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "poll close time must be in the future"))
+			return
+		}
+		poll = &store.Poll{
+			Options:   len(doc.Poll.Options),
+			Multi:     doc.Poll.Multi,
+			Anonymous: doc.Poll.Anonymous,
+			ClosesAt:  doc.Poll.ClosesAt,
+		}
+	}
+
+	// Validate the reply target and fill the quoted preview server-side
+	replyTo := send.ReplyTo
+	contentReply := 0
+	if doc.Reply != nil {
+		contentReply = doc.Reply.Seq
+	}
+	if contentReply > 0 {
+		if replyTo > 0 && replyTo != contentReply {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "reply seq mismatch"))
+			return
+		}
+		replyTo = contentReply
+	}
+	if replyTo > 0 {
+		original, err := h.db.GetVisibleMessageBySeq(ctx, convID, s.UserID(), replyTo, member.ClearSeq)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+		if original == nil {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "reply target not found"))
+			return
+		}
+		if contentReply > 0 {
+			h.hydrateReply(doc, original)
+		}
+	}
+
 	// Build head
 	var head json.RawMessage
 	headMap := make(map[string]any)
-	if send.ReplyTo > 0 {
-		headMap["reply_to"] = send.ReplyTo
+	if replyTo > 0 {
+		headMap["reply_to"] = replyTo
+	}
+	if threadRoot > 0 {
+		headMap["thread_root"] = threadRoot
 	}
 	if send.ViewOnce {
 		headMap["view_once"] = true
@@ -1001,22 +1336,34 @@ func (h *Handlers) handleSend(s SessionInterface, msg *ClientMessage) {
 		}
 	}
 
-	// Extract mentions from content and store in head for queryability
-	var contentData struct {
-		Mentions []struct {
-			UserID   string `json:"userId"`
-			Username string `json:"username,omitempty"`
-			Offset   int    `json:"offset,omitempty"`
-			Length   int    `json:"length,omitempty"`
-		} `json:"mentions,omitempty"`
+	// Store mentions in head for queryability
+	if len(doc.Mentions) > 0 {
+		headMap["mentions"] = doc.Mentions
 	}
-	if err := json.Unmarshal(send.Content, &contentData); err == nil && len(contentData.Mentions) > 0 {
-		headMap["mentions"] = contentData.Mentions
+
+	// Content is encrypted, so file refs go in head for CanAccessFile
+	if refs := mediaRefs(doc); len(refs) > 0 {
+		headMap["files"] = refs
+	}
+	if send.NoForward {
+		headMap["no_forward"] = true
+	}
+	if send.Urgent {
+		headMap["urgent"] = true
+	}
+	if send.Silent {
+		headMap["silent"] = true
+	}
+	// Scheduled sends store their id, so a replay after a crash is caught.
+	// Members aren't told it.
+	if sched, ok := s.(*scheduledSession); ok {
+		headMap["scheduled"] = sched.scheduledID.String()
 	}
 
 	if len(headMap) > 0 {
 		head, _ = json.Marshal(headMap)
 	}
+	delete(headMap, "scheduled")
 
 	// Validate view-once TTL
 	var viewOnceTTL *int
@@ -1033,25 +1380,67 @@ func (h *Handlers) handleSend(s SessionInterface, msg *ClientMessage) {
 		viewOnceTTL = &ttl
 	}
 
-	// Encrypt content
+	// Enforce slow mode in rooms (owners and admins are exempt)
+	slowModeApplies := conv.Type == "room" && conv.SlowMode > 0 &&
+		member.Role != "owner" && member.Role != "admin" && h.slowMode != nil
+	if slowModeApplies {
+		wait := h.slowMode.Acquire(ctx, convID, s.UserID(), time.Duration(conv.SlowMode)*time.Second)
+		if wait > 0 {
+			s.Send(CtrlErrorWithParams(msg.ID, CodeTooManyRequests, "slow mode", map[string]any{
+				"conv":     convID.String(),
+				"slowMode": conv.SlowMode,
+				"wait":     int(math.Ceil(wait.Seconds())),
+			}))
+			return
+		}
+	}
+
+	// Encrypt the canonical form
+	send.Content, err = doc.ToJSON()
+	if err != nil {
+		if slowModeApplies {
+			h.slowMode.Release(ctx, convID, s.UserID())
+		}
+		s.Send(CtrlError(msg.ID, CodeInternalError, "encoding failed"))
+		return
+	}
 	content, err := h.encryptor.Encrypt(send.Content)
 	if err != nil {
+		if slowModeApplies {
+			h.slowMode.Release(ctx, convID, s.UserID())
+		}
 		s.Send(CtrlError(msg.ID, CodeInternalError, "encryption failed"))
 		return
 	}
 
-	// Create message with view-once support
+	// Create message with view-once, thread and poll support
 	var message *store.Message
-	if send.ViewOnce {
+	switch {
+	case threadRoot > 0:
+		message, err = h.db.CreateThreadReply(ctx, convID, s.UserID(), threadRoot, content, head)
+	case poll != nil:
+		message, err = h.db.CreatePollMessage(ctx, convID, s.UserID(), content, head, poll)
+	case send.ViewOnce:
 		message, err = h.db.CreateMessageWithViewOnce(ctx, convID, s.UserID(), content, head, true, viewOnceTTL)
-	} else {
+	default:
 		message, err = h.db.CreateMessage(ctx, convID, s.UserID(), content, head)
 	}
 	if err != nil {
+		if slowModeApplies {
+			h.slowMode.Release(ctx, convID, s.UserID())
+		}
+		if errors.Is(err, store.ErrThreadRootNotFound) {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "thread root not found"))
+			return
+		}
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to send"))
 		return
 	}
 
+	if !send.ViewOnce {
+		h.indexMessage(ctx, message, doc)
+	}
+
 	// Send confirmation to sender
 	response := map[string]any{
 		"conv": convID.String(),
@@ -1061,6 +1450,9 @@ func (h *Handlers) handleSend(s SessionInterface, msg *ClientMessage) {
 	if send.ViewOnce {
 		response["viewOnce"] = true
 	}
+	if threadRoot > 0 {
+		response["thread"] = threadRoot
+	}
 	s.Send(CtrlSuccess(msg.ID, CodeAccepted, response))
 
 	// Broadcast to other members
@@ -1078,6 +1470,119 @@ func (h *Handlers) handleSend(s SessionInterface, msg *ClientMessage) {
 	if h.hub != nil {
 		h.hub.SendToUsers(memberIDs, dataMsg, s.ID())
 	}
+	if h.typing != nil {
+		h.typing.MessageSent(convID, s.UserID())
+	}
+
+	// Notify members who aren't connected
+	h.pushMessage(ctx, convID, s.UserID(), message.Seq, doc, headMap)
+}
+
+// canSendUrgent reports whether a member may send urgent messages: room
+// owners and admins, and in a DM a user the other member has as a contact.
+func (h *Handlers) canSendUrgent(ctx context.Context, conv *store.Conversation, member *store.Member, senderID uuid.UUID) (bool, error) {
+	if conv.Type == "room" {
+		return member.Role == "owner" || member.Role == "admin", nil
+	}
+	other, err := h.db.GetDMOtherUser(ctx, conv.ID, senderID)
+	if err != nil || other == nil {
+		return false, err
+	}
+	return h.db.IsContact(ctx, other.ID, senderID)
+}
+
+// replyPreviewLength is the max length (in graphemes) of a hydrated reply preview.
+const replyPreviewLength = 50
+
+// hydrateReply replaces the client-supplied reply block with one built from
+// the original message. Unsent, deleted and view-once originals get no
+// preview so their content is never quoted.
+func (h *Handlers) hydrateReply(doc *irido.Irido, original *store.Message) {
+	reply := &irido.Reply{
+		Seq:  original.Seq,
+		From: original.FromUserID.String(),
+	}
+	if original.DeletedAt == nil && !original.ViewOnce {
+		plaintext, err := h.encryptor.Decrypt(original.Content)
+		if err != nil {
+			plaintext = original.Content // Fallback for unencrypted messages
+		}
+		if preview, err := irido.Preview(plaintext, replyPreviewLength); err == nil {
+			reply.Preview = preview
+		}
+	}
+	doc.Reply = reply
+}
+
+// normalizeContent validates message content and returns its canonical form.
+// Mentioned users must be conversation members and media refs must be files
+// uploaded by the sender. On failure it sends an error response and returns nil.
+func (h *Handlers) normalizeContent(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, raw json.RawMessage) *irido.Irido {
+	doc, err := irido.Normalize(raw, irido.NormalizeOptions{})
+	if err != nil {
+		s.Send(CtrlErrorWithParams(msg.ID, CodeBadRequest, "invalid content", map[string]any{
+			"reason": err.Error(),
+		}))
+		return nil
+	}
+
+	if len(doc.Mentions) > 0 {
+		memberIDs, err := h.db.GetConversationMembers(ctx, convID)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return nil
+		}
+		members := make(map[uuid.UUID]bool, len(memberIDs))
+		for _, id := range memberIDs {
+			members[id] = true
+		}
+		for _, m := range doc.Mentions {
+			userID, err := uuid.Parse(m.UserID)
+			if err != nil || !members[userID] {
+				s.Send(CtrlErrorWithParams(msg.ID, CodeBadRequest, "mentioned user is not a member", map[string]any{
+					"user": m.UserID,
+				}))
+				return nil
+			}
+		}
+	}
+
+	for _, m := range doc.Media {
+		if m.Ref == "" {
+			continue
+		}
+		fileID, err := uuid.Parse(m.Ref)
+		if err != nil {
+			s.Send(CtrlErrorWithParams(msg.ID, CodeBadRequest, "invalid file reference", map[string]any{
+				"ref": m.Ref,
+			}))
+			return nil
+		}
+		file, err := h.db.GetFileByID(ctx, fileID)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return nil
+		}
+		if file == nil || file.UploaderID != s.UserID() || file.DeletedAt != nil {
+			s.Send(CtrlErrorWithParams(msg.ID, CodeBadRequest, "invalid file reference", map[string]any{
+				"ref": m.Ref,
+			}))
+			return nil
+		}
+	}
+
+	return doc
+}
+
+// mediaRefs returns the file refs of a message's attachments.
+func mediaRefs(doc *irido.Irido) []string {
+	var refs []string
+	for _, m := range doc.Media {
+		if m.Ref != "" {
+			refs = append(refs, m.Ref)
+		}
+	}
+	return refs
 }
 
 // HandleEdit processes edit message requests.
@@ -1134,18 +1639,69 @@ func (h *Handlers) handleEdit(s SessionInterface, msg *ClientMessage) {
 		return
 	}
 
-	// Encrypt content
+	// Votes refer to option indexes, so polls can't change after sending
+	poll, err := h.db.GetPoll(ctx, convID, edit.Seq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if poll != nil {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "polls cannot be edited"))
+		return
+	}
+
+	// Validate and normalize content
+	doc := h.normalizeContent(ctx, s, msg, convID, edit.Content)
+	if doc == nil {
+		return
+	}
+	if doc.Poll != nil {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "polls cannot be edited"))
+		return
+	}
+
+	// Re-hydrate any reply block so edits can't fabricate a quote either
+	if doc.Reply != nil {
+		member, err := h.db.GetMember(ctx, convID, s.UserID())
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+		if member == nil {
+			s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+			return
+		}
+		original, err := h.db.GetVisibleMessageBySeq(ctx, convID, s.UserID(), doc.Reply.Seq, member.ClearSeq)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+		if original == nil {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "reply target not found"))
+			return
+		}
+		h.hydrateReply(doc, original)
+	}
+
+	// Encrypt the canonical form
+	edit.Content, err = doc.ToJSON()
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "encoding failed"))
+		return
+	}
 	content, err := h.encryptor.Encrypt(edit.Content)
 	if err != nil {
 		s.Send(CtrlError(msg.ID, CodeInternalError, "encryption failed"))
 		return
 	}
 
-	if err := h.db.EditMessage(ctx, convID, edit.Seq, content); err != nil {
+	// Attachments may have changed; head.files grants access to them
+	if err := h.db.EditMessage(ctx, convID, edit.Seq, content, mediaRefs(doc)); err != nil {
 		slog.Error("edit message failed", "conv", convID, "seq", edit.Seq, "error", err)
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to edit"))
 		return
 	}
+	h.indexMessage(ctx, origMsg, doc)
 
 	now := time.Now().UTC()
 	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
@@ -1334,11 +1890,24 @@ func (h *Handlers) handleReact(s SessionInterface, msg *ClientMessage) {
 		return
 	}
 
-	if !h.requireMember(ctx, s, msg.ID, convID) {
+	if len(react.Emoji) > maxEmojiLength {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid emoji"))
+		return
+	}
+
+	message := h.memberMessage(ctx, s, msg, convID, react.Seq)
+	if message == nil {
 		return
 	}
 
-	if err := h.db.AddReaction(ctx, convID, react.Seq, s.UserID(), react.Emoji); err != nil {
+	added, count, err := h.db.ToggleReaction(ctx, message.ID, s.UserID(), react.Emoji, h.maxReactionEmojis())
+	if err != nil {
+		if errors.Is(err, store.ErrReactionLimitReached) {
+			s.Send(CtrlErrorWithParams(msg.ID, CodeForbidden, "reaction limit reached", map[string]any{
+				"max": h.maxReactionEmojis(),
+			}))
+			return
+		}
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to react"))
 		return
 	}
@@ -1348,6 +1917,8 @@ func (h *Handlers) handleReact(s SessionInterface, msg *ClientMessage) {
 		"conv":  convID.String(),
 		"seq":   react.Seq,
 		"emoji": react.Emoji,
+		"added": added,
+		"count": count,
 		"ts":    now,
 	}))
 
@@ -1358,6 +1929,8 @@ func (h *Handlers) handleReact(s SessionInterface, msg *ClientMessage) {
 		What:           "react",
 		Seq:            react.Seq,
 		Emoji:          react.Emoji,
+		Count:          &count,
+		Removed:        !added,
 		Ts:             now,
 	}, s.ID())
 }
@@ -1378,27 +1951,61 @@ func (h *Handlers) handleTyping(s SessionInterface, msg *ClientMessage) {
 		return
 	}
 
-	ctx, cancel := handlerCtx()
-	defer cancel()
+	activity := typing.Activity
+	switch activity {
+	case "":
+		activity = typingText
+	case typingText, typingRecording, typingUploading:
+	default:
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid activity"))
+		return
+	}
 
 	convID, err := uuid.Parse(typing.ConversationID)
-	if err != nil {
+	if err != nil || h.typing == nil {
 		return // Silently ignore invalid conv
 	}
 
+	// Only known typists can stop, and repeats within the throttle are absorbed
+	if typing.Stop {
+		h.typing.Stop(convID, s.UserID())
+		return
+	}
+	if h.typing.Refresh(convID, s.UserID(), activity) {
+		return
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
 	// Check membership
 	isMember, err := h.db.IsMember(ctx, convID, s.UserID())
 	if err != nil || !isMember {
 		return // Silently ignore
 	}
+	conv, err := h.db.GetConversationByID(ctx, convID)
+	if err != nil || conv == nil {
+		return
+	}
 
-	// Broadcast to members (no response to sender)
-	h.broadcastToConv(ctx, convID, &MsgServerInfo{
-		ConversationID: convID.String(),
-		From:           s.UserID().String(),
-		What:           "typing",
-		Ts:             time.Now().UTC(),
-	}, s.ID())
+	// Relayed to members (no response to sender)
+	h.typing.Start(convID, s.UserID(), s.ID(), activity, conv.Type == "room" && conv.MemberCount > typingAggregateMembers)
+}
+
+// sendTyping delivers typing activity to a conversation's members, leaving
+// out the session that reported it.
+func (h *Handlers) sendTyping(convID uuid.UUID, info *MsgServerInfo, skipSession string) {
+	if h.hub == nil {
+		return
+	}
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	memberIDs, err := h.db.GetConversationMembers(ctx, convID)
+	if err != nil {
+		return
+	}
+	h.hub.SendToUsers(memberIDs, &ServerMessage{Info: info}, skipSession)
 }
 
 // HandleRead processes read receipt requests.
@@ -1425,6 +2032,12 @@ func (h *Handlers) handleRead(s SessionInterface, msg *ClientMessage) {
 		return
 	}
 
+	// Thread read position is tracked separately from the main timeline
+	if read.Thread > 0 {
+		h.handleThreadRead(ctx, s, msg, convID, read)
+		return
+	}
+
 	// Update read seq
 	if err := h.db.UpdateReadSeq(ctx, convID, s.UserID(), read.Seq); err != nil {
 		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update"))
@@ -1451,14 +2064,13 @@ func (h *Handlers) handleRead(s SessionInterface, msg *ClientMessage) {
 		"ts":   now,
 	}))
 
-	// Broadcast to members
-	h.broadcastToConv(ctx, convID, &MsgServerInfo{
+	h.broadcastRead(ctx, s, convID, &MsgServerInfo{
 		ConversationID: convID.String(),
 		From:           s.UserID().String(),
 		What:           "read",
 		Seq:            read.Seq,
 		Ts:             now,
-	}, s.ID())
+	})
 }
 
 // HandleRecv processes delivery receipt requests.
@@ -1555,109 +2167,3 @@ func (h *Handlers) handleClear(s SessionInterface, msg *ClientMessage) {
 		"ts":   time.Now().UTC(),
 	}))
 }
-
-// HandlePin processes pin/unpin message requests.
-func (h *Handlers) HandlePin(s *Session, msg *ClientMessage) {
-	h.handlePin(s, msg)
-}
-
-func (h *Handlers) handlePin(s SessionInterface, msg *ClientMessage) {
-	if !s.RequireAuth(msg.ID) {
-		return
-	}
-
-	pin := msg.Pin
-	if pin == nil || pin.ConversationID == "" {
-		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing pin data"))
-		return
-	}
-
-	ctx, cancel := handlerCtx()
-	defer cancel()
-
-	convID, ok := parseUUID(s, msg.ID, pin.ConversationID, "conv id")
-	if !ok {
-		return
-	}
-
-	// Check membership and get conversation type
-	conv, err := h.db.GetConversationByID(ctx, convID)
-	if err != nil {
-		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
-		return
-	}
-	if conv == nil {
-		s.Send(CtrlError(msg.ID, CodeNotFound, "conversation not found"))
-		return
-	}
-
-	// Check requester's role
-	role, err := h.db.GetMemberRole(ctx, convID, s.UserID())
-	if err != nil {
-		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
-		return
-	}
-	if role == "" {
-		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
-		return
-	}
-
-	// For rooms, only owner/admin can pin. For DMs, any member can pin.
-	if conv.Type == "room" && role != "owner" && role != "admin" {
-		s.Send(CtrlError(msg.ID, CodeForbidden, "only owner or admin can pin"))
-		return
-	}
-
-	now := time.Now().UTC()
-
-	if pin.Seq == 0 {
-		// Unpin
-		if err := h.db.SetPinnedMessage(ctx, convID, nil, s.UserID()); err != nil {
-			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to unpin"))
-			return
-		}
-
-		s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
-			"conv":       convID.String(),
-			"unpinnedAt": now,
-		}))
-
-		// Broadcast unpin
-		h.broadcastToConv(ctx, convID, &MsgServerInfo{
-			ConversationID: convID.String(),
-			From:           s.UserID().String(),
-			What:           "unpin",
-			Ts:             now,
-		}, "")
-	} else {
-		// Pin - verify message exists
-		message, err := h.db.GetMessageBySeq(ctx, convID, pin.Seq)
-		if err != nil {
-			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
-			return
-		}
-		if message == nil {
-			s.Send(CtrlError(msg.ID, CodeNotFound, "message not found"))
-			return
-		}
-
-		if err := h.db.SetPinnedMessage(ctx, convID, &message.ID, s.UserID()); err != nil {
-			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to pin"))
-			return
-		}
-
-		s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
-			"seq":      pin.Seq,
-			"pinnedAt": now,
-		}))
-
-		// Broadcast pin
-		h.broadcastToConv(ctx, convID, &MsgServerInfo{
-			ConversationID: convID.String(),
-			From:           s.UserID().String(),
-			What:           "pin",
-			Seq:            pin.Seq,
-			Ts:             now,
-		}, "")
-	}
-}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -292,7 +293,7 @@ func TestHandleGetConversations_Success(t *testing.T) {
 		},
 	}
 
-	h.handleGetConversations(context.Background(), sess, msg)
+	h.handleGetConversations(context.Background(), sess, msg, msg.Get)
 
 	resp := sess.LastMessage()
 	if resp == nil {
@@ -307,6 +308,32 @@ func TestHandleGetConversations_Success(t *testing.T) {
 	}
 }
 
+func TestHandleGetConversations_ThreadUnread(t *testing.T) {
+	mockStore := &store.MockStore{
+		GetUserConversationsFn: func(ctx context.Context, uID uuid.UUID) ([]store.ConversationWithMember, error) {
+			return []store.ConversationWithMember{{
+				Conversation:  store.Conversation{ID: uuid.New(), Type: "room", LastSeq: 10},
+				ReadSeq:       4,
+				UnreadReplies: 2,
+			}}, nil
+		},
+		CountThreadRepliesFn: func(ctx context.Context, convID uuid.UUID, afterSeq int) (int, error) {
+			t.Error("expected thread replies to come with the conversations")
+			return 0, nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(uuid.New())
+	msg := &ClientMessage{ID: "1", Get: &MsgClientGet{What: "conversations", Threads: true}}
+	h.handleGetConversations(context.Background(), sess, msg, msg.Get)
+
+	convs := sess.LastMessage().Ctrl.Params["conversations"].([]map[string]any)
+	if unread := convs[0]["unread"]; unread != 4 {
+		t.Errorf("expected 4 unread outside threads, got %v", unread)
+	}
+}
+
 func TestHandleGetMessages_Success(t *testing.T) {
 	userID := uuid.New()
 	convID := uuid.New()
@@ -481,7 +508,7 @@ func TestHandleSend_Success(t *testing.T) {
 		ID: "test-1",
 		Send: &MsgClientSend{
 			ConversationID: convID.String(),
-			Content:        []byte("Hello world"),
+			Content:        json.RawMessage(`{"v":1,"text":"Hello world"}`),
 		},
 	}
 
@@ -518,7 +545,7 @@ func TestHandleSend_NotMember(t *testing.T) {
 		ID: "test-1",
 		Send: &MsgClientSend{
 			ConversationID: convID.String(),
-			Content:        []byte("Hello"),
+			Content:        json.RawMessage(`{"v":1,"text":"Hello"}`),
 		},
 	}
 
@@ -580,18 +607,25 @@ func TestHandleRead_Success(t *testing.T) {
 func TestHandleReact_Success(t *testing.T) {
 	userID := uuid.New()
 	convID := uuid.New()
+	messageID := uuid.New()
 	reactCalled := false
 
 	mockStore := &store.MockStore{
-		IsMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (bool, error) {
-			return true, nil
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
 		},
-		AddReactionFn: func(ctx context.Context, cID uuid.UUID, seq int, uID uuid.UUID, emoji string) error {
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			return &store.Message{ID: messageID, ConversationID: cID, Seq: seq}, nil
+		},
+		ToggleReactionFn: func(ctx context.Context, mID, uID uuid.UUID, emoji string, maxEmojis int) (bool, int, error) {
 			reactCalled = true
+			if mID != messageID {
+				t.Errorf("expected message %s, got %s", messageID, mID)
+			}
 			if emoji != "👍" {
 				t.Errorf("expected emoji 👍, got %s", emoji)
 			}
-			return nil
+			return true, 1, nil
 		},
 		GetConversationMembersFn: func(ctx context.Context, cID uuid.UUID) ([]uuid.UUID, error) {
 			return []uuid.UUID{userID}, nil
@@ -613,7 +647,7 @@ func TestHandleReact_Success(t *testing.T) {
 	h.handleReact(sess, msg)
 
 	if !reactCalled {
-		t.Error("AddReaction not called")
+		t.Error("ToggleReaction not called")
 	}
 
 	resp := sess.LastMessage()
@@ -645,7 +679,10 @@ func TestHandleEdit_Success(t *testing.T) {
 		GetEditCountFn: func(ctx context.Context, cID uuid.UUID, seq int) (int, error) {
 			return 0, nil
 		},
-		EditMessageFn: func(ctx context.Context, cID uuid.UUID, seq int, content []byte) error {
+		EditMessageFn: func(ctx context.Context, cID uuid.UUID, seq int, content []byte, files []string) error {
+			if len(files) != 0 {
+				t.Errorf("expected no files, got %v", files)
+			}
 			return nil
 		},
 		GetConversationMembersFn: func(ctx context.Context, cID uuid.UUID) ([]uuid.UUID, error) {
@@ -664,7 +701,7 @@ func TestHandleEdit_Success(t *testing.T) {
 		Edit: &MsgClientEdit{
 			ConversationID: convID.String(),
 			Seq:            1,
-			Content:        []byte("edited content"),
+			Content:        json.RawMessage(`{"v":1,"text":"edited content"}`),
 		},
 	}
 
@@ -679,6 +716,42 @@ func TestHandleEdit_Success(t *testing.T) {
 	}
 }
 
+func TestHandleEdit_Files(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	fileID := uuid.New()
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	var files []string
+	mockStore := &store.MockStore{
+		GetMessageBySeqFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Message, error) {
+			return &store.Message{ID: uuid.New(), ConversationID: convID, FromUserID: userID, Seq: seq, CreatedAt: time.Now()}, nil
+		},
+		GetFileByIDFn: func(ctx context.Context, id uuid.UUID) (*store.File, error) {
+			return &store.File{ID: id, UploaderID: userID}, nil
+		},
+		EditMessageFn: func(ctx context.Context, cID uuid.UUID, seq int, content []byte, refs []string) error {
+			files = refs
+			return nil
+		},
+	}
+
+	h := &Handlers{db: mockStore, encryptor: encryptor}
+	sess := newTestSession(userID)
+	h.handleEdit(sess, &ClientMessage{ID: "1", Edit: &MsgClientEdit{
+		ConversationID: convID.String(),
+		Seq:            1,
+		Content:        json.RawMessage(`{"v":2,"media":[{"type":"image","ref":"` + fileID.String() + `"}]}`),
+	}})
+
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected OK, got %d: %s", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if len(files) != 1 || files[0] != fileID.String() {
+		t.Errorf("expected head files to list the new attachment, got %v", files)
+	}
+}
+
 func TestHandleEdit_NotYourMessage(t *testing.T) {
 	userID := uuid.New()
 	otherUserID := uuid.New()
@@ -707,7 +780,7 @@ func TestHandleEdit_NotYourMessage(t *testing.T) {
 		Edit: &MsgClientEdit{
 			ConversationID: convID.String(),
 			Seq:            1,
-			Content:        []byte("edited"),
+			Content:        json.RawMessage(`{"v":1,"text":"edited"}`),
 		},
 	}
 
@@ -749,7 +822,7 @@ func TestHandleEdit_WindowExpired(t *testing.T) {
 		Edit: &MsgClientEdit{
 			ConversationID: convID.String(),
 			Seq:            1,
-			Content:        []byte("edited"),
+			Content:        json.RawMessage(`{"v":1,"text":"edited"}`),
 		},
 	}
 
@@ -886,6 +959,50 @@ func TestHandleTyping_Success(t *testing.T) {
 	}
 }
 
+func TestHandleTyping_Activity(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	queries := 0
+
+	mockStore := &store.MockStore{
+		IsMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (bool, error) {
+			queries++
+			return true, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: id, Type: "dm", MemberCount: 2}, nil
+		},
+	}
+
+	rec := &typingRecorder{}
+	h := testHandlers(mockStore)
+	h.typing = NewTypingTracker(nil, rec.send)
+	sess := newTestSession(userID)
+
+	typing := func(activity string, stop bool) {
+		h.handleTyping(sess, &ClientMessage{Typing: &MsgClientTyping{ConversationID: convID.String(), Activity: activity, Stop: stop}})
+	}
+
+	typing("dancing", false)
+	if resp := sess.LastMessage(); resp == nil || resp.Ctrl == nil || resp.Ctrl.Text != "invalid activity" {
+		t.Fatalf("expected invalid activity, got %+v", resp)
+	}
+
+	typing(typingRecording, false)
+	typing(typingRecording, false)
+	if infos := rec.take(); len(infos) != 1 || infos[0].Activity != typingRecording {
+		t.Fatalf("expected one relayed start, got %+v", infos)
+	}
+	if queries != 1 {
+		t.Errorf("expected the repeat to skip the database, got %d queries", queries)
+	}
+
+	typing("", true)
+	if infos := rec.take(); len(infos) != 1 || infos[0].What != "typing_stop" {
+		t.Errorf("expected a stop, got %+v", infos)
+	}
+}
+
 func TestHandleGet_UnknownWhat(t *testing.T) {
 	userID := uuid.New()
 	h := testHandlers(&store.MockStore{})
@@ -1064,7 +1181,7 @@ func TestHandleSend_Blocked(t *testing.T) {
 		ID: "test-1",
 		Send: &MsgClientSend{
 			ConversationID: convID.String(),
-			Content:        []byte("Hello"),
+			Content:        json.RawMessage(`{"v":1,"text":"Hello"}`),
 		},
 	}
 
@@ -1112,3 +1229,699 @@ func TestHandleStartDM_DatabaseError(t *testing.T) {
 		t.Errorf("expected code %d, got %d", CodeInternalError, resp.Ctrl.Code)
 	}
 }
+
+func TestHandleSend_SlowMode(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{Role: "member"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room", SlowMode: 30}, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+		slowMode:  NewSlowModeTracker(nil),
+	}
+	sess := newTestSession(userID)
+
+	send := func(id string) *ServerMessage {
+		h.handleSend(sess, &ClientMessage{
+			ID: id,
+			Send: &MsgClientSend{
+				ConversationID: convID.String(),
+				Content:        json.RawMessage(`{"v":1,"text":"Hello world"}`),
+			},
+		})
+		return sess.LastMessage()
+	}
+
+	if resp := send("test-1"); resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected first send to be accepted, got %d: %s", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+
+	resp := send("test-2")
+	if resp.Ctrl.Code != CodeTooManyRequests {
+		t.Fatalf("expected code %d, got %d", CodeTooManyRequests, resp.Ctrl.Code)
+	}
+	wait, ok := resp.Ctrl.Params["wait"].(int)
+	if !ok || wait <= 0 || wait > 30 {
+		t.Errorf("expected wait between 1 and 30 seconds, got %v", resp.Ctrl.Params["wait"])
+	}
+}
+
+func TestHandleSend_SlowModeAdminExempt(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{Role: "admin"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room", SlowMode: 30}, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+		slowMode:  NewSlowModeTracker(nil),
+	}
+	sess := newTestSession(userID)
+
+	for i := 0; i < 3; i++ {
+		h.handleSend(sess, &ClientMessage{
+			ID: "test-1",
+			Send: &MsgClientSend{
+				ConversationID: convID.String(),
+				Content:        json.RawMessage(`{"v":1,"text":"Hello world"}`),
+			},
+		})
+		if resp := sess.LastMessage(); resp.Ctrl.Code != CodeAccepted {
+			t.Fatalf("send %d: expected code %d, got %d: %s", i, CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+		}
+	}
+}
+
+func TestHandleUpdateRoom_SlowModeInvalid(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	mockStore := &store.MockStore{
+		GetMemberRoleFn: func(ctx context.Context, cID, uID uuid.UUID) (string, error) {
+			return "owner", nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	interval := 7
+	h.handleRoom(sess, &ClientMessage{
+		ID: "test-1",
+		Room: &MsgClientRoom{
+			ID:       convID.String(),
+			Action:   "update",
+			SlowMode: &interval,
+		},
+	})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil {
+		t.Fatal("expected ctrl response")
+	}
+	if resp.Ctrl.Code != CodeBadRequest {
+		t.Errorf("expected code %d, got %d", CodeBadRequest, resp.Ctrl.Code)
+	}
+}
+
+func TestHandleInviteToRoom_RoomFull(t *testing.T) {
+	userID := uuid.New()
+	targetID := uuid.New()
+	convID := uuid.New()
+
+	mockStore := &store.MockStore{
+		GetMemberRoleFn: func(ctx context.Context, cID, uID uuid.UUID) (string, error) {
+			return "owner", nil
+		},
+		GetUserByIDFn: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			return &store.User{ID: id, State: "ok"}, nil
+		},
+		AddRoomMemberFn: func(ctx context.Context, cID, uID uuid.UUID, role string, maxMembers int) error {
+			return store.ErrRoomFull
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room", MaxMembers: 2, MemberCount: 2}, nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handleRoom(sess, &ClientMessage{
+		ID: "test-1",
+		Room: &MsgClientRoom{
+			ID:     convID.String(),
+			Action: "invite",
+			User:   targetID.String(),
+		},
+	})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil {
+		t.Fatal("expected ctrl response")
+	}
+	if resp.Ctrl.Code != CodeConflict {
+		t.Fatalf("expected code %d, got %d", CodeConflict, resp.Ctrl.Code)
+	}
+	if resp.Ctrl.Text != "room is full" {
+		t.Errorf("unexpected error text: %s", resp.Ctrl.Text)
+	}
+	if resp.Ctrl.Params["maxMembers"] != 2 {
+		t.Errorf("expected maxMembers 2, got %v", resp.Ctrl.Params["maxMembers"])
+	}
+}
+
+func TestHandleSend_ThreadReply(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	rootSeq := 3
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	var gotRoot int
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room"}, nil
+		},
+		GetMessageBySeqFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Message, error) {
+			if seq == rootSeq {
+				return &store.Message{ID: uuid.New(), ConversationID: cID, Seq: rootSeq}, nil
+			}
+			// Replying to a reply lands in the root's thread
+			return &store.Message{ID: uuid.New(), ConversationID: cID, Seq: seq, ThreadSeq: &rootSeq}, nil
+		},
+		CreateThreadReplyFn: func(ctx context.Context, cID, fromID uuid.UUID, root int, content []byte, head json.RawMessage) (*store.Message, error) {
+			gotRoot = root
+			return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromID, Seq: 7, ThreadSeq: &root}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			t.Error("thread reply should not create a top-level message")
+			return nil, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"text":"Hello world"}`),
+			Thread:         5,
+		},
+	}
+
+	h.handleSend(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if gotRoot != rootSeq {
+		t.Errorf("expected thread root %d, got %d", rootSeq, gotRoot)
+	}
+	if resp.Ctrl.Params["thread"] != rootSeq {
+		t.Errorf("expected thread param %d, got %v", rootSeq, resp.Ctrl.Params["thread"])
+	}
+}
+
+func TestHandleGetThread_Success(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	rootSeq := 3
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetMessageBySeqFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Message, error) {
+			content, _ := encryptor.Encrypt([]byte("root"))
+			return &store.Message{
+				ID:      uuid.New(),
+				Seq:     rootSeq,
+				Content: content,
+				Head:    json.RawMessage(`{"thread":{"replies":2,"last_seq":9}}`),
+			}, nil
+		},
+		GetThreadMessagesFn: func(ctx context.Context, cID, uID uuid.UUID, root, before, limit int, clearSeq int) ([]store.Message, error) {
+			content, _ := encryptor.Encrypt([]byte("reply"))
+			return []store.Message{
+				{ID: uuid.New(), Seq: 9, Content: content, ThreadSeq: &rootSeq},
+				{ID: uuid.New(), Seq: 5, Content: content, ThreadSeq: &rootSeq},
+			}, nil
+		},
+		GetThreadReadSeqFn: func(ctx context.Context, cID, uID uuid.UUID, root int) (int, error) {
+			return 5, nil
+		},
+		CountThreadUnreadFn: func(ctx context.Context, cID uuid.UUID, root, afterSeq int) (int, error) {
+			if root != rootSeq || afterSeq != 5 {
+				t.Errorf("unexpected unread query root=%d after=%d", root, afterSeq)
+			}
+			return 1, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Get: &MsgClientGet{
+			What:           "thread",
+			ConversationID: convID.String(),
+			Seq:            rootSeq,
+		},
+	}
+
+	h.handleGetThread(context.Background(), sess, msg, msg.Get)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if msgs, _ := resp.Ctrl.Params["messages"].([]map[string]any); len(msgs) != 2 {
+		t.Errorf("expected 2 replies, got %v", resp.Ctrl.Params["messages"])
+	}
+	if resp.Ctrl.Params["unread"] != 1 {
+		t.Errorf("expected 1 unread, got %v", resp.Ctrl.Params["unread"])
+	}
+}
+
+func TestHandleRead_ThreadKeepsMainReadSeq(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	var threadRead bool
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetMessageBySeqFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Message, error) {
+			return &store.Message{ConversationID: cID, Seq: seq}, nil
+		},
+		UpdateThreadReadSeqFn: func(ctx context.Context, cID, uID uuid.UUID, root, seq int) error {
+			threadRead = root == 3 && seq == 9
+			return nil
+		},
+		UpdateReadSeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int) error {
+			t.Error("thread read should not update the main read seq")
+			return nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Read: &MsgClientRead{
+			ConversationID: convID.String(),
+			Seq:            9,
+			Thread:         3,
+		},
+	}
+
+	h.handleRead(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if !threadRead {
+		t.Error("expected thread read seq to be updated")
+	}
+}
+
+func TestHandleRead_ThreadRootNotFound(t *testing.T) {
+	rootSeq := 3
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetMessageBySeqFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Message, error) {
+			if seq == 4 {
+				return &store.Message{ConversationID: cID, Seq: seq, ThreadSeq: &rootSeq}, nil
+			}
+			return nil, nil
+		},
+		UpdateThreadReadSeqFn: func(ctx context.Context, cID, uID uuid.UUID, root, seq int) error {
+			t.Errorf("unexpected read of thread %d", root)
+			return nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	// A missing message and a reply aren't thread roots
+	for _, thread := range []int{99, 4} {
+		sess := newTestSession(uuid.New())
+		h.handleRead(sess, &ClientMessage{ID: "1", Read: &MsgClientRead{
+			ConversationID: uuid.NewString(),
+			Seq:            9,
+			Thread:         thread,
+		}})
+		if resp := sess.LastMessage(); resp.Ctrl.Code != CodeNotFound {
+			t.Errorf("thread %d: expected not found, got %d: %s", thread, resp.Ctrl.Code, resp.Ctrl.Text)
+		}
+	}
+}
+
+func TestHandleSend_ReplyHydrated(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	var stored []byte
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room"}, nil
+		},
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			content, _ := encryptor.Encrypt([]byte(`{"v":1,"text":"the real original"}`))
+			return &store.Message{ID: uuid.New(), Seq: seq, FromUserID: otherID, Content: content}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			stored, _ = encryptor.Decrypt(content)
+			return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromID, Seq: 5}, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"text":"hi","reply":{"seq":2,"preview":"fabricated","from":"someone"}}`),
+		},
+	}
+
+	h.handleSend(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+
+	var got struct {
+		Text  string `json:"text"`
+		Reply struct {
+			Seq     int    `json:"seq"`
+			Preview string `json:"preview"`
+			From    string `json:"from"`
+		} `json:"reply"`
+	}
+	if err := json.Unmarshal(stored, &got); err != nil {
+		t.Fatalf("stored content is not JSON: %v", err)
+	}
+	if got.Text != "hi" || got.Reply.Seq != 2 {
+		t.Errorf("unexpected content: %s", stored)
+	}
+	if got.Reply.Preview != "the real original" || got.Reply.From != otherID.String() {
+		t.Errorf("reply not hydrated from original: %s", stored)
+	}
+}
+
+func TestHandleSend_ReplyTargetNotVisible(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ClearSeq: 10}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "dm"}, nil
+		},
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			return nil, nil // Cleared from the sender's history
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			t.Error("message should not be created")
+			return nil, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"text":"hi"}`),
+			ReplyTo:        3,
+		},
+	}
+
+	h.handleSend(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeNotFound {
+		t.Errorf("expected code %d, got %d: %s", CodeNotFound, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleSend_ReplyToViewOnceHasNoPreview(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	var stored []byte
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "dm"}, nil
+		},
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			content, _ := encryptor.Encrypt([]byte(`{"v":1,"text":"secret"}`))
+			return &store.Message{ID: uuid.New(), Seq: seq, FromUserID: uuid.New(), Content: content, ViewOnce: true}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			stored, _ = encryptor.Decrypt(content)
+			return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromID, Seq: 5}, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"text":"hi","reply":{"seq":2,"preview":"secret"}}`),
+		},
+	}
+
+	h.handleSend(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected accepted response, got %+v", resp)
+	}
+	if strings.Contains(string(stored), "secret") {
+		t.Errorf("view-once content leaked into reply preview: %s", stored)
+	}
+}
+
+func TestHandleSend_InvalidContent(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "dm"}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			t.Error("message should not be created")
+			return nil, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+
+	for _, content := range []string{`"just a string"`, `{"v":1}`, `{"v":1,"text":"hi","mentions":[{"userId":"x","offset":0,"length":9}]}`} {
+		sess := newTestSession(userID)
+		msg := &ClientMessage{
+			ID: "test-1",
+			Send: &MsgClientSend{
+				ConversationID: convID.String(),
+				Content:        json.RawMessage(content),
+			},
+		}
+
+		h.handleSend(sess, msg)
+
+		resp := sess.LastMessage()
+		if resp == nil {
+			t.Fatal("expected response")
+		}
+		if resp.Ctrl.Code != CodeBadRequest {
+			t.Errorf("%s: expected code %d, got %d: %s", content, CodeBadRequest, resp.Ctrl.Code, resp.Ctrl.Text)
+		}
+	}
+}
+
+func TestHandleSend_MentionNonMember(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	outsider := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room"}, nil
+		},
+		GetConversationMembersFn: func(ctx context.Context, cID uuid.UUID) ([]uuid.UUID, error) {
+			return []uuid.UUID{userID}, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"text":"hi @eve","mentions":[{"userId":"` + outsider.String() + `","offset":3,"length":4}]}`),
+		},
+	}
+
+	h.handleSend(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeBadRequest || resp.Ctrl.Text != "mentioned user is not a member" {
+		t.Errorf("expected mention rejection, got %d: %s", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleSend_FileRefNotOwned(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	fileID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "dm"}, nil
+		},
+		GetFileByIDFn: func(ctx context.Context, id uuid.UUID) (*store.File, error) {
+			return &store.File{ID: id, UploaderID: uuid.New()}, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"media":[{"type":"image","ref":"` + fileID.String() + `"}]}`),
+		},
+	}
+
+	h.handleSend(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeBadRequest || resp.Ctrl.Text != "invalid file reference" {
+		t.Errorf("expected file ref rejection, got %d: %s", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestClientHead(t *testing.T) {
+	tests := []struct {
+		head, want string
+	}{
+		{`{"urgent":true}`, `{"urgent":true}`},
+		{`{"scheduled":"0b7c","urgent":true}`, `{"urgent":true}`},
+		{`{"scheduled":"0b7c"}`, ``},
+		{``, ``},
+	}
+	for _, tt := range tests {
+		var head json.RawMessage
+		if tt.head != "" {
+			head = json.RawMessage(tt.head)
+		}
+		if got := clientHead(head); string(got) != tt.want {
+			t.Errorf("clientHead(%s) = %s, want %s", tt.head, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/irido"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+const (
+	// maxForwardMessages is the most messages one forward request can copy.
+	maxForwardMessages = 50
+	// maxForwardTargets is the most conversations one forward request can copy into.
+	maxForwardTargets = 10
+)
+
+// forwardSource is a message ready to be copied into target conversations.
+type forwardSource struct {
+	doc     *irido.Irido
+	content []byte         // Canonical Irido JSON
+	head    map[string]any // forwarded_from and file refs
+}
+
+// forwardTarget is a conversation the user may forward into.
+type forwardTarget struct {
+	convID   uuid.UUID
+	slowMode bool // Slow mode slot acquired; release if nothing is sent
+}
+
+// HandleForward processes message forward requests.
+func (h *Handlers) HandleForward(s *Session, msg *ClientMessage) {
+	h.handleForward(s, msg)
+}
+
+func (h *Handlers) handleForward(s SessionInterface, msg *ClientMessage) {
+	if !s.RequireAuth(msg.ID) {
+		return
+	}
+
+	fwd := msg.Forward
+	if fwd == nil || fwd.ConversationID == "" || len(fwd.Seqs) == 0 || len(fwd.To) == 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing forward data"))
+		return
+	}
+	if len(fwd.Seqs) > maxForwardMessages {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "too many messages"))
+		return
+	}
+	if len(fwd.To) > maxForwardTargets {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "too many targets"))
+		return
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	convID, ok := parseUUID(s, msg.ID, fwd.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return
+	}
+
+	// Load every source message before writing anything
+	sources := make([]*forwardSource, 0, len(fwd.Seqs))
+	for _, seq := range fwd.Seqs {
+		src := h.forwardSource(ctx, s, msg, convID, seq, member.ClearSeq, fwd.HideSender)
+		if src == nil {
+			return
+		}
+		sources = append(sources, src)
+	}
+
+	targets := h.forwardTargets(ctx, s, msg, fwd.To)
+	if targets == nil {
+		return
+	}
+
+	results := make([]map[string]any, 0, len(targets))
+	for i, target := range targets {
+		seqs := make([]int, 0, len(sources))
+		var err error
+		for _, src := range sources {
+			var message *store.Message
+			message, err = h.forwardMessage(ctx, s, target.convID, src)
+			if err != nil {
+				break
+			}
+			seqs = append(seqs, message.Seq)
+		}
+		results = append(results, map[string]any{
+			"conv": target.convID.String(),
+			"seqs": seqs,
+		})
+		if err != nil {
+			slog.Error("forward failed", "conv", target.convID, "error", err)
+			// Give back slow mode slots of targets that got nothing
+			unsent := targets[i+1:]
+			if len(seqs) == 0 {
+				unsent = targets[i:]
+			}
+			for _, t := range unsent {
+				if t.slowMode {
+					h.slowMode.Release(ctx, t.convID, s.UserID())
+				}
+			}
+			s.Send(CtrlErrorWithParams(msg.ID, CodeInternalError, "failed to forward", map[string]any{
+				"forwarded": results,
+			}))
+			return
+		}
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeAccepted, map[string]any{
+		"forwarded": results,
+	}))
+}
+
+// forwardSource loads the message at seq and prepares its forwarded copy.
+// View-once, deleted, no-forward and poll messages are refused. On failure
+// it sends an error response and returns nil.
+func (h *Handlers) forwardSource(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, seq, clearSeq int, hideSender bool) *forwardSource {
+	original, err := h.db.GetVisibleMessageBySeq(ctx, convID, s.UserID(), seq, clearSeq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return nil
+	}
+	if original == nil || original.DeletedAt != nil {
+		s.Send(CtrlErrorWithParams(msg.ID, CodeNotFound, "message not found", map[string]any{
+			"seq": seq,
+		}))
+		return nil
+	}
+	if original.ViewOnce {
+		s.Send(CtrlErrorWithParams(msg.ID, CodeForbidden, "view-once messages cannot be forwarded", map[string]any{
+			"seq": seq,
+		}))
+		return nil
+	}
+
+	var origHead map[string]any
+	if len(original.Head) > 0 {
+		_ = json.Unmarshal(original.Head, &origHead)
+	}
+	if noForward, _ := origHead["no_forward"].(bool); noForward {
+		s.Send(CtrlErrorWithParams(msg.ID, CodeForbidden, "message cannot be forwarded", map[string]any{
+			"seq": seq,
+		}))
+		return nil
+	}
+
+	plaintext, err := h.encryptor.Decrypt(original.Content)
+	if err != nil {
+		plaintext = original.Content // Fallback for unencrypted messages
+	}
+	doc, err := irido.Parse(plaintext)
+	if err != nil || doc == nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to read message"))
+		return nil
+	}
+	if doc.Poll != nil {
+		s.Send(CtrlErrorWithParams(msg.ID, CodeBadRequest, "polls cannot be forwarded", map[string]any{
+			"seq": seq,
+		}))
+		return nil
+	}
+
+	// Replies and mentions refer to the source conversation
+	doc.Reply = nil
+	doc.Mentions = nil
+
+	content, err := doc.ToJSON()
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "encoding failed"))
+		return nil
+	}
+
+	head := map[string]any{
+		"forwarded_from": forwardedFrom(original, origHead, hideSender),
+	}
+	if refs := mediaRefs(doc); len(refs) > 0 {
+		head["files"] = refs
+	}
+
+	return &forwardSource{doc: doc, content: content, head: head}
+}
+
+// forwardedFrom builds the provenance for a forwarded copy of original.
+// Forwarding a forward keeps the first provenance. Hiding the sender also
+// drops the source location, which would identify them.
+func forwardedFrom(original *store.Message, origHead map[string]any, hideSender bool) map[string]any {
+	from, ok := origHead["forwarded_from"].(map[string]any)
+	if !ok {
+		from = map[string]any{
+			"conv": original.ConversationID.String(),
+			"seq":  original.Seq,
+			"from": original.FromUserID.String(),
+			"ts":   original.CreatedAt,
+		}
+	}
+	if hideSender {
+		delete(from, "conv")
+		delete(from, "seq")
+		delete(from, "from")
+	}
+	return from
+}
+
+// forwardTargets checks that the user can send to every target conversation
+// and takes a slow mode slot in rooms that have it. On failure it releases
+// any slots taken, sends an error response and returns nil.
+func (h *Handlers) forwardTargets(ctx context.Context, s SessionInterface, msg *ClientMessage, to []string) []forwardTarget {
+	targets := make([]forwardTarget, 0, len(to))
+	fail := func(resp *ServerMessage) []forwardTarget {
+		for _, t := range targets {
+			if t.slowMode {
+				h.slowMode.Release(ctx, t.convID, s.UserID())
+			}
+		}
+		s.Send(resp)
+		return nil
+	}
+
+	seen := make(map[uuid.UUID]bool, len(to))
+	for _, idStr := range to {
+		convID, err := uuid.Parse(idStr)
+		if err != nil {
+			return fail(CtrlError(msg.ID, CodeBadRequest, "invalid target conv id"))
+		}
+		if seen[convID] {
+			continue
+		}
+		seen[convID] = true
+
+		member, err := h.db.GetMember(ctx, convID, s.UserID())
+		if err != nil {
+			return fail(CtrlError(msg.ID, CodeInternalError, "database error"))
+		}
+		if member == nil {
+			return fail(CtrlErrorWithParams(msg.ID, CodeForbidden, "not a member", map[string]any{
+				"conv": idStr,
+			}))
+		}
+
+		conv, err := h.db.GetConversationByID(ctx, convID)
+		if err != nil || conv == nil {
+			return fail(CtrlErrorWithParams(msg.ID, CodeNotFound, "conversation not found", map[string]any{
+				"conv": idStr,
+			}))
+		}
+
+		if conv.Type == "dm" {
+			otherUser, _ := h.db.GetDMOtherUser(ctx, convID, s.UserID())
+			if otherUser != nil {
+				blocked, _ := h.db.IsBlocked(ctx, convID, otherUser.ID, s.UserID())
+				if blocked {
+					return fail(CtrlErrorWithParams(msg.ID, CodeForbidden, "blocked", map[string]any{
+						"conv": idStr,
+					}))
+				}
+			}
+		}
+
+		// A forward counts as one message for slow mode
+		target := forwardTarget{convID: convID}
+		if conv.Type == "room" && conv.SlowMode > 0 &&
+			member.Role != "owner" && member.Role != "admin" && h.slowMode != nil {
+			wait := h.slowMode.Acquire(ctx, convID, s.UserID(), time.Duration(conv.SlowMode)*time.Second)
+			if wait > 0 {
+				return fail(CtrlErrorWithParams(msg.ID, CodeTooManyRequests, "slow mode", map[string]any{
+					"conv":     idStr,
+					"slowMode": conv.SlowMode,
+					"wait":     int(math.Ceil(wait.Seconds())),
+				}))
+			}
+			target.slowMode = true
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// forwardMessage stores one forwarded copy and delivers it to the target's members.
+func (h *Handlers) forwardMessage(ctx context.Context, s SessionInterface, convID uuid.UUID, src *forwardSource) (*store.Message, error) {
+	content, err := h.encryptor.Encrypt(src.content)
+	if err != nil {
+		return nil, err
+	}
+	head, err := json.Marshal(src.head)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := h.db.CreateMessage(ctx, convID, s.UserID(), content, head)
+	if err != nil {
+		return nil, err
+	}
+	h.indexMessage(ctx, message, src.doc)
+
+	if h.hub != nil {
+		memberIDs, _ := h.db.GetConversationMembers(ctx, convID)
+		h.hub.SendToUsers(memberIDs, &ServerMessage{
+			Data: &MsgServerData{
+				ConversationID: convID.String(),
+				Seq:            message.Seq,
+				From:           s.UserID().String(),
+				Content:        src.content,
+				Head:           src.head,
+				Ts:             message.CreatedAt,
+			},
+		}, s.ID())
+	}
+	if h.typing != nil {
+		h.typing.MessageSent(convID, s.UserID())
+	}
+	h.pushMessage(ctx, convID, s.UserID(), message.Seq, src.doc, src.head)
+	return message, nil
+}
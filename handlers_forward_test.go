@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// forwardTestHandlers returns handlers whose store holds one message at seq 5
+// in srcID and treats the user as a member of every conversation.
+func forwardTestHandlers(t *testing.T, srcID, authorID uuid.UUID, content string, head json.RawMessage, viewOnce bool) (*Handlers, *store.MockStore) {
+	t.Helper()
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	encrypted, err := encryptor.Encrypt([]byte(content))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: id, Type: "room"}, nil
+		},
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			if cID != srcID || seq != 5 {
+				return nil, nil
+			}
+			return &store.Message{
+				ID: uuid.New(), ConversationID: srcID, Seq: 5, FromUserID: authorID,
+				CreatedAt: created, Content: encrypted, Head: head, ViewOnce: viewOnce,
+			}, nil
+		},
+	}
+	return &Handlers{db: mockStore, encryptor: encryptor}, mockStore
+}
+
+func TestHandleForward_RecordsProvenanceAndFiles(t *testing.T) {
+	userID := uuid.New()
+	authorID := uuid.New()
+	srcID := uuid.New()
+	targetID := uuid.New()
+	fileID := uuid.New()
+
+	content := `{"v":2,"text":"look @bob","media":[{"type":"image","ref":"` + fileID.String() + `"}],` +
+		`"mentions":[{"userId":"` + authorID.String() + `","offset":5,"length":4}],"reply":{"seq":2}}`
+	h, mockStore := forwardTestHandlers(t, srcID, authorID, content, nil, false)
+
+	var gotConv uuid.UUID
+	var gotContent []byte
+	var gotHead map[string]any
+	mockStore.CreateMessageFn = func(ctx context.Context, cID, fromUserID uuid.UUID, c []byte, head json.RawMessage) (*store.Message, error) {
+		gotConv = cID
+		gotContent, _ = h.encryptor.Decrypt(c)
+		_ = json.Unmarshal(head, &gotHead)
+		return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromUserID, Seq: 9}, nil
+	}
+
+	sess := newTestSession(userID)
+	h.handleForward(sess, &ClientMessage{
+		ID: "test-1",
+		Forward: &MsgClientForward{
+			ConversationID: srcID.String(),
+			Seqs:           []int{5},
+			To:             []string{targetID.String()},
+		},
+	})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil {
+		t.Fatal("expected ctrl response")
+	}
+	if resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if gotConv != targetID {
+		t.Errorf("expected message in %s, got %s", targetID, gotConv)
+	}
+
+	from, ok := gotHead["forwarded_from"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected forwarded_from in head, got %v", gotHead)
+	}
+	if from["from"] != authorID.String() || from["conv"] != srcID.String() || from["seq"] != float64(5) {
+		t.Errorf("unexpected provenance: %v", from)
+	}
+	files, _ := gotHead["files"].([]any)
+	if len(files) != 1 || files[0] != fileID.String() {
+		t.Errorf("expected file ref in head, got %v", gotHead["files"])
+	}
+
+	// Reply and mentions point into the source conversation
+	var doc map[string]any
+	_ = json.Unmarshal(gotContent, &doc)
+	if doc["reply"] != nil || doc["mentions"] != nil {
+		t.Errorf("expected reply and mentions dropped, got %s", gotContent)
+	}
+	if doc["text"] != "look @bob" {
+		t.Errorf("expected text kept, got %s", gotContent)
+	}
+}
+
+func TestHandleForward_EndsTyping(t *testing.T) {
+	userID := uuid.New()
+	srcID := uuid.New()
+	targetID := uuid.New()
+	h, _ := forwardTestHandlers(t, srcID, uuid.New(), `{"v":2,"text":"hi"}`, nil, false)
+	rec := &typingRecorder{}
+	h.typing = NewTypingTracker(nil, rec.send)
+
+	sess := newTestSession(userID)
+	h.typing.Start(targetID, userID, sess.ID(), typingText, false)
+	h.handleForward(sess, &ClientMessage{
+		ID: "test-1",
+		Forward: &MsgClientForward{
+			ConversationID: srcID.String(),
+			Seqs:           []int{5},
+			To:             []string{targetID.String()},
+		},
+	})
+
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if len(h.typing.typists) != 0 {
+		t.Error("expected the forward to end typing in the target")
+	}
+}
+
+func TestHandleForward_HideSender(t *testing.T) {
+	userID := uuid.New()
+	authorID := uuid.New()
+	srcID := uuid.New()
+
+	h, mockStore := forwardTestHandlers(t, srcID, authorID, `{"v":2,"text":"hi"}`, nil, false)
+
+	var gotHead map[string]any
+	mockStore.CreateMessageFn = func(ctx context.Context, cID, fromUserID uuid.UUID, c []byte, head json.RawMessage) (*store.Message, error) {
+		_ = json.Unmarshal(head, &gotHead)
+		return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromUserID, Seq: 9}, nil
+	}
+
+	sess := newTestSession(userID)
+	h.handleForward(sess, &ClientMessage{
+		ID: "test-1",
+		Forward: &MsgClientForward{
+			ConversationID: srcID.String(),
+			Seqs:           []int{5},
+			To:             []string{uuid.New().String()},
+			HideSender:     true,
+		},
+	})
+
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	from := gotHead["forwarded_from"].(map[string]any)
+	if _, ok := from["from"]; ok {
+		t.Errorf("expected sender hidden, got %v", from)
+	}
+	if _, ok := from["conv"]; ok {
+		t.Errorf("expected source hidden, got %v", from)
+	}
+	if from["ts"] == nil {
+		t.Errorf("expected original timestamp, got %v", from)
+	}
+}
+
+func TestHandleForward_KeepsFirstProvenance(t *testing.T) {
+	userID := uuid.New()
+	srcID := uuid.New()
+
+	head := json.RawMessage(`{"forwarded_from":{"ts":"2025-01-01T00:00:00Z"}}`)
+	h, mockStore := forwardTestHandlers(t, srcID, uuid.New(), `{"v":2,"text":"hi"}`, head, false)
+
+	var gotHead map[string]any
+	mockStore.CreateMessageFn = func(ctx context.Context, cID, fromUserID uuid.UUID, c []byte, head json.RawMessage) (*store.Message, error) {
+		_ = json.Unmarshal(head, &gotHead)
+		return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromUserID, Seq: 9}, nil
+	}
+
+	sess := newTestSession(userID)
+	h.handleForward(sess, &ClientMessage{
+		ID: "test-1",
+		Forward: &MsgClientForward{
+			ConversationID: srcID.String(),
+			Seqs:           []int{5},
+			To:             []string{uuid.New().String()},
+		},
+	})
+
+	from := gotHead["forwarded_from"].(map[string]any)
+	if _, ok := from["from"]; ok || from["ts"] != "2025-01-01T00:00:00Z" {
+		t.Errorf("expected original hidden provenance, got %v", from)
+	}
+}
+
+func TestHandleForward_Refused(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		head     json.RawMessage
+		viewOnce bool
+		seq      int
+		code     int
+		want     string
+	}{
+		{"view-once", `{"v":2,"text":"hi"}`, nil, true, 5, CodeForbidden, "view-once messages cannot be forwarded"},
+		{"no-forward", `{"v":2,"text":"hi"}`, json.RawMessage(`{"no_forward":true}`), false, 5, CodeForbidden, "message cannot be forwarded"},
+		{"poll", `{"v":2,"poll":{"question":"Lunch?","options":[{"text":"Yes"},{"text":"No"}]}}`, nil, false, 5, CodeBadRequest, "polls cannot be forwarded"},
+		{"missing", `{"v":2,"text":"hi"}`, nil, false, 6, CodeNotFound, "message not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcID := uuid.New()
+			h, mockStore := forwardTestHandlers(t, srcID, uuid.New(), tt.content, tt.head, tt.viewOnce)
+			mockStore.CreateMessageFn = func(ctx context.Context, cID, fromUserID uuid.UUID, c []byte, head json.RawMessage) (*store.Message, error) {
+				t.Error("message should not be forwarded")
+				return nil, nil
+			}
+
+			sess := newTestSession(uuid.New())
+			h.handleForward(sess, &ClientMessage{
+				ID: "test-1",
+				Forward: &MsgClientForward{
+					ConversationID: srcID.String(),
+					Seqs:           []int{tt.seq},
+					To:             []string{uuid.New().String()},
+				},
+			})
+
+			resp := sess.LastMessage()
+			if resp.Ctrl.Code != tt.code || resp.Ctrl.Text != tt.want {
+				t.Errorf("expected %d %q, got %d %q", tt.code, tt.want, resp.Ctrl.Code, resp.Ctrl.Text)
+			}
+		})
+	}
+}
+
+func TestHandleForward_NotMemberOfTarget(t *testing.T) {
+	userID := uuid.New()
+	srcID := uuid.New()
+	targetID := uuid.New()
+
+	h, mockStore := forwardTestHandlers(t, srcID, uuid.New(), `{"v":2,"text":"hi"}`, nil, false)
+	mockStore.GetMemberFn = func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+		if cID == targetID {
+			return nil, nil
+		}
+		return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+	}
+	mockStore.CreateMessageFn = func(ctx context.Context, cID, fromUserID uuid.UUID, c []byte, head json.RawMessage) (*store.Message, error) {
+		t.Error("message should not be forwarded")
+		return nil, nil
+	}
+
+	sess := newTestSession(userID)
+	h.handleForward(sess, &ClientMessage{
+		ID: "test-1",
+		Forward: &MsgClientForward{
+			ConversationID: srcID.String(),
+			Seqs:           []int{5},
+			To:             []string{uuid.New().String(), targetID.String()},
+		},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeForbidden || resp.Ctrl.Params["conv"] != targetID.String() {
+		t.Errorf("expected 403 for target, got %d %q %v", resp.Ctrl.Code, resp.Ctrl.Text, resp.Ctrl.Params)
+	}
+}
+
+func TestHandleSend_RecordsFilesAndNoForward(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	fileID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	var gotHead map[string]any
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: id, Type: "room"}, nil
+		},
+		GetFileByIDFn: func(ctx context.Context, id uuid.UUID) (*store.File, error) {
+			return &store.File{ID: id, UploaderID: userID}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromUserID uuid.UUID, c []byte, head json.RawMessage) (*store.Message, error) {
+			_ = json.Unmarshal(head, &gotHead)
+			return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromUserID, Seq: 1}, nil
+		},
+	}
+	h := &Handlers{db: mockStore, encryptor: encryptor}
+
+	sess := newTestSession(userID)
+	h.handleSend(sess, &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":2,"media":[{"type":"image","ref":"` + fileID.String() + `"}]}`),
+			NoForward:      true,
+		},
+	})
+
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if gotHead["no_forward"] != true {
+		t.Errorf("expected no_forward in head, got %v", gotHead)
+	}
+	files, _ := gotHead["files"].([]any)
+	if len(files) != 1 || files[0] != fileID.String() {
+		t.Errorf("expected file ref in head, got %v", gotHead["files"])
+	}
+}
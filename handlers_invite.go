@@ -236,6 +236,7 @@ func (h *Handlers) handleRedeemInviteExisting(ctx context.Context, s *Session, m
 	if err := h.db.AddContact(ctx, invite.InviterID, s.UserID(), "invite", &invite.ID); err != nil {
 		log.Printf("invite: failed to add contact between %s and %s: %v", shortID(invite.InviterID), shortID(s.UserID()), err)
 	}
+	h.presenceChanged(invite.InviterID, s.UserID())
 
 	// Get inviter info
 	inviter, _ := h.db.GetUserByID(ctx, invite.InviterID)
@@ -288,6 +289,7 @@ func (h *Handlers) RedeemInviteCode(ctx context.Context, code string, newUserID
 		if err := h.db.AddContact(ctx, invite.InviterID, newUserID, "invite", &invite.ID); err != nil {
 			log.Printf("invite: failed to add contact between %s and %s: %v", shortID(invite.InviterID), shortID(newUserID), err)
 		}
+		h.presenceChanged(invite.InviterID, newUserID)
 		connectedUsers = append(connectedUsers, invite.InviterID)
 	}
 
@@ -315,6 +317,7 @@ func (h *Handlers) RedeemInviteCode(ctx context.Context, code string, newUserID
 			if err := h.db.AddContact(ctx, other.InviterID, newUserID, "invite", &other.ID); err != nil {
 				log.Printf("invite: failed to add contact between %s and %s: %v", shortID(other.InviterID), shortID(newUserID), err)
 			}
+			h.presenceChanged(other.InviterID, newUserID)
 			connectedUsers = append(connectedUsers, other.InviterID)
 		}
 	}
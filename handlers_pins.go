@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// HandlePin processes pin, unpin and reorder requests.
+func (h *Handlers) HandlePin(s *Session, msg *ClientMessage) {
+	h.handlePin(s, msg)
+}
+
+func (h *Handlers) handlePin(s SessionInterface, msg *ClientMessage) {
+	if !s.RequireAuth(msg.ID) {
+		return
+	}
+
+	pin := msg.Pin
+	if pin == nil || pin.ConversationID == "" {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing pin data"))
+		return
+	}
+
+	// Legacy form: seq > 0 pins, seq 0 unpins all
+	action := pin.Action
+	if action == "" {
+		action = "pin"
+		if pin.Seq == 0 {
+			action = "unpin"
+		}
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	convID, ok := parseUUID(s, msg.ID, pin.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	// Check membership and get conversation type
+	conv, err := h.db.GetConversationByID(ctx, convID)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if conv == nil {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "conversation not found"))
+		return
+	}
+
+	// Check requester's role
+	role, err := h.db.GetMemberRole(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if role == "" {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return
+	}
+
+	// For rooms, only owner/admin can pin. For DMs, any member can pin.
+	if conv.Type == "room" && role != "owner" && role != "admin" {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "only owner or admin can pin"))
+		return
+	}
+
+	switch action {
+	case "pin":
+		h.pinMessage(ctx, s, msg, convID, pin)
+	case "unpin":
+		h.unpinMessage(ctx, s, msg, convID, pin)
+	case "reorder":
+		h.reorderPins(ctx, s, msg, convID, pin)
+	default:
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "unknown action"))
+	}
+}
+
+func (h *Handlers) pinMessage(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, pin *MsgClientPin) {
+	if pin.Seq <= 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing seq"))
+		return
+	}
+
+	// Verify message exists
+	message, err := h.db.GetMessageBySeq(ctx, convID, pin.Seq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if message == nil || message.DeletedAt != nil {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "message not found"))
+		return
+	}
+	if message.ViewOnce {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "view-once messages cannot be pinned"))
+		return
+	}
+
+	maxPins := h.maxPinnedMessages()
+	if err := h.db.PinMessage(ctx, convID, message.ID, s.UserID(), maxPins); err != nil {
+		switch {
+		case errors.Is(err, store.ErrAlreadyPinned):
+			s.Send(CtrlError(msg.ID, CodeConflict, "already pinned"))
+		case errors.Is(err, store.ErrPinLimitReached):
+			s.Send(CtrlErrorWithParams(msg.ID, CodeConflict, "pin limit reached", map[string]any{
+				"conv":    convID.String(),
+				"maxPins": maxPins,
+			}))
+		default:
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to pin"))
+		}
+		return
+	}
+
+	now := time.Now().UTC()
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":     convID.String(),
+		"seq":      pin.Seq,
+		"pinnedAt": now,
+	}))
+
+	// Broadcast pin
+	h.broadcastToConv(ctx, convID, &MsgServerInfo{
+		ConversationID: convID.String(),
+		From:           s.UserID().String(),
+		What:           "pin",
+		Seq:            pin.Seq,
+		Ts:             now,
+	}, "")
+}
+
+func (h *Handlers) unpinMessage(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, pin *MsgClientPin) {
+	if pin.Seq == 0 {
+		// Unpin all
+		if err := h.db.UnpinAllMessages(ctx, convID); err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to unpin"))
+			return
+		}
+	} else {
+		message, err := h.db.GetMessageBySeq(ctx, convID, pin.Seq)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+		if message == nil {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "message not found"))
+			return
+		}
+		removed, err := h.db.UnpinMessage(ctx, convID, message.ID)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to unpin"))
+			return
+		}
+		if !removed {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "message not pinned"))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	params := map[string]any{
+		"conv":       convID.String(),
+		"unpinnedAt": now,
+	}
+	if pin.Seq > 0 {
+		params["seq"] = pin.Seq
+	}
+	s.Send(CtrlSuccess(msg.ID, CodeOK, params))
+
+	// Broadcast unpin (seq omitted when all pins were cleared)
+	h.broadcastToConv(ctx, convID, &MsgServerInfo{
+		ConversationID: convID.String(),
+		From:           s.UserID().String(),
+		What:           "unpin",
+		Seq:            pin.Seq,
+		Ts:             now,
+	}, "")
+}
+
+func (h *Handlers) reorderPins(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, pin *MsgClientPin) {
+	if len(pin.Seqs) == 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing seqs"))
+		return
+	}
+
+	if err := h.db.ReorderPinnedMessages(ctx, convID, pin.Seqs); err != nil {
+		if errors.Is(err, store.ErrInvalidPinOrder) {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "seqs must list every pinned message once"))
+			return
+		}
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to reorder"))
+		return
+	}
+
+	now := time.Now().UTC()
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv": convID.String(),
+		"seqs": pin.Seqs,
+	}))
+
+	order, _ := json.Marshal(pin.Seqs)
+	h.broadcastToConv(ctx, convID, &MsgServerInfo{
+		ConversationID: convID.String(),
+		From:           s.UserID().String(),
+		What:           "pins_reordered",
+		Content:        order,
+		Ts:             now,
+	}, "")
+}
+
+// handleGetPins returns a conversation's pinned messages in pin order.
+func (h *Handlers) handleGetPins(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
+	if get.ConversationID == "" {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing conv"))
+		return
+	}
+
+	convID, ok := parseUUID(s, msg.ID, get.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	// Check membership and get clear_seq
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return
+	}
+
+	pins, err := h.db.GetPinnedMessages(ctx, convID, s.UserID(), member.ClearSeq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get pins"))
+		return
+	}
+
+	results := make([]map[string]any, 0, len(pins))
+	for i := range pins {
+		p := &pins[i]
+		item := h.messageItem(&p.Message)
+		item["position"] = p.Position
+		item["pinnedAt"] = p.PinnedAt
+		if p.PinnedBy != nil {
+			item["pinnedBy"] = p.PinnedBy.String()
+		}
+		results = append(results, item)
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv": convID.String(),
+		"pins": results,
+	}))
+}
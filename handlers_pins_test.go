@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func TestHandlePin_LimitReached(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	mockStore := &store.MockStore{
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "dm"}, nil
+		},
+		GetMessageBySeqFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Message, error) {
+			return &store.Message{ID: uuid.New(), ConversationID: cID, Seq: seq}, nil
+		},
+		PinMessageFn: func(ctx context.Context, cID, messageID, pinnedBy uuid.UUID, maxPins int) error {
+			return store.ErrPinLimitReached
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Pin: &MsgClientPin{
+			ConversationID: convID.String(),
+			Action:         "pin",
+			Seq:            4,
+		},
+	}
+
+	h.handlePin(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeConflict {
+		t.Errorf("expected code %d, got %d: %s", CodeConflict, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandlePin_LegacyUnpinAll(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	var cleared bool
+	mockStore := &store.MockStore{
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "dm"}, nil
+		},
+		UnpinAllMessagesFn: func(ctx context.Context, cID uuid.UUID) error {
+			cleared = true
+			return nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID:  "test-1",
+		Pin: &MsgClientPin{ConversationID: convID.String()},
+	}
+
+	h.handlePin(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeOK {
+		t.Errorf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if !cleared {
+		t.Error("expected all pins to be cleared")
+	}
+}
+
+func TestHandlePin_ReorderInvalid(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	mockStore := &store.MockStore{
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room"}, nil
+		},
+		GetMemberRoleFn: func(ctx context.Context, cID, uID uuid.UUID) (string, error) {
+			return "admin", nil
+		},
+		ReorderPinnedMessagesFn: func(ctx context.Context, cID uuid.UUID, seqs []int) error {
+			return store.ErrInvalidPinOrder
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Pin: &MsgClientPin{
+			ConversationID: convID.String(),
+			Action:         "reorder",
+			Seqs:           []int{3, 3},
+		},
+	}
+
+	h.handlePin(sess, msg)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeBadRequest {
+		t.Errorf("expected code %d, got %d: %s", CodeBadRequest, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleGetPins_FiltersForUser(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ClearSeq: 5}, nil
+		},
+		GetPinnedMessagesFn: func(ctx context.Context, cID, uID uuid.UUID, clearSeq int) ([]store.PinnedMessage, error) {
+			// The store applies the requester's visibility
+			if uID != userID || clearSeq != 5 {
+				t.Errorf("GetPinnedMessages(user %s, clearSeq %d), want user %s, clearSeq 5", uID, clearSeq, userID)
+			}
+			return []store.PinnedMessage{
+				{Message: store.Message{ID: uuid.New(), Seq: 8, Content: []byte("a")}, Position: 0},
+			}, nil
+		},
+	}
+
+	h := &Handlers{
+		db:        mockStore,
+		encryptor: encryptor,
+	}
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{
+		ID: "test-1",
+		Get: &MsgClientGet{
+			What:           "pins",
+			ConversationID: convID.String(),
+		},
+	}
+
+	h.handleGetPins(context.Background(), sess, msg, msg.Get)
+
+	resp := sess.LastMessage()
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	pins, _ := resp.Ctrl.Params["pins"].([]map[string]any)
+	if len(pins) != 1 || pins[0]["seq"] != 8 {
+		t.Errorf("expected only seq 8, got %v", resp.Ctrl.Params["pins"])
+	}
+}
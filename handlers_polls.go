@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// HandleVote processes poll votes and close requests.
+func (h *Handlers) HandleVote(s *Session, msg *ClientMessage) {
+	h.handleVote(s, msg)
+}
+
+func (h *Handlers) handleVote(s SessionInterface, msg *ClientMessage) {
+	if !s.RequireAuth(msg.ID) {
+		return
+	}
+
+	vote := msg.Vote
+	if vote == nil || vote.ConversationID == "" || vote.Seq <= 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing vote data"))
+		return
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	convID, ok := parseUUID(s, msg.ID, vote.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	poll := h.memberPoll(ctx, s, msg, convID, vote.Seq)
+	if poll == nil {
+		return
+	}
+
+	if vote.Close {
+		h.closePoll(ctx, s, msg, poll)
+		return
+	}
+
+	// Validate the selection against the poll
+	if len(vote.Options) > 1 && !poll.Multi {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "poll allows one option"))
+		return
+	}
+	seen := make(map[int]bool, len(vote.Options))
+	for _, option := range vote.Options {
+		if option < 0 || option >= poll.Options || seen[option] {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid option"))
+			return
+		}
+		seen[option] = true
+	}
+
+	if err := h.db.CastVote(ctx, poll.MessageID, s.UserID(), vote.Options); err != nil {
+		switch {
+		case errors.Is(err, store.ErrPollClosed):
+			s.Send(CtrlError(msg.ID, CodeConflict, "poll closed"))
+		case errors.Is(err, store.ErrPollNotFound):
+			s.Send(CtrlError(msg.ID, CodeNotFound, "poll not found"))
+		default:
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to vote"))
+		}
+		return
+	}
+
+	results, _, err := h.pollResults(ctx, poll, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+
+	options := vote.Options
+	if options == nil {
+		options = []int{}
+	}
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":    poll.ConversationID.String(),
+		"seq":     poll.Seq,
+		"options": options,
+		"poll":    results,
+	}))
+
+	// Anonymous polls don't reveal who just voted
+	from := s.UserID().String()
+	if poll.Anonymous {
+		from = ""
+	}
+	h.broadcastPollUpdate(ctx, poll, results, from)
+}
+
+func (h *Handlers) closePoll(ctx context.Context, s SessionInterface, msg *ClientMessage, poll *store.Poll) {
+	if poll.CreatedBy == nil || *poll.CreatedBy != s.UserID() {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "only the poll creator can close it"))
+		return
+	}
+
+	if err := h.db.ClosePoll(ctx, poll.MessageID); err != nil {
+		if errors.Is(err, store.ErrPollClosed) {
+			s.Send(CtrlError(msg.ID, CodeConflict, "poll closed"))
+			return
+		}
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to close poll"))
+		return
+	}
+
+	now := time.Now().UTC()
+	poll.ClosedAt = &now
+
+	results, _, err := h.pollResults(ctx, poll, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv": poll.ConversationID.String(),
+		"seq":  poll.Seq,
+		"poll": results,
+	}))
+
+	h.broadcastPollUpdate(ctx, poll, results, s.UserID().String())
+}
+
+// handleGetPoll returns a poll's current results and the caller's own vote.
+func (h *Handlers) handleGetPoll(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
+	if get.ConversationID == "" || get.Seq <= 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing conv or seq"))
+		return
+	}
+
+	convID, ok := parseUUID(s, msg.ID, get.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	poll := h.memberPoll(ctx, s, msg, convID, get.Seq)
+	if poll == nil {
+		return
+	}
+
+	results, mine, err := h.pollResults(ctx, poll, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":    convID.String(),
+		"seq":     poll.Seq,
+		"options": mine,
+		"poll":    results,
+	}))
+}
+
+// memberPoll checks that the user is a member who can see the poll at seq
+// and returns it. On failure it sends an error response and returns nil.
+func (h *Handlers) memberPoll(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, seq int) *store.Poll {
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return nil
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return nil
+	}
+
+	poll, err := h.db.GetPoll(ctx, convID, seq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return nil
+	}
+	if poll == nil || poll.Seq <= member.ClearSeq {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "poll not found"))
+		return nil
+	}
+	return poll
+}
+
+// pollResults tallies a poll's votes. It also returns the options chosen by
+// userID. Voter IDs are left out of the results for anonymous polls.
+func (h *Handlers) pollResults(ctx context.Context, poll *store.Poll, userID uuid.UUID) (*PollResults, []int, error) {
+	votes, err := h.db.GetPollVotes(ctx, poll.MessageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := &PollResults{
+		Counts:   make([]int, poll.Options),
+		Closed:   poll.IsClosed(time.Now().UTC()),
+		ClosesAt: poll.ClosesAt,
+	}
+	if !poll.Anonymous {
+		results.Votes = make([][]string, poll.Options)
+		for i := range results.Votes {
+			results.Votes[i] = []string{}
+		}
+	}
+
+	mine := []int{}
+	voters := make(map[uuid.UUID]bool)
+	for _, v := range votes {
+		if v.Option < 0 || v.Option >= poll.Options {
+			continue
+		}
+		results.Counts[v.Option]++
+		voters[v.UserID] = true
+		if results.Votes != nil {
+			results.Votes[v.Option] = append(results.Votes[v.Option], v.UserID.String())
+		}
+		if v.UserID == userID {
+			mine = append(mine, v.Option)
+		}
+	}
+	results.Voters = len(voters)
+
+	return results, mine, nil
+}
+
+// broadcastPollUpdate sends the latest results to all conversation members.
+func (h *Handlers) broadcastPollUpdate(ctx context.Context, poll *store.Poll, results *PollResults, from string) {
+	h.broadcastToConv(ctx, poll.ConversationID, &MsgServerInfo{
+		ConversationID: poll.ConversationID.String(),
+		From:           from,
+		What:           "poll_updated",
+		Seq:            poll.Seq,
+		Poll:           results,
+		Ts:             time.Now().UTC(),
+	}, "")
+}
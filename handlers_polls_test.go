@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func pollTestStore(convID uuid.UUID, poll *store.Poll, votes []store.PollVote) *store.MockStore {
+	return &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetPollFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Poll, error) {
+			if poll == nil || seq != poll.Seq {
+				return nil, nil
+			}
+			p := *poll
+			return &p, nil
+		},
+		GetPollVotesFn: func(ctx context.Context, messageID uuid.UUID) ([]store.PollVote, error) {
+			return votes, nil
+		},
+	}
+}
+
+func TestHandleVote_AnonymousHidesVoters(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+	convID := uuid.New()
+	poll := &store.Poll{MessageID: uuid.New(), ConversationID: convID, Seq: 3, Options: 3, Anonymous: true}
+
+	var cast []int
+	mockStore := pollTestStore(convID, poll, []store.PollVote{
+		{UserID: userID, Option: 1},
+		{UserID: otherID, Option: 1},
+		{UserID: otherID, Option: 2},
+	})
+	mockStore.CastVoteFn = func(ctx context.Context, messageID, uID uuid.UUID, options []int) error {
+		cast = options
+		return nil
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handleVote(sess, &ClientMessage{
+		ID:   "test-1",
+		Vote: &MsgClientVote{ConversationID: convID.String(), Seq: 3, Options: []int{1}},
+	})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil {
+		t.Fatal("expected ctrl response")
+	}
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if len(cast) != 1 || cast[0] != 1 {
+		t.Errorf("expected vote for option 1, got %v", cast)
+	}
+
+	results := resp.Ctrl.Params["poll"].(*PollResults)
+	if results.Voters != 2 || results.Counts[1] != 2 || results.Counts[2] != 1 {
+		t.Errorf("unexpected tally: %+v", results)
+	}
+	data, _ := json.Marshal(results)
+	for _, id := range []uuid.UUID{userID, otherID} {
+		if strings.Contains(string(data), id.String()) {
+			t.Errorf("anonymous results leak voter %s: %s", id, data)
+		}
+	}
+}
+
+func TestHandleVote_Validation(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	poll := &store.Poll{MessageID: uuid.New(), ConversationID: convID, Seq: 3, Options: 2}
+
+	tests := []struct {
+		name    string
+		options []int
+		want    string
+	}{
+		{"multiple on single choice", []int{0, 1}, "poll allows one option"},
+		{"out of range", []int{2}, "invalid option"},
+		{"negative", []int{-1}, "invalid option"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := pollTestStore(convID, poll, nil)
+			mockStore.CastVoteFn = func(ctx context.Context, messageID, uID uuid.UUID, options []int) error {
+				t.Error("vote should not be recorded")
+				return nil
+			}
+			h := testHandlers(mockStore)
+			sess := newTestSession(userID)
+
+			h.handleVote(sess, &ClientMessage{
+				ID:   "test-1",
+				Vote: &MsgClientVote{ConversationID: convID.String(), Seq: 3, Options: tt.options},
+			})
+
+			resp := sess.LastMessage()
+			if resp.Ctrl.Code != CodeBadRequest || resp.Ctrl.Text != tt.want {
+				t.Errorf("expected 400 %q, got %d %q", tt.want, resp.Ctrl.Code, resp.Ctrl.Text)
+			}
+		})
+	}
+}
+
+func TestHandleVote_Closed(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	poll := &store.Poll{MessageID: uuid.New(), ConversationID: convID, Seq: 3, Options: 2}
+
+	mockStore := pollTestStore(convID, poll, nil)
+	mockStore.CastVoteFn = func(ctx context.Context, messageID, uID uuid.UUID, options []int) error {
+		return store.ErrPollClosed
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handleVote(sess, &ClientMessage{
+		ID:   "test-1",
+		Vote: &MsgClientVote{ConversationID: convID.String(), Seq: 3, Options: []int{0}},
+	})
+
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeConflict {
+		t.Errorf("expected code %d, got %d: %s", CodeConflict, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleVote_CloseByCreatorOnly(t *testing.T) {
+	creatorID := uuid.New()
+	convID := uuid.New()
+	poll := &store.Poll{MessageID: uuid.New(), ConversationID: convID, Seq: 3, Options: 2, CreatedBy: &creatorID}
+
+	var closed bool
+	mockStore := pollTestStore(convID, poll, nil)
+	mockStore.ClosePollFn = func(ctx context.Context, messageID uuid.UUID) error {
+		closed = true
+		return nil
+	}
+	h := testHandlers(mockStore)
+
+	// Another member can't close it
+	sess := newTestSession(uuid.New())
+	h.handleVote(sess, &ClientMessage{
+		ID:   "test-1",
+		Vote: &MsgClientVote{ConversationID: convID.String(), Seq: 3, Close: true},
+	})
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeForbidden {
+		t.Errorf("expected code %d, got %d: %s", CodeForbidden, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if closed {
+		t.Fatal("poll closed by non-creator")
+	}
+
+	// The creator can
+	sess = newTestSession(creatorID)
+	h.handleVote(sess, &ClientMessage{
+		ID:   "test-2",
+		Vote: &MsgClientVote{ConversationID: convID.String(), Seq: 3, Close: true},
+	})
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if !closed || !resp.Ctrl.Params["poll"].(*PollResults).Closed {
+		t.Error("expected poll to be closed")
+	}
+}
+
+func TestHandleSend_Poll(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	var created *store.Poll
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room"}, nil
+		},
+		CreatePollMessageFn: func(ctx context.Context, cID, fromUserID uuid.UUID, content []byte, head json.RawMessage, poll *store.Poll) (*store.Message, error) {
+			created = poll
+			return &store.Message{ID: uuid.New(), ConversationID: cID, Seq: 5}, nil
+		},
+	}
+	h := &Handlers{db: mockStore, encryptor: encryptor}
+
+	closesAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	content := `{"v":2,"poll":{"question":"Lunch?","options":[{"text":"Yes"},{"text":"No"}],"anonymous":true,"closesAt":"` + closesAt + `"}}`
+
+	sess := newTestSession(userID)
+	h.handleSend(sess, &ClientMessage{
+		ID:   "test-1",
+		Send: &MsgClientSend{ConversationID: convID.String(), Content: json.RawMessage(content)},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if created == nil || created.Options != 2 || !created.Anonymous || created.ClosesAt == nil {
+		t.Errorf("unexpected poll: %+v", created)
+	}
+
+	// Deadlines in the past are rejected
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	content = `{"v":2,"poll":{"question":"Lunch?","options":[{"text":"Yes"},{"text":"No"}],"closesAt":"` + past + `"}}`
+	h.handleSend(sess, &ClientMessage{
+		ID:   "test-2",
+		Send: &MsgClientSend{ConversationID: convID.String(), Content: json.RawMessage(content)},
+	})
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeBadRequest {
+		t.Errorf("expected code %d, got %d: %s", CodeBadRequest, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+const (
+	// maxStatusLength is the longest custom status, in characters.
+	maxStatusLength = 140
+	// maxStatusTTL is the longest a custom status can be set to last.
+	maxStatusTTL = 30 * 24 * time.Hour
+	// maxPresenceExceptions caps the presence privacy exceptions list.
+	maxPresenceExceptions = 100
+	// maxPresenceProbe caps the users one probe can ask about.
+	maxPresenceProbe = 100
+)
+
+// HandlePres processes presence updates.
+func (h *Handlers) HandlePres(s *Session, msg *ClientMessage) {
+	h.handlePres(s, msg)
+}
+
+func (h *Handlers) handlePres(s SessionInterface, msg *ClientMessage) {
+	if !s.RequireAuth(msg.ID) {
+		return
+	}
+
+	pres := msg.Pres
+	update := pres.State != "" || pres.Status != nil || pres.Idle != nil
+	subs := pres.Probe != nil || pres.Sub != nil || pres.Unsub != nil
+	if !update && !subs {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing presence"))
+		return
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	if subs {
+		if !h.handlePresSubs(ctx, s, msg) {
+			return
+		}
+		if !update {
+			s.Send(CtrlSuccess(msg.ID, CodeOK, h.presenceSubsResponse(s)))
+			return
+		}
+	}
+
+	if pres.Idle != nil {
+		if sess, ok := s.(*Session); ok {
+			sess.SetIdle(*pres.Idle)
+			if h.hub != nil && h.hub.presence != nil {
+				h.hub.presence.RefreshIdle(s.UserID())
+			}
+		}
+		if pres.State == "" && pres.Status == nil {
+			s.Send(CtrlSuccess(msg.ID, CodeOK, nil))
+			return
+		}
+	}
+
+	user, err := h.db.GetUserByID(ctx, s.UserID())
+	if err != nil || user == nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+
+	var chosen store.Presence
+	if user.Presence != nil {
+		chosen = *user.Presence
+	}
+	if err := applyPresence(&chosen, pres, time.Now().UTC()); err != nil {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, err.Error()))
+		return
+	}
+
+	var stored *store.Presence
+	if chosen != (store.Presence{}) {
+		stored = &chosen
+	}
+	if err := h.db.UpdateUserPresence(ctx, s.UserID(), stored); err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update presence"))
+		return
+	}
+
+	if h.hub != nil && h.hub.presence != nil {
+		h.hub.presence.SetPresence(s.UserID(), chosen)
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, presenceResponse(&chosen)))
+}
+
+// handlePresSubs handles the probe and subscription parts of a presence
+// request. Everything is validated before any subscription changes.
+func (h *Handlers) handlePresSubs(ctx context.Context, s SessionInterface, msg *ClientMessage) bool {
+	pres := msg.Pres
+	if h.hub == nil || h.hub.presence == nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "presence unavailable"))
+		return false
+	}
+	if len(pres.Probe) > maxPresenceProbe {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "too many users to probe"))
+		return false
+	}
+
+	probe, ok := parseUUIDs(s, msg.ID, pres.Probe, "user id")
+	if !ok {
+		return false
+	}
+	var sub, unsub presenceTargets
+	if pres.Sub != nil {
+		if sub, ok = parsePresenceTargets(s, msg.ID, pres.Sub); !ok {
+			return false
+		}
+		// Conversation members are only followed from inside
+		for _, convID := range sub.convs {
+			if !h.requireMember(ctx, s, msg.ID, convID) {
+				return false
+			}
+		}
+	}
+	if pres.Unsub != nil {
+		if unsub, ok = parsePresenceTargets(s, msg.ID, pres.Unsub); !ok {
+			return false
+		}
+	}
+
+	// Strangers can't be followed; they are dropped like unknown users
+	presence := h.hub.presence
+	sub.users = presence.related(ctx, s.UserID(), sub.users)
+	if pres.Unsub != nil {
+		presence.Unsubscribe(s.ID(), unsub.users, unsub.convs)
+	}
+	if pres.Sub != nil {
+		if err := presence.Subscribe(s.ID(), sub.users, sub.convs); err != nil {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, err.Error()))
+			return false
+		}
+	}
+	if len(probe) > 0 {
+		presence.SendPresenceProbe(s, probe)
+	}
+	return true
+}
+
+// presenceTargets is a parsed MsgPresenceTargets.
+type presenceTargets struct {
+	users, convs []uuid.UUID
+}
+
+func parsePresenceTargets(s SessionInterface, msgID string, m *MsgPresenceTargets) (presenceTargets, bool) {
+	var t presenceTargets
+	var ok bool
+	if t.users, ok = parseUUIDs(s, msgID, m.Users, "user id"); !ok {
+		return t, false
+	}
+	if t.convs, ok = parseUUIDs(s, msgID, m.Convs, "conv id"); !ok {
+		return t, false
+	}
+	if len(t.users)+len(t.convs) > maxPresenceSubs {
+		s.Send(CtrlError(msgID, CodeBadRequest, errTooManyPresenceSubs.Error()))
+		return t, false
+	}
+	return t, true
+}
+
+// parseUUIDs parses a list of IDs, sending an error response for the first
+// invalid one. Duplicates are dropped.
+func parseUUIDs(s SessionInterface, msgID string, raw []string, field string) ([]uuid.UUID, bool) {
+	var ids []uuid.UUID
+	for _, r := range raw {
+		id, ok := parseUUID(s, msgID, r, field)
+		if !ok {
+			return nil, false
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, true
+}
+
+// presenceSubsResponse returns a session's explicit presence subscriptions,
+// or nil if it follows everyone it shares a conversation with.
+func (h *Handlers) presenceSubsResponse(s SessionInterface) map[string]any {
+	users, convs, explicit := h.hub.presence.Subscriptions(s.ID())
+	if !explicit {
+		return nil
+	}
+	userStrs := make([]string, len(users))
+	for i, id := range users {
+		userStrs[i] = id.String()
+	}
+	convStrs := make([]string, len(convs))
+	for i, id := range convs {
+		convStrs[i] = id.String()
+	}
+	slices.Sort(userStrs)
+	slices.Sort(convStrs)
+	return map[string]any{"users": userStrs, "convs": convStrs}
+}
+
+// applyPresence applies a client's presence update to the chosen presence.
+func applyPresence(chosen *store.Presence, pres *MsgClientPres, now time.Time) error {
+	switch pres.State {
+	case "":
+	case presAvailable:
+		chosen.State = ""
+	case presAway, presBusy, presDND, presInvisible:
+		chosen.State = pres.State
+	default:
+		return errors.New("invalid state")
+	}
+
+	ttl := time.Duration(pres.StatusTTL) * time.Second
+	if pres.StatusTTL < 0 || ttl > maxStatusTTL {
+		return errors.New("invalid status ttl")
+	}
+
+	if pres.Status == nil {
+		if pres.StatusTTL != 0 {
+			return errors.New("missing status")
+		}
+		// Drop a status that has run out
+		if chosen.StatusExpires != nil && !now.Before(*chosen.StatusExpires) {
+			chosen.Status, chosen.StatusExpires = "", nil
+		}
+		return nil
+	}
+
+	status := strings.TrimSpace(*pres.Status)
+	if utf8.RuneCountInString(status) > maxStatusLength {
+		return errors.New("status too long")
+	}
+	chosen.Status, chosen.StatusExpires = status, nil
+	if status != "" && ttl > 0 {
+		expires := now.Add(ttl)
+		chosen.StatusExpires = &expires
+	}
+	return nil
+}
+
+// presenceResponse returns the chosen presence in client form.
+func presenceResponse(chosen *store.Presence) map[string]any {
+	state := chosen.State
+	if state == "" {
+		state = presAvailable
+	}
+	resp := map[string]any{"state": state}
+	if status, expires := activeStatus(chosen, time.Now()); status != "" {
+		resp["status"] = status
+		if expires != nil {
+			resp["statusExpires"] = expires
+		}
+	}
+	return resp
+}
+
+// presenceAudience returns which of userIDs' presence the viewer may see.
+func (h *Handlers) presenceAudience(ctx context.Context, viewer uuid.UUID, userIDs []uuid.UUID) map[uuid.UUID]bool {
+	return presenceAudience(ctx, h.db, viewer, userIDs)
+}
+
+// presenceJoined tells the presence graph users joined a conversation.
+func (h *Handlers) presenceJoined(convID uuid.UUID, userIDs ...uuid.UUID) {
+	if h.hub != nil && h.hub.presence != nil {
+		h.hub.presence.ConversationJoined(convID, userIDs...)
+	}
+}
+
+// presenceLeft tells the presence graph a user left a conversation.
+func (h *Handlers) presenceLeft(convID, userID uuid.UUID) {
+	if h.hub != nil && h.hub.presence != nil {
+		h.hub.presence.ConversationLeft(convID, userID)
+	}
+}
+
+// presenceChanged tells the presence graph users' blocks or contacts changed.
+func (h *Handlers) presenceChanged(userIDs ...uuid.UUID) {
+	if h.hub != nil && h.hub.presence != nil {
+		h.hub.presence.RelationsChanged(userIDs...)
+	}
+}
+
+// userPresence adds a user's presence to a response item: online and
+// lastSeen, plus the state and custom status when set. When the viewer may
+// not see it (visible from presenceAudience) only the custom status is shown.
+func (h *Handlers) userPresence(ctx context.Context, item map[string]any, user *store.User, visible bool) {
+	var pres *MsgServerPres
+	switch {
+	case !visible:
+		pres = offlinePres(user.ID, user.Presence, nil)
+	case h.hub != nil && h.hub.presence != nil:
+		pres = h.hub.presence.presenceOf(ctx, user)
+	default:
+		pres = offlinePres(user.ID, user.Presence, user.LastSeen)
+	}
+
+	item["online"] = pres.What == "on"
+	if visible {
+		item["lastSeen"] = user.LastSeen
+	}
+	if pres.State != "" {
+		item["state"] = pres.State
+	}
+	if pres.Status != "" {
+		item["status"] = pres.Status
+		if pres.StatusExpires != nil {
+			item["statusExpires"] = pres.StatusExpires
+		}
+	}
+}
+
+// parsePresencePrivacy converts an account request's presence privacy to
+// the stored form. Everyone with no exceptions is stored as nil.
+func parsePresencePrivacy(m *MsgPresencePrivacy, self uuid.UUID) (*store.PresencePrivacy, error) {
+	level := m.Level
+	switch level {
+	case "":
+		level = store.PresenceEveryone
+	case store.PresenceEveryone, store.PresenceContacts, store.PresenceNobody:
+	default:
+		return nil, errors.New("invalid presence privacy level")
+	}
+	if len(m.Exceptions) > maxPresenceExceptions {
+		return nil, errors.New("too many presence exceptions")
+	}
+
+	var exceptions []uuid.UUID
+	for _, raw := range m.Exceptions {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, errors.New("invalid exception user id")
+		}
+		if id != self && !slices.Contains(exceptions, id) {
+			exceptions = append(exceptions, id)
+		}
+	}
+
+	if level == store.PresenceEveryone && len(exceptions) == 0 {
+		return nil, nil
+	}
+	return &store.PresencePrivacy{Level: level, Exceptions: exceptions}, nil
+}
+
+// presencePrivacyResponse formats stored presence privacy for clients.
+func presencePrivacyResponse(privacy *store.PresencePrivacy) map[string]any {
+	if privacy == nil {
+		return map[string]any{"level": store.PresenceEveryone}
+	}
+	exceptions := make([]string, len(privacy.Exceptions))
+	for i, id := range privacy.Exceptions {
+		exceptions[i] = id.String()
+	}
+	return map[string]any{"level": privacy.Level, "exceptions": exceptions}
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestApplyPresence(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		chosen  store.Presence
+		pres    MsgClientPres
+		want    store.Presence
+		wantErr string
+	}{
+		{"set dnd", store.Presence{}, MsgClientPres{State: presDND}, store.Presence{State: presDND}, ""},
+		{"available clears state", store.Presence{State: presBusy}, MsgClientPres{State: presAvailable}, store.Presence{}, ""},
+		{"state keeps status", store.Presence{Status: "lunch"}, MsgClientPres{State: presAway}, store.Presence{State: presAway, Status: "lunch"}, ""},
+		{"status trimmed", store.Presence{}, MsgClientPres{Status: strPtr("  on call ")}, store.Presence{Status: "on call"}, ""},
+		{"expired status dropped", store.Presence{Status: "old", StatusExpires: &past}, MsgClientPres{State: presBusy}, store.Presence{State: presBusy}, ""},
+		{"unknown state", store.Presence{}, MsgClientPres{State: "asleep"}, store.Presence{}, "invalid state"},
+		{"negative ttl", store.Presence{}, MsgClientPres{Status: strPtr("x"), StatusTTL: -1}, store.Presence{}, "invalid status ttl"},
+		{"ttl without status", store.Presence{}, MsgClientPres{State: presBusy, StatusTTL: 60}, store.Presence{}, "missing status"},
+		{"status too long", store.Presence{}, MsgClientPres{Status: strPtr(strings.Repeat("é", maxStatusLength+1))}, store.Presence{}, "status too long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chosen := tt.chosen
+			err := applyPresence(&chosen, &tt.pres, now)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chosen != tt.want {
+				t.Errorf("got %+v, want %+v", chosen, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPresence_StatusTTL(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var chosen store.Presence
+	if err := applyPresence(&chosen, &MsgClientPres{Status: strPtr("in a meeting"), StatusTTL: 3600}, now); err != nil {
+		t.Fatal(err)
+	}
+	if chosen.StatusExpires == nil || !chosen.StatusExpires.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected expiry %v", chosen.StatusExpires)
+	}
+	if status, _ := activeStatus(&chosen, now.Add(2*time.Hour)); status != "" {
+		t.Errorf("expected the status to have expired, got %q", status)
+	}
+}
+
+func TestHandlePres_SetState(t *testing.T) {
+	userID := uuid.New()
+
+	var saved *store.Presence
+	mockStore := &store.MockStore{
+		GetUserByIDFn: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			return &store.User{ID: id, Presence: &store.Presence{Status: "lunch"}}, nil
+		},
+		UpdateUserPresenceFn: func(ctx context.Context, uID uuid.UUID, presence *store.Presence) error {
+			saved = presence
+			return nil
+		},
+	}
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handlePres(sess, &ClientMessage{ID: "1", Pres: &MsgClientPres{State: presDND}})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected OK, got %+v", resp.Ctrl)
+	}
+	if saved == nil || saved.State != presDND || saved.Status != "lunch" {
+		t.Errorf("unexpected saved presence %+v", saved)
+	}
+	if resp.Ctrl.Params["state"] != presDND || resp.Ctrl.Params["status"] != "lunch" {
+		t.Errorf("unexpected params %v", resp.Ctrl.Params)
+	}
+}
+
+func TestHandlePres_ResetToAvailable(t *testing.T) {
+	userID := uuid.New()
+
+	saved := &store.Presence{}
+	mockStore := &store.MockStore{
+		GetUserByIDFn: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			return &store.User{ID: id, Presence: &store.Presence{State: presBusy}}, nil
+		},
+		UpdateUserPresenceFn: func(ctx context.Context, uID uuid.UUID, presence *store.Presence) error {
+			saved = presence
+			return nil
+		},
+	}
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handlePres(sess, &ClientMessage{ID: "1", Pres: &MsgClientPres{State: presAvailable}})
+
+	if saved != nil {
+		t.Errorf("expected the presence to be reset, got %+v", saved)
+	}
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil || resp.Ctrl.Params["state"] != presAvailable {
+		t.Errorf("unexpected response %+v", resp.Ctrl)
+	}
+}
+
+func TestHandlePres_Errors(t *testing.T) {
+	mockStore := &store.MockStore{
+		GetUserByIDFn: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			return &store.User{ID: id}, nil
+		},
+		UpdateUserPresenceFn: func(ctx context.Context, uID uuid.UUID, presence *store.Presence) error {
+			t.Error("presence should not be saved")
+			return nil
+		},
+	}
+	h := testHandlers(mockStore)
+
+	tests := []struct {
+		name string
+		pres *MsgClientPres
+		want string
+	}{
+		{"empty", &MsgClientPres{}, "missing presence"},
+		{"bad state", &MsgClientPres{State: "online"}, "invalid state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := newTestSession(uuid.New())
+			h.handlePres(sess, &ClientMessage{ID: "1", Pres: tt.pres})
+			resp := sess.LastMessage()
+			if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != CodeBadRequest || resp.Ctrl.Text != tt.want {
+				t.Errorf("expected %q, got %+v", tt.want, resp.Ctrl)
+			}
+		})
+	}
+}
+
+// presenceFixture is a hub with two users sharing a conversation, and a
+// presence manager without Redis.
+type presenceFixture struct {
+	hub        *Hub
+	db         *store.MockStore
+	presence   *PresenceManager
+	alice, bob uuid.UUID
+	convID     uuid.UUID
+	bobSess    *Session
+	chosen     *store.Presence
+	// Alice's presence privacy and whether she has Bob as a contact
+	privacy *store.PresencePrivacy
+	contact bool
+	// Alice's contacts she shares no conversation with
+	strangers []uuid.UUID
+}
+
+func newPresenceFixture(t *testing.T) *presenceFixture {
+	t.Helper()
+	f := &presenceFixture{hub: NewHub(), alice: uuid.New(), bob: uuid.New(), convID: uuid.New()}
+	convID := f.convID
+
+	f.db = &store.MockStore{
+		GetUserByIDFn: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			user := &store.User{ID: id}
+			if id == f.alice {
+				user.Presence = f.chosen
+			}
+			return user, nil
+		},
+		GetPresenceNodeFn: func(ctx context.Context, userID uuid.UUID) (*store.PresenceNode, error) {
+			node := &store.PresenceNode{}
+			if userID == f.alice || userID == f.bob {
+				node.Conversations = []uuid.UUID{convID}
+			}
+			if userID == f.alice {
+				node.Privacy = f.privacy
+				if f.contact {
+					node.Contacts = []uuid.UUID{f.bob}
+				}
+				node.Contacts = append(node.Contacts, f.strangers...)
+			}
+			return node, nil
+		},
+		GetConversationMembersFn: func(ctx context.Context, cID uuid.UUID) ([]uuid.UUID, error) {
+			return []uuid.UUID{f.alice, f.bob}, nil
+		},
+		IsMemberFn: func(ctx context.Context, cID, userID uuid.UUID) (bool, error) {
+			return cID == convID && (userID == f.alice || userID == f.bob), nil
+		},
+		GetPresencePeersFn: func(ctx context.Context, userID uuid.UUID, others []uuid.UUID) (map[uuid.UUID]store.PresencePeer, error) {
+			peers := map[uuid.UUID]store.PresencePeer{}
+			for _, id := range others {
+				switch {
+				case id == f.alice && userID == f.bob:
+					peers[id] = store.PresencePeer{Privacy: f.privacy, ContactOf: f.contact}
+				case id == f.alice:
+					peers[id] = store.PresencePeer{Privacy: f.privacy}
+				case id == f.bob && userID == f.alice:
+					peers[id] = store.PresencePeer{IsContact: f.contact}
+				default:
+					peers[id] = store.PresencePeer{}
+				}
+			}
+			return peers, nil
+		},
+	}
+	f.presence = NewPresenceManager(f.hub, f.db)
+	f.hub.SetPresence(f.presence)
+	f.bobSess = f.connect(f.bob)
+	return f
+}
+
+// connect adds a session for the user straight to the hub.
+func (f *presenceFixture) connect(userID uuid.UUID) *Session {
+	sess := &Session{id: uuid.New().String(), send: make(chan *ServerMessage, sendBufferSize)}
+	sess.SetUserID(userID)
+	f.hub.mu.Lock()
+	f.hub.sessions[sess.id] = sess
+	f.hub.userSessions[userID] = append(f.hub.userSessions[userID], sess)
+	f.hub.online[userID] = true
+	f.hub.mu.Unlock()
+	return sess
+}
+
+// nextPres returns the next presence notification queued for sess, or nil.
+func nextPres(sess *Session) *MsgServerPres {
+	select {
+	case msg := <-sess.send:
+		return msg.Pres
+	default:
+		return nil
+	}
+}
+
+func TestPresenceManager_Invisible(t *testing.T) {
+	f := newPresenceFixture(t)
+	f.connect(f.alice)
+	f.presence.UserOnline(f.alice)
+	if pres := nextPres(f.bobSess); pres == nil || pres.What != "on" || pres.State != presAvailable {
+		t.Fatalf("expected alice online, got %+v", pres)
+	}
+
+	f.chosen = &store.Presence{State: presInvisible}
+	f.presence.SetPresence(f.alice, *f.chosen)
+	pres := nextPres(f.bobSess)
+	if pres == nil || pres.What != "off" || pres.LastSeen == nil || pres.State != "" {
+		t.Fatalf("expected alice to look offline, got %+v", pres)
+	}
+
+	user, _ := f.presence.db.GetUserByID(context.Background(), f.alice)
+	if pres := f.presence.presenceOf(context.Background(), user); pres.What != "off" {
+		t.Errorf("expected an invisible user to probe as offline, got %+v", pres)
+	}
+
+	// Disconnecting while invisible says nothing more
+	f.presence.UserOffline(f.alice)
+	if pres := nextPres(f.bobSess); pres != nil {
+		t.Errorf("expected no notification, got %+v", pres)
+	}
+}
+
+func TestPresenceManager_IdleAway(t *testing.T) {
+	f := newPresenceFixture(t)
+	phone := f.connect(f.alice)
+	desktop := f.connect(f.alice)
+	f.presence.UserOnline(f.alice)
+	nextPres(f.bobSess)
+
+	phone.SetIdle(true)
+	f.presence.RefreshIdle(f.alice)
+	if pres := nextPres(f.bobSess); pres != nil {
+		t.Fatalf("expected no change while a session is active, got %+v", pres)
+	}
+
+	desktop.SetIdle(true)
+	f.presence.RefreshIdle(f.alice)
+	if pres := nextPres(f.bobSess); pres == nil || pres.State != presAway {
+		t.Fatalf("expected away, got %+v", pres)
+	}
+
+	desktop.SetIdle(false)
+	f.presence.RefreshIdle(f.alice)
+	if pres := nextPres(f.bobSess); pres == nil || pres.State != presAvailable {
+		t.Fatalf("expected available, got %+v", pres)
+	}
+}
+
+func TestPresenceManager_IdleKeepsChosenState(t *testing.T) {
+	f := newPresenceFixture(t)
+	f.chosen = &store.Presence{State: presDND, Status: "focusing"}
+	phone := f.connect(f.alice)
+	f.presence.UserOnline(f.alice)
+	if pres := nextPres(f.bobSess); pres == nil || pres.State != presDND || pres.Status != "focusing" {
+		t.Fatalf("expected dnd with status, got %+v", pres)
+	}
+
+	phone.SetIdle(true)
+	f.presence.RefreshIdle(f.alice)
+	if pres := nextPres(f.bobSess); pres != nil {
+		t.Errorf("expected idleness to stay hidden behind dnd, got %+v", pres)
+	}
+}
+
+func TestPresenceManager_PrivacyHidesPresence(t *testing.T) {
+	f := newPresenceFixture(t)
+	f.privacy = &store.PresencePrivacy{Level: store.PresenceContacts}
+	f.connect(f.alice)
+	f.presence.UserOnline(f.alice)
+	if pres := nextPres(f.bobSess); pres != nil {
+		t.Fatalf("expected nothing for a non-contact, got %+v", pres)
+	}
+
+	// Once Bob is her contact he is told she is online
+	f.contact = true
+	f.presence.PrivacyChanged(f.alice)
+	if pres := nextPres(f.bobSess); pres == nil || pres.What != "on" {
+		t.Fatalf("expected alice online, got %+v", pres)
+	}
+
+	// Hiding again tells Bob she is offline, without a last seen time
+	f.privacy = &store.PresencePrivacy{Level: store.PresenceNobody}
+	f.presence.PrivacyChanged(f.alice)
+	if pres := nextPres(f.bobSess); pres == nil || pres.What != "off" || pres.LastSeen != nil {
+		t.Fatalf("expected alice offline with no last seen, got %+v", pres)
+	}
+
+	f.presence.UserOffline(f.alice)
+	if pres := nextPres(f.bobSess); pres != nil {
+		t.Errorf("expected nothing on disconnect, got %+v", pres)
+	}
+}
+
+func TestPresenceManager_Subscriptions(t *testing.T) {
+	f := newPresenceFixture(t)
+	f.connect(f.alice)
+	otherConv := uuid.New()
+
+	// Following another conversation only hides Alice
+	if err := f.presence.Subscribe(f.bobSess.ID(), nil, []uuid.UUID{otherConv}); err != nil {
+		t.Fatal(err)
+	}
+	f.presence.UserOnline(f.alice)
+	if pres := nextPres(f.bobSess); pres != nil {
+		t.Fatalf("expected nothing for an unfollowed user, got %+v", pres)
+	}
+
+	// Following their shared conversation brings her back
+	f.presence.Subscribe(f.bobSess.ID(), nil, []uuid.UUID{f.convID})
+	f.presence.SetPresence(f.alice, store.Presence{State: presBusy})
+	if pres := nextPres(f.bobSess); pres == nil || pres.State != presBusy {
+		t.Fatalf("expected busy, got %+v", pres)
+	}
+
+	// Carol is Alice's contact but shares no conversation; she follows her by name
+	carol := uuid.New()
+	carolSess := f.connect(carol)
+	f.strangers = []uuid.UUID{carol}
+	f.presence.RelationsChanged(f.alice, carol)
+	f.presence.Subscribe(carolSess.ID(), []uuid.UUID{f.alice}, nil)
+	f.presence.SetPresence(f.alice, store.Presence{})
+	if pres := nextPres(carolSess); pres == nil || pres.State != presAvailable {
+		t.Fatalf("expected carol to see alice, got %+v", pres)
+	}
+
+	// Privacy still applies to followers by name
+	f.privacy = &store.PresencePrivacy{Level: store.PresenceNobody}
+	f.presence.PrivacyChanged(f.alice)
+	if pres := nextPres(carolSess); pres == nil || pres.What != "off" {
+		t.Fatalf("expected alice to look offline to carol, got %+v", pres)
+	}
+
+	// Once Alice removes her as a contact, Carol gets nothing more
+	f.privacy = nil
+	f.presence.PrivacyChanged(f.alice)
+	nextPres(carolSess)
+	f.strangers = nil
+	f.presence.RelationsChanged(f.alice, carol)
+	f.presence.SetPresence(f.alice, store.Presence{State: presAway})
+	if pres := nextPres(carolSess); pres != nil {
+		t.Fatalf("expected nothing for a former contact, got %+v", pres)
+	}
+
+	f.presence.Unsubscribe(carolSess.ID(), []uuid.UUID{f.alice}, nil)
+	f.presence.SessionClosed(f.bobSess.ID())
+	if len(f.presence.watchers) != 0 || len(f.presence.subs) != 1 {
+		t.Errorf("expected only carol's empty subscriptions, got %d watchers and %d sessions",
+			len(f.presence.watchers), len(f.presence.subs))
+	}
+}
+
+func TestHandlePres_Subscribe(t *testing.T) {
+	f := newPresenceFixture(t)
+	h := testHandlers(f.db)
+	h.hub = f.hub
+	sess := newTestSession(f.bob)
+
+	h.handlePres(sess, &ClientMessage{ID: "1", Pres: &MsgClientPres{
+		Probe: []string{f.alice.String()},
+		Sub:   &MsgPresenceTargets{Users: []string{f.alice.String()}, Convs: []string{f.convID.String()}},
+	}})
+	if len(sess.messages) != 2 || sess.messages[0].Pres == nil || sess.messages[0].Pres.What != "off" {
+		t.Fatalf("expected a probe result then a reply, got %+v", sess.messages)
+	}
+	resp := sess.LastMessage()
+	if resp.Ctrl == nil || resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected OK, got %+v", resp.Ctrl)
+	}
+	users := resp.Ctrl.Params["users"].([]string)
+	convs := resp.Ctrl.Params["convs"].([]string)
+	if len(users) != 1 || users[0] != f.alice.String() || len(convs) != 1 || convs[0] != f.convID.String() {
+		t.Errorf("unexpected subscriptions %v", resp.Ctrl.Params)
+	}
+
+	h.handlePres(sess, &ClientMessage{ID: "2", Pres: &MsgClientPres{
+		Unsub: &MsgPresenceTargets{Users: []string{f.alice.String()}},
+	}})
+	if users := sess.LastMessage().Ctrl.Params["users"].([]string); len(users) != 0 {
+		t.Errorf("expected alice unsubscribed, got %v", users)
+	}
+}
+
+func TestHandlePres_StrangersHidden(t *testing.T) {
+	f := newPresenceFixture(t)
+	h := testHandlers(f.db)
+	h.hub = f.hub
+	f.connect(f.alice)
+	f.presence.UserOnline(f.alice)
+	sess := newTestSession(uuid.New())
+
+	h.handlePres(sess, &ClientMessage{ID: "1", Pres: &MsgClientPres{
+		Probe: []string{f.alice.String(), uuid.NewString()},
+		Sub:   &MsgPresenceTargets{Users: []string{f.alice.String()}},
+	}})
+	if len(sess.messages) != 1 {
+		t.Fatalf("expected only a reply, got %+v", sess.messages)
+	}
+	resp := sess.LastMessage()
+	if resp.Ctrl == nil || resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected OK, got %+v", resp.Ctrl)
+	}
+	if users := resp.Ctrl.Params["users"].([]string); len(users) != 0 {
+		t.Errorf("expected a stranger not to be followed, got %v", users)
+	}
+	if len(f.presence.watching(f.alice)) != 0 {
+		t.Error("expected no watchers for alice")
+	}
+}
+
+func TestHandlePres_SubscribeErrors(t *testing.T) {
+	f := newPresenceFixture(t)
+	h := testHandlers(f.db)
+	h.hub = f.hub
+
+	tooMany := make([]string, maxPresenceProbe+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.NewString()
+	}
+	tests := []struct {
+		name string
+		pres *MsgClientPres
+		code int
+		want string
+	}{
+		{"bad probe id", &MsgClientPres{Probe: []string{"nope"}}, CodeBadRequest, "invalid user id"},
+		{"probe too big", &MsgClientPres{Probe: tooMany}, CodeBadRequest, "too many users to probe"},
+		{"bad conv id", &MsgClientPres{Sub: &MsgPresenceTargets{Convs: []string{"nope"}}}, CodeBadRequest, "invalid conv id"},
+		{"foreign conv", &MsgClientPres{Sub: &MsgPresenceTargets{Convs: []string{uuid.NewString()}}}, CodeForbidden, "not a member"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := newTestSession(f.bob)
+			h.handlePres(sess, &ClientMessage{ID: "1", Pres: tt.pres})
+			resp := sess.LastMessage()
+			if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != tt.code || resp.Ctrl.Text != tt.want {
+				t.Errorf("expected %q, got %+v", tt.want, resp)
+			}
+			if _, _, explicit := f.presence.Subscriptions(sess.ID()); explicit {
+				t.Error("expected no subscriptions after an error")
+			}
+		})
+	}
+}
+
+func TestPresenceAllows(t *testing.T) {
+	other := uuid.New()
+	tests := []struct {
+		name      string
+		privacy   *store.PresencePrivacy
+		isContact bool
+		want      bool
+	}{
+		{"default", nil, false, true},
+		{"everyone", &store.PresencePrivacy{Level: store.PresenceEveryone}, false, true},
+		{"everyone except", &store.PresencePrivacy{Level: store.PresenceEveryone, Exceptions: []uuid.UUID{other}}, true, false},
+		{"contacts, contact", &store.PresencePrivacy{Level: store.PresenceContacts}, true, true},
+		{"contacts, stranger", &store.PresencePrivacy{Level: store.PresenceContacts}, false, false},
+		{"contacts except", &store.PresencePrivacy{Level: store.PresenceContacts, Exceptions: []uuid.UUID{other}}, true, false},
+		{"contacts plus", &store.PresencePrivacy{Level: store.PresenceContacts, Exceptions: []uuid.UUID{other}}, false, true},
+		{"nobody", &store.PresencePrivacy{Level: store.PresenceNobody}, true, false},
+		{"nobody but", &store.PresencePrivacy{Level: store.PresenceNobody, Exceptions: []uuid.UUID{other}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := presenceAllows(tt.privacy, other, tt.isContact); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresenceAudience_Reciprocal(t *testing.T) {
+	viewer, open, hidden := uuid.New(), uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		ownPrivacy *store.PresencePrivacy
+		want       map[uuid.UUID]bool
+	}{
+		{"sharing", nil, map[uuid.UUID]bool{open: true, hidden: false}},
+		{"hiding", &store.PresencePrivacy{Level: store.PresenceNobody}, map[uuid.UUID]bool{open: false, hidden: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &store.MockStore{
+				GetPresencePeersFn: func(ctx context.Context, userID uuid.UUID, others []uuid.UUID) (map[uuid.UUID]store.PresencePeer, error) {
+					return map[uuid.UUID]store.PresencePeer{
+						viewer: {Privacy: tt.ownPrivacy},
+						open:   {},
+						hidden: {Privacy: &store.PresencePrivacy{Level: store.PresenceNobody}},
+					}, nil
+				},
+			}
+			got := presenceAudience(context.Background(), mockStore, viewer, []uuid.UUID{viewer, open, hidden})
+			if !got[viewer] {
+				t.Error("expected users to see themselves")
+			}
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("visible[%s] = %v, want %v", id, got[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePresencePrivacy(t *testing.T) {
+	self, other := uuid.New(), uuid.New()
+
+	got, err := parsePresencePrivacy(&MsgPresencePrivacy{
+		Level:      store.PresenceContacts,
+		Exceptions: []string{other.String(), other.String(), self.String()},
+	}, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Level != store.PresenceContacts || len(got.Exceptions) != 1 || got.Exceptions[0] != other {
+		t.Errorf("unexpected privacy %+v", got)
+	}
+
+	if got, err := parsePresencePrivacy(&MsgPresencePrivacy{Level: store.PresenceEveryone}, self); err != nil || got != nil {
+		t.Errorf("expected everyone to be stored as nil, got %+v, %v", got, err)
+	}
+
+	for _, m := range []*MsgPresencePrivacy{
+		{Level: "friends"},
+		{Level: store.PresenceNobody, Exceptions: []string{"not-a-uuid"}},
+	} {
+		if _, err := parsePresencePrivacy(m, self); err == nil {
+			t.Errorf("expected error for %+v", m)
+		}
+	}
+}
+
+func TestHandleGetUser_HidesPresence(t *testing.T) {
+	viewerID, userID := uuid.New(), uuid.New()
+	lastSeen := time.Now().Add(-time.Hour)
+
+	mockStore := &store.MockStore{
+		GetUserByIDFn: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			return &store.User{ID: id, LastSeen: &lastSeen, Presence: &store.Presence{Status: "away for the week"}}, nil
+		},
+		GetPresencePeersFn: func(ctx context.Context, uID uuid.UUID, others []uuid.UUID) (map[uuid.UUID]store.PresencePeer, error) {
+			return map[uuid.UUID]store.PresencePeer{
+				viewerID: {},
+				userID:   {Privacy: &store.PresencePrivacy{Level: store.PresenceContacts}},
+			}, nil
+		},
+	}
+	h := testHandlers(mockStore)
+	sess := newTestSession(viewerID)
+
+	h.handleGetUser(context.Background(), sess, &ClientMessage{ID: "1"}, &MsgClientGet{User: userID.String()})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected OK, got %+v", resp)
+	}
+	user := resp.Ctrl.Params["user"].(map[string]any)
+	if _, ok := user["lastSeen"]; ok {
+		t.Error("expected last seen to be hidden")
+	}
+	if user["online"] != false || user["status"] != "away for the week" {
+		t.Errorf("unexpected user %v", user)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/irido"
+	"github.com/scalecode-solutions/mvchat2/push"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+const (
+	// maxDeviceIDLength matches push_devices.device_id.
+	maxDeviceIDLength = 64
+	// maxPushTokenLength bounds provider device tokens.
+	maxPushTokenLength = 4096
+	// pushPreviewLength is the max length (in graphemes) of a message preview.
+	pushPreviewLength = 100
+	// pushSendInterval is how often the sender looks for queued notifications.
+	pushSendInterval = 5 * time.Second
+	// pushSendBatch is the maximum number of notifications claimed per round.
+	pushSendBatch = 50
+	// pushLease is how long a claimed notification is hidden from other
+	// senders. It must cover a whole batch of provider requests.
+	pushLease = 10 * time.Minute
+	// pushRetryBase is the delay before the first retry; it doubles each time.
+	pushRetryBase = 30 * time.Second
+	// pushRetryMax caps the retry delay.
+	pushRetryMax = time.Hour
+)
+
+// pushPayload is a queued notification. The device token isn't part of it:
+// the device's current token is read when the notification is delivered.
+type pushPayload struct {
+	Title       string            `json:"title,omitempty"`
+	Body        string            `json:"body"`
+	Data        map[string]string `json:"data,omitempty"`
+	CollapseKey string            `json:"collapse,omitempty"`
+}
+
+// SetPush enables push notifications through the given service.
+func (h *Handlers) SetPush(p *push.Service) {
+	h.push = p
+	h.webPush, _ = p.Provider(push.PlatformWebPush).(*push.WebPush)
+}
+
+// vapidPublicKey returns the key browsers subscribe with, or "" if Web Push
+// is disabled.
+func (h *Handlers) vapidPublicKey() string {
+	if h.webPush == nil {
+		return ""
+	}
+	return h.webPush.PublicKey()
+}
+
+// HandleDevice processes push token registration for the session's device.
+func (h *Handlers) HandleDevice(s *Session, msg *ClientMessage) {
+	h.handleDevice(s, msg)
+}
+
+func (h *Handlers) handleDevice(s SessionInterface, msg *ClientMessage) {
+	if !s.RequireAuth(msg.ID) {
+		return
+	}
+
+	dev := msg.Device
+	deviceID := s.DeviceID()
+	if deviceID == "" {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing device id"))
+		return
+	}
+	if len(deviceID) > maxDeviceIDLength {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid device id"))
+		return
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	if dev.Remove {
+		removed, err := h.db.UnregisterPushDevice(ctx, s.UserID(), deviceID)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to remove device"))
+			return
+		}
+		if !removed {
+			s.Send(CtrlError(msg.ID, CodeNotFound, "device not registered"))
+			return
+		}
+		s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+			"dev": deviceID,
+		}))
+		return
+	}
+
+	if h.push == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "push notifications disabled"))
+		return
+	}
+	if !h.push.Supports(dev.Platform) {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "unsupported platform"))
+		return
+	}
+	device := &store.PushDevice{DeviceID: deviceID, Platform: dev.Platform, Token: dev.Token}
+	if dev.Platform == push.PlatformWebPush {
+		sub := dev.Subscription
+		if sub == nil {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "missing subscription"))
+			return
+		}
+		if err := h.webPush.ValidateSubscription(sub.Endpoint, sub.Keys.P256DH, sub.Keys.Auth); err != nil {
+			s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid subscription: "+err.Error()))
+			return
+		}
+		device.Token = sub.Endpoint
+		device.P256DH = sub.Keys.P256DH
+		device.Auth = sub.Keys.Auth
+	}
+	if device.Token == "" || len(device.Token) > maxPushTokenLength {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "invalid token"))
+		return
+	}
+
+	if err := h.db.RegisterPushDevice(ctx, s.UserID(), device); err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to register device"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"dev":      deviceID,
+		"platform": dev.Platform,
+	}))
+}
+
+// pushMessage queues a notification of a new message for every member who
+// should be notified but has no live session. The alert is the configured
+// generic text, or the opt-in message preview unless head marks the message
+// view-once. Silent messages queue nothing.
+func (h *Handlers) pushMessage(ctx context.Context, convID, senderID uuid.UUID, seq int, doc *irido.Irido, head map[string]any) {
+	if h.push == nil || h.cfg == nil {
+		return
+	}
+	if silent, _ := head["silent"].(bool); silent {
+		return
+	}
+
+	urgent, _ := head["urgent"].(bool)
+	recipients, err := h.notifyRecipients(ctx, convID, senderID, mentionedUsers(doc), urgent)
+	if err != nil {
+		slog.Error("get push recipients failed", "conv", convID, "error", err)
+		return
+	}
+	var offline []uuid.UUID
+	for _, id := range recipients {
+		if !h.onlineAnywhere(ctx, id) {
+			offline = append(offline, id)
+		}
+	}
+	if len(offline) == 0 {
+		return
+	}
+
+	p := pushPayload{
+		Title: h.cfg.Push.Title,
+		Body:  h.cfg.Push.Body,
+		Data: map[string]string{
+			"conv": convID.String(),
+			"seq":  strconv.Itoa(seq),
+		},
+		CollapseKey: convID.String(),
+	}
+	if viewOnce, _ := head["view_once"].(bool); !viewOnce && h.cfg.Push.ShowPreview {
+		if text, err := irido.Preview(doc, pushPreviewLength); err == nil && text != "" {
+			p.Body = text
+		}
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	payload, err := h.encryptor.Encrypt(data)
+	if err != nil {
+		slog.Error("encrypt push payload failed", "error", err)
+		return
+	}
+	if _, err := h.db.EnqueuePush(ctx, convID, offline, payload); err != nil {
+		slog.Error("enqueue push failed", "conv", convID, "error", err)
+	}
+}
+
+// onlineAnywhere reports whether a user has a live session on any node.
+func (h *Handlers) onlineAnywhere(ctx context.Context, userID uuid.UUID) bool {
+	if h.hub == nil {
+		return false
+	}
+	if h.hub.presence != nil {
+		return h.hub.presence.IsOnline(ctx, userID)
+	}
+	return h.hub.IsOnline(userID)
+}
+
+// StartPushSender starts a goroutine that delivers queued notifications.
+// Safe to run on every node: each notification is claimed by one sender.
+func (h *Handlers) StartPushSender(ctx context.Context) {
+	if h.push == nil {
+		return
+	}
+	ticker := time.NewTicker(pushSendInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				h.sendPushes(ctx)
+			}
+		}
+	}()
+}
+
+// sendPushes claims and delivers one batch of queued notifications.
+func (h *Handlers) sendPushes(ctx context.Context) {
+	claimCtx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	due, err := h.db.ClaimPushes(claimCtx, pushSendBatch, pushLease)
+	cancel()
+	if err != nil {
+		slog.Error("claim push notifications failed", "error", err)
+		return
+	}
+
+	for i := range due {
+		h.deliverPush(ctx, &due[i])
+	}
+}
+
+// deliverPush sends a claimed notification and records the outcome. Tokens
+// the provider rejects are forgotten; other failures are retried with
+// backoff until the configured number of attempts is used up.
+func (h *Handlers) deliverPush(ctx context.Context, d *store.PushDelivery) {
+	ctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	defer cancel()
+
+	n, err := h.decodePush(d)
+	if err != nil {
+		slog.Error("decode push notification failed", "id", d.ID, "error", err)
+		h.completePush(ctx, d)
+		return
+	}
+
+	err = h.push.Send(ctx, d.Platform, n)
+	switch {
+	case err == nil:
+		h.completePush(ctx, d)
+	case errors.Is(err, push.ErrUnregistered):
+		slog.Debug("push token unregistered", "device", d.DeviceID, "platform", d.Platform)
+		if err := h.db.RemovePushDevice(ctx, d.DeviceID); err != nil {
+			slog.Error("remove push device failed", "device", d.DeviceID, "error", err)
+		}
+	case h.cfg == nil || d.Attempts >= h.cfg.Push.MaxAttempts:
+		slog.Error("push notification abandoned", "id", d.ID, "attempts", d.Attempts, "error", err)
+		h.completePush(ctx, d)
+	default:
+		if err := h.db.RetryPush(ctx, d.ID, time.Now().Add(pushBackoff(d.Attempts))); err != nil {
+			slog.Error("reschedule push notification failed", "id", d.ID, "error", err)
+		}
+	}
+}
+
+func (h *Handlers) completePush(ctx context.Context, d *store.PushDelivery) {
+	if err := h.db.CompletePush(ctx, d.ID); err != nil {
+		slog.Error("complete push notification failed", "id", d.ID, "error", err)
+	}
+}
+
+// decodePush turns a claimed queue entry back into a notification.
+func (h *Handlers) decodePush(d *store.PushDelivery) (*push.Notification, error) {
+	data, err := h.encryptor.Decrypt(d.Payload)
+	if err != nil {
+		return nil, err
+	}
+	var p pushPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &push.Notification{
+		Token:       d.Token,
+		P256DH:      d.P256DH,
+		Auth:        d.Auth,
+		Title:       p.Title,
+		Body:        p.Body,
+		Data:        p.Data,
+		CollapseKey: p.CollapseKey,
+	}, nil
+}
+
+// pushBackoff returns the delay before retrying after the given number of
+// failed attempts.
+func pushBackoff(attempts int) time.Duration {
+	delay := pushRetryBase
+	for i := 1; i < attempts && delay < pushRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, pushRetryMax)
+}
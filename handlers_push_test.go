@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/config"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/irido"
+	"github.com/scalecode-solutions/mvchat2/push"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// fakeProvider records notifications and fails with err.
+type fakeProvider struct {
+	sent []*push.Notification
+	err  error
+}
+
+func (p *fakeProvider) Send(ctx context.Context, n *push.Notification) error {
+	p.sent = append(p.sent, n)
+	return p.err
+}
+
+func testPushHandlers(mockStore *store.MockStore, provider push.Provider) *Handlers {
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	svc := push.New()
+	svc.Register(push.PlatformFCM, provider)
+	cfg := &config.Config{}
+	cfg.Push.Body = "You have a new message"
+	cfg.Push.MaxAttempts = 3
+	h := &Handlers{db: mockStore, encryptor: encryptor, cfg: cfg}
+	h.SetPush(svc)
+	return h
+}
+
+func TestHandleDevice_Register(t *testing.T) {
+	userID := uuid.New()
+
+	var got *store.PushDevice
+	mockStore := &store.MockStore{
+		RegisterPushDeviceFn: func(ctx context.Context, uID uuid.UUID, dev *store.PushDevice) error {
+			got = dev
+			return nil
+		},
+	}
+	h := testPushHandlers(mockStore, &fakeProvider{})
+	sess := newTestSession(userID)
+	sess.deviceID = "phone-1"
+
+	h.handleDevice(sess, &ClientMessage{ID: "1", Device: &MsgClientDevice{Platform: push.PlatformFCM, Token: "tok"}})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected OK, got %+v", resp)
+	}
+	if got == nil || got.DeviceID != "phone-1" || got.Platform != push.PlatformFCM || got.Token != "tok" {
+		t.Errorf("unexpected registration %+v", got)
+	}
+}
+
+func TestHandleDevice_WebPush(t *testing.T) {
+	vapidPublic, vapidPrivate, _ := push.GenerateVAPIDKeys()
+	webPush, err := push.NewWebPush(push.WebPushConfig{PublicKey: vapidPublic, PrivateKey: vapidPrivate, Subject: "mailto:ops@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Any P-256 public key will do as the browser's p256dh
+	p256dh := vapidPublic
+
+	var got *store.PushDevice
+	mockStore := &store.MockStore{
+		RegisterPushDeviceFn: func(ctx context.Context, uID uuid.UUID, dev *store.PushDevice) error {
+			got = dev
+			return nil
+		},
+	}
+	h := testPushHandlers(mockStore, &fakeProvider{})
+	h.push.Register(push.PlatformWebPush, webPush)
+	h.SetPush(h.push)
+
+	if h.vapidPublicKey() != vapidPublic {
+		t.Errorf("vapid key = %q, want %q", h.vapidPublicKey(), vapidPublic)
+	}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		code     int
+	}{
+		{"https endpoint", "https://push.example.com/sub-1", CodeOK},
+		{"http endpoint", "http://push.example.com/sub-1", CodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			sess := newTestSession(uuid.New())
+			sess.deviceID = "browser-1"
+			sub := &WebPushSubscription{Endpoint: tt.endpoint}
+			sub.Keys.P256DH = p256dh
+			sub.Keys.Auth = "AAAAAAAAAAAAAAAAAAAAAA"
+
+			h.handleDevice(sess, &ClientMessage{ID: "1", Device: &MsgClientDevice{Platform: push.PlatformWebPush, Subscription: sub}})
+
+			resp := sess.LastMessage()
+			if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != tt.code {
+				t.Fatalf("expected %d, got %+v", tt.code, resp)
+			}
+			if tt.code == CodeOK && (got == nil || got.Token != tt.endpoint || got.P256DH != p256dh || got.Auth == "") {
+				t.Errorf("unexpected registration %+v", got)
+			}
+			if tt.code != CodeOK && got != nil {
+				t.Error("invalid subscription should not be stored")
+			}
+		})
+	}
+}
+
+func TestHandleDevice_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		deviceID string
+		device   *MsgClientDevice
+		code     int
+		text     string
+	}{
+		{"no device id", "", &MsgClientDevice{Platform: push.PlatformFCM, Token: "tok"}, CodeBadRequest, "missing device id"},
+		{"unsupported platform", "phone-1", &MsgClientDevice{Platform: push.PlatformAPNs, Token: "tok"}, CodeBadRequest, "unsupported platform"},
+		{"no token", "phone-1", &MsgClientDevice{Platform: push.PlatformFCM}, CodeBadRequest, "invalid token"},
+		{"remove unregistered", "phone-1", &MsgClientDevice{Remove: true}, CodeNotFound, "device not registered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testPushHandlers(&store.MockStore{}, &fakeProvider{})
+			sess := newTestSession(uuid.New())
+			sess.deviceID = tt.deviceID
+
+			h.handleDevice(sess, &ClientMessage{ID: "1", Device: tt.device})
+
+			resp := sess.LastMessage()
+			if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != tt.code || resp.Ctrl.Text != tt.text {
+				t.Errorf("expected %d %q, got %+v", tt.code, tt.text, resp.Ctrl)
+			}
+		})
+	}
+}
+
+func TestHandleDevice_PushDisabled(t *testing.T) {
+	h := testHandlers(&store.MockStore{})
+	sess := newTestSession(uuid.New())
+	sess.deviceID = "phone-1"
+
+	h.handleDevice(sess, &ClientMessage{ID: "1", Device: &MsgClientDevice{Platform: push.PlatformFCM, Token: "tok"}})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != CodeForbidden {
+		t.Errorf("expected forbidden, got %+v", resp)
+	}
+}
+
+func TestPushMessage(t *testing.T) {
+	senderID := uuid.New()
+	recipientID := uuid.New()
+	mutedID := uuid.New()
+	convID := uuid.New()
+	doc := &irido.Irido{V: irido.Version1, Text: "meet at the usual place"}
+
+	tests := []struct {
+		name        string
+		showPreview bool
+		head        map[string]any
+		wantBody    string
+	}{
+		{"content-free by default", false, nil, "You have a new message"},
+		{"preview enabled", true, nil, "meet at the usual place"},
+		{"no preview for view-once", true, map[string]any{"view_once": true}, "You have a new message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUsers []uuid.UUID
+			var gotPayload []byte
+			mockStore := &store.MockStore{
+				GetNotifySettingsFn: func(ctx context.Context, cID, sID uuid.UUID) ([]store.NotifySetting, error) {
+					return []store.NotifySetting{
+						{UserID: senderID, Level: notifyAll},
+						{UserID: recipientID, Level: notifyAll},
+						{UserID: mutedID, Level: notifyAll, Muted: true},
+					}, nil
+				},
+				EnqueuePushFn: func(ctx context.Context, cID uuid.UUID, userIDs []uuid.UUID, payload []byte) (int, error) {
+					if cID != convID {
+						t.Errorf("queued for conversation %v, want %v", cID, convID)
+					}
+					gotUsers, gotPayload = userIDs, payload
+					return len(userIDs), nil
+				},
+			}
+			h := testPushHandlers(mockStore, &fakeProvider{})
+			h.cfg.Push.ShowPreview = tt.showPreview
+
+			h.pushMessage(context.Background(), convID, senderID, 7, doc, tt.head)
+
+			if len(gotUsers) != 1 || gotUsers[0] != recipientID {
+				t.Fatalf("expected only %v to be queued, got %v", recipientID, gotUsers)
+			}
+			n, err := h.decodePush(&store.PushDelivery{Token: "tok", Payload: gotPayload})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.Body != tt.wantBody {
+				t.Errorf("body = %q, want %q", n.Body, tt.wantBody)
+			}
+			if n.Data["conv"] != convID.String() || n.Data["seq"] != "7" || n.CollapseKey != convID.String() {
+				t.Errorf("unexpected notification %+v", n)
+			}
+		})
+	}
+}
+
+func TestPushMessage_Silent(t *testing.T) {
+	mockStore := &store.MockStore{
+		GetNotifySettingsFn: func(ctx context.Context, cID, sID uuid.UUID) ([]store.NotifySetting, error) {
+			t.Error("silent messages should not look up recipients")
+			return nil, nil
+		},
+		EnqueuePushFn: func(ctx context.Context, cID uuid.UUID, userIDs []uuid.UUID, payload []byte) (int, error) {
+			t.Error("silent messages should not be queued")
+			return 0, nil
+		},
+	}
+	h := testPushHandlers(mockStore, &fakeProvider{})
+
+	h.pushMessage(context.Background(), uuid.New(), uuid.New(), 1, nil, map[string]any{"silent": true})
+}
+
+func TestHandleSend_Silent(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	var head json.RawMessage
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: convID, UserID: userID, Role: "member"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: convID, Type: "room"}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromID uuid.UUID, content []byte, h json.RawMessage) (*store.Message, error) {
+			head = h
+			return &store.Message{ID: uuid.New(), ConversationID: cID, Seq: 1, CreatedAt: time.Now()}, nil
+		},
+	}
+	h := testPushHandlers(mockStore, &fakeProvider{})
+	sess := newTestSession(userID)
+
+	send := &MsgClientSend{ConversationID: convID.String(), Content: json.RawMessage(`{"v":1,"text":"hi"}`), Silent: true}
+	h.handleSend(sess, &ClientMessage{ID: "1", Send: send})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != CodeAccepted {
+		t.Fatalf("expected accepted, got %+v", resp)
+	}
+	if !strings.Contains(string(head), `"silent":true`) {
+		t.Errorf("expected silent in head, got %s", head)
+	}
+
+	send.Urgent = true
+	h.handleSend(sess, &ClientMessage{ID: "2", Send: send})
+	if resp := sess.LastMessage(); resp.Ctrl == nil || resp.Ctrl.Code != CodeBadRequest {
+		t.Errorf("expected urgent and silent to be rejected, got %+v", resp.Ctrl)
+	}
+}
+
+func TestDeliverPush(t *testing.T) {
+	tests := []struct {
+		name      string
+		sendErr   error
+		attempts  int
+		completed bool
+		removed   bool
+		retried   bool
+	}{
+		{"delivered", nil, 1, true, false, false},
+		{"unregistered", push.ErrUnregistered, 1, false, true, false},
+		{"retry", errors.New("unavailable"), 1, false, false, true},
+		{"give up", errors.New("unavailable"), 3, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var completed, removed, retried bool
+			mockStore := &store.MockStore{
+				CompletePushFn: func(ctx context.Context, id int64) error {
+					completed = true
+					return nil
+				},
+				RemovePushDeviceFn: func(ctx context.Context, id int64) error {
+					removed = id == 2
+					return nil
+				},
+				RetryPushFn: func(ctx context.Context, id int64, at time.Time) error {
+					retried = at.After(time.Now())
+					return nil
+				},
+			}
+			provider := &fakeProvider{err: tt.sendErr}
+			h := testPushHandlers(mockStore, provider)
+
+			data, _ := json.Marshal(pushPayload{Body: "You have a new message"})
+			payload, _ := h.encryptor.Encrypt(data)
+			h.deliverPush(context.Background(), &store.PushDelivery{
+				ID: 1, DeviceID: 2, Platform: push.PlatformFCM, Token: "tok", Payload: payload, Attempts: tt.attempts,
+			})
+
+			if len(provider.sent) != 1 || provider.sent[0].Token != "tok" {
+				t.Fatalf("expected one send to tok, got %+v", provider.sent)
+			}
+			if completed != tt.completed || removed != tt.removed || retried != tt.retried {
+				t.Errorf("completed=%v removed=%v retried=%v", completed, removed, retried)
+			}
+		})
+	}
+}
+
+func TestPushBackoff(t *testing.T) {
+	if got := pushBackoff(1); got != pushRetryBase {
+		t.Errorf("first retry = %v, want %v", got, pushRetryBase)
+	}
+	if got := pushBackoff(3); got != 4*pushRetryBase {
+		t.Errorf("third retry = %v, want %v", got, 4*pushRetryBase)
+	}
+	if got := pushBackoff(100); got != pushRetryMax {
+		t.Errorf("backoff not capped: %v", got)
+	}
+}
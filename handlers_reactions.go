@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// maxEmojiLength is the max length of a reaction emoji in bytes.
+const maxEmojiLength = 64
+
+// handleGetReactions returns a message's reaction counts, or with an emoji,
+// who reacted with it, most recent first.
+func (h *Handlers) handleGetReactions(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
+	if get.ConversationID == "" || get.Seq <= 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing conv or seq"))
+		return
+	}
+
+	convID, ok := parseUUID(s, msg.ID, get.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	message := h.memberMessage(ctx, s, msg, convID, get.Seq)
+	if message == nil {
+		return
+	}
+
+	if get.Emoji == "" {
+		counts, err := h.db.GetReactionCounts(ctx, []uuid.UUID{message.ID}, s.UserID())
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get reactions"))
+			return
+		}
+		reactions := counts[message.ID]
+		if reactions == nil {
+			reactions = []store.ReactionCount{}
+		}
+		s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+			"conv":      convID.String(),
+			"seq":       message.Seq,
+			"reactions": reactions,
+		}))
+		return
+	}
+
+	limit := get.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	reactions, err := h.db.GetReactions(ctx, message.ID, get.Emoji, int64(get.Before), limit)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get reactions"))
+		return
+	}
+
+	users := make([]map[string]any, 0, len(reactions))
+	for _, r := range reactions {
+		users = append(users, map[string]any{
+			"id":   r.ID,
+			"user": r.UserID.String(),
+			"ts":   r.CreatedAt,
+		})
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":  convID.String(),
+		"seq":   message.Seq,
+		"emoji": get.Emoji,
+		"users": users,
+	}))
+}
+
+// memberMessage checks that the user is a member who can see the message at
+// seq and returns it. On failure it sends an error response and returns nil.
+func (h *Handlers) memberMessage(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, seq int) *store.Message {
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return nil
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return nil
+	}
+
+	message, err := h.db.GetVisibleMessageBySeq(ctx, convID, s.UserID(), seq, member.ClearSeq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return nil
+	}
+	if message == nil || message.DeletedAt != nil {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "message not found"))
+		return nil
+	}
+	return message
+}
+
+// messageItems builds the response representation of a page of messages
+// with their aggregated reaction counts.
+func (h *Handlers) messageItems(ctx context.Context, userID uuid.UUID, messages []store.Message) []map[string]any {
+	ids := make([]uuid.UUID, 0, len(messages))
+	for i := range messages {
+		if messages[i].DeletedAt == nil {
+			ids = append(ids, messages[i].ID)
+		}
+	}
+
+	counts, err := h.db.GetReactionCounts(ctx, ids, userID)
+	if err != nil {
+		// Reactions are secondary; serve the page without them
+		slog.Error("get reaction counts failed", "error", err)
+	}
+
+	items := make([]map[string]any, 0, len(messages))
+	for i := range messages {
+		item := h.messageItem(&messages[i])
+		if reactions := counts[messages[i].ID]; len(reactions) > 0 {
+			item["reactions"] = reactions
+		}
+		items = append(items, item)
+	}
+	return items
+}
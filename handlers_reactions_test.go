@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/config"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func reactionTestStore(messageID uuid.UUID) *store.MockStore {
+	return &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			if seq != 5 {
+				return nil, nil
+			}
+			return &store.Message{ID: messageID, ConversationID: cID, Seq: seq}, nil
+		},
+	}
+}
+
+func TestHandleReact_LimitReached(t *testing.T) {
+	messageID := uuid.New()
+	mockStore := reactionTestStore(messageID)
+	mockStore.ToggleReactionFn = func(ctx context.Context, mID, uID uuid.UUID, emoji string, maxEmojis int) (bool, int, error) {
+		if maxEmojis != 3 {
+			t.Errorf("expected limit 3, got %d", maxEmojis)
+		}
+		return false, 0, store.ErrReactionLimitReached
+	}
+
+	h := testHandlers(mockStore)
+	h.cfg = &config.Config{Limits: config.LimitsConfig{MaxReactionEmojis: 3}}
+	sess := newTestSession(uuid.New())
+
+	h.handleReact(sess, &ClientMessage{
+		ID:    "test-1",
+		React: &MsgClientReact{ConversationID: uuid.New().String(), Seq: 5, Emoji: "🎉"},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeForbidden || resp.Ctrl.Text != "reaction limit reached" {
+		t.Errorf("expected 403 reaction limit reached, got %d %q", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleReact_MessageNotFound(t *testing.T) {
+	mockStore := reactionTestStore(uuid.New())
+	mockStore.ToggleReactionFn = func(ctx context.Context, mID, uID uuid.UUID, emoji string, maxEmojis int) (bool, int, error) {
+		t.Error("reaction should not be stored")
+		return true, 1, nil
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(uuid.New())
+
+	h.handleReact(sess, &ClientMessage{
+		ID:    "test-1",
+		React: &MsgClientReact{ConversationID: uuid.New().String(), Seq: 6, Emoji: "👍"},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeNotFound {
+		t.Errorf("expected 404, got %d %q", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleGetReactions(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+	messageID := uuid.New()
+
+	mockStore := reactionTestStore(messageID)
+	mockStore.GetReactionCountsFn = func(ctx context.Context, ids []uuid.UUID, uID uuid.UUID) (map[uuid.UUID][]store.ReactionCount, error) {
+		return map[uuid.UUID][]store.ReactionCount{
+			messageID: {{Emoji: "👍", Count: 2, Mine: true}, {Emoji: "❤️", Count: 1}},
+		}, nil
+	}
+	var gotBefore int64
+	mockStore.GetReactionsFn = func(ctx context.Context, mID uuid.UUID, emoji string, before int64, limit int) ([]store.Reaction, error) {
+		gotBefore = before
+		return []store.Reaction{{ID: 8, MessageID: mID, UserID: otherID, Emoji: emoji}}, nil
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+	convID := uuid.New().String()
+
+	h.handleGet(sess, &ClientMessage{
+		ID:  "test-1",
+		Get: &MsgClientGet{What: "reactions", ConversationID: convID, Seq: 5},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	counts := resp.Ctrl.Params["reactions"].([]store.ReactionCount)
+	if len(counts) != 2 || counts[0].Count != 2 || !counts[0].Mine {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+
+	h.handleGet(sess, &ClientMessage{
+		ID:  "test-2",
+		Get: &MsgClientGet{What: "reactions", ConversationID: convID, Seq: 5, Emoji: "👍", Before: 10},
+	})
+
+	resp = sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if gotBefore != 10 {
+		t.Errorf("expected before 10, got %d", gotBefore)
+	}
+	users := resp.Ctrl.Params["users"].([]map[string]any)
+	if len(users) != 1 || users[0]["user"] != otherID.String() || users[0]["id"] != int64(8) {
+		t.Errorf("unexpected users: %v", users)
+	}
+}
+
+func TestHandleGetMessages_IncludesReactionCounts(t *testing.T) {
+	userID := uuid.New()
+	reactedID := uuid.New()
+	deletedID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	content, _ := encryptor.Encrypt([]byte(`{"v":2,"text":"hi"}`))
+
+	var gotIDs []uuid.UUID
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetMessagesFn: func(ctx context.Context, cID, uID uuid.UUID, before, limit int, clearSeq int) ([]store.Message, error) {
+			return []store.Message{
+				{ID: reactedID, ConversationID: cID, Seq: 2, Content: content},
+				{ID: deletedID, ConversationID: cID, Seq: 1, DeletedAt: &[]time.Time{time.Now()}[0]},
+			}, nil
+		},
+		GetReactionCountsFn: func(ctx context.Context, ids []uuid.UUID, uID uuid.UUID) (map[uuid.UUID][]store.ReactionCount, error) {
+			gotIDs = ids
+			return map[uuid.UUID][]store.ReactionCount{reactedID: {{Emoji: "👍", Count: 1}}}, nil
+		},
+	}
+	h := &Handlers{db: mockStore, encryptor: encryptor}
+	sess := newTestSession(userID)
+
+	h.handleGet(sess, &ClientMessage{
+		ID:  "test-1",
+		Get: &MsgClientGet{What: "messages", ConversationID: uuid.New().String()},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if len(gotIDs) != 1 || gotIDs[0] != reactedID {
+		t.Errorf("expected counts for visible messages only, got %v", gotIDs)
+	}
+	items := resp.Ctrl.Params["messages"].([]map[string]any)
+	if _, ok := items[0]["reactions"]; !ok {
+		t.Error("expected reactions on first message")
+	}
+	if _, ok := items[1]["reactions"]; ok {
+		t.Error("expected no reactions on deleted message")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// handleGetStatus returns who a message has been delivered to and who has
+// read it, with timestamps. Members who turned off read receipts are only
+// ever listed as delivered.
+func (h *Handlers) handleGetStatus(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
+	if get.ConversationID == "" || get.Seq <= 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing conv or seq"))
+		return
+	}
+
+	convID, ok := parseUUID(s, msg.ID, get.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	message := h.memberMessage(ctx, s, msg, convID, get.Seq)
+	if message == nil {
+		return
+	}
+
+	statuses, err := h.db.GetMessageStatus(ctx, convID, message.Seq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get status"))
+		return
+	}
+
+	delivered := make([]map[string]any, 0, len(statuses))
+	read := make([]map[string]any, 0, len(statuses))
+	for _, st := range statuses {
+		if st.UserID == message.FromUserID {
+			continue
+		}
+		if st.Read && (!st.HideReadReceipts || st.UserID == s.UserID()) {
+			item := map[string]any{"user": st.UserID.String()}
+			if st.ReadAt != nil {
+				item["ts"] = *st.ReadAt
+			}
+			read = append(read, item)
+			continue
+		}
+		item := map[string]any{"user": st.UserID.String()}
+		if st.RecvAt != nil {
+			item["ts"] = *st.RecvAt
+		}
+		delivered = append(delivered, item)
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":      convID.String(),
+		"seq":       message.Seq,
+		"delivered": delivered,
+		"read":      read,
+	}))
+}
+
+// broadcastRead sends a read notification to the conversation, or only to
+// the user's other sessions if they have turned off read receipts.
+func (h *Handlers) broadcastRead(ctx context.Context, s SessionInterface, convID uuid.UUID, info *MsgServerInfo) {
+	if h.hub == nil {
+		return
+	}
+
+	user, err := h.db.GetUserByID(ctx, s.UserID())
+	if err != nil {
+		slog.Error("get user for read receipt failed", "user", s.UserID(), "error", err)
+	}
+	// When in doubt, don't reveal the read
+	if user == nil || user.HideReadReceipts {
+		h.hub.SendToUsers([]uuid.UUID{s.UserID()}, &ServerMessage{Info: info}, s.ID())
+		return
+	}
+
+	h.broadcastToConv(ctx, convID, info, s.ID())
+}
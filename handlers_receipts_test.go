@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func TestHandleGetStatus(t *testing.T) {
+	userID := uuid.New()
+	senderID := uuid.New()
+	readerID := uuid.New()
+	privateID := uuid.New()
+	pendingID := uuid.New()
+	recvAt := time.Now().Add(-time.Hour).UTC()
+	readAt := time.Now().UTC()
+
+	var gotSeq int
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID}, nil
+		},
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			return &store.Message{ID: uuid.New(), ConversationID: cID, Seq: seq, FromUserID: senderID}, nil
+		},
+		GetMessageStatusFn: func(ctx context.Context, cID uuid.UUID, seq int) ([]store.MessageStatus, error) {
+			gotSeq = seq
+			return []store.MessageStatus{
+				{UserID: senderID, Read: true},
+				{UserID: readerID, Read: true, RecvAt: &recvAt, ReadAt: &readAt},
+				{UserID: privateID, Read: true, RecvAt: &recvAt, ReadAt: &readAt, HideReadReceipts: true},
+				{UserID: userID, Read: true, ReadAt: &readAt, HideReadReceipts: true},
+				{UserID: pendingID, RecvAt: &recvAt},
+			}, nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handleGet(sess, &ClientMessage{
+		ID:  "test-1",
+		Get: &MsgClientGet{What: "status", ConversationID: uuid.New().String(), Seq: 7},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if gotSeq != 7 {
+		t.Errorf("expected status for seq 7, got %d", gotSeq)
+	}
+
+	read := resp.Ctrl.Params["read"].([]map[string]any)
+	if len(read) != 2 || read[0]["user"] != readerID.String() || read[1]["user"] != userID.String() {
+		t.Fatalf("expected reader and self in read list, got %v", read)
+	}
+	if read[0]["ts"] != readAt {
+		t.Errorf("expected read time %v, got %v", readAt, read[0]["ts"])
+	}
+
+	// A member with read receipts off only shows as delivered
+	delivered := resp.Ctrl.Params["delivered"].([]map[string]any)
+	if len(delivered) != 2 || delivered[0]["user"] != privateID.String() || delivered[1]["user"] != pendingID.String() {
+		t.Fatalf("expected private reader and pending member delivered, got %v", delivered)
+	}
+	if delivered[0]["ts"] != recvAt {
+		t.Errorf("expected delivery time %v, got %v", recvAt, delivered[0]["ts"])
+	}
+}
+
+func TestHandleGetStatus_NotMember(t *testing.T) {
+	mockStore := &store.MockStore{
+		GetMessageStatusFn: func(ctx context.Context, cID uuid.UUID, seq int) ([]store.MessageStatus, error) {
+			t.Error("status should not be read")
+			return nil, nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(uuid.New())
+
+	h.handleGet(sess, &ClientMessage{
+		ID:  "test-1",
+		Get: &MsgClientGet{What: "status", ConversationID: uuid.New().String(), Seq: 7},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeForbidden || resp.Ctrl.Text != "not a member" {
+		t.Errorf("expected 403 not a member, got %d %q", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleGetReceipts_HiddenReads(t *testing.T) {
+	userID := uuid.New()
+	privateID := uuid.New()
+
+	mockStore := &store.MockStore{
+		IsMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (bool, error) {
+			return true, nil
+		},
+		GetReadReceiptsFn: func(ctx context.Context, cID uuid.UUID) ([]store.ReadReceipt, error) {
+			return []store.ReadReceipt{
+				{UserID: userID, ReadSeq: 10, RecvSeq: 15, HideReadReceipts: true},
+				{UserID: privateID, ReadSeq: 8, RecvSeq: 15, HideReadReceipts: true},
+			}, nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	msg := &ClientMessage{ID: "test-1", Get: &MsgClientGet{What: "receipts", ConversationID: uuid.New().String()}}
+	h.handleGetReceipts(context.Background(), sess, msg, msg.Get)
+
+	receipts := sess.LastMessage().Ctrl.Params["receipts"].([]map[string]any)
+	if receipts[0]["readSeq"] != 10 {
+		t.Errorf("expected own read seq, got %v", receipts[0])
+	}
+	if _, ok := receipts[1]["readSeq"]; ok || receipts[1]["recvSeq"] != 15 {
+		t.Errorf("expected only delivery for private member, got %v", receipts[1])
+	}
+}
+
+func TestHandleUpdateAccount_ReadReceipts(t *testing.T) {
+	userID := uuid.New()
+
+	var got *bool
+	mockStore := &store.MockStore{
+		UpdateUserReadReceiptsFn: func(ctx context.Context, uID uuid.UUID, enabled bool) error {
+			got = &enabled
+			return nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	off := false
+	h.handleAcc(sess, &ClientMessage{ID: "test-1", Acc: &MsgClientAcc{User: "me", ReadReceipts: &off}})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if got == nil || *got {
+		t.Errorf("expected read receipts disabled, got %v", got)
+	}
+	if resp.Ctrl.Params["readReceipts"] != false {
+		t.Errorf("expected readReceipts false in response, got %v", resp.Ctrl.Params)
+	}
+}
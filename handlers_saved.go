@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/irido"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+const (
+	// maxSavedMessages is the most messages a user can keep saved.
+	maxSavedMessages = 1000
+	// maxSavedNoteLength is the max length (in graphemes) of a saved message note.
+	maxSavedNoteLength = 500
+)
+
+// HandleSave processes save and unsave requests.
+func (h *Handlers) HandleSave(s *Session, msg *ClientMessage) {
+	h.handleSave(s, msg)
+}
+
+func (h *Handlers) handleSave(s SessionInterface, msg *ClientMessage) {
+	if !s.RequireAuth(msg.ID) {
+		return
+	}
+
+	save := msg.Save
+	if save == nil || save.ConversationID == "" || save.Seq <= 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing save data"))
+		return
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	convID, ok := parseUUID(s, msg.ID, save.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	if save.Remove {
+		h.unsaveMessage(ctx, s, msg, convID, save.Seq)
+		return
+	}
+
+	if irido.GraphemeLength(save.Note) > maxSavedNoteLength {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "note too long"))
+		return
+	}
+
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return
+	}
+
+	message, err := h.db.GetVisibleMessageBySeq(ctx, convID, s.UserID(), save.Seq, member.ClearSeq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if message == nil || message.DeletedAt != nil {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "message not found"))
+		return
+	}
+	if message.ViewOnce {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "view-once messages cannot be saved"))
+		return
+	}
+
+	var note []byte
+	if save.Note != "" {
+		note, err = h.encryptor.Encrypt([]byte(save.Note))
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "encryption failed"))
+			return
+		}
+	}
+
+	if err := h.db.SaveMessage(ctx, s.UserID(), message.ID, note, maxSavedMessages); err != nil {
+		if errors.Is(err, store.ErrSavedLimitReached) {
+			s.Send(CtrlErrorWithParams(msg.ID, CodeForbidden, "saved limit reached", map[string]any{
+				"max": maxSavedMessages,
+			}))
+			return
+		}
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to save"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv": convID.String(),
+		"seq":  save.Seq,
+	}))
+
+	h.notifySaved(s, convID, save.Seq, "saved")
+}
+
+func (h *Handlers) unsaveMessage(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, seq int) {
+	message, err := h.db.GetMessageBySeq(ctx, convID, seq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if message == nil {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "message not found"))
+		return
+	}
+
+	removed, err := h.db.UnsaveMessage(ctx, s.UserID(), message.ID)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to unsave"))
+		return
+	}
+	if !removed {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "not saved"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv": convID.String(),
+		"seq":  seq,
+	}))
+
+	h.notifySaved(s, convID, seq, "unsaved")
+}
+
+// notifySaved tells the user's other sessions that their saved collection changed.
+func (h *Handlers) notifySaved(s SessionInterface, convID uuid.UUID, seq int, what string) {
+	if h.hub == nil {
+		return
+	}
+	h.hub.SendToUsers([]uuid.UUID{s.UserID()}, &ServerMessage{Info: &MsgServerInfo{
+		ConversationID: convID.String(),
+		From:           s.UserID().String(),
+		What:           what,
+		Seq:            seq,
+		Ts:             time.Now().UTC(),
+	}}, s.ID())
+}
+
+// handleGetSaved returns the user's saved messages, most recently saved
+// first, with their notes and the conversation each belongs to.
+func (h *Handlers) handleGetSaved(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
+	limit := get.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	saved, err := h.db.GetSavedMessages(ctx, s.UserID(), int64(get.Before), limit)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get saved messages"))
+		return
+	}
+
+	results := make([]map[string]any, 0, len(saved))
+	for i := range saved {
+		m := &saved[i]
+		item := h.messageItem(&m.Message)
+		item["id"] = m.SavedID
+		item["conv"] = m.ConversationID.String()
+		item["convType"] = m.ConvType
+		if m.ConvType == "room" && m.ConvPublic != nil {
+			item["public"] = m.ConvPublic
+		}
+		item["savedAt"] = m.SavedAt
+		if m.Note != nil {
+			if note, err := h.encryptor.Decrypt(m.Note); err == nil {
+				item["note"] = string(note)
+			}
+		}
+		results = append(results, item)
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"saved": results,
+	}))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func savedTestHandlers(mockStore *store.MockStore) *Handlers {
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	return &Handlers{db: mockStore, encryptor: encryptor}
+}
+
+func TestHandleSave_EncryptsNote(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	messageID := uuid.New()
+
+	var savedID uuid.UUID
+	var savedNote []byte
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+			return &store.Message{ID: messageID, ConversationID: cID, Seq: seq}, nil
+		},
+		SaveMessageFn: func(ctx context.Context, uID, mID uuid.UUID, note []byte, maxSaved int) error {
+			savedID = mID
+			savedNote = note
+			return nil
+		},
+	}
+	h := savedTestHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handleSave(sess, &ClientMessage{
+		ID:   "test-1",
+		Save: &MsgClientSave{ConversationID: convID.String(), Seq: 7, Note: "court date"},
+	})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil {
+		t.Fatal("expected ctrl response")
+	}
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if savedID != messageID {
+		t.Errorf("expected message %s saved, got %s", messageID, savedID)
+	}
+	if strings.Contains(string(savedNote), "court date") {
+		t.Error("note stored in plaintext")
+	}
+	if note, err := h.encryptor.Decrypt(savedNote); err != nil || string(note) != "court date" {
+		t.Errorf("expected encrypted note, got %q (%v)", note, err)
+	}
+}
+
+func TestHandleSave_Refused(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *store.Message
+		note    string
+		code    int
+		want    string
+	}{
+		{"not visible", nil, "", CodeNotFound, "message not found"},
+		{"deleted", &store.Message{DeletedAt: &time.Time{}}, "", CodeNotFound, "message not found"},
+		{"view-once", &store.Message{ViewOnce: true}, "", CodeForbidden, "view-once messages cannot be saved"},
+		{"long note", &store.Message{}, strings.Repeat("a", maxSavedNoteLength+1), CodeBadRequest, "note too long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &store.MockStore{
+				GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+					return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+				},
+				GetVisibleMessageBySeqFn: func(ctx context.Context, cID, uID uuid.UUID, seq int, clearSeq int) (*store.Message, error) {
+					return tt.message, nil
+				},
+				SaveMessageFn: func(ctx context.Context, uID, mID uuid.UUID, note []byte, maxSaved int) error {
+					t.Error("message should not be saved")
+					return nil
+				},
+			}
+			h := savedTestHandlers(mockStore)
+			sess := newTestSession(uuid.New())
+
+			h.handleSave(sess, &ClientMessage{
+				ID:   "test-1",
+				Save: &MsgClientSave{ConversationID: uuid.New().String(), Seq: 7, Note: tt.note},
+			})
+
+			resp := sess.LastMessage()
+			if resp.Ctrl.Code != tt.code || resp.Ctrl.Text != tt.want {
+				t.Errorf("expected %d %q, got %d %q", tt.code, tt.want, resp.Ctrl.Code, resp.Ctrl.Text)
+			}
+		})
+	}
+}
+
+func TestHandleSave_Remove(t *testing.T) {
+	convID := uuid.New()
+	messageID := uuid.New()
+
+	mockStore := &store.MockStore{
+		GetMessageBySeqFn: func(ctx context.Context, cID uuid.UUID, seq int) (*store.Message, error) {
+			return &store.Message{ID: messageID, ConversationID: cID, Seq: seq}, nil
+		},
+		UnsaveMessageFn: func(ctx context.Context, uID, mID uuid.UUID) (bool, error) {
+			return false, nil
+		},
+	}
+	h := savedTestHandlers(mockStore)
+	sess := newTestSession(uuid.New())
+
+	h.handleSave(sess, &ClientMessage{
+		ID:   "test-1",
+		Save: &MsgClientSave{ConversationID: convID.String(), Seq: 7, Remove: true},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeNotFound || resp.Ctrl.Text != "not saved" {
+		t.Errorf("expected 404 not saved, got %d %q", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestHandleGetSaved_DecryptsWithContext(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	h := savedTestHandlers(&store.MockStore{})
+	content, _ := h.encryptor.Encrypt([]byte(`{"v":2,"text":"hotline 555-0100"}`))
+	note, _ := h.encryptor.Encrypt([]byte("call at night"))
+
+	var gotBefore int64
+	h.db.(*store.MockStore).GetSavedMessagesFn = func(ctx context.Context, uID uuid.UUID, before int64, limit int) ([]store.SavedMessage, error) {
+		gotBefore = before
+		return []store.SavedMessage{{
+			Message:    store.Message{ID: uuid.New(), ConversationID: convID, Seq: 4, FromUserID: userID, Content: content},
+			SavedID:    12,
+			Note:       note,
+			ConvType:   "room",
+			ConvPublic: json.RawMessage(`{"name":"Support"}`),
+		}}, nil
+	}
+	sess := newTestSession(userID)
+
+	h.handleGet(sess, &ClientMessage{
+		ID:  "test-1",
+		Get: &MsgClientGet{What: "saved", Before: 20},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if gotBefore != 20 {
+		t.Errorf("expected before 20, got %d", gotBefore)
+	}
+	items := resp.Ctrl.Params["saved"].([]map[string]any)
+	if len(items) != 1 {
+		t.Fatalf("expected 1 saved message, got %d", len(items))
+	}
+	item := items[0]
+	if string(item["content"].([]byte)) != `{"v":2,"text":"hotline 555-0100"}` {
+		t.Errorf("expected decrypted content, got %v", item["content"])
+	}
+	if item["note"] != "call at night" || item["conv"] != convID.String() || item["convType"] != "room" || item["id"] != int64(12) {
+		t.Errorf("unexpected item: %v", item)
+	}
+	if item["public"] == nil {
+		t.Error("expected room public data")
+	}
+}
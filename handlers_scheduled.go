@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+const (
+	// maxScheduledMessages is the maximum number of pending scheduled messages per user.
+	maxScheduledMessages = 100
+	// maxScheduleAhead is how far in the future a message can be scheduled.
+	maxScheduleAhead = 365 * 24 * time.Hour
+	// scheduledDispatchInterval is how often the dispatcher looks for due messages.
+	scheduledDispatchInterval = 10 * time.Second
+	// scheduledDispatchBatch is the maximum number of messages claimed per round.
+	scheduledDispatchBatch = 50
+	// scheduledLease is how long a claimed message stays with its node before
+	// another node may claim it again. It must cover a whole batch of sends.
+	scheduledLease = 30 * time.Minute
+	// scheduledMaxAttempts is how many times a message is claimed before it
+	// is marked failed.
+	scheduledMaxAttempts = 5
+	// scheduledRetryDelay is the delay before retrying after a temporary
+	// error; it grows with each attempt.
+	scheduledRetryDelay = time.Minute
+)
+
+// scheduleSend stores a send request with a future send time. Content is
+// validated now so the sender learns about problems immediately; everything
+// else is checked again by handleSend at dispatch.
+func (h *Handlers) scheduleSend(ctx context.Context, s SessionInterface, msg *ClientMessage, send *MsgClientSend) {
+	sendAt := send.SendAt.UTC()
+	if !validSendAt(s, msg, sendAt) {
+		return
+	}
+
+	convID, ok := parseUUID(s, msg.ID, send.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return
+	}
+
+	doc := h.normalizeContent(ctx, s, msg, convID, send.Content)
+	if doc == nil {
+		return
+	}
+	request := *send
+	request.SendAt = nil
+	request.Content, err = doc.ToJSON()
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "encoding failed"))
+		return
+	}
+	payload, err := h.encodeScheduled(&request)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "encryption failed"))
+		return
+	}
+
+	scheduled, err := h.db.CreateScheduledMessage(ctx, convID, s.UserID(), sendAt, payload, maxScheduledMessages)
+	if err != nil {
+		if errors.Is(err, store.ErrScheduleLimitReached) {
+			s.Send(CtrlErrorWithParams(msg.ID, CodeConflict, "schedule limit reached", map[string]any{
+				"maxScheduled": maxScheduledMessages,
+			}))
+			return
+		}
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to schedule"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeAccepted, map[string]any{
+		"conv":      convID.String(),
+		"scheduled": scheduled.ID.String(),
+		"sendAt":    scheduled.SendAt,
+	}))
+}
+
+// validSendAt checks a requested send time, sending an error response if invalid.
+func validSendAt(s SessionInterface, msg *ClientMessage, sendAt time.Time) bool {
+	now := time.Now().UTC()
+	if !sendAt.After(now) {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "send time must be in the future"))
+		return false
+	}
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "send time too far ahead"))
+		return false
+	}
+	return true
+}
+
+// encodeScheduled serializes and encrypts a send request for storage.
+func (h *Handlers) encodeScheduled(send *MsgClientSend) ([]byte, error) {
+	data, err := json.Marshal(send)
+	if err != nil {
+		return nil, err
+	}
+	return h.encryptor.Encrypt(data)
+}
+
+// decodeScheduled reverses encodeScheduled.
+func (h *Handlers) decodeScheduled(payload []byte) (*MsgClientSend, error) {
+	data, err := h.encryptor.Decrypt(payload)
+	if err != nil {
+		return nil, err
+	}
+	var send MsgClientSend
+	if err := json.Unmarshal(data, &send); err != nil {
+		return nil, err
+	}
+	return &send, nil
+}
+
+// HandleScheduled processes edits and cancellations of scheduled messages.
+func (h *Handlers) HandleScheduled(s *Session, msg *ClientMessage) {
+	h.handleScheduled(s, msg)
+}
+
+func (h *Handlers) handleScheduled(s SessionInterface, msg *ClientMessage) {
+	if !s.RequireAuth(msg.ID) {
+		return
+	}
+
+	sched := msg.Scheduled
+	if sched == nil || sched.ID == "" {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing scheduled data"))
+		return
+	}
+
+	ctx, cancel := handlerCtx()
+	defer cancel()
+
+	id, ok := parseUUID(s, msg.ID, sched.ID, "scheduled id")
+	if !ok {
+		return
+	}
+
+	scheduled, err := h.db.GetScheduledMessage(ctx, id)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if scheduled == nil || scheduled.UserID != s.UserID() {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "scheduled message not found"))
+		return
+	}
+
+	switch sched.Action {
+	case "cancel":
+		h.cancelScheduled(ctx, s, msg, scheduled)
+	case "edit":
+		h.editScheduled(ctx, s, msg, scheduled, sched)
+	default:
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "unknown action"))
+	}
+}
+
+func (h *Handlers) cancelScheduled(ctx context.Context, s SessionInterface, msg *ClientMessage, scheduled *store.ScheduledMessage) {
+	removed, err := h.db.CancelScheduledMessage(ctx, scheduled.ID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to cancel"))
+		return
+	}
+	if !removed {
+		s.Send(CtrlError(msg.ID, CodeConflict, "scheduled message already sent"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":      scheduled.ConversationID.String(),
+		"scheduled": scheduled.ID.String(),
+	}))
+}
+
+func (h *Handlers) editScheduled(ctx context.Context, s SessionInterface, msg *ClientMessage, scheduled *store.ScheduledMessage, sched *MsgClientScheduled) {
+	if sched.Content == nil && sched.SendAt == nil {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing content or sendAt"))
+		return
+	}
+	if scheduled.Status != store.ScheduledPending {
+		s.Send(CtrlError(msg.ID, CodeConflict, "scheduled message not pending"))
+		return
+	}
+
+	send, err := h.decodeScheduled(scheduled.Payload)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "decryption failed"))
+		return
+	}
+
+	sendAt := scheduled.SendAt
+	if sched.SendAt != nil {
+		sendAt = sched.SendAt.UTC()
+		if !validSendAt(s, msg, sendAt) {
+			return
+		}
+	}
+
+	if sched.Content != nil {
+		doc := h.normalizeContent(ctx, s, msg, scheduled.ConversationID, sched.Content)
+		if doc == nil {
+			return
+		}
+		send.Content, err = doc.ToJSON()
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "encoding failed"))
+			return
+		}
+	}
+
+	payload, err := h.encodeScheduled(send)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "encryption failed"))
+		return
+	}
+
+	updated, err := h.db.UpdateScheduledMessage(ctx, scheduled.ID, s.UserID(), sendAt, payload)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update"))
+		return
+	}
+	if !updated {
+		s.Send(CtrlError(msg.ID, CodeConflict, "scheduled message not pending"))
+		return
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":      scheduled.ConversationID.String(),
+		"scheduled": scheduled.ID.String(),
+		"sendAt":    sendAt,
+	}))
+}
+
+// handleGetScheduled lists the user's pending and failed scheduled messages,
+// optionally limited to one conversation.
+func (h *Handlers) handleGetScheduled(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
+	var convID *uuid.UUID
+	if get.ConversationID != "" {
+		id, ok := parseUUID(s, msg.ID, get.ConversationID, "conv id")
+		if !ok {
+			return
+		}
+		convID = &id
+	}
+
+	scheduled, err := h.db.GetUserScheduledMessages(ctx, s.UserID(), convID)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get scheduled messages"))
+		return
+	}
+
+	results := make([]map[string]any, 0, len(scheduled))
+	for i := range scheduled {
+		m := &scheduled[i]
+		item := map[string]any{
+			"id":        m.ID.String(),
+			"conv":      m.ConversationID.String(),
+			"sendAt":    m.SendAt,
+			"status":    m.Status,
+			"createdAt": m.CreatedAt,
+		}
+		if m.Error != nil {
+			item["error"] = *m.Error
+		}
+		if send, err := h.decodeScheduled(m.Payload); err == nil {
+			item["content"] = send.Content
+			if send.ReplyTo > 0 {
+				item["replyTo"] = send.ReplyTo
+			}
+			if send.Thread > 0 {
+				item["thread"] = send.Thread
+			}
+			if send.ViewOnce {
+				item["viewOnce"] = true
+			}
+		}
+		results = append(results, item)
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"scheduled": results,
+	}))
+}
+
+// StartScheduler starts a goroutine that dispatches scheduled messages when
+// they fall due. Safe to run on every node: each message is claimed once.
+func (h *Handlers) StartScheduler(ctx context.Context) {
+	ticker := time.NewTicker(scheduledDispatchInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				h.dispatchScheduled(ctx)
+			}
+		}
+	}()
+}
+
+// dispatchScheduled claims and sends one batch of due messages.
+func (h *Handlers) dispatchScheduled(ctx context.Context) {
+	claimCtx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	due, err := h.db.ClaimDueScheduledMessages(claimCtx, scheduledDispatchBatch, scheduledLease)
+	cancel()
+	if err != nil {
+		slog.Error("claim scheduled messages failed", "error", err)
+		return
+	}
+
+	for i := range due {
+		h.sendScheduled(ctx, &due[i])
+	}
+}
+
+// sendScheduled runs a claimed message through the normal send path as its
+// sender and records the outcome. Temporary errors (slow mode, server
+// errors) put it back for a later attempt until scheduledMaxAttempts.
+func (h *Handlers) sendScheduled(ctx context.Context, m *store.ScheduledMessage) {
+	ctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	defer cancel()
+
+	info := &MsgServerInfo{
+		ConversationID: m.ConversationID.String(),
+		From:           m.UserID.String(),
+		Scheduled:      m.ID.String(),
+	}
+
+	// An earlier attempt may have sent it and died before recording that
+	if m.Attempts > 1 {
+		seq, err := h.db.GetScheduledMessageSeq(ctx, m.ID)
+		if err != nil {
+			// Left sending, so it is claimed again once the lease runs out
+			slog.Error("look up scheduled message failed", "id", m.ID, "error", err)
+			return
+		}
+		if seq > 0 {
+			h.scheduledSent(ctx, m, info, seq)
+			return
+		}
+	}
+
+	// Claimed again after its node died too many times
+	if m.Attempts > scheduledMaxAttempts {
+		h.failScheduled(ctx, m, info, "not sent")
+		return
+	}
+
+	send, err := h.decodeScheduled(m.Payload)
+	if err != nil {
+		slog.Error("decode scheduled message failed", "id", m.ID, "error", err)
+		h.failScheduled(ctx, m, info, "invalid payload")
+		return
+	}
+
+	sess := &scheduledSession{id: "scheduled:" + m.ID.String(), userID: m.UserID, scheduledID: m.ID}
+	h.handleSend(sess, &ClientMessage{ID: m.ID.String(), Send: send})
+
+	reply := sess.reply
+	if reply == nil || reply.Ctrl == nil {
+		h.failScheduled(ctx, m, info, "no response")
+		return
+	}
+	if delay, ok := scheduledRetry(m, reply.Ctrl); ok {
+		if err := h.db.RetryScheduledMessage(ctx, m.ID, time.Now().Add(delay)); err != nil {
+			slog.Error("reschedule scheduled message failed", "id", m.ID, "error", err)
+		}
+		return
+	}
+	if reply.Ctrl.Code != CodeAccepted {
+		h.failScheduled(ctx, m, info, reply.Ctrl.Text)
+		return
+	}
+
+	seq, _ := reply.Ctrl.Params["seq"].(int)
+	h.scheduledSent(ctx, m, info, seq)
+}
+
+// scheduledSent records that a scheduled message was sent as seq and tells
+// the sender.
+func (h *Handlers) scheduledSent(ctx context.Context, m *store.ScheduledMessage, info *MsgServerInfo, seq int) {
+	if err := h.db.MarkScheduledSent(ctx, m.ID, seq); err != nil {
+		slog.Error("mark scheduled message sent failed", "id", m.ID, "error", err)
+	}
+	info.What = "scheduled_sent"
+	info.Seq = seq
+	h.notifyScheduled(m, info)
+}
+
+// scheduledRetry returns how long to wait before sending a message again
+// after a temporary error, and false if the reply isn't one or the message
+// is out of attempts. Slow mode says how long to wait.
+func scheduledRetry(m *store.ScheduledMessage, reply *MsgServerCtrl) (time.Duration, bool) {
+	if m.Attempts >= scheduledMaxAttempts {
+		return 0, false
+	}
+	delay := time.Duration(m.Attempts) * scheduledRetryDelay
+	switch reply.Code {
+	case CodeTooManyRequests:
+		if wait, ok := reply.Params["wait"].(int); ok {
+			delay = time.Duration(wait) * time.Second
+		}
+	case CodeInternalError:
+	default:
+		return 0, false
+	}
+	return delay, true
+}
+
+func (h *Handlers) failScheduled(ctx context.Context, m *store.ScheduledMessage, info *MsgServerInfo, reason string) {
+	if err := h.db.MarkScheduledFailed(ctx, m.ID, reason); err != nil {
+		slog.Error("record scheduled failure failed", "id", m.ID, "error", err)
+	}
+	info.What = "scheduled_failed"
+	h.notifyScheduled(m, info)
+}
+
+// notifyScheduled tells the sender's sessions what happened to a scheduled message.
+func (h *Handlers) notifyScheduled(m *store.ScheduledMessage, info *MsgServerInfo) {
+	if h.hub == nil {
+		return
+	}
+	info.Ts = time.Now().UTC()
+	h.hub.SendToUsers([]uuid.UUID{m.UserID}, &ServerMessage{Info: info}, "")
+}
+
+// scheduledSession stands in for the sender's connection when the
+// dispatcher replays a scheduled message through handleSend.
+type scheduledSession struct {
+	id          string
+	userID      uuid.UUID
+	scheduledID uuid.UUID
+	reply       *ServerMessage
+}
+
+func (s *scheduledSession) ID() string { return s.id }
+
+func (s *scheduledSession) UserID() uuid.UUID { return s.userID }
+
+func (s *scheduledSession) UserAgent() string { return "scheduler" }
+
+func (s *scheduledSession) DeviceID() string { return "" }
+
+func (s *scheduledSession) IsAuthenticated() bool { return true }
+
+func (s *scheduledSession) RequireAuth(msgID string) bool { return true }
+
+func (s *scheduledSession) Send(msg *ServerMessage) { s.reply = msg }
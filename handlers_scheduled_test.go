@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func TestHandleSend_Scheduled(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+	var stored []byte
+	mockStore := &store.MockStore{
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		CreateScheduledMessageFn: func(ctx context.Context, cID, uID uuid.UUID, sendAt time.Time, payload []byte, maxPending int) (*store.ScheduledMessage, error) {
+			stored = payload
+			return &store.ScheduledMessage{ID: uuid.New(), ConversationID: cID, UserID: uID, SendAt: sendAt}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			t.Error("scheduled message sent immediately")
+			return nil, nil
+		},
+	}
+	h := &Handlers{db: mockStore, encryptor: encryptor}
+	sess := newTestSession(userID)
+
+	sendAt := time.Now().Add(time.Hour)
+	h.handleSend(sess, &ClientMessage{
+		ID: "test-1",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"text":"reminder"}`),
+			SendAt:         &sendAt,
+		},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeAccepted || resp.Ctrl.Params["scheduled"] == nil {
+		t.Fatalf("expected scheduled response, got %d: %s", resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+
+	send, err := h.decodeScheduled(stored)
+	if err != nil {
+		t.Fatalf("payload not decodable: %v", err)
+	}
+	if send.SendAt != nil || string(send.Content) != `{"v":2,"text":"reminder"}` {
+		t.Errorf("unexpected stored request: %+v", send)
+	}
+
+	// Past send times are rejected
+	past := time.Now().Add(-time.Minute)
+	h.handleSend(sess, &ClientMessage{
+		ID: "test-2",
+		Send: &MsgClientSend{
+			ConversationID: convID.String(),
+			Content:        json.RawMessage(`{"v":1,"text":"late"}`),
+			SendAt:         &past,
+		},
+	})
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeBadRequest {
+		t.Errorf("expected code %d, got %d: %s", CodeBadRequest, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestDispatchScheduled(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	h := &Handlers{encryptor: encryptor}
+
+	payload, err := h.encodeScheduled(&MsgClientSend{
+		ConversationID: convID.String(),
+		Content:        json.RawMessage(`{"v":2,"text":"reminder"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentID, failedID := uuid.New(), uuid.New()
+	otherConvID := uuid.New()
+	failedPayload, _ := h.encodeScheduled(&MsgClientSend{
+		ConversationID: otherConvID.String(),
+		Content:        json.RawMessage(`{"v":2,"text":"reminder"}`),
+	})
+
+	var sentSeq int
+	var failReason string
+	h.db = &store.MockStore{
+		ClaimDueScheduledMessagesFn: func(ctx context.Context, limit int, lease time.Duration) ([]store.ScheduledMessage, error) {
+			return []store.ScheduledMessage{
+				{ID: sentID, ConversationID: convID, UserID: userID, Payload: payload, Status: store.ScheduledSending},
+				{ID: failedID, ConversationID: otherConvID, UserID: userID, Payload: failedPayload, Status: store.ScheduledSending},
+			}, nil
+		},
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			if cID != convID {
+				return nil, nil // No longer a member
+			}
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: id, Type: "room"}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			if fromUserID != userID {
+				t.Errorf("sent as %s, want sender %s", fromUserID, userID)
+			}
+			if !strings.Contains(string(head), sentID.String()) {
+				t.Errorf("expected the scheduled id in head, got %s", head)
+			}
+			return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromUserID, Seq: 9}, nil
+		},
+		MarkScheduledSentFn: func(ctx context.Context, id uuid.UUID, seq int) error {
+			if id == sentID {
+				sentSeq = seq
+			}
+			return nil
+		},
+		MarkScheduledFailedFn: func(ctx context.Context, id uuid.UUID, reason string) error {
+			if id == failedID {
+				failReason = reason
+			}
+			return nil
+		},
+	}
+
+	h.dispatchScheduled(context.Background())
+
+	if sentSeq != 9 {
+		t.Errorf("expected message sent with seq 9, got %d", sentSeq)
+	}
+	if failReason != "not a member" {
+		t.Errorf("expected failure reason %q, got %q", "not a member", failReason)
+	}
+}
+
+func TestDispatchScheduled_Retry(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	h := &Handlers{encryptor: encryptor}
+
+	payload, err := h.encodeScheduled(&MsgClientSend{
+		ConversationID: convID.String(),
+		Content:        json.RawMessage(`{"v":2,"text":"reminder"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	retriedID, exhaustedID := uuid.New(), uuid.New()
+
+	var retryAt time.Time
+	var failed []uuid.UUID
+	h.db = &store.MockStore{
+		ClaimDueScheduledMessagesFn: func(ctx context.Context, limit int, lease time.Duration) ([]store.ScheduledMessage, error) {
+			return []store.ScheduledMessage{
+				{ID: retriedID, ConversationID: convID, UserID: userID, Payload: payload, Status: store.ScheduledSending, Attempts: 1},
+				{ID: exhaustedID, ConversationID: convID, UserID: userID, Payload: payload, Status: store.ScheduledSending, Attempts: scheduledMaxAttempts},
+			}, nil
+		},
+		GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+			return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+		},
+		GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+			return &store.Conversation{ID: id, Type: "room"}, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			return nil, errors.New("database unavailable")
+		},
+		RetryScheduledMessageFn: func(ctx context.Context, id uuid.UUID, at time.Time) error {
+			if id != retriedID {
+				t.Errorf("unexpected retry of %s", id)
+			}
+			retryAt = at
+			return nil
+		},
+		MarkScheduledFailedFn: func(ctx context.Context, id uuid.UUID, reason string) error {
+			failed = append(failed, id)
+			return nil
+		},
+	}
+
+	h.dispatchScheduled(context.Background())
+
+	if retryAt.Before(time.Now()) {
+		t.Errorf("expected a retry later, got %v", retryAt)
+	}
+	if len(failed) != 1 || failed[0] != exhaustedID {
+		t.Errorf("expected only the message out of attempts to fail, got %v", failed)
+	}
+}
+
+func TestDispatchScheduled_AlreadySent(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	h := &Handlers{encryptor: encryptor}
+
+	payload, err := h.encodeScheduled(&MsgClientSend{
+		ConversationID: convID.String(),
+		Content:        json.RawMessage(`{"v":2,"text":"reminder"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduledID := uuid.New()
+
+	// Reclaimed after the node that sent it died before marking it sent
+	var sentSeq int
+	h.db = &store.MockStore{
+		ClaimDueScheduledMessagesFn: func(ctx context.Context, limit int, lease time.Duration) ([]store.ScheduledMessage, error) {
+			return []store.ScheduledMessage{
+				{ID: scheduledID, ConversationID: convID, UserID: userID, Payload: payload, Status: store.ScheduledSending, Attempts: 2},
+			}, nil
+		},
+		GetScheduledMessageSeqFn: func(ctx context.Context, id uuid.UUID) (int, error) {
+			return 12, nil
+		},
+		CreateMessageFn: func(ctx context.Context, cID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*store.Message, error) {
+			t.Error("scheduled message sent twice")
+			return &store.Message{ID: uuid.New(), ConversationID: cID, FromUserID: fromUserID, Seq: 13}, nil
+		},
+		MarkScheduledSentFn: func(ctx context.Context, id uuid.UUID, seq int) error {
+			sentSeq = seq
+			return nil
+		},
+	}
+
+	h.dispatchScheduled(context.Background())
+
+	if sentSeq != 12 {
+		t.Errorf("expected the earlier send with seq 12 recorded, got %d", sentSeq)
+	}
+}
+
+func TestHandleScheduled_OtherUser(t *testing.T) {
+	scheduledID := uuid.New()
+	mockStore := &store.MockStore{
+		GetScheduledMessageFn: func(ctx context.Context, id uuid.UUID) (*store.ScheduledMessage, error) {
+			return &store.ScheduledMessage{ID: id, UserID: uuid.New(), Status: store.ScheduledPending}, nil
+		},
+		CancelScheduledMessageFn: func(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+			t.Error("cancelled another user's message")
+			return true, nil
+		},
+	}
+	h := testHandlers(mockStore)
+	sess := newTestSession(uuid.New())
+
+	h.handleScheduled(sess, &ClientMessage{
+		ID:        "test-1",
+		Scheduled: &MsgClientScheduled{ID: scheduledID.String(), Action: "cancel"},
+	})
+
+	if resp := sess.LastMessage(); resp.Ctrl.Code != CodeNotFound {
+		t.Errorf("expected code %d, got %d: %s", CodeNotFound, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/irido"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// maxSearchTerms is the most words a message search query may contain.
+const maxSearchTerms = 10
+
+// searchMessages finds messages containing every word of the query, in one
+// conversation or across all of the user's conversations.
+func (h *Handlers) searchMessages(ctx context.Context, s SessionInterface, msg *ClientMessage, search *MsgClientSearch) {
+	var convID *uuid.UUID
+	if search.ConversationID != "" {
+		id, ok := parseUUID(s, msg.ID, search.ConversationID, "conv id")
+		if !ok {
+			return
+		}
+		isMember, err := h.db.IsMember(ctx, id, s.UserID())
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+		if !isMember {
+			s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+			return
+		}
+		convID = &id
+	}
+
+	terms := crypto.Tokenize(search.Query)
+	if len(terms) == 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "search query too short"))
+		return
+	}
+	if len(terms) > maxSearchTerms {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "too many search terms"))
+		return
+	}
+
+	limit := search.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	messages, err := h.db.SearchMessages(ctx, s.UserID(), convID, h.encryptor.BlindTokens(search.Query), limit)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "search failed"))
+		return
+	}
+
+	results := make([]map[string]any, 0, len(messages))
+	for i := range messages {
+		item := h.messageItem(&messages[i])
+		item["conv"] = messages[i].ConversationID.String()
+		results = append(results, item)
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"messages": results,
+	}))
+}
+
+// indexMessage records the message's words in the blind search index.
+// View-once and deleted messages are never indexed. Failures are logged,
+// not returned: a message that can't be indexed is still delivered.
+func (h *Handlers) indexMessage(ctx context.Context, message *store.Message, doc *irido.Irido) {
+	if message.ViewOnce || message.DeletedAt != nil {
+		return
+	}
+	tokens := h.encryptor.BlindTokens(searchText(doc))
+	if err := h.db.IndexMessage(ctx, message.ID, message.ConversationID, tokens); err != nil {
+		slog.Error("index message failed", "conv", message.ConversationID, "seq", message.Seq, "error", err)
+	}
+}
+
+// searchText returns the searchable text of a message: its text, attachment
+// names, link preview titles and poll question and options.
+func searchText(doc *irido.Irido) string {
+	parts := []string{doc.Text}
+	for _, m := range doc.Media {
+		parts = append(parts, m.Name)
+		if m.Embed != nil {
+			parts = append(parts, m.Embed.Title)
+		}
+	}
+	if doc.Poll != nil {
+		parts = append(parts, doc.Poll.Question)
+		for _, o := range doc.Poll.Options {
+			parts = append(parts, o.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func TestHandleSearch_Messages(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+
+	encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+	content, _ := encryptor.Encrypt([]byte(`{"v":2,"text":"Shelter address is 12 Oak St"}`))
+
+	var gotConv *uuid.UUID
+	var gotTokens [][]byte
+	mockStore := &store.MockStore{
+		IsMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (bool, error) {
+			return true, nil
+		},
+		SearchMessagesFn: func(ctx context.Context, uID uuid.UUID, cID *uuid.UUID, tokens [][]byte, limit int) ([]store.Message, error) {
+			gotConv = cID
+			gotTokens = tokens
+			return []store.Message{{ID: uuid.New(), ConversationID: convID, Seq: 3, FromUserID: userID, Content: content}}, nil
+		},
+	}
+	h := &Handlers{db: mockStore, encryptor: encryptor}
+	sess := newTestSession(userID)
+
+	h.handleSearch(sess, &ClientMessage{
+		ID:     "test-1",
+		Search: &MsgClientSearch{What: "messages", Query: "shelter ADDRESS", ConversationID: convID.String()},
+	})
+
+	resp := sess.LastMessage()
+	if resp == nil || resp.Ctrl == nil {
+		t.Fatal("expected ctrl response")
+	}
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if gotConv == nil || *gotConv != convID {
+		t.Errorf("expected search scoped to %s, got %v", convID, gotConv)
+	}
+
+	// Terms are hashed exactly as the indexed message text
+	want := encryptor.BlindTokens("address shelter")
+	if len(gotTokens) != 2 || !bytes.Equal(gotTokens[0], want[1]) || !bytes.Equal(gotTokens[1], want[0]) {
+		t.Errorf("unexpected tokens: %x", gotTokens)
+	}
+
+	items := resp.Ctrl.Params["messages"].([]map[string]any)
+	if len(items) != 1 || items[0]["conv"] != convID.String() {
+		t.Fatalf("unexpected results: %v", items)
+	}
+	if string(items[0]["content"].([]byte)) != `{"v":2,"text":"Shelter address is 12 Oak St"}` {
+		t.Errorf("expected decrypted content, got %v", items[0]["content"])
+	}
+}
+
+func TestHandleSearch_MessagesValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		search *MsgClientSearch
+		member bool
+		code   int
+		want   string
+	}{
+		{"not a member", &MsgClientSearch{What: "messages", Query: "shelter", ConversationID: uuid.New().String()}, false, CodeForbidden, "not a member"},
+		{"too short", &MsgClientSearch{What: "messages", Query: "a !"}, true, CodeBadRequest, "search query too short"},
+		{"too many terms", &MsgClientSearch{What: "messages", Query: "aa bb cc dd ee ff gg hh ii jj kk"}, true, CodeBadRequest, "too many search terms"},
+		{"unknown what", &MsgClientSearch{What: "files", Query: "shelter"}, true, CodeBadRequest, "unknown what"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+			mockStore := &store.MockStore{
+				IsMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (bool, error) {
+					return tt.member, nil
+				},
+				SearchMessagesFn: func(ctx context.Context, uID uuid.UUID, cID *uuid.UUID, tokens [][]byte, limit int) ([]store.Message, error) {
+					t.Error("search should not run")
+					return nil, nil
+				},
+			}
+			h := &Handlers{db: mockStore, encryptor: encryptor}
+			sess := newTestSession(uuid.New())
+
+			h.handleSearch(sess, &ClientMessage{ID: "test-1", Search: tt.search})
+
+			resp := sess.LastMessage()
+			if resp.Ctrl.Code != tt.code || resp.Ctrl.Text != tt.want {
+				t.Errorf("expected %d %q, got %d %q", tt.code, tt.want, resp.Ctrl.Code, resp.Ctrl.Text)
+			}
+		})
+	}
+}
+
+func TestHandleSend_IndexesMessage(t *testing.T) {
+	for _, viewOnce := range []bool{false, true} {
+		userID := uuid.New()
+		encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+
+		var indexed [][]byte
+		calls := 0
+		mockStore := &store.MockStore{
+			GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+				return &store.Member{ConversationID: cID, UserID: uID, Role: "member"}, nil
+			},
+			GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+				return &store.Conversation{ID: id, Type: "room"}, nil
+			},
+			IndexMessageFn: func(ctx context.Context, messageID, convID uuid.UUID, tokens [][]byte) error {
+				calls++
+				indexed = tokens
+				return nil
+			},
+		}
+		h := &Handlers{db: mockStore, encryptor: encryptor}
+		sess := newTestSession(userID)
+
+		h.handleSend(sess, &ClientMessage{
+			ID: "test-1",
+			Send: &MsgClientSend{
+				ConversationID: uuid.New().String(),
+				Content:        json.RawMessage(`{"v":2,"text":"Court date Monday"}`),
+				ViewOnce:       viewOnce,
+			},
+		})
+
+		if resp := sess.LastMessage(); resp.Ctrl.Code != CodeAccepted {
+			t.Fatalf("expected code %d, got %d: %s", CodeAccepted, resp.Ctrl.Code, resp.Ctrl.Text)
+		}
+		if viewOnce {
+			if calls != 0 {
+				t.Error("view-once message should not be indexed")
+			}
+			continue
+		}
+		want := encryptor.BlindTokens("court date monday")
+		if calls != 1 || len(indexed) != 3 || !bytes.Equal(indexed[0], want[0]) {
+			t.Errorf("expected message indexed, got %d calls with %x", calls, indexed)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// handleGetThread returns a thread root and a page of its replies.
+func (h *Handlers) handleGetThread(ctx context.Context, s SessionInterface, msg *ClientMessage, get *MsgClientGet) {
+	if get.ConversationID == "" {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing conv"))
+		return
+	}
+	if get.Seq <= 0 {
+		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing seq"))
+		return
+	}
+
+	convID, ok := parseUUID(s, msg.ID, get.ConversationID, "conv id")
+	if !ok {
+		return
+	}
+
+	// Check membership and get clear_seq
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return
+	}
+
+	root, err := h.db.GetMessageBySeq(ctx, convID, get.Seq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if root == nil || root.ThreadSeq != nil || root.Seq <= member.ClearSeq {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "thread root not found"))
+		return
+	}
+
+	messages, err := h.db.GetThreadMessages(ctx, convID, s.UserID(), root.Seq, get.Before, get.Limit, member.ClearSeq)
+	if err != nil {
+		slog.Error("get thread messages failed", "conv", convID, "root", root.Seq, "error", err)
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to get messages"))
+		return
+	}
+
+	readSeq, err := h.db.GetThreadReadSeq(ctx, convID, s.UserID(), root.Seq)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+
+	unread := 0
+	if summary := threadSummary(root.Head); summary.LastSeq > readSeq {
+		unread, err = h.db.CountThreadUnread(ctx, convID, root.Seq, readSeq)
+		if err != nil {
+			s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+			return
+		}
+	}
+
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"root":     h.messageItem(root),
+		"messages": h.messageItems(ctx, s.UserID(), messages),
+		"replies":  threadSummary(root.Head).Replies,
+		"readSeq":  readSeq,
+		"unread":   unread,
+	}))
+}
+
+// handleThreadRead advances the user's read position within a thread without
+// touching the conversation's main read_seq.
+func (h *Handlers) handleThreadRead(ctx context.Context, s SessionInterface, msg *ClientMessage, convID uuid.UUID, read *MsgClientRead) {
+	member, err := h.db.GetMember(ctx, convID, s.UserID())
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if member == nil {
+		s.Send(CtrlError(msg.ID, CodeForbidden, "not a member"))
+		return
+	}
+
+	root, err := h.db.GetMessageBySeq(ctx, convID, read.Thread)
+	if err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "database error"))
+		return
+	}
+	if root == nil || root.ThreadSeq != nil || root.Seq <= member.ClearSeq {
+		s.Send(CtrlError(msg.ID, CodeNotFound, "thread root not found"))
+		return
+	}
+
+	if err := h.db.UpdateThreadReadSeq(ctx, convID, s.UserID(), read.Thread, read.Seq); err != nil {
+		s.Send(CtrlError(msg.ID, CodeInternalError, "failed to update"))
+		return
+	}
+
+	// Record message reads for disappearing/view-once message expiration
+	messages, err := h.db.GetThreadMessages(ctx, convID, s.UserID(), read.Thread, read.Seq+1, 0, member.ClearSeq)
+	if err == nil {
+		for _, m := range messages {
+			if m.FromUserID != s.UserID() {
+				h.db.RecordMessageRead(ctx, m.ID, s.UserID())
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+		"conv":   convID.String(),
+		"seq":    read.Seq,
+		"thread": read.Thread,
+		"ts":     now,
+	}))
+
+	h.broadcastRead(ctx, s, convID, &MsgServerInfo{
+		ConversationID: convID.String(),
+		From:           s.UserID().String(),
+		What:           "read",
+		Seq:            read.Seq,
+		Thread:         read.Thread,
+		Ts:             now,
+	})
+}
+
+// unreadCount returns the number of unread messages in a conversation. In thread
+// mode, thread replies are excluded since they are tracked per thread.
+func (h *Handlers) unreadCount(ctx context.Context, convID uuid.UUID, lastSeq, readSeq int, threadMode bool) int {
+	unread := lastSeq - readSeq
+	if !threadMode || unread <= 0 {
+		return unread
+	}
+	replies, err := h.db.CountThreadReplies(ctx, convID, readSeq)
+	if err != nil {
+		slog.Error("count thread replies failed", "conv", convID, "error", err)
+		return unread
+	}
+	return withoutReplies(unread, replies)
+}
+
+// withoutReplies leaves unread thread replies out of an unread count.
+func withoutReplies(unread, replies int) int {
+	if replies > unread {
+		return 0
+	}
+	return unread - replies
+}
+
+// threadSummary extracts the thread summary from a root message's head.
+func threadSummary(head json.RawMessage) store.ThreadSummary {
+	var summary store.ThreadSummary
+	if len(head) == 0 {
+		return summary
+	}
+	var headMap map[string]json.RawMessage
+	if err := json.Unmarshal(head, &headMap); err != nil {
+		return summary
+	}
+	if raw, ok := headMap["thread"]; ok {
+		_ = json.Unmarshal(raw, &summary)
+	}
+	return summary
+}
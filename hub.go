@@ -152,6 +152,9 @@ func (h *Hub) removeSession(sess *Session) {
 	defer h.mu.Unlock()
 
 	delete(h.sessions, sess.id)
+	if h.presence != nil {
+		h.presence.SessionClosed(sess.id)
+	}
 
 	// Remove from user sessions if authenticated
 	userID := sess.UserID()
@@ -171,6 +174,9 @@ func (h *Hub) removeSession(sess *Session) {
 			if h.presence != nil {
 				go h.presence.UserOffline(userID)
 			}
+		} else if h.presence != nil {
+			// The sessions left may all be idle
+			go h.presence.RefreshIdle(userID)
 		}
 	}
 }
@@ -315,8 +321,13 @@ func (h *Hub) AuthenticateSession(sess *Session, userID uuid.UUID) {
 
 	h.mu.Unlock()
 
-	// Broadcast online presence if this is the first session
-	if !wasOnline && h.presence != nil {
-		go h.presence.UserOnline(userID)
+	// Broadcast online presence if this is the first session; a new
+	// session on an idle user brings them back from away
+	if h.presence != nil {
+		if !wasOnline {
+			go h.presence.UserOnline(userID)
+		} else {
+			go h.presence.RefreshIdle(userID)
+		}
 	}
 }
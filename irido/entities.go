@@ -0,0 +1,161 @@
+package irido
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Entity types for styled text (v2).
+const (
+	EntityBold    = "bold"
+	EntityItalic  = "italic"
+	EntityStrike  = "strike"
+	EntityCode    = "code"
+	EntityPre     = "pre"
+	EntitySpoiler = "spoiler"
+	EntityLink    = "link"
+)
+
+// MaxEntities is the maximum number of formatting entities per message.
+const MaxEntities = 100
+
+// ErrInvalidEntity is returned for malformed or overlapping entities.
+var ErrInvalidEntity = errors.New("irido: invalid entity")
+
+var entityTypes = map[string]bool{
+	EntityBold:    true,
+	EntityItalic:  true,
+	EntityStrike:  true,
+	EntityCode:    true,
+	EntityPre:     true,
+	EntitySpoiler: true,
+	EntityLink:    true,
+}
+
+// linkSchemes lists the URL schemes allowed in link entities.
+var linkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// ValidateEntities checks that entities lie within text and nest properly.
+// Entities may contain one another but must not partially overlap; code and
+// pre can't contain other entities, and links can't contain links.
+func ValidateEntities(text string, entities []Entity) error {
+	if len(entities) > MaxEntities {
+		return fmt.Errorf("%w: too many entities", ErrInvalidEntity)
+	}
+	textLen := GraphemeLength(text)
+
+	for _, e := range entities {
+		if !entityTypes[e.Type] {
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidEntity, e.Type)
+		}
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > textLen {
+			return fmt.Errorf("%w: %s at %d+%d out of range", ErrInvalidEntity, e.Type, e.Offset, e.Length)
+		}
+		if (e.Type == EntityLink) != (e.URL != "") {
+			return fmt.Errorf("%w: url is required for links only", ErrInvalidEntity)
+		}
+		if e.Type == EntityLink && !IsSafeURL(e.URL) {
+			return fmt.Errorf("%w: unsupported url", ErrInvalidEntity)
+		}
+		if e.Language != "" && (e.Type != EntityPre || !validLanguage(e.Language)) {
+			return fmt.Errorf("%w: invalid language", ErrInvalidEntity)
+		}
+	}
+
+	for i, a := range entities {
+		for _, b := range entities[i+1:] {
+			aEnd, bEnd := a.Offset+a.Length, b.Offset+b.Length
+			if a.Offset >= bEnd || b.Offset >= aEnd {
+				continue // Disjoint
+			}
+			// On equal ranges, code and pre are the inner entity
+			outer, inner := a, b
+			if b.Length > a.Length || (b.Length == a.Length && isCodeEntity(a.Type)) {
+				outer, inner = b, a
+			}
+			if inner.Offset < outer.Offset || inner.Offset+inner.Length > outer.Offset+outer.Length {
+				return fmt.Errorf("%w: %s and %s overlap", ErrInvalidEntity, a.Type, b.Type)
+			}
+			if isCodeEntity(outer.Type) {
+				return fmt.Errorf("%w: %s can't contain other entities", ErrInvalidEntity, outer.Type)
+			}
+			if outer.Type == inner.Type {
+				return fmt.Errorf("%w: nested %s", ErrInvalidEntity, inner.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// isCodeEntity reports whether typ is code or pre, whose text is literal.
+func isCodeEntity(typ string) bool {
+	return typ == EntityCode || typ == EntityPre
+}
+
+// Upgrade converts v1 content to the current version by turning its Markdown
+// into entities and remapping mention offsets. Other versions are returned
+// unchanged. The input is not modified.
+func Upgrade(irido *Irido) *Irido {
+	if irido == nil || irido.V != 1 {
+		return irido
+	}
+
+	upgraded := *irido
+	upgraded.V = Version
+	text, entities, pos := parseMarkdown(irido.Text)
+	upgraded.Text = text
+	upgraded.Entities = entities
+
+	if len(irido.Mentions) > 0 {
+		upgraded.Mentions = make([]Mention, 0, len(irido.Mentions))
+		for _, m := range irido.Mentions {
+			if m.Offset < 0 || m.Length <= 0 || m.Offset+m.Length >= len(pos) {
+				// Out of range in the original text: keep as is for validation to reject
+				upgraded.Mentions = append(upgraded.Mentions, m)
+				continue
+			}
+			start, end := pos[m.Offset], pos[m.Offset+m.Length]
+			if end <= start {
+				continue // Mention text was entirely markup
+			}
+			m.Offset, m.Length = start, end-start
+			upgraded.Mentions = append(upgraded.Mentions, m)
+		}
+	}
+	return &upgraded
+}
+
+// IsSafeURL reports whether u is an absolute URL with a scheme allowed in links
+// (http, https, mailto).
+func IsSafeURL(u string) bool {
+	if u == "" || strings.ContainsAny(u, " \t\r\n") {
+		return false
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return linkSchemes[strings.ToLower(parsed.Scheme)]
+}
+
+// validLanguage reports whether lang is a plausible code block language name.
+func validLanguage(lang string) bool {
+	if len(lang) > 32 {
+		return false
+	}
+	for _, r := range lang {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '+' || r == '-' || r == '_' || r == '#' || r == '.':
+		default:
+			return false
+		}
+	}
+	return lang != ""
+}
@@ -2,16 +2,28 @@
 // Irido is named after iridophores - the reflecting cells in octopus skin
 // that create hidden iridescent colors ("hidden beauty").
 //
-// Structure: { v: 1, text?: string, media?: [], reply?: {}, mentions?: [] }
+// Structure: { v: 2, text?: string, entities?: [], media?: [], reply?: {}, mentions?: [], poll?: {} }
 // MIME type: application/x-irido
+//
+// Version 1 carried Markdown in text; version 2 carries plain text plus
+// explicit formatting entities. v1 content is upgraded when parsed.
 package irido
 
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 )
 
+// Supported format versions.
+const (
+	// Version is the current format version.
+	Version = 2
+	// Version1 is the legacy Markdown-in-text format.
+	Version1 = 1
+)
+
 var (
 	ErrInvalidContent = errors.New("invalid irido content")
 	ErrNotIrido       = errors.New("content is not irido format")
@@ -19,16 +31,20 @@ var (
 
 // Irido represents the root message content structure.
 type Irido struct {
-	// Version - always 1 for now
+	// Version - 2 (current) or 1 (legacy, upgraded on parse)
 	V int `json:"v"`
-	// Text content with Markdown support
+	// Text content (v1: with Markdown; v2: plain, styled via Entities)
 	Text string `json:"text,omitempty"`
+	// Formatting entities over Text (v2 only)
+	Entities []Entity `json:"entities,omitempty"`
 	// Media attachments (max 10)
 	Media []Media `json:"media,omitempty"`
 	// Reply to another message
 	Reply *Reply `json:"reply,omitempty"`
 	// User mentions
 	Mentions []Mention `json:"mentions,omitempty"`
+	// Poll attached to the message
+	Poll *Poll `json:"poll,omitempty"`
 }
 
 // Media represents a media attachment.
@@ -72,6 +88,20 @@ type Reply struct {
 	From string `json:"from,omitempty"`
 }
 
+// Entity is a formatting range over the text, in graphemes like Mention.
+type Entity struct {
+	// Type: bold, italic, strike, code, pre, spoiler, link
+	Type string `json:"type"`
+	// Character offset in text (in graphemes, not bytes)
+	Offset int `json:"offset"`
+	// Length of the styled text (in graphemes)
+	Length int `json:"length"`
+	// Target URL (link only)
+	URL string `json:"url,omitempty"`
+	// Code language (pre only, optional)
+	Language string `json:"language,omitempty"`
+}
+
 // Mention represents a user mention in the text.
 type Mention struct {
 	// User ID of the mentioned user (UUID)
@@ -86,15 +116,15 @@ type Mention struct {
 
 // New creates a new Irido with just text content.
 func New(text string) *Irido {
-	return &Irido{V: 1, Text: text}
+	return &Irido{V: Version, Text: text}
 }
 
 // NewWithMedia creates a new Irido with text and media.
 func NewWithMedia(text string, media []Media) *Irido {
-	return &Irido{V: 1, Text: text, Media: media}
+	return &Irido{V: Version, Text: text, Media: media}
 }
 
-// IsIrido checks if content is in Irido format (has v:1).
+// IsIrido checks if content is in Irido format (has a supported v).
 func IsIrido(content any) bool {
 	if content == nil {
 		return false
@@ -105,21 +135,27 @@ func IsIrido(content any) bool {
 		if v, ok := c["v"]; ok {
 			switch vv := v.(type) {
 			case int:
-				return vv == 1
+				return supportedVersion(vv)
 			case float64:
-				return vv == 1
+				return vv == float64(int(vv)) && supportedVersion(int(vv))
 			}
 		}
 	case *Irido:
-		return c.V == 1
+		return supportedVersion(c.V)
 	case Irido:
-		return c.V == 1
+		return supportedVersion(c.V)
 	}
 	return false
 }
 
+func supportedVersion(v int) bool {
+	return v == Version1 || v == Version
+}
+
 // Parse converts raw content to an Irido struct.
 // Handles: plain strings, JSON bytes, map[string]any, and Irido structs.
+// Plain text and serialized v1 content are upgraded to the current version;
+// Irido structs are returned as given.
 func Parse(content any) (*Irido, error) {
 	if content == nil {
 		return nil, nil
@@ -127,20 +163,23 @@ func Parse(content any) (*Irido, error) {
 
 	switch c := content.(type) {
 	case string:
-		// Plain text string - wrap in Irido
-		return &Irido{V: 1, Text: c}, nil
+		// Plain text string - treat as v1 Markdown
+		return Upgrade(&Irido{V: Version1, Text: c}), nil
 
 	case []byte:
 		// JSON bytes - unmarshal
 		var irido Irido
 		if err := json.Unmarshal(c, &irido); err != nil {
 			// Try as plain text
-			return &Irido{V: 1, Text: string(c)}, nil
+			return Upgrade(&Irido{V: Version1, Text: string(c)}), nil
 		}
-		if irido.V != 1 {
+		if !supportedVersion(irido.V) {
 			return nil, ErrInvalidContent
 		}
-		return &irido, nil
+		if irido.V == Version1 {
+			irido.Entities = nil
+		}
+		return Upgrade(&irido), nil
 
 	case *Irido:
 		return c, nil
@@ -171,16 +210,24 @@ func parseMap(c map[string]any) (*Irido, error) {
 	default:
 		return nil, ErrInvalidContent
 	}
-	if version != 1 {
+	if !supportedVersion(version) {
 		return nil, ErrInvalidContent
 	}
 
-	irido := &Irido{V: 1}
+	irido := &Irido{V: version}
 
 	if text, ok := c["text"].(string); ok {
 		irido.Text = text
 	}
 
+	if entities, ok := c["entities"].([]any); ok && version == Version {
+		for _, e := range entities {
+			if em, ok := e.(map[string]any); ok {
+				irido.Entities = append(irido.Entities, *parseEntity(em))
+			}
+		}
+	}
+
 	if media, ok := c["media"].([]any); ok {
 		for _, m := range media {
 			if mm, ok := m.(map[string]any); ok {
@@ -207,7 +254,33 @@ func parseMap(c map[string]any) (*Irido, error) {
 		}
 	}
 
-	return irido, nil
+	if poll, ok := c["poll"].(map[string]any); ok {
+		irido.Poll = parsePoll(poll)
+	}
+
+	return Upgrade(irido), nil
+}
+
+func parseEntity(e map[string]any) *Entity {
+	entity := &Entity{}
+
+	if t, ok := e["type"].(string); ok {
+		entity.Type = t
+	}
+	if offset, ok := e["offset"].(float64); ok {
+		entity.Offset = int(offset)
+	}
+	if length, ok := e["length"].(float64); ok {
+		entity.Length = int(length)
+	}
+	if url, ok := e["url"].(string); ok {
+		entity.URL = url
+	}
+	if lang, ok := e["language"].(string); ok {
+		entity.Language = lang
+	}
+
+	return entity
 }
 
 func parseMedia(m map[string]any) *Media {
@@ -317,7 +390,7 @@ func (i *Irido) String() string {
 }
 
 // PlainText converts Irido content to plain text for search/notifications.
-// Markdown formatting is preserved. Media is represented as [TYPE 'name'].
+// Formatting is dropped. Media is represented as [TYPE 'name'].
 func PlainText(content any) (string, error) {
 	irido, err := Parse(content)
 	if err != nil {
@@ -334,16 +407,21 @@ func PlainText(content any) (string, error) {
 	}
 
 	for _, m := range irido.Media {
-		desc := mediaDescription(&m)
+		desc := MediaDescription(&m)
 		if desc != "" {
 			parts = append(parts, desc)
 		}
 	}
 
+	if irido.Poll != nil {
+		parts = append(parts, PollDescription(irido.Poll))
+	}
+
 	return strings.TrimSpace(strings.Join(parts, " ")), nil
 }
 
-func mediaDescription(m *Media) string {
+// MediaDescription describes an attachment as [TYPE 'name'] for text output.
+func MediaDescription(m *Media) string {
 	typeNames := map[string]string{
 		"image": "IMAGE",
 		"video": "VIDEO",
@@ -371,6 +449,11 @@ func mediaDescription(m *Media) string {
 	return "[" + typeName + " '" + name + "']"
 }
 
+// PollDescription describes a poll as [POLL 'question'] for text output.
+func PollDescription(p *Poll) string {
+	return "[POLL '" + p.Question + "']"
+}
+
 // Preview creates a shortened version for push notifications.
 // maxLength is in graphemes (not bytes) to handle emoji correctly.
 func Preview(content any, maxLength int) (string, error) {
@@ -395,7 +478,10 @@ func Preview(content any, maxLength int) (string, error) {
 
 	// If no text but has media, describe the first media item
 	if result == "" && len(irido.Media) > 0 {
-		result = mediaDescription(&irido.Media[0])
+		result = MediaDescription(&irido.Media[0])
+	}
+	if result == "" && irido.Poll != nil {
+		result = PollDescription(irido.Poll)
 	}
 
 	return strings.TrimSpace(result), nil
@@ -411,15 +497,17 @@ func PreviewIrido(content any, maxLength int) (*Irido, error) {
 		return nil, nil
 	}
 
-	preview := &Irido{V: 1}
+	preview := &Irido{V: Version}
 
-	// Truncate text
+	// Truncate text, clipping entities to what remains
 	if irido.Text != "" {
 		g := NewGraphemes(irido.Text)
 		if g.Length() > maxLength {
 			preview.Text = g.Slice(0, maxLength) + "…"
+			preview.Entities = clipEntities(irido.Entities, maxLength)
 		} else {
 			preview.Text = irido.Text
+			preview.Entities = irido.Entities
 		}
 	}
 
@@ -453,6 +541,21 @@ func PreviewIrido(content any, maxLength int) (*Irido, error) {
 	return preview, nil
 }
 
+// clipEntities returns the parts of entities that fall within the first n graphemes.
+func clipEntities(entities []Entity, n int) []Entity {
+	var clipped []Entity
+	for _, e := range entities {
+		if e.Offset >= n {
+			continue
+		}
+		if e.Offset+e.Length > n {
+			e.Length = n - e.Offset
+		}
+		clipped = append(clipped, e)
+	}
+	return clipped
+}
+
 // GetFileRefs extracts all file references from media attachments.
 func GetFileRefs(content any) []string {
 	irido, err := Parse(content)
@@ -512,21 +615,31 @@ func Validate(content any) error {
 	if irido == nil {
 		return ErrInvalidContent
 	}
+	return validate(irido)
+}
 
-	// Must have text or media
-	if irido.Text == "" && len(irido.Media) == 0 {
-		return errors.New("irido: must have text or media")
+// validate checks the structure of parsed content.
+func validate(irido *Irido) error {
+	// Must have text, media or a poll
+	if irido.Text == "" && len(irido.Media) == 0 && irido.Poll == nil {
+		return ErrEmptyContent
 	}
 
-	// Max 10 media attachments
-	if len(irido.Media) > 10 {
-		return errors.New("irido: max 10 media attachments")
+	if len(irido.Media) > MaxMedia {
+		return ErrTooManyMedia
 	}
 
 	// Validate mentions
 	if len(irido.Mentions) > 0 && irido.Text == "" {
-		return errors.New("irido: mentions require text")
+		return fmt.Errorf("%w: mentions require text", ErrInvalidMention)
+	}
+
+	if irido.Poll != nil {
+		if err := validatePoll(irido.Poll); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	// Validate formatting entities
+	return ValidateEntities(irido.Text, irido.Entities)
 }
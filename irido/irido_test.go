@@ -8,8 +8,8 @@ import (
 
 func TestNew(t *testing.T) {
 	i := New("Hello world")
-	if i.V != 1 {
-		t.Errorf("expected V=1, got %d", i.V)
+	if i.V != Version {
+		t.Errorf("expected V=%d, got %d", Version, i.V)
 	}
 	if i.Text != "Hello world" {
 		t.Errorf("expected text 'Hello world', got '%s'", i.Text)
@@ -26,7 +26,8 @@ func TestIsIrido(t *testing.T) {
 		{"plain string", "hello", false},
 		{"map with v:1", map[string]any{"v": 1, "text": "hi"}, true},
 		{"map with v:1 float", map[string]any{"v": 1.0, "text": "hi"}, true},
-		{"map with v:2", map[string]any{"v": 2, "text": "hi"}, false},
+		{"map with v:2", map[string]any{"v": 2, "text": "hi"}, true},
+		{"map with v:3", map[string]any{"v": 3, "text": "hi"}, false},
 		{"map without v", map[string]any{"text": "hi"}, false},
 		{"Irido struct", &Irido{V: 1, Text: "hi"}, true},
 	}
@@ -46,7 +47,7 @@ func TestParse(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if i.V != 1 || i.Text != "hello" {
+		if i.V != Version || i.Text != "hello" {
 			t.Errorf("unexpected result: %+v", i)
 		}
 	})
@@ -302,8 +303,8 @@ func TestNewWithMedia(t *testing.T) {
 	}
 	i := NewWithMedia("Check this out", media)
 
-	if i.V != 1 {
-		t.Errorf("expected V=1, got %d", i.V)
+	if i.V != Version {
+		t.Errorf("expected V=%d, got %d", Version, i.V)
 	}
 	if i.Text != "Check this out" {
 		t.Errorf("expected text 'Check this out', got '%s'", i.Text)
@@ -550,7 +551,7 @@ func TestParse_Errors(t *testing.T) {
 	})
 
 	t.Run("wrong version", func(t *testing.T) {
-		_, err := Parse(map[string]any{"v": 2, "text": "hello"})
+		_, err := Parse(map[string]any{"v": 3, "text": "hello"})
 		if err != ErrInvalidContent {
 			t.Errorf("expected ErrInvalidContent, got %v", err)
 		}
@@ -564,7 +565,7 @@ func TestParse_Errors(t *testing.T) {
 	})
 
 	t.Run("JSON with wrong version", func(t *testing.T) {
-		data := []byte(`{"v":2,"text":"hello"}`)
+		data := []byte(`{"v":3,"text":"hello"}`)
 		_, err := Parse(data)
 		if err != ErrInvalidContent {
 			t.Errorf("expected ErrInvalidContent, got %v", err)
@@ -776,7 +777,7 @@ func TestValidate_EdgeCases(t *testing.T) {
 func TestPlainText_ErrorCase(t *testing.T) {
 	// Test with content that causes Parse to error
 	content := map[string]any{
-		"v": 2, // wrong version
+		"v": 3, // wrong version
 	}
 	_, err := PlainText(content)
 	if err == nil {
@@ -787,7 +788,7 @@ func TestPlainText_ErrorCase(t *testing.T) {
 func TestPreview_ErrorCase(t *testing.T) {
 	// Test with content that causes Parse to error
 	content := map[string]any{
-		"v": 2, // wrong version
+		"v": 3, // wrong version
 	}
 	_, err := Preview(content, 100)
 	if err == nil {
@@ -798,7 +799,7 @@ func TestPreview_ErrorCase(t *testing.T) {
 func TestPreviewIrido_ErrorCase(t *testing.T) {
 	// Test with content that causes Parse to error
 	content := map[string]any{
-		"v": 2, // wrong version
+		"v": 3, // wrong version
 	}
 	_, err := PreviewIrido(content, 100)
 	if err == nil {
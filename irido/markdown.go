@@ -0,0 +1,392 @@
+package irido
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseMarkdown converts the supported Markdown subset into plain text plus
+// formatting entities. Offsets are in graphemes of the returned text.
+//
+// Supported syntax:
+//
+//	**bold**  *italic*  _italic_  ~~strike~~  ||spoiler||
+//	`code`  ```lang\npre```  [text](https://example.com)
+//
+// A backslash escapes the following punctuation character. Unmatched markers
+// are kept as literal text.
+func ParseMarkdown(text string) (string, []Entity) {
+	out, entities, _ := parseMarkdown(text)
+	return out, entities
+}
+
+// parseMarkdown is ParseMarkdown that also returns, for every input grapheme
+// index (plus the end), the corresponding output grapheme index. Used to remap
+// mention offsets when upgrading v1 content.
+func parseMarkdown(text string) (string, []Entity, []int) {
+	p := &mdParser{
+		gs:      splitGraphemes(text),
+		plain:   make(map[string][]int),
+		closes:  make(map[mdScan]int),
+		linkURL: make(map[int]string),
+	}
+	p.pos = make([]int, len(p.gs)+1)
+	p.parse(0, len(p.gs))
+	p.pos[len(p.gs)] = len(p.out)
+	sortEntities(p.entities)
+	return strings.Join(p.out, ""), flattenEntities(p.entities), p.pos
+}
+
+// flattenEntities makes parsed entities valid: an entity inside another of
+// the same type (as in *a _b_ c*) adds nothing and is dropped, and only the
+// first MaxEntities are kept. Entities must be sorted outer first.
+func flattenEntities(entities []Entity) []Entity {
+	var kept []Entity
+	for _, e := range entities {
+		redundant := false
+		for _, k := range kept {
+			if k.Type == e.Type && k.Offset <= e.Offset && e.Offset+e.Length <= k.Offset+k.Length {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			kept = append(kept, e)
+			if len(kept) == MaxEntities {
+				break
+			}
+		}
+	}
+	return kept
+}
+
+type mdParser struct {
+	gs       []string // input graphemes
+	out      []string // output graphemes
+	pos      []int    // input grapheme index -> output grapheme index
+	entities []Entity
+
+	// Scan caches keeping parsing linear on unmatched markers
+	plain   map[string][]int // token -> next occurrence at or after each index
+	closes  map[mdScan]int   // findClose state -> result
+	linkURL map[int]string   // link text close -> safe URL ("" if none)
+}
+
+// mdScan is a findClose state. The scan from k onwards depends only on k, end
+// and tok, so scans from different openers share results once they meet.
+type mdScan struct {
+	tok    string
+	end, k int
+}
+
+// mdEscapable lists the characters a backslash can escape.
+const mdEscapable = "\\`*_~|[]()"
+
+func (p *mdParser) emit(i int) {
+	p.pos[i] = len(p.out)
+	p.out = append(p.out, p.gs[i])
+}
+
+func (p *mdParser) skip(from, to int) {
+	for i := from; i < to; i++ {
+		p.pos[i] = len(p.out)
+	}
+}
+
+// has reports whether the ASCII token tok starts at grapheme i and ends before end.
+func (p *mdParser) has(i, end int, tok string) bool {
+	if i < 0 || i+len(tok) > end {
+		return false
+	}
+	for k := 0; k < len(tok); k++ {
+		if p.gs[i+k] != tok[k:k+1] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *mdParser) parse(start, end int) {
+	for i := start; i < end; {
+		g := p.gs[i]
+
+		// Escapes
+		if g == `\` && i+1 < end && strings.Contains(mdEscapable, p.gs[i+1]) {
+			p.skip(i, i+1)
+			p.emit(i + 1)
+			i += 2
+			continue
+		}
+
+		// Pre block
+		if p.has(i, end, "```") {
+			if next, ok := p.pre(i, end); ok {
+				i = next
+				continue
+			}
+		}
+
+		// Inline code
+		if g == "`" {
+			if close := p.findPlain(i+1, end, "`"); close > i+1 {
+				p.skip(i, i+1)
+				outStart := len(p.out)
+				for k := i + 1; k < close; k++ {
+					p.emit(k)
+				}
+				p.skip(close, close+1)
+				p.add(EntityCode, outStart, "", "")
+				i = close + 1
+				continue
+			}
+		}
+
+		// Paired delimiters
+		if tok, typ := p.delimiter(i, end); tok != "" {
+			if close := p.findClose(i+len(tok), end, tok); close >= 0 {
+				p.skip(i, i+len(tok))
+				outStart := len(p.out)
+				p.parse(i+len(tok), close)
+				p.skip(close, close+len(tok))
+				p.add(typ, outStart, "", "")
+				i = close + len(tok)
+				continue
+			}
+		}
+
+		// Links
+		if g == "[" {
+			if next, ok := p.link(i, end); ok {
+				i = next
+				continue
+			}
+		}
+
+		p.emit(i)
+		i++
+	}
+}
+
+// delimiter returns the paired delimiter starting at i, if it can open a span.
+func (p *mdParser) delimiter(i, end int) (string, string) {
+	var tok, typ string
+	switch {
+	case p.has(i, end, "**"):
+		tok, typ = "**", EntityBold
+	case p.has(i, end, "~~"):
+		tok, typ = "~~", EntityStrike
+	case p.has(i, end, "||"):
+		tok, typ = "||", EntitySpoiler
+	case p.gs[i] == "*":
+		tok, typ = "*", EntityItalic
+	case p.gs[i] == "_":
+		// No intraword emphasis: snake_case stays literal
+		if i > 0 && isWordGrapheme(p.gs[i-1]) {
+			return "", ""
+		}
+		tok, typ = "_", EntityItalic
+	default:
+		return "", ""
+	}
+	// Opening marker must be followed by non-space
+	if i+len(tok) >= end || isSpaceGrapheme(p.gs[i+len(tok)]) {
+		return "", ""
+	}
+	return tok, typ
+}
+
+// findClose finds the closing delimiter tok in [from, end), skipping escapes
+// and code spans. Returns -1 if there is none. Every state the scan passes
+// through is cached with the result, so repeated openers don't rescan.
+func (p *mdParser) findClose(from, end int, tok string) int {
+	var path []int
+	close := -1
+	for k := from; k < end; k++ {
+		// The start state differs in refusing a closer at from, so it's not cached
+		if k != from {
+			if c, ok := p.closes[mdScan{tok, end, k}]; ok {
+				close = c
+				break
+			}
+			path = append(path, k)
+		}
+		switch {
+		case p.gs[k] == `\`:
+			k++
+			continue
+		case p.gs[k] == "`":
+			if c := p.findPlain(k+1, end, "`"); c > k {
+				k = c
+			}
+			continue
+		}
+		if !p.has(k, end, tok) {
+			continue
+		}
+		// A single * must not match half of a **
+		if tok == "*" && p.has(k, end, "**") {
+			k++
+			continue
+		}
+		// Closing marker must follow non-space and enclose something
+		if k == from || isSpaceGrapheme(p.gs[k-1]) {
+			continue
+		}
+		if tok == "_" && k+1 < end && isWordGrapheme(p.gs[k+1]) {
+			continue
+		}
+		close = k
+		break
+	}
+	for _, k := range path {
+		p.closes[mdScan{tok, end, k}] = close
+	}
+	return close
+}
+
+// findPlain finds tok in [from, end) without interpreting any markup.
+func (p *mdParser) findPlain(from, end int, tok string) int {
+	next, ok := p.plain[tok]
+	if !ok {
+		// next[k] is the first occurrence of tok at or after k, or -1
+		next = make([]int, len(p.gs)+1)
+		next[len(p.gs)] = -1
+		for k := len(p.gs) - 1; k >= 0; k-- {
+			next[k] = next[k+1]
+			if p.has(k, len(p.gs), tok) {
+				next[k] = k
+			}
+		}
+		p.plain[tok] = next
+	}
+	if from < 0 || from >= len(next) {
+		return -1
+	}
+	if k := next[from]; k >= 0 && k+len(tok) <= end {
+		return k
+	}
+	return -1
+}
+
+// pre handles a ``` block starting at i. Returns the index after the block.
+func (p *mdParser) pre(i, end int) (int, bool) {
+	close := p.findPlain(i+3, end, "```")
+	if close < 0 {
+		return 0, false
+	}
+	contentStart := i + 3
+	language := ""
+
+	// Optional language on the opening line
+	for k := contentStart; k < close; k++ {
+		if isNewlineGrapheme(p.gs[k]) {
+			lang := strings.Join(p.gs[contentStart:k], "")
+			if lang == "" || validLanguage(lang) {
+				language = lang
+				contentStart = k + 1
+			}
+			break
+		}
+	}
+	contentEnd := close
+	if contentEnd > contentStart && isNewlineGrapheme(p.gs[contentEnd-1]) {
+		contentEnd--
+	}
+	if contentEnd <= contentStart {
+		return 0, false
+	}
+
+	p.skip(i, contentStart)
+	outStart := len(p.out)
+	for k := contentStart; k < contentEnd; k++ {
+		p.emit(k)
+	}
+	p.skip(contentEnd, close+3)
+	p.add(EntityPre, outStart, "", language)
+	return close + 3, true
+}
+
+// link handles [text](url) starting at i. Returns the index after the link.
+func (p *mdParser) link(i, end int) (int, bool) {
+	closeText := p.findClose(i+1, end, "]")
+	if closeText < 0 || !p.has(closeText+1, end, "(") {
+		return 0, false
+	}
+	closeURL := p.findPlain(closeText+2, end, ")")
+	if closeURL < 0 {
+		return 0, false
+	}
+	// Openers sharing a text close also share the URL, so check it once
+	url, ok := p.linkURL[closeText]
+	if !ok {
+		url = strings.Join(p.gs[closeText+2:closeURL], "")
+		if !IsSafeURL(url) {
+			url = ""
+		}
+		p.linkURL[closeText] = url
+	}
+	if url == "" {
+		return 0, false
+	}
+
+	p.skip(i, i+1)
+	outStart := len(p.out)
+	p.parse(i+1, closeText)
+	p.skip(closeText, closeURL+1)
+	p.add(EntityLink, outStart, url, "")
+	return closeURL + 1, true
+}
+
+// add records an entity spanning from outStart to the current output end.
+func (p *mdParser) add(typ string, outStart int, url, language string) {
+	length := len(p.out) - outStart
+	if length <= 0 {
+		return
+	}
+	p.entities = append(p.entities, Entity{
+		Type:     typ,
+		Offset:   outStart,
+		Length:   length,
+		URL:      url,
+		Language: language,
+	})
+}
+
+// sortEntities orders entities by offset, outer entities first. On equal
+// ranges, code and pre come last, as they can't wrap anything.
+func sortEntities(entities []Entity) {
+	sort.SliceStable(entities, func(a, b int) bool {
+		if entities[a].Offset != entities[b].Offset {
+			return entities[a].Offset < entities[b].Offset
+		}
+		if entities[a].Length != entities[b].Length {
+			return entities[a].Length > entities[b].Length
+		}
+		return !isCodeEntity(entities[a].Type) && isCodeEntity(entities[b].Type)
+	})
+}
+
+func splitGraphemes(text string) []string {
+	g := NewGraphemes(text)
+	gs := make([]string, g.Length())
+	for i := range gs {
+		gs[i] = g.At(i)
+	}
+	return gs
+}
+
+func isSpaceGrapheme(g string) bool {
+	r, _ := utf8.DecodeRuneInString(g)
+	return unicode.IsSpace(r)
+}
+
+func isNewlineGrapheme(g string) bool {
+	return g == "\n" || g == "\r\n"
+}
+
+func isWordGrapheme(g string) bool {
+	r, _ := utf8.DecodeRuneInString(g)
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,212 @@
+package irido
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		text     string
+		entities []Entity
+	}{
+		{"plain", "hello world", "hello world", nil},
+		{"bold", "**bold** text", "bold text", []Entity{{Type: EntityBold, Offset: 0, Length: 4}}},
+		{"italic star", "an *italic* word", "an italic word", []Entity{{Type: EntityItalic, Offset: 3, Length: 6}}},
+		{"italic underscore", "_hi_", "hi", []Entity{{Type: EntityItalic, Offset: 0, Length: 2}}},
+		{"strike", "~~gone~~", "gone", []Entity{{Type: EntityStrike, Offset: 0, Length: 4}}},
+		{"spoiler", "a ||secret||", "a secret", []Entity{{Type: EntitySpoiler, Offset: 2, Length: 6}}},
+		{"nested", "*a **b** c*", "a b c", []Entity{
+			{Type: EntityItalic, Offset: 0, Length: 5},
+			{Type: EntityBold, Offset: 2, Length: 1},
+		}},
+		{"nested same type", "*foo _bar_ baz*", "foo bar baz", []Entity{{Type: EntityItalic, Offset: 0, Length: 11}}},
+		{"code keeps markup", "`**x**`", "**x**", []Entity{{Type: EntityCode, Offset: 0, Length: 5}}},
+		{"pre with language", "```go\nfmt.Println()\n```", "fmt.Println()", []Entity{{Type: EntityPre, Offset: 0, Length: 13, Language: "go"}}},
+		{"pre without language", "```\nx := 1```", "x := 1", []Entity{{Type: EntityPre, Offset: 0, Length: 6}}},
+		{"link", "see [site](https://example.com)!", "see site!", []Entity{{Type: EntityLink, Offset: 4, Length: 4, URL: "https://example.com"}}},
+		{"unsafe link", "[x](javascript:alert(1))", "[x](javascript:alert(1))", nil},
+		{"escaped", `\*not\*`, "*not*", nil},
+		{"intraword underscore", "snake_case_name", "snake_case_name", nil},
+		{"spaced stars", "2 * 3 * 4", "2 * 3 * 4", nil},
+		{"unmatched", "**open", "**open", nil},
+		{"graphemes", "👨‍👩‍👧 **hi**", "👨‍👩‍👧 hi", []Entity{{Type: EntityBold, Offset: 2, Length: 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := ParseMarkdown(tt.input)
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("entities = %+v, want %+v", entities, tt.entities)
+			}
+			if err := ValidateEntities(text, entities); err != nil {
+				t.Errorf("parsed entities invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpgrade_RemapsMentions(t *testing.T) {
+	v1 := &Irido{
+		V:        Version1,
+		Text:     "**hi** @bob",
+		Mentions: []Mention{{UserID: "u1", Username: "bob", Offset: 7, Length: 4}},
+	}
+	got := Upgrade(v1)
+	if got.V != Version || got.Text != "hi @bob" {
+		t.Fatalf("unexpected upgrade: %+v", got)
+	}
+	if got.Mentions[0].Offset != 3 || got.Mentions[0].Length != 4 {
+		t.Errorf("mention = %+v, want offset 3 length 4", got.Mentions[0])
+	}
+	if v1.Text != "**hi** @bob" {
+		t.Error("Upgrade modified its input")
+	}
+}
+
+func TestUpgrade_AlwaysValid(t *testing.T) {
+	inputs := []string{
+		"*foo _bar_ baz*",
+		"**a **b** c**",
+		"~~x ~~y~~ z~~ and ||p ||q|| r||",
+		strings.Repeat("*a* ", MaxEntities+10),
+	}
+	for _, input := range inputs {
+		if err := Validate(map[string]any{"v": 1, "text": input}); err != nil {
+			t.Errorf("upgrading %q: %v", input, err)
+		}
+	}
+}
+
+// unmatchedMarkdown holds long inputs whose openers never close. Each used to
+// rescan the rest of the text, making parsing quadratic.
+var unmatchedMarkdown = []string{
+	strings.Repeat("[", 60000),
+	strings.Repeat("**a ", 15000),
+	strings.Repeat("_a ", 20000),
+	strings.Repeat("[a]", 20000),
+	strings.Repeat("`", 60000),
+	strings.Repeat("[", 20000) + "](" + strings.Repeat("x", 40000) + ")",
+}
+
+func TestParseMarkdown_UnmatchedMarkers(t *testing.T) {
+	for _, input := range unmatchedMarkdown {
+		text, entities := ParseMarkdown(input)
+		if err := ValidateEntities(text, entities); err != nil {
+			t.Errorf("parsed entities invalid: %v", err)
+		}
+	}
+	// Results must match the short forms
+	if text, entities := ParseMarkdown(strings.Repeat("**a ", 1000)); text != strings.Repeat("**a ", 1000) || entities != nil {
+		t.Errorf("unmatched bold: got %d entities", len(entities))
+	}
+}
+
+func BenchmarkParseMarkdown_Unmatched(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, input := range unmatchedMarkdown {
+			ParseMarkdown(input)
+		}
+	}
+}
+
+func TestUpgrade_CodeWrappedWholly(t *testing.T) {
+	tests := []struct {
+		input string
+		outer Entity
+	}{
+		{"**`x`**", Entity{Type: EntityBold, Offset: 0, Length: 1}},
+		{"||`x`||", Entity{Type: EntitySpoiler, Offset: 0, Length: 1}},
+		{"[`x`](https://a.b)", Entity{Type: EntityLink, Offset: 0, Length: 1, URL: "https://a.b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			want := []Entity{tt.outer, {Type: EntityCode, Offset: 0, Length: 1}}
+			up := Upgrade(&Irido{V: Version1, Text: tt.input})
+			if up.Text != "x" || !reflect.DeepEqual(up.Entities, want) {
+				t.Errorf("Upgrade() = %q %+v, want %+v", up.Text, up.Entities, want)
+			}
+
+			content, _ := json.Marshal(map[string]any{"v": 1, "text": tt.input})
+			doc, err := Normalize(content, NormalizeOptions{})
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if !reflect.DeepEqual(doc.Entities, want) {
+				t.Errorf("Normalize() entities = %+v, want %+v", doc.Entities, want)
+			}
+
+			// v2 clients may send the entities in either order
+			for _, entities := range [][]Entity{want, {want[1], want[0]}} {
+				v2, _ := json.Marshal(&Irido{V: Version, Text: "x", Entities: entities})
+				if _, err := Normalize(v2, NormalizeOptions{}); err != nil {
+					t.Errorf("Normalize(%s) error = %v", v2, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_UpgradesV1(t *testing.T) {
+	i, err := Parse([]byte(`{"v":1,"text":"**hi**"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.V != Version || i.Text != "hi" || len(i.Entities) != 1 {
+		t.Errorf("unexpected result: %s", i)
+	}
+
+	i, err = Parse(map[string]any{"v": 2, "text": "**hi**", "entities": []any{
+		map[string]any{"type": "bold", "offset": 0.0, "length": 2.0},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Text != "**hi**" || len(i.Entities) != 1 {
+		t.Errorf("v2 content should not be reinterpreted: %s", i)
+	}
+}
+
+func TestValidateEntities(t *testing.T) {
+	text := "hello world"
+	tests := []struct {
+		name     string
+		entities []Entity
+		wantErr  bool
+	}{
+		{"none", nil, false},
+		{"nested", []Entity{{Type: EntityBold, Offset: 0, Length: 11}, {Type: EntityItalic, Offset: 6, Length: 5}}, false},
+		{"disjoint", []Entity{{Type: EntityBold, Offset: 0, Length: 5}, {Type: EntityBold, Offset: 6, Length: 5}}, false},
+		{"partial overlap", []Entity{{Type: EntityBold, Offset: 0, Length: 7}, {Type: EntityItalic, Offset: 6, Length: 5}}, true},
+		{"inside code", []Entity{{Type: EntityCode, Offset: 0, Length: 11}, {Type: EntityBold, Offset: 0, Length: 5}}, true},
+		{"bold wrapping code", []Entity{{Type: EntityBold, Offset: 0, Length: 5}, {Type: EntityCode, Offset: 0, Length: 5}}, false},
+		{"code wrapped by bold", []Entity{{Type: EntityCode, Offset: 0, Length: 5}, {Type: EntityBold, Offset: 0, Length: 5}}, false},
+		{"pre wrapped by link", []Entity{{Type: EntityPre, Offset: 0, Length: 5}, {Type: EntityLink, Offset: 0, Length: 5, URL: "https://example.com"}}, false},
+		{"code on code", []Entity{{Type: EntityCode, Offset: 0, Length: 5}, {Type: EntityCode, Offset: 0, Length: 5}}, true},
+		{"same type nested", []Entity{{Type: EntityBold, Offset: 0, Length: 11}, {Type: EntityBold, Offset: 0, Length: 5}}, true},
+		{"out of range", []Entity{{Type: EntityBold, Offset: 6, Length: 6}}, true},
+		{"unknown type", []Entity{{Type: "blink", Offset: 0, Length: 5}}, true},
+		{"link", []Entity{{Type: EntityLink, Offset: 0, Length: 5, URL: "https://example.com"}}, false},
+		{"link without url", []Entity{{Type: EntityLink, Offset: 0, Length: 5}}, true},
+		{"unsafe link", []Entity{{Type: EntityLink, Offset: 0, Length: 5, URL: "javascript:alert(1)"}}, true},
+		{"url on bold", []Entity{{Type: EntityBold, Offset: 0, Length: 5, URL: "https://example.com"}}, true},
+		{"pre language", []Entity{{Type: EntityPre, Offset: 0, Length: 5, Language: "c++"}}, false},
+		{"bad language", []Entity{{Type: EntityPre, Offset: 0, Length: 5, Language: "<script>"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEntities(text, tt.entities)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEntities() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
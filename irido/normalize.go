@@ -0,0 +1,132 @@
+package irido
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Content limits. Validate enforces MaxMedia; Normalize also MaxTextLength.
+const (
+	// MaxMedia is the maximum number of media attachments per message.
+	MaxMedia = 10
+	// MaxTextLength is the default maximum text length in graphemes.
+	MaxTextLength = 10000
+)
+
+var (
+	ErrEmptyContent   = errors.New("irido: must have text, media or a poll")
+	ErrTooManyMedia   = errors.New("irido: too many media attachments")
+	ErrTextTooLong    = errors.New("irido: text too long")
+	ErrInvalidMedia   = errors.New("irido: invalid media")
+	ErrInvalidMention = errors.New("irido: invalid mention")
+	ErrInvalidReply   = errors.New("irido: invalid reply")
+)
+
+// mediaTypes lists the accepted media attachment types.
+var mediaTypes = map[string]bool{
+	"image": true,
+	"video": true,
+	"audio": true,
+	"file":  true,
+	"embed": true,
+}
+
+// NormalizeOptions controls Normalize.
+type NormalizeOptions struct {
+	// MaxTextLength in graphemes (0 = MaxTextLength)
+	MaxTextLength int
+}
+
+// Normalize strictly validates raw JSON content and returns it in canonical
+// form. Unlike Parse, it never falls back to plain text: content must be a
+// JSON object with a supported v. v1 content is upgraded to the current
+// version. On top of Validate's checks, text length, media, mention ranges
+// and reply seqs are checked. Unknown fields are dropped when the result is
+// re-serialized.
+func Normalize(content []byte, opts NormalizeOptions) (*Irido, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 || content[0] != '{' {
+		return nil, ErrNotIrido
+	}
+
+	var doc Irido
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, ErrInvalidContent
+	}
+	if !supportedVersion(doc.V) {
+		return nil, ErrInvalidContent
+	}
+	if doc.V == Version1 && len(doc.Entities) > 0 {
+		return nil, fmt.Errorf("%w: entities require v%d", ErrInvalidEntity, Version)
+	}
+	// Stricter rules for content about to be stored. The raw text is checked
+	// before upgrading so oversized v1 Markdown is never parsed.
+	maxText := opts.MaxTextLength
+	if maxText <= 0 {
+		maxText = MaxTextLength
+	}
+	if GraphemeLength(doc.Text) > maxText {
+		return nil, ErrTextTooLong
+	}
+
+	irido := Upgrade(&doc)
+	if irido.Poll != nil {
+		trimPoll(irido.Poll)
+	}
+	if err := validate(irido); err != nil {
+		return nil, err
+	}
+
+	textLen := GraphemeLength(irido.Text)
+	if textLen > maxText {
+		return nil, ErrTextTooLong
+	}
+
+	for i := range irido.Media {
+		if err := validateMedia(&irido.Media[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range irido.Mentions {
+		if m.UserID == "" || m.Offset < 0 || m.Length <= 0 || m.Offset+m.Length > textLen {
+			return nil, fmt.Errorf("%w: %q at %d+%d", ErrInvalidMention, m.UserID, m.Offset, m.Length)
+		}
+	}
+
+	if irido.Reply != nil && irido.Reply.Seq <= 0 {
+		return nil, ErrInvalidReply
+	}
+
+	if len(irido.Media) == 0 {
+		irido.Media = nil
+	}
+	if len(irido.Mentions) == 0 {
+		irido.Mentions = nil
+	}
+	if len(irido.Entities) == 0 {
+		irido.Entities = nil
+	}
+	return irido, nil
+}
+
+func validateMedia(m *Media) error {
+	if !mediaTypes[m.Type] {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidMedia, m.Type)
+	}
+	if m.Size < 0 || m.Width < 0 || m.Height < 0 || m.Duration < 0 {
+		return fmt.Errorf("%w: negative dimension", ErrInvalidMedia)
+	}
+	if m.Type == "embed" {
+		if m.Embed == nil || m.Embed.URL == "" {
+			return fmt.Errorf("%w: embed requires url", ErrInvalidMedia)
+		}
+		return nil
+	}
+	if m.Ref == "" {
+		return fmt.Errorf("%w: %s requires ref", ErrInvalidMedia, m.Type)
+	}
+	return nil
+}
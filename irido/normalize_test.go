@@ -0,0 +1,97 @@
+package irido
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{"valid text", `{"v":1,"text":"hello"}`, nil},
+		{"valid media", `{"v":1,"media":[{"type":"image","ref":"f1"}]}`, nil},
+		{"valid embed", `{"v":1,"media":[{"type":"embed","embed":{"url":"https://example.com"}}]}`, nil},
+		{"valid mention", `{"v":1,"text":"hi @bob","mentions":[{"userId":"u1","offset":3,"length":4}]}`, nil},
+		{"plain string", `"hello"`, ErrNotIrido},
+		{"not json", `hello`, ErrNotIrido},
+		{"wrong version", `{"v":3,"text":"hello"}`, ErrInvalidContent},
+		{"missing version", `{"text":"hello"}`, ErrInvalidContent},
+		{"empty", `{"v":1}`, ErrEmptyContent},
+		{"unknown media type", `{"v":1,"media":[{"type":"sticker","ref":"f1"}]}`, ErrInvalidMedia},
+		{"media without ref", `{"v":1,"media":[{"type":"image"}]}`, ErrInvalidMedia},
+		{"embed without url", `{"v":1,"media":[{"type":"embed"}]}`, ErrInvalidMedia},
+		{"mention past text", `{"v":1,"text":"hi","mentions":[{"userId":"u1","offset":1,"length":5}]}`, ErrInvalidMention},
+		{"mention without user", `{"v":1,"text":"hi","mentions":[{"offset":0,"length":2}]}`, ErrInvalidMention},
+		{"reply without seq", `{"v":1,"text":"hi","reply":{}}`, ErrInvalidReply},
+		{"valid poll", `{"v":2,"poll":{"question":"Lunch?","options":[{"text":"Yes"},{"text":"No"}],"multi":true}}`, nil},
+		{"poll without question", `{"v":2,"poll":{"question":" ","options":[{"text":"Yes"},{"text":"No"}]}}`, ErrInvalidPoll},
+		{"poll with one option", `{"v":2,"poll":{"question":"Lunch?","options":[{"text":"Yes"}]}}`, ErrInvalidPoll},
+		{"poll with duplicate options", `{"v":2,"poll":{"question":"Lunch?","options":[{"text":"Yes"},{"text":" Yes "}]}}`, ErrInvalidPoll},
+		{"poll with empty option", `{"v":2,"poll":{"question":"Lunch?","options":[{"text":"Yes"},{"text":""}]}}`, ErrInvalidPoll},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Normalize([]byte(tt.content), NormalizeOptions{})
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Normalize() unexpected error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Normalize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalize_MentionOffsetsInGraphemes(t *testing.T) {
+	// The family emoji is one grapheme but many bytes
+	content := `{"v":1,"text":"👨‍👩‍👧 @bob","mentions":[{"userId":"u1","offset":2,"length":4}]}`
+	if _, err := Normalize([]byte(content), NormalizeOptions{}); err != nil {
+		t.Errorf("Normalize() error = %v", err)
+	}
+}
+
+func TestNormalize_TextLength(t *testing.T) {
+	content := `{"v":1,"text":"` + strings.Repeat("a", 11) + `"}`
+	if _, err := Normalize([]byte(content), NormalizeOptions{MaxTextLength: 10}); !errors.Is(err, ErrTextTooLong) {
+		t.Errorf("expected ErrTextTooLong, got %v", err)
+	}
+	if _, err := Normalize([]byte(content), NormalizeOptions{MaxTextLength: 11}); err != nil {
+		t.Errorf("unexpected error = %v", err)
+	}
+}
+
+func TestNormalize_RawTextLength(t *testing.T) {
+	// v1 markup counts toward the limit: the raw text is checked before upgrading
+	content := `{"v":1,"text":"**` + strings.Repeat("a", 9) + `**"}`
+	if _, err := Normalize([]byte(content), NormalizeOptions{MaxTextLength: 10}); !errors.Is(err, ErrTextTooLong) {
+		t.Errorf("expected ErrTextTooLong, got %v", err)
+	}
+
+	content = `{"v":1,"text":"` + strings.Repeat("[", 60000) + `"}`
+	if _, err := Normalize([]byte(content), NormalizeOptions{}); !errors.Is(err, ErrTextTooLong) {
+		t.Errorf("expected ErrTextTooLong, got %v", err)
+	}
+}
+
+func TestNormalize_TooManyMedia(t *testing.T) {
+	media := strings.Repeat(`{"type":"image","ref":"f"},`, MaxMedia+1)
+	content := `{"v":1,"media":[` + strings.TrimSuffix(media, ",") + `]}`
+	if _, err := Normalize([]byte(content), NormalizeOptions{}); !errors.Is(err, ErrTooManyMedia) {
+		t.Errorf("expected ErrTooManyMedia, got %v", err)
+	}
+}
+
+func TestNormalize_DropsUnknownFields(t *testing.T) {
+	doc, err := Normalize([]byte(`{"v":1,"text":"hi","evil":"<script>","media":[]}`), NormalizeOptions{})
+	if err != nil {
+		t.Fatalf("Normalize() error = %v", err)
+	}
+	if got := doc.String(); got != `{"v":2,"text":"hi"}` {
+		t.Errorf("canonical form = %s", got)
+	}
+}
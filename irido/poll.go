@@ -0,0 +1,104 @@
+package irido
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Poll limits enforced by Normalize.
+const (
+	// MinPollOptions is the minimum number of options in a poll.
+	MinPollOptions = 2
+	// MaxPollOptions is the maximum number of options in a poll.
+	MaxPollOptions = 10
+	// MaxPollQuestionLength is the maximum question length in graphemes.
+	MaxPollQuestionLength = 300
+	// MaxPollOptionLength is the maximum option length in graphemes.
+	MaxPollOptionLength = 100
+)
+
+// ErrInvalidPoll is returned for malformed poll blocks.
+var ErrInvalidPoll = errors.New("irido: invalid poll")
+
+// Poll is a poll attached to a message. Votes are kept server-side and
+// referenced by option index.
+type Poll struct {
+	// Question being asked
+	Question string `json:"question"`
+	// Answer options, in display order
+	Options []PollOption `json:"options"`
+	// Allow voting for more than one option
+	Multi bool `json:"multi,omitempty"`
+	// Hide who voted for what
+	Anonymous bool `json:"anonymous,omitempty"`
+	// When voting closes automatically (optional)
+	ClosesAt *time.Time `json:"closesAt,omitempty"`
+}
+
+// PollOption is one answer in a poll.
+type PollOption struct {
+	Text string `json:"text"`
+}
+
+// trimPoll removes surrounding whitespace from the question and options.
+func trimPoll(p *Poll) {
+	p.Question = strings.TrimSpace(p.Question)
+	for i := range p.Options {
+		p.Options[i].Text = strings.TrimSpace(p.Options[i].Text)
+	}
+}
+
+func validatePoll(p *Poll) error {
+	if strings.TrimSpace(p.Question) == "" {
+		return fmt.Errorf("%w: missing question", ErrInvalidPoll)
+	}
+	if GraphemeLength(p.Question) > MaxPollQuestionLength {
+		return fmt.Errorf("%w: question too long", ErrInvalidPoll)
+	}
+	if len(p.Options) < MinPollOptions || len(p.Options) > MaxPollOptions {
+		return fmt.Errorf("%w: must have %d to %d options", ErrInvalidPoll, MinPollOptions, MaxPollOptions)
+	}
+	seen := make(map[string]bool, len(p.Options))
+	for i := range p.Options {
+		text := strings.TrimSpace(p.Options[i].Text)
+		if text == "" || GraphemeLength(text) > MaxPollOptionLength {
+			return fmt.Errorf("%w: option %d must be 1 to %d characters", ErrInvalidPoll, i, MaxPollOptionLength)
+		}
+		if seen[text] {
+			return fmt.Errorf("%w: duplicate option %q", ErrInvalidPoll, text)
+		}
+		seen[text] = true
+	}
+	return nil
+}
+
+func parsePoll(p map[string]any) *Poll {
+	poll := &Poll{}
+
+	if question, ok := p["question"].(string); ok {
+		poll.Question = question
+	}
+	if options, ok := p["options"].([]any); ok {
+		for _, o := range options {
+			if om, ok := o.(map[string]any); ok {
+				text, _ := om["text"].(string)
+				poll.Options = append(poll.Options, PollOption{Text: text})
+			}
+		}
+	}
+	if multi, ok := p["multi"].(bool); ok {
+		poll.Multi = multi
+	}
+	if anonymous, ok := p["anonymous"].(bool); ok {
+		poll.Anonymous = anonymous
+	}
+	if closesAt, ok := p["closesAt"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, closesAt); err == nil {
+			poll.ClosesAt = &t
+		}
+	}
+
+	return poll
+}
@@ -0,0 +1,134 @@
+package render
+
+import (
+	"html"
+	"strings"
+
+	"github.com/scalecode-solutions/mvchat2/irido"
+)
+
+// HTML renders content as an HTML fragment with all user content escaped.
+//
+// Output is a sequence of blocks: the reply as <blockquote class="irido-reply">,
+// the text as <div class="irido-text">, one <div class="irido-media"> per
+// attachment, and a poll as <div class="irido-poll"> with its options in an
+// <ol>. Images with a URL render as <img>, other attachments and embeds as
+// links. Links carry rel="noopener noreferrer nofollow".
+func HTML(content any, opts Options) (string, error) {
+	doc, err := irido.Parse(content)
+	if err != nil || doc == nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	if doc.Reply != nil && doc.Reply.Preview != "" {
+		b.WriteString(`<blockquote class="irido-reply">`)
+		if name := opts.userName(doc.Reply.From); name != "" {
+			b.WriteString("<cite>" + html.EscapeString(name) + "</cite> ")
+		}
+		b.WriteString(escapeLines(doc.Reply.Preview))
+		b.WriteString("</blockquote>\n")
+	}
+
+	if doc.Text != "" {
+		b.WriteString(`<div class="irido-text">`)
+		renderText(&b, htmlFormatter{}, doc, &opts)
+		b.WriteString("</div>\n")
+	}
+
+	for i := range doc.Media {
+		m := &doc.Media[i]
+		b.WriteString(`<div class="irido-media irido-` + html.EscapeString(m.Type) + `">`)
+		writeHTMLMedia(&b, m, &opts)
+		b.WriteString("</div>\n")
+	}
+
+	if doc.Poll != nil {
+		b.WriteString(`<div class="irido-poll"><p>` + html.EscapeString(doc.Poll.Question) + "</p><ol>")
+		for _, o := range doc.Poll.Options {
+			b.WriteString("<li>" + html.EscapeString(o.Text) + "</li>")
+		}
+		b.WriteString("</ol></div>\n")
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func writeHTMLMedia(b *strings.Builder, m *irido.Media, opts *Options) {
+	label := html.EscapeString(mediaLabel(m))
+
+	if u := opts.fileURL(m); u != "" {
+		if m.Type == "image" {
+			b.WriteString(`<img src="` + html.EscapeString(u) + `" alt="` + label + `">`)
+			return
+		}
+		writeHTMLLink(b, u, label)
+		return
+	}
+
+	if u := embedURL(m); u != "" {
+		writeHTMLLink(b, u, label)
+		if m.Embed.Description != "" {
+			b.WriteString(" <span>" + html.EscapeString(m.Embed.Description) + "</span>")
+		}
+		return
+	}
+
+	b.WriteString(html.EscapeString(irido.MediaDescription(m)))
+}
+
+func writeHTMLLink(b *strings.Builder, url, label string) {
+	b.WriteString(`<a href="` + html.EscapeString(url) + `" rel="noopener noreferrer nofollow">` + label + `</a>`)
+}
+
+// escapeLines escapes s and turns newlines into <br>.
+func escapeLines(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>\n")
+}
+
+var htmlTags = map[string]string{
+	irido.EntityBold:    "strong",
+	irido.EntityItalic:  "em",
+	irido.EntityStrike:  "s",
+	irido.EntitySpoiler: "span",
+	irido.EntityLink:    "a",
+}
+
+type htmlFormatter struct{}
+
+func (htmlFormatter) text(b *strings.Builder, s string) {
+	b.WriteString(escapeLines(s))
+}
+
+func (htmlFormatter) open(b *strings.Builder, e *irido.Entity) {
+	switch e.Type {
+	case irido.EntitySpoiler:
+		b.WriteString(`<span class="irido-spoiler">`)
+	case irido.EntityLink:
+		b.WriteString(`<a href="` + html.EscapeString(e.URL) + `" rel="noopener noreferrer nofollow">`)
+	default:
+		b.WriteString("<" + htmlTags[e.Type] + ">")
+	}
+}
+
+func (htmlFormatter) close(b *strings.Builder, e *irido.Entity) {
+	b.WriteString("</" + htmlTags[e.Type] + ">")
+}
+
+func (htmlFormatter) code(b *strings.Builder, e *irido.Entity, s string) {
+	if e.Type == irido.EntityCode {
+		b.WriteString("<code>" + html.EscapeString(s) + "</code>")
+		return
+	}
+	b.WriteString("<pre><code")
+	if e.Language != "" {
+		b.WriteString(` class="language-` + html.EscapeString(e.Language) + `"`)
+	}
+	b.WriteString(">" + html.EscapeString(s) + "</code></pre>")
+}
+
+func (htmlFormatter) mention(b *strings.Builder, m *irido.Mention, name string) {
+	b.WriteString(`<span class="irido-mention" data-user-id="` + html.EscapeString(m.UserID) + `">@` +
+		html.EscapeString(name) + `</span>`)
+}
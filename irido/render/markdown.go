@@ -0,0 +1,144 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/scalecode-solutions/mvchat2/irido"
+)
+
+// Markdown renders content as Markdown. Markdown syntax in the text is
+// escaped so only entities produce formatting. A reply is rendered as a
+// blockquote, attachments as images or links when a URL is known, and a
+// poll as its bold question followed by a numbered list of options.
+// Blocks are separated by blank lines.
+func Markdown(content any, opts Options) (string, error) {
+	doc, err := irido.Parse(content)
+	if err != nil || doc == nil {
+		return "", err
+	}
+
+	var blocks []string
+
+	if doc.Reply != nil && doc.Reply.Preview != "" {
+		preview := escapeMarkdown(doc.Reply.Preview)
+		if name := opts.userName(doc.Reply.From); name != "" {
+			preview = "**" + escapeMarkdown(name) + ":** " + preview
+		}
+		blocks = append(blocks, "> "+strings.ReplaceAll(preview, "\n", "\n> "))
+	}
+
+	if doc.Text != "" {
+		var b strings.Builder
+		renderText(&b, markdownFormatter{}, doc, &opts)
+		blocks = append(blocks, b.String())
+	}
+
+	for i := range doc.Media {
+		m := &doc.Media[i]
+		label := escapeMarkdown(mediaLabel(m))
+		switch u := opts.fileURL(m); {
+		case u != "" && m.Type == "image":
+			blocks = append(blocks, "!["+label+"]("+markdownURL(u)+")")
+		case u != "":
+			blocks = append(blocks, "["+label+"]("+markdownURL(u)+")")
+		case embedURL(m) != "":
+			blocks = append(blocks, "["+label+"]("+markdownURL(m.Embed.URL)+")")
+		default:
+			blocks = append(blocks, escapeMarkdown(irido.MediaDescription(m)))
+		}
+	}
+
+	if doc.Poll != nil {
+		lines := []string{"**" + escapeMarkdown(doc.Poll.Question) + "**", ""}
+		for i, o := range doc.Poll.Options {
+			lines = append(lines, strconv.Itoa(i+1)+". "+escapeMarkdown(o.Text))
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(blocks, "\n\n"), nil
+}
+
+var markdownDelimiters = map[string]string{
+	irido.EntityBold:    "**",
+	irido.EntityItalic:  "_",
+	irido.EntityStrike:  "~~",
+	irido.EntitySpoiler: "||",
+}
+
+type markdownFormatter struct{}
+
+func (markdownFormatter) text(b *strings.Builder, s string) {
+	b.WriteString(escapeMarkdown(s))
+}
+
+func (markdownFormatter) open(b *strings.Builder, e *irido.Entity) {
+	if e.Type == irido.EntityLink {
+		b.WriteString("[")
+		return
+	}
+	b.WriteString(markdownDelimiters[e.Type])
+}
+
+func (markdownFormatter) close(b *strings.Builder, e *irido.Entity) {
+	if e.Type == irido.EntityLink {
+		b.WriteString("](" + markdownURL(e.URL) + ")")
+		return
+	}
+	b.WriteString(markdownDelimiters[e.Type])
+}
+
+func (markdownFormatter) code(b *strings.Builder, e *irido.Entity, s string) {
+	// Fences must be longer than any backtick run in the code
+	run := longestRun(s, '`')
+	if e.Type == irido.EntityPre {
+		fence := strings.Repeat("`", max(3, run+1))
+		b.WriteString(fence + e.Language + "\n" + s)
+		if !strings.HasSuffix(s, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(fence)
+		return
+	}
+	fence := strings.Repeat("`", run+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	b.WriteString(fence + s + fence)
+}
+
+func (markdownFormatter) mention(b *strings.Builder, m *irido.Mention, name string) {
+	b.WriteString("@" + escapeMarkdown(name))
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `~`, `\~`, `|`, `\|`,
+	`[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `#`, `\#`,
+)
+
+// escapeMarkdown backslash-escapes characters with meaning in Markdown.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+var markdownURLEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E")
+
+// markdownURL escapes characters that would end a link destination early.
+func markdownURL(u string) string {
+	return markdownURLEscaper.Replace(u)
+}
+
+// longestRun returns the length of the longest run of c in s.
+func longestRun(s string, c byte) int {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
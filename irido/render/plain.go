@@ -0,0 +1,78 @@
+package render
+
+import (
+	"strings"
+
+	"github.com/scalecode-solutions/mvchat2/irido"
+)
+
+// PlainText renders content as plain text. Formatting is dropped and
+// mentions use resolved names. A reply is quoted with "> " before the text,
+// each attachment is described on its own line, followed by its URL
+// when known, and poll options are listed one per line.
+func PlainText(content any, opts Options) (string, error) {
+	doc, err := irido.Parse(content)
+	if err != nil || doc == nil {
+		return "", err
+	}
+
+	var parts []string
+
+	if doc.Reply != nil && doc.Reply.Preview != "" {
+		preview := doc.Reply.Preview
+		if name := opts.userName(doc.Reply.From); name != "" {
+			preview = name + ": " + preview
+		}
+		parts = append(parts, "> "+strings.ReplaceAll(preview, "\n", "\n> "))
+	}
+
+	if doc.Text != "" {
+		var b strings.Builder
+		renderText(&b, plainFormatter{}, doc, &opts)
+		parts = append(parts, b.String())
+	}
+
+	for i := range doc.Media {
+		m := &doc.Media[i]
+		line := irido.MediaDescription(m)
+		if u := opts.fileURL(m); u != "" {
+			line += " " + u
+		} else if u := embedURL(m); u != "" {
+			line += " " + u
+		}
+		parts = append(parts, line)
+	}
+
+	if doc.Poll != nil {
+		lines := []string{irido.PollDescription(doc.Poll)}
+		for _, o := range doc.Poll.Options {
+			lines = append(lines, "- "+o.Text)
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(parts, "\n"), nil
+}
+
+type plainFormatter struct{}
+
+func (plainFormatter) text(b *strings.Builder, s string) {
+	b.WriteString(s)
+}
+
+func (plainFormatter) open(b *strings.Builder, e *irido.Entity) {}
+
+func (plainFormatter) close(b *strings.Builder, e *irido.Entity) {
+	if e.Type == irido.EntityLink {
+		// Keep the target, which would otherwise be lost
+		b.WriteString(" (" + e.URL + ")")
+	}
+}
+
+func (plainFormatter) code(b *strings.Builder, e *irido.Entity, s string) {
+	b.WriteString(s)
+}
+
+func (plainFormatter) mention(b *strings.Builder, m *irido.Mention, name string) {
+	b.WriteString("@" + name)
+}
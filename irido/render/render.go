@@ -0,0 +1,179 @@
+// Package render converts Irido message content into plain text, HTML and
+// Markdown for email digests, exports and web views.
+//
+// Text, entities and mentions are rendered together: entities become markup,
+// mentions become "@name" using the UserName hook. Entities that are invalid
+// or partially overlap an earlier range are dropped rather than failing the
+// whole message. All output formats escape user content.
+package render
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/scalecode-solutions/mvchat2/irido"
+)
+
+// Options holds hooks for resolving references in the content.
+// The zero value renders references from the content alone.
+type Options struct {
+	// UserName returns the display name for a user ID, or "" if unknown.
+	// Used for mentions and reply authors.
+	UserName func(userID string) string
+	// FileURL returns a URL for a media attachment, or "" if it has none.
+	FileURL func(m *irido.Media) string
+}
+
+func (o *Options) userName(userID string) string {
+	if o.UserName == nil || userID == "" {
+		return ""
+	}
+	return o.UserName(userID)
+}
+
+func (o *Options) fileURL(m *irido.Media) string {
+	if o.FileURL == nil || m.Ref == "" {
+		return ""
+	}
+	return o.FileURL(m)
+}
+
+// formatter writes one output format.
+type formatter interface {
+	// text writes ordinary text.
+	text(b *strings.Builder, s string)
+	// open and close write the markup around a styled range.
+	open(b *strings.Builder, e *irido.Entity)
+	close(b *strings.Builder, e *irido.Entity)
+	// code writes the whole of a code or pre range.
+	code(b *strings.Builder, e *irido.Entity, s string)
+	// mention writes a mention; name is the resolved display name.
+	mention(b *strings.Builder, m *irido.Mention, name string)
+}
+
+// span is a styled range of text; children are nested inside it.
+type span struct {
+	start, end int
+	entity     *irido.Entity
+	mention    *irido.Mention
+	children   []*span
+}
+
+// leaf reports whether the span's text is rendered as a unit.
+func (s *span) leaf() bool {
+	return s.mention != nil || s.entity.Type == irido.EntityCode || s.entity.Type == irido.EntityPre
+}
+
+// buildSpans arranges valid entities and mentions into a tree of
+// non-overlapping ranges.
+func buildSpans(doc *irido.Irido, length int) []*span {
+	var spans []*span
+	for i := range doc.Entities {
+		e := &doc.Entities[i]
+		if irido.ValidateEntities(doc.Text, []irido.Entity{*e}) != nil {
+			continue
+		}
+		spans = append(spans, &span{start: e.Offset, end: e.Offset + e.Length, entity: e})
+	}
+	for i := range doc.Mentions {
+		m := &doc.Mentions[i]
+		if m.Offset < 0 || m.Length <= 0 || m.Offset+m.Length > length {
+			continue
+		}
+		spans = append(spans, &span{start: m.Offset, end: m.Offset + m.Length, mention: m})
+	}
+
+	// Outer ranges first; for equal ranges, other entities wrap code, pre
+	// and mentions, and entities wrap mentions
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		if spans[i].end != spans[j].end {
+			return spans[i].end > spans[j].end
+		}
+		return !spans[i].leaf() && spans[j].leaf()
+	})
+
+	var roots, stack []*span
+	for _, s := range spans {
+		for len(stack) > 0 && s.start >= stack[len(stack)-1].end {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, s)
+		} else {
+			parent := stack[len(stack)-1]
+			if s.end > parent.end || parent.leaf() {
+				continue // Partial overlap, or nested in code or a mention
+			}
+			parent.children = append(parent.children, s)
+		}
+		stack = append(stack, s)
+	}
+	return roots
+}
+
+// renderText writes doc.Text with its entities and mentions using f.
+func renderText(b *strings.Builder, f formatter, doc *irido.Irido, opts *Options) {
+	g := irido.NewGraphemes(doc.Text)
+	r := &textRenderer{b: b, f: f, g: g, opts: opts}
+	r.spans(0, g.Length(), buildSpans(doc, g.Length()))
+}
+
+type textRenderer struct {
+	b    *strings.Builder
+	f    formatter
+	g    *irido.Graphemes
+	opts *Options
+}
+
+func (r *textRenderer) spans(start, end int, children []*span) {
+	pos := start
+	for _, c := range children {
+		r.f.text(r.b, r.g.Slice(pos, c.start))
+		r.span(c)
+		pos = c.end
+	}
+	r.f.text(r.b, r.g.Slice(pos, end))
+}
+
+func (r *textRenderer) span(s *span) {
+	switch {
+	case s.mention != nil:
+		name := r.opts.userName(s.mention.UserID)
+		if name == "" {
+			// Keep the mention text as written
+			name = strings.TrimPrefix(r.g.Slice(s.start, s.end), "@")
+		}
+		r.f.mention(r.b, s.mention, name)
+	case s.leaf():
+		r.f.code(r.b, s.entity, r.g.Slice(s.start, s.end))
+	default:
+		r.f.open(r.b, s.entity)
+		r.spans(s.start, s.end, s.children)
+		r.f.close(r.b, s.entity)
+	}
+}
+
+// mediaLabel returns a short human-readable label for an attachment.
+func mediaLabel(m *irido.Media) string {
+	if m.Name != "" {
+		return m.Name
+	}
+	if m.Embed != nil {
+		if m.Embed.Title != "" {
+			return m.Embed.Title
+		}
+		return m.Embed.URL
+	}
+	return "attachment"
+}
+
+// embedURL returns the embed's URL if it is safe to link to.
+func embedURL(m *irido.Media) string {
+	if m.Embed == nil || !irido.IsSafeURL(m.Embed.URL) {
+		return ""
+	}
+	return m.Embed.URL
+}
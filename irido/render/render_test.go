@@ -0,0 +1,175 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/scalecode-solutions/mvchat2/irido"
+)
+
+func testDoc() *irido.Irido {
+	return &irido.Irido{
+		V:    irido.Version,
+		Text: "hi @bob, see <docs> and run x := 1",
+		Entities: []irido.Entity{
+			{Type: irido.EntityBold, Offset: 0, Length: 7},
+			{Type: irido.EntityLink, Offset: 13, Length: 6, URL: "https://example.com/a_(b)"},
+			{Type: irido.EntityCode, Offset: 28, Length: 6},
+		},
+		Mentions: []irido.Mention{{UserID: "u1", Username: "bob", Offset: 3, Length: 4}},
+	}
+}
+
+func testOptions() Options {
+	return Options{
+		UserName: func(userID string) string {
+			if userID == "u1" {
+				return "Bob <B>"
+			}
+			return ""
+		},
+		FileURL: func(m *irido.Media) string {
+			return "/v0/file/" + m.Ref
+		},
+	}
+}
+
+func TestHTML(t *testing.T) {
+	doc := testDoc()
+	doc.Reply = &irido.Reply{Seq: 4, Preview: "earlier\nmessage", From: "u1"}
+	doc.Media = []irido.Media{
+		{Type: "image", Ref: "f1", Name: "cat.png"},
+		{Type: "embed", Embed: &irido.Embed{URL: "javascript:alert(1)", Title: "x"}},
+	}
+
+	got, err := HTML(doc, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<blockquote class="irido-reply"><cite>Bob &lt;B&gt;</cite> earlier<br>
+message</blockquote>
+<div class="irido-text"><strong>hi <span class="irido-mention" data-user-id="u1">@Bob &lt;B&gt;</span></strong>, see <a href="https://example.com/a_(b)" rel="noopener noreferrer nofollow">&lt;docs&gt;</a> and run <code>x := 1</code></div>
+<div class="irido-media irido-image"><img src="/v0/file/f1" alt="cat.png"></div>
+<div class="irido-media irido-embed">[LINK &#39;x&#39;]</div>`
+	if got != want {
+		t.Errorf("HTML() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHTML_CodeWrappedWholly(t *testing.T) {
+	// Code listed before the bold on the same range still renders inside it
+	doc := &irido.Irido{V: irido.Version, Text: "x", Entities: []irido.Entity{
+		{Type: irido.EntityCode, Offset: 0, Length: 1},
+		{Type: irido.EntityBold, Offset: 0, Length: 1},
+	}}
+	got, err := HTML(doc, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<div class="irido-text"><strong><code>x</code></strong></div>`; got != want {
+		t.Errorf("HTML() = %s, want %s", got, want)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	got, err := Markdown(testDoc(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "**hi @bob**, see [\\<docs\\>](https://example.com/a_%28b%29) and run `x := 1`"
+	if got != want {
+		t.Errorf("Markdown() = %q, want %q", got, want)
+	}
+}
+
+func TestMarkdown_RoundTrip(t *testing.T) {
+	input := "*a **b** c* ~~d~~ ||e|| `f` [g](https://example.com)"
+	doc, err := irido.Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := Markdown(doc, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, entities := irido.ParseMarkdown(md)
+	if text != doc.Text || len(entities) != len(doc.Entities) {
+		t.Errorf("round trip: %q -> %q -> %q %+v", input, md, text, entities)
+	}
+}
+
+func TestMarkdown_Pre(t *testing.T) {
+	doc := &irido.Irido{
+		V:        irido.Version,
+		Text:     "a ``` b",
+		Entities: []irido.Entity{{Type: irido.EntityPre, Offset: 0, Length: 7, Language: "sh"}},
+	}
+	got, _ := Markdown(doc, Options{})
+	if want := "````sh\na ``` b\n````"; got != want {
+		t.Errorf("Markdown() = %q, want %q", got, want)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	doc := testDoc()
+	doc.Media = []irido.Media{{Type: "file", Ref: "f2", Name: "notes.pdf"}}
+
+	got, err := PlainText(doc, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "hi @Bob <B>, see <docs> (https://example.com/a_(b)) and run x := 1\n[FILE 'notes.pdf'] /v0/file/f2"
+	if got != want {
+		t.Errorf("PlainText() = %q, want %q", got, want)
+	}
+}
+
+func TestInvalidRangesDropped(t *testing.T) {
+	doc := &irido.Irido{
+		V:    irido.Version,
+		Text: "abcdef",
+		Entities: []irido.Entity{
+			{Type: irido.EntityBold, Offset: 0, Length: 4},
+			{Type: irido.EntityItalic, Offset: 2, Length: 4}, // Partial overlap
+			{Type: irido.EntityStrike, Offset: 4, Length: 9}, // Out of range
+			{Type: irido.EntityLink, Offset: 4, Length: 2, URL: "javascript:x"},
+		},
+	}
+	got, err := HTML(doc, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<div class="irido-text"><strong>abcd</strong>ef</div>`; got != want {
+		t.Errorf("HTML() = %q, want %q", got, want)
+	}
+}
+
+func TestNilContent(t *testing.T) {
+	for _, fn := range []func(any, Options) (string, error){PlainText, HTML, Markdown} {
+		if got, err := fn(nil, Options{}); got != "" || err != nil {
+			t.Errorf("got %q, %v for nil content", got, err)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	doc := &irido.Irido{
+		V: irido.Version,
+		Poll: &irido.Poll{
+			Question: "Lunch <today>?",
+			Options:  []irido.PollOption{{Text: "Yes"}, {Text: "*No*"}},
+		},
+	}
+
+	got, _ := HTML(doc, Options{})
+	if want := `<div class="irido-poll"><p>Lunch &lt;today&gt;?</p><ol><li>Yes</li><li>*No*</li></ol></div>`; got != want {
+		t.Errorf("HTML() = %q, want %q", got, want)
+	}
+	got, _ = Markdown(doc, Options{})
+	if want := "**Lunch \\<today\\>?**\n\n1. Yes\n2. \\*No\\*"; got != want {
+		t.Errorf("Markdown() = %q, want %q", got, want)
+	}
+	got, _ = PlainText(doc, Options{})
+	if want := "[POLL 'Lunch <today>?']\n- Yes\n- *No*"; got != want {
+		t.Errorf("PlainText() = %q, want %q", got, want)
+	}
+}
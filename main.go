@@ -18,6 +18,7 @@ import (
 	"github.com/scalecode-solutions/mvchat2/email"
 	"github.com/scalecode-solutions/mvchat2/media"
 	"github.com/scalecode-solutions/mvchat2/middleware"
+	"github.com/scalecode-solutions/mvchat2/push"
 	"github.com/scalecode-solutions/mvchat2/redis"
 	"github.com/scalecode-solutions/mvchat2/store"
 )
@@ -113,9 +114,9 @@ func main() {
 	go hub.Run()
 
 	// Start Redis pub/sub listener if enabled
+	var pubsubCtx context.Context
 	var pubsubCancel context.CancelFunc
 	if redisClient != nil {
-		var pubsubCtx context.Context
 		pubsubCtx, pubsubCancel = context.WithCancel(context.Background())
 
 		// Subscribe to node-specific channel
@@ -133,9 +134,13 @@ func main() {
 	presence := NewPresenceManager(hub, db)
 	hub.SetPresence(presence)
 
-	// Start presence heartbeat if Redis is enabled
+	// Start presence heartbeat and share presence graph changes if Redis is enabled
 	if redisClient != nil {
 		presence.StartHeartbeat(context.Background())
+
+		presencePubsub := redisClient.NewPubSub(presence.HandlePubSubMessage)
+		presencePubsub.Subscribe(pubsubCtx, presenceChannel)
+		go presencePubsub.Listen(pubsubCtx)
 	}
 
 	// Initialize encryptor for message content
@@ -167,6 +172,25 @@ func main() {
 	// Initialize handlers
 	handlers := NewHandlers(db, authService, hub, encryptor, emailService, inviteTokenGen, cfg)
 
+	// Initialize push notifications (disabled by default)
+	if cfg.Push.Enabled {
+		pushService, err := newPushService(&cfg.Push)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize push notifications: %v\n", err)
+			os.Exit(1)
+		}
+		handlers.SetPush(pushService)
+		fmt.Println("Push notifications enabled")
+	}
+
+	// Start periodic cleanup (message expiry, stale pins, poll deadlines)
+	// and the scheduled message dispatcher and push sender
+	maintenanceCtx, maintenanceCancel := context.WithCancel(context.Background())
+	defer maintenanceCancel()
+	handlers.StartMaintenance(maintenanceCtx)
+	handlers.StartScheduler(maintenanceCtx)
+	handlers.StartPushSender(maintenanceCtx)
+
 	// Initialize media processor
 	mediaProcessor := media.NewProcessor(media.Config{
 		UploadPath:    cfg.Media.UploadDir,
@@ -243,6 +267,63 @@ func main() {
 	fmt.Println("Server stopped")
 }
 
+// newPushService creates the push service with a provider for each enabled platform.
+func newPushService(cfg *config.PushConfig) (*push.Service, error) {
+	svc := push.New()
+
+	if cfg.APNs.Enabled {
+		key, err := os.ReadFile(cfg.APNs.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read apns key: %w", err)
+		}
+		endpoint := cfg.APNs.Endpoint
+		if endpoint == "" && cfg.APNs.Sandbox {
+			endpoint = push.APNsSandbox
+		}
+		apns, err := push.NewAPNs(push.APNsConfig{
+			KeyID:    cfg.APNs.KeyID,
+			TeamID:   cfg.APNs.TeamID,
+			Topic:    cfg.APNs.Topic,
+			Key:      key,
+			Endpoint: endpoint,
+		})
+		if err != nil {
+			return nil, err
+		}
+		svc.Register(push.PlatformAPNs, apns)
+	}
+
+	if cfg.FCM.Enabled {
+		creds, err := os.ReadFile(cfg.FCM.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read fcm credentials: %w", err)
+		}
+		fcm, err := push.NewFCM(push.FCMConfig{
+			Credentials: creds,
+			Endpoint:    cfg.FCM.Endpoint,
+		})
+		if err != nil {
+			return nil, err
+		}
+		svc.Register(push.PlatformFCM, fcm)
+	}
+
+	if cfg.WebPush.Enabled {
+		webPush, err := push.NewWebPush(push.WebPushConfig{
+			PublicKey:     cfg.WebPush.VAPIDPublicKey,
+			PrivateKey:    cfg.WebPush.VAPIDPrivateKey,
+			Subject:       cfg.WebPush.Subject,
+			AllowInsecure: cfg.WebPush.AllowInsecure,
+		})
+		if err != nil {
+			return nil, err
+		}
+		svc.Register(push.PlatformWebPush, webPush)
+	}
+
+	return svc, nil
+}
+
 // generateSecureKey generates a cryptographically secure random key.
 func generateSecureKey(bytes int) string {
 	key := make([]byte, bytes)
@@ -275,4 +356,17 @@ func printGeneratedKeys() {
 	fmt.Printf("  api_key_salt: %s\n", generateSecureKey(32))
 	fmt.Println("  token:")
 	fmt.Printf("    key: %s\n", generateSecureKey(32))
+
+	// VAPID keys identify this server to browser push services. Unlike the
+	// keys above they are only needed with push.webpush enabled, and
+	// changing them invalidates existing browser subscriptions.
+	vapidPublic, vapidPrivate, err := push.GenerateVAPIDKeys()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate VAPID keys: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("")
+	fmt.Println("# Web Push (VAPID) keys:")
+	fmt.Printf("export VAPID_PUBLIC_KEY='%s'\n", vapidPublic)
+	fmt.Printf("export VAPID_PRIVATE_KEY='%s'\n", vapidPrivate)
 }
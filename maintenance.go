@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maintenanceInterval is how often periodic cleanup runs.
+const maintenanceInterval = time.Minute
+
+// StartMaintenance starts a goroutine that periodically drops expired
+// messages from the search index, removes pins and saved messages that are
+// no longer visible, and closes polls past their deadline.
+func (h *Handlers) StartMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				h.runMaintenance(ctx)
+			}
+		}
+	}()
+}
+
+// runMaintenance performs one round of periodic cleanup.
+func (h *Handlers) runMaintenance(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	defer cancel()
+
+	if n, err := h.db.PurgeExpiredMessageIndex(ctx); err != nil {
+		slog.Error("purge expired message index failed", "error", err)
+	} else if n > 0 {
+		slog.Debug("purged expired message index", "count", n)
+	}
+
+	pins, err := h.db.RemoveExpiredPins(ctx)
+	if err != nil {
+		slog.Error("remove expired pins failed", "error", err)
+	}
+	now := time.Now().UTC()
+	for _, p := range pins {
+		h.broadcastToConv(ctx, p.ConversationID, &MsgServerInfo{
+			ConversationID: p.ConversationID.String(),
+			What:           "unpin",
+			Seq:            p.Seq,
+			Ts:             now,
+		}, "")
+	}
+
+	if n, err := h.db.RemoveUnavailableSavedMessages(ctx); err != nil {
+		slog.Error("remove unavailable saved messages failed", "error", err)
+	} else if n > 0 {
+		slog.Debug("removed unavailable saved messages", "count", n)
+	}
+
+	polls, err := h.db.CloseDuePolls(ctx)
+	if err != nil {
+		slog.Error("close due polls failed", "error", err)
+	}
+	for i := range polls {
+		results, _, err := h.pollResults(ctx, &polls[i], uuid.Nil)
+		if err != nil {
+			slog.Error("tally closed poll failed", "conv", polls[i].ConversationID, "seq", polls[i].Seq, "error", err)
+			continue
+		}
+		h.broadcastPollUpdate(ctx, &polls[i], results, "")
+	}
+}
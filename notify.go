@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/irido"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// Notification levels, per conversation or as a user's default.
+const (
+	notifyAll      = "all"
+	notifyMentions = "mentions"
+	notifyNone     = "none"
+)
+
+// validNotifyLevel reports whether level is a known notification level.
+func validNotifyLevel(level string) bool {
+	return level == notifyAll || level == notifyMentions || level == notifyNone
+}
+
+// isMuted reports whether a conversation is muted at now: indefinitely, or
+// until a time that hasn't passed yet. Timed mutes lapse on their own.
+func isMuted(muted bool, until *time.Time, now time.Time) bool {
+	return muted || (until != nil && until.After(now))
+}
+
+// inQuietHours reports whether now falls within a user's quiet hours.
+// An unknown time zone is treated as UTC.
+func inQuietHours(q *store.QuietHours, now time.Time) bool {
+	if q == nil || q.Start == q.End {
+		return false
+	}
+	loc, err := time.LoadLocation(q.TZ)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if q.Start < q.End {
+		return minute >= q.Start && minute < q.End
+	}
+	// Runs past midnight
+	return minute >= q.Start || minute < q.End
+}
+
+// shouldNotify decides whether a member is notified of a new message.
+// Mentioned covers being mentioned in or replied to by the message. Urgent
+// messages and senders on the member's bypass list ignore quiet hours, but
+// not mutes or the notification level.
+func shouldNotify(ns store.NotifySetting, mentioned, urgent bool, now time.Time) bool {
+	if ns.Blocked || isMuted(ns.Muted, ns.MutedUntil, now) {
+		return false
+	}
+	switch ns.Level {
+	case notifyNone:
+		return false
+	case notifyMentions:
+		if !mentioned {
+			return false
+		}
+	}
+	if !urgent && !ns.BypassQuiet && inQuietHours(ns.QuietHours, now) {
+		return false
+	}
+	return true
+}
+
+// mentionedUsers returns the users a message mentions or replies to.
+func mentionedUsers(doc *irido.Irido) []uuid.UUID {
+	if doc == nil {
+		return nil
+	}
+	var ids []uuid.UUID
+	for _, m := range doc.Mentions {
+		if id, err := uuid.Parse(m.UserID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if doc.Reply != nil {
+		if id, err := uuid.Parse(doc.Reply.From); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// notifyRecipients returns the members of a conversation to notify of a
+// message from senderID. Every notification the server sends outside of
+// live sessions is decided here.
+func (h *Handlers) notifyRecipients(ctx context.Context, convID, senderID uuid.UUID, mentioned []uuid.UUID, urgent bool) ([]uuid.UUID, error) {
+	settings, err := h.db.GetNotifySettings(ctx, convID, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	isMentioned := make(map[uuid.UUID]bool, len(mentioned))
+	for _, id := range mentioned {
+		isMentioned[id] = true
+	}
+
+	now := time.Now().UTC()
+	var recipients []uuid.UUID
+	for _, ns := range settings {
+		if ns.UserID != senderID && shouldNotify(ns, isMentioned[ns.UserID], urgent, now) {
+			recipients = append(recipients, ns.UserID)
+		}
+	}
+	return recipients, nil
+}
+
+// notifySettings validates a dm or room request's notification settings and
+// adds them to settings. A mute end time replaces an indefinite mute. On
+// failure it sends an error response and returns false.
+func notifySettings(s SessionInterface, msgID string, settings *store.MemberSettings, muted *bool, until *time.Time, notify *string) bool {
+	settings.Muted = muted
+	if until != nil {
+		if !until.After(time.Now()) {
+			s.Send(CtrlError(msgID, CodeBadRequest, "mute end must be in the future"))
+			return false
+		}
+		unmuted := false
+		t := until.UTC()
+		settings.Muted = &unmuted
+		settings.MutedUntil = &t
+	}
+	if notify != nil {
+		if *notify != "" && !validNotifyLevel(*notify) {
+			s.Send(CtrlError(msgID, CodeBadRequest, "invalid notify level"))
+			return false
+		}
+		settings.Notify = notify
+	}
+	return true
+}
+
+// notifySettingsResponse adds updated notification settings to a response.
+func notifySettingsResponse(response map[string]any, settings store.MemberSettings) {
+	if settings.MutedUntil != nil {
+		response["muted"] = true
+		response["mutedUntil"] = *settings.MutedUntil
+	} else if settings.Muted != nil {
+		response["muted"] = *settings.Muted
+	}
+	if settings.Notify != nil {
+		response["notify"] = *settings.Notify
+	}
+}
+
+// notifySettingsItem adds a member's notification settings to a
+// conversation response item. Muted reflects any timed mute still running.
+func notifySettingsItem(item map[string]any, muted bool, until *time.Time, notify *string) {
+	now := time.Now().UTC()
+	item["muted"] = isMuted(muted, until, now)
+	if until != nil && until.After(now) {
+		item["mutedUntil"] = *until
+	}
+	if notify != nil {
+		item["notify"] = *notify
+	}
+}
+
+// parseQuietHours converts an account request's quiet hours to the stored
+// form. Empty start and end turn quiet hours off (nil).
+func parseQuietHours(q *MsgQuietHours) (*store.QuietHours, error) {
+	if q.Start == "" && q.End == "" {
+		return nil, nil
+	}
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, errors.New("quiet hours start and end must differ")
+	}
+	tz := q.TZ
+	if tz == "" {
+		tz = "UTC"
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return nil, errors.New("invalid time zone")
+	}
+	return &store.QuietHours{Start: start, End: end, TZ: tz}, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.New("invalid quiet hours time")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// quietHoursResponse formats stored quiet hours for clients.
+func quietHoursResponse(q *store.QuietHours) map[string]any {
+	return map[string]any{
+		"start": fmt.Sprintf("%02d:%02d", q.Start/60, q.Start%60),
+		"end":   fmt.Sprintf("%02d:%02d", q.End/60, q.End%60),
+		"tz":    q.TZ,
+	}
+}
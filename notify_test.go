@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/crypto"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+func TestShouldNotify(t *testing.T) {
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	// Quiet hours covering now, in a zone other than UTC
+	loc, _ := time.LoadLocation("America/Chicago")
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	quiet := &store.QuietHours{Start: (minute + 1440 - 60) % 1440, End: (minute + 60) % 1440, TZ: "America/Chicago"}
+
+	tests := []struct {
+		name      string
+		setting   store.NotifySetting
+		mentioned bool
+		urgent    bool
+		want      bool
+	}{
+		{"all", store.NotifySetting{Level: notifyAll}, false, false, true},
+		{"unset level", store.NotifySetting{}, false, false, true},
+		{"mentions without mention", store.NotifySetting{Level: notifyMentions}, false, false, false},
+		{"mentions with mention", store.NotifySetting{Level: notifyMentions}, true, false, true},
+		{"none", store.NotifySetting{Level: notifyNone}, true, false, false},
+		{"muted", store.NotifySetting{Level: notifyAll, Muted: true}, true, false, false},
+		{"timed mute running", store.NotifySetting{Level: notifyAll, MutedUntil: &future}, true, false, false},
+		{"timed mute lapsed", store.NotifySetting{Level: notifyAll, MutedUntil: &past}, false, false, true},
+		{"blocked", store.NotifySetting{Level: notifyAll, Blocked: true}, true, false, false},
+		{"quiet hours", store.NotifySetting{Level: notifyAll, QuietHours: quiet}, true, false, false},
+		{"quiet hours urgent", store.NotifySetting{Level: notifyAll, QuietHours: quiet}, false, true, true},
+		{"quiet hours bypass", store.NotifySetting{Level: notifyAll, QuietHours: quiet, BypassQuiet: true}, false, false, true},
+		{"urgent while muted", store.NotifySetting{Level: notifyAll, Muted: true}, false, true, false},
+		{"urgent below level", store.NotifySetting{Level: notifyMentions}, false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldNotify(tt.setting, tt.mentioned, tt.urgent, now); got != tt.want {
+				t.Errorf("shouldNotify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyRecipients(t *testing.T) {
+	senderID := uuid.New()
+	allID := uuid.New()
+	mentionedID := uuid.New()
+	quietID := uuid.New()
+
+	mockStore := &store.MockStore{
+		GetNotifySettingsFn: func(ctx context.Context, cID, sID uuid.UUID) ([]store.NotifySetting, error) {
+			return []store.NotifySetting{
+				{UserID: senderID, Level: notifyAll},
+				{UserID: allID, Level: notifyAll},
+				{UserID: mentionedID, Level: notifyMentions},
+				{UserID: quietID, Level: notifyMentions},
+			}, nil
+		},
+	}
+	h := testHandlers(mockStore)
+
+	got, err := h.notifyRecipients(context.Background(), uuid.New(), senderID, []uuid.UUID{mentionedID, senderID}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != allID || got[1] != mentionedID {
+		t.Errorf("expected %v and %v, got %v", allID, mentionedID, got)
+	}
+}
+
+func TestHandleManageDM_NotifySettings(t *testing.T) {
+	userID := uuid.New()
+	convID := uuid.New()
+	until := time.Now().Add(8 * time.Hour).UTC()
+	level := notifyMentions
+
+	var got store.MemberSettings
+	mockStore := &store.MockStore{
+		IsMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (bool, error) {
+			return true, nil
+		},
+		UpdateMemberSettingsFn: func(ctx context.Context, cID, uID uuid.UUID, settings store.MemberSettings) error {
+			got = settings
+			return nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(userID)
+
+	h.handleDM(sess, &ClientMessage{
+		ID: "test-1",
+		DM: &MsgClientDM{ConversationID: convID.String(), MutedUntil: &until, Notify: &level},
+	})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK {
+		t.Fatalf("expected code %d, got %d: %s", CodeOK, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+	if got.MutedUntil == nil || !got.MutedUntil.Equal(until) {
+		t.Errorf("expected mute until %v, got %v", until, got.MutedUntil)
+	}
+	if got.Muted == nil || *got.Muted {
+		t.Error("expected a timed mute to replace an indefinite one")
+	}
+	if got.Notify == nil || *got.Notify != notifyMentions {
+		t.Errorf("expected notify level mentions, got %v", got.Notify)
+	}
+	if resp.Ctrl.Params["muted"] != true || resp.Ctrl.Params["notify"] != notifyMentions {
+		t.Errorf("unexpected response: %v", resp.Ctrl.Params)
+	}
+}
+
+func TestHandleRoomSettings_Validation(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	bogus := "loud"
+
+	tests := []struct {
+		name string
+		room *MsgClientRoom
+		want string
+	}{
+		{"past mute", &MsgClientRoom{MutedUntil: &past}, "mute end must be in the future"},
+		{"unknown level", &MsgClientRoom{Notify: &bogus}, "invalid notify level"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &store.MockStore{
+				IsMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (bool, error) {
+					return true, nil
+				},
+				UpdateMemberSettingsFn: func(ctx context.Context, cID, uID uuid.UUID, settings store.MemberSettings) error {
+					t.Error("settings should not be stored")
+					return nil
+				},
+			}
+			h := testHandlers(mockStore)
+			sess := newTestSession(uuid.New())
+
+			tt.room.ID = uuid.New().String()
+			tt.room.Action = "settings"
+			h.handleRoom(sess, &ClientMessage{ID: "test-1", Room: tt.room})
+
+			resp := sess.LastMessage()
+			if resp.Ctrl.Code != CodeBadRequest || resp.Ctrl.Text != tt.want {
+				t.Errorf("expected 400 %q, got %d %q", tt.want, resp.Ctrl.Code, resp.Ctrl.Text)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateAccount_NotifyDefault(t *testing.T) {
+	var got string
+	mockStore := &store.MockStore{
+		UpdateUserNotifyDefaultFn: func(ctx context.Context, uID uuid.UUID, level string) error {
+			got = level
+			return nil
+		},
+	}
+
+	h := testHandlers(mockStore)
+	sess := newTestSession(uuid.New())
+
+	level := notifyNone
+	h.handleAcc(sess, &ClientMessage{ID: "test-1", Acc: &MsgClientAcc{User: "me", Notify: &level}})
+
+	resp := sess.LastMessage()
+	if resp.Ctrl.Code != CodeOK || got != notifyNone {
+		t.Errorf("expected default level none stored, got %q (%d %s)", got, resp.Ctrl.Code, resp.Ctrl.Text)
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	// 23:30 and 12:00 in New York (UTC-5 in January)
+	night := time.Date(2026, 1, 15, 4, 30, 0, 0, time.UTC)
+	noon := time.Date(2026, 1, 15, 17, 0, 0, 0, time.UTC)
+	overnight := &store.QuietHours{Start: 22 * 60, End: 7 * 60, TZ: "America/New_York"}
+	daytime := &store.QuietHours{Start: 9 * 60, End: 17 * 60, TZ: "America/New_York"}
+
+	tests := []struct {
+		name  string
+		quiet *store.QuietHours
+		now   time.Time
+		want  bool
+	}{
+		{"none", nil, night, false},
+		{"overnight at night", overnight, night, true},
+		{"overnight at noon", overnight, noon, false},
+		{"daytime at noon", daytime, noon, true},
+		{"daytime at night", daytime, night, false},
+		{"unknown zone falls back to UTC", &store.QuietHours{Start: 4 * 60, End: 5 * 60, TZ: "Nowhere/Nope"}, night, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inQuietHours(tt.quiet, tt.now); got != tt.want {
+				t.Errorf("inQuietHours() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	q, err := parseQuietHours(&MsgQuietHours{Start: "22:30", End: "07:00", TZ: "Europe/London"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Start != 22*60+30 || q.End != 7*60 || q.TZ != "Europe/London" {
+		t.Errorf("unexpected quiet hours %+v", q)
+	}
+	if resp := quietHoursResponse(q); resp["start"] != "22:30" || resp["end"] != "07:00" {
+		t.Errorf("unexpected response %v", resp)
+	}
+
+	if q, err := parseQuietHours(&MsgQuietHours{}); err != nil || q != nil {
+		t.Errorf("expected empty quiet hours to turn them off, got %+v, %v", q, err)
+	}
+
+	for _, bad := range []*MsgQuietHours{
+		{Start: "25:00", End: "07:00"},
+		{Start: "22:00"},
+		{Start: "07:00", End: "07:00"},
+		{Start: "22:00", End: "07:00", TZ: "Mars/Olympus"},
+	} {
+		if _, err := parseQuietHours(bad); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestHandleSend_Urgent(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+	convID := uuid.New()
+
+	tests := []struct {
+		name     string
+		convType string
+		role     string
+		contact  bool
+		code     int
+	}{
+		{"room admin", "room", "admin", false, CodeAccepted},
+		{"room member", "room", "member", false, CodeForbidden},
+		{"dm contact", "dm", "member", true, CodeAccepted},
+		{"dm stranger", "dm", "member", false, CodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var head json.RawMessage
+			mockStore := &store.MockStore{
+				GetMemberFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.Member, error) {
+					return &store.Member{ConversationID: convID, UserID: userID, Role: tt.role}, nil
+				},
+				GetConversationByIDFn: func(ctx context.Context, id uuid.UUID) (*store.Conversation, error) {
+					return &store.Conversation{ID: convID, Type: tt.convType}, nil
+				},
+				GetDMOtherUserFn: func(ctx context.Context, cID, uID uuid.UUID) (*store.User, error) {
+					return &store.User{ID: otherID}, nil
+				},
+				IsContactFn: func(ctx context.Context, uID, cID uuid.UUID) (bool, error) {
+					return tt.contact && uID == otherID && cID == userID, nil
+				},
+				CreateMessageFn: func(ctx context.Context, cID, fromID uuid.UUID, content []byte, h json.RawMessage) (*store.Message, error) {
+					head = h
+					return &store.Message{ID: uuid.New(), ConversationID: cID, Seq: 1, CreatedAt: time.Now()}, nil
+				},
+			}
+			encryptor, _ := crypto.NewEncryptor([]byte("test-key-32-bytes-long-for-test!"))
+			h := &Handlers{db: mockStore, encryptor: encryptor}
+			sess := newTestSession(userID)
+
+			h.handleSend(sess, &ClientMessage{ID: "1", Send: &MsgClientSend{
+				ConversationID: convID.String(),
+				Content:        json.RawMessage(`{"v":1,"text":"help"}`),
+				Urgent:         true,
+			}})
+
+			resp := sess.LastMessage()
+			if resp == nil || resp.Ctrl == nil || resp.Ctrl.Code != tt.code {
+				t.Fatalf("expected %d, got %+v", tt.code, resp.Ctrl)
+			}
+			if tt.code == CodeAccepted && !strings.Contains(string(head), `"urgent":true`) {
+				t.Errorf("expected urgent in head, got %s", head)
+			}
+		})
+	}
+}
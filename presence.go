@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,19 +13,148 @@ import (
 	"github.com/scalecode-solutions/mvchat2/store"
 )
 
+// Presence states. Available is stored as an empty state.
+const (
+	presAvailable = "available"
+	presAway      = "away"
+	presBusy      = "busy"
+	presDND       = "dnd"
+	presInvisible = "invisible"
+)
+
+// livePresence is an online user's presence. It is kept in Redis when enabled
+// so every node agrees, and in memory otherwise.
+type livePresence struct {
+	store.Presence
+	// Every session the user has reported itself idle
+	Idle bool `json:"idle,omitempty"`
+}
+
+// state returns the state others see: the chosen one, or away while idle.
+func (lp *livePresence) state() string {
+	switch {
+	case lp.State != "":
+		return lp.State
+	case lp.Idle:
+		return presAway
+	}
+	return presAvailable
+}
+
+// invisible reports whether the user chose to appear offline.
+func invisible(pr *store.Presence) bool {
+	return pr != nil && pr.State == presInvisible
+}
+
+// activeStatus returns the custom status and its expiry, or nothing once it
+// has expired.
+func activeStatus(pr *store.Presence, now time.Time) (string, *time.Time) {
+	if pr.StatusExpires != nil && !now.Before(*pr.StatusExpires) {
+		return "", nil
+	}
+	return pr.Status, pr.StatusExpires
+}
+
+// onlinePres builds the notification for a user others see online.
+func onlinePres(userID uuid.UUID, lp *livePresence) *MsgServerPres {
+	pres := &MsgServerPres{UserID: userID.String(), What: "on", State: lp.state()}
+	pres.Status, pres.StatusExpires = activeStatus(&lp.Presence, time.Now())
+	return pres
+}
+
+// offlinePres builds the notification for a user others see offline.
+func offlinePres(userID uuid.UUID, pr *store.Presence, lastSeen *time.Time) *MsgServerPres {
+	pres := &MsgServerPres{UserID: userID.String(), What: "off", LastSeen: lastSeen}
+	if pr != nil {
+		pres.Status, pres.StatusExpires = activeStatus(pr, time.Now())
+	}
+	return pres
+}
+
+// presenceAllows reports whether a user's privacy settings let other see
+// their presence; isContact is whether the user has other as a contact.
+func presenceAllows(privacy *store.PresencePrivacy, other uuid.UUID, isContact bool) bool {
+	if privacy == nil {
+		return true
+	}
+	excepted := slices.Contains(privacy.Exceptions, other)
+	switch privacy.Level {
+	case store.PresenceContacts:
+		return isContact != excepted
+	case store.PresenceNobody:
+		return excepted
+	}
+	return !excepted
+}
+
+// presenceMutual reports whether a user and another may see each other's
+// presence: both users' settings must allow it. ownContact is whether the
+// user has the other as a contact, theirContact the reverse.
+func presenceMutual(userID uuid.UUID, own *store.PresencePrivacy, ownContact bool, other uuid.UUID, theirs *store.PresencePrivacy, theirContact bool) bool {
+	return presenceAllows(own, other, ownContact) && presenceAllows(theirs, userID, theirContact)
+}
+
+// presenceAudience returns which of others may see userID's presence. The
+// rule is mutual, so it is also whose presence userID may see: a user who
+// hides their presence from someone can't see theirs either. Nobody is
+// visible if the settings can't be loaded.
+func presenceAudience(ctx context.Context, db store.Store, userID uuid.UUID, others []uuid.UUID) map[uuid.UUID]bool {
+	visible := make(map[uuid.UUID]bool, len(others))
+	if len(others) == 0 {
+		return visible
+	}
+	peers, err := db.GetPresencePeers(ctx, userID, append(slices.Clip(others), userID))
+	if err != nil {
+		log.Printf("presence: failed to load privacy settings for user %s: %v", shortID(userID), err)
+		return visible
+	}
+
+	own := peers[userID].Privacy
+	for _, id := range others {
+		if id == userID {
+			visible[id] = true
+			continue
+		}
+		peer, ok := peers[id]
+		if !ok {
+			continue
+		}
+		visible[id] = presenceMutual(userID, own, peer.IsContact, id, peer.Privacy, peer.ContactOf)
+	}
+	return visible
+}
+
 // PresenceManager handles online/offline status and notifications.
 type PresenceManager struct {
 	hub   *Hub
-	db    *store.DB
+	db    store.Store
 	redis *redis.Client
+	// Who follows whose presence
+	graph *presenceGraph
+
+	// Serializes read-modify-write of presence records on this node
+	mu sync.Mutex
+	// Presence records when Redis is disabled
+	live map[uuid.UUID]*livePresence
+
+	subsMu sync.Mutex
+	// Explicit presence subscriptions by session ID
+	subs map[string]*presenceSubs
+	// Session IDs subscribed to each user by name
+	watchers map[uuid.UUID]map[string]bool
 }
 
 // NewPresenceManager creates a new presence manager.
-func NewPresenceManager(hub *Hub, db *store.DB) *PresenceManager {
+func NewPresenceManager(hub *Hub, db store.Store) *PresenceManager {
 	return &PresenceManager{
 		hub:   hub,
 		db:    db,
 		redis: hub.redis,
+		graph: newPresenceGraph(db, hub.redis),
+		live:  make(map[uuid.UUID]*livePresence),
+
+		subs:     make(map[string]*presenceSubs),
+		watchers: make(map[uuid.UUID]map[string]bool),
 	}
 }
 
@@ -38,20 +170,25 @@ func (p *PresenceManager) UserOnline(userID uuid.UUID) {
 		}
 	}
 
-	// Get all users who should be notified (DM partners and group members)
-	notifyUsers := p.getPresenceSubscribers(ctx, userID)
-
-	// Send online notification
-	presMsg := &ServerMessage{
-		Pres: &MsgServerPres{
-			UserID: userID.String(),
-			What:   "on",
-		},
+	// Start from the presence the user chose last time
+	lp := &livePresence{}
+	user, err := p.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("presence: failed to load user %s: %v", shortID(userID), err)
+	}
+	if user != nil && user.Presence != nil {
+		lp.Presence = *user.Presence
 	}
+	p.mu.Lock()
+	p.save(ctx, userID, lp)
+	p.mu.Unlock()
 
-	for _, uid := range notifyUsers {
-		p.hub.SendToUser(uid, presMsg)
+	if lp.State == presInvisible {
+		return
 	}
+
+	// Send online notification
+	p.notify(ctx, userID, onlinePres(userID, lp), nil)
 }
 
 // UserOffline is called when a user goes offline (last session disconnects).
@@ -65,97 +202,306 @@ func (p *PresenceManager) UserOffline(userID uuid.UUID) {
 			log.Printf("presence: failed to set offline for user %s: %v", shortID(userID), err)
 		}
 	}
+	p.mu.Lock()
+	p.forget(ctx, userID)
+	p.mu.Unlock()
+
+	// An invisible user already looks offline, as of when they went invisible
+	user, _ := p.db.GetUserByID(ctx, userID)
+	if user != nil && invisible(user.Presence) {
+		p.graph.forget(userID)
+		return
+	}
 
 	// Update last_seen in database
 	p.db.UpdateUserLastSeen(ctx, userID, "")
+	lastSeen := time.Now().UTC()
 
-	// Get user's last seen time
-	user, _ := p.db.GetUserByID(ctx, userID)
-	var lastSeen *time.Time
+	var chosen *store.Presence
 	if user != nil {
-		lastSeen = user.LastSeen
+		chosen = user.Presence
 	}
 
-	// Get all users who should be notified
-	notifyUsers := p.getPresenceSubscribers(ctx, userID)
-
 	// Send offline notification
-	presMsg := &ServerMessage{
-		Pres: &MsgServerPres{
-			UserID:   userID.String(),
-			What:     "off",
-			LastSeen: lastSeen,
-		},
+	p.notify(ctx, userID, offlinePres(userID, chosen, &lastSeen), nil)
+	p.graph.forget(userID)
+}
+
+// SetPresence applies a presence the user has chosen and tells everyone who
+// follows their presence. Going invisible looks like going offline.
+func (p *PresenceManager) SetPresence(userID uuid.UUID, chosen store.Presence) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p.mu.Lock()
+	lp := p.load(ctx, userID)
+	if lp == nil {
+		lp = &livePresence{}
 	}
+	wasInvisible := lp.State == presInvisible
+	lp.Presence = chosen
+	p.save(ctx, userID, lp)
+	p.mu.Unlock()
 
-	for _, uid := range notifyUsers {
-		p.hub.SendToUser(uid, presMsg)
+	switch {
+	case chosen.State != presInvisible:
+		p.notify(ctx, userID, onlinePres(userID, lp), nil)
+	case !wasInvisible:
+		p.db.UpdateUserLastSeen(ctx, userID, "")
+		lastSeen := time.Now().UTC()
+		p.notify(ctx, userID, offlinePres(userID, &chosen, &lastSeen), nil)
 	}
 }
 
-// getPresenceSubscribers returns all users who should receive presence updates for a user.
-// This includes DM partners and group members.
-func (p *PresenceManager) getPresenceSubscribers(ctx context.Context, userID uuid.UUID) []uuid.UUID {
-	subscribers := make(map[uuid.UUID]bool)
+// PrivacyChanged re-announces a user's presence after they change who may
+// see it, so users who lost sight of it stop showing them online.
+func (p *PresenceManager) PrivacyChanged(userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	// Get all conversations the user is in
-	convs, err := p.db.GetUserConversations(ctx, userID)
-	if err != nil {
-		return nil
+	p.graph.invalidate(userID)
+	user, err := p.db.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		return
 	}
+	p.notify(ctx, userID, p.presenceOf(ctx, user), offlinePres(userID, user.Presence, nil))
+}
 
-	for _, conv := range convs {
-		// Get members of each conversation
-		members, err := p.db.GetConversationMembers(ctx, conv.Conversation.ID)
-		if err != nil {
+// RefreshIdle recomputes whether all of a user's sessions are idle, and
+// announces the change when it moves an available user to away or back.
+func (p *PresenceManager) RefreshIdle(userID uuid.UUID) {
+	sessions := p.hub.GetUserSessions(userID)
+	if len(sessions) == 0 {
+		return
+	}
+	idle := true
+	for _, sess := range sessions {
+		if !sess.Idle() {
+			idle = false
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p.mu.Lock()
+	lp := p.load(ctx, userID)
+	if lp == nil || lp.Idle == idle {
+		p.mu.Unlock()
+		return
+	}
+	lp.Idle = idle
+	p.save(ctx, userID, lp)
+	p.mu.Unlock()
+
+	// Idleness only shows for users who haven't chosen a state
+	if lp.State != "" {
+		return
+	}
+	p.notify(ctx, userID, onlinePres(userID, lp), nil)
+}
+
+// notify sends a presence change to the sessions interested in userID's
+// presence: pres to those its privacy settings allow, and hidden, if set, to
+// the rest. Only sessions on this node are considered.
+func (p *PresenceManager) notify(ctx context.Context, userID uuid.UUID, pres, hidden *MsgServerPres) {
+	var userConvs, contacts map[uuid.UUID]bool
+	if n, _ := p.graph.node(ctx, userID); n != nil {
+		userConvs, contacts = n.convs, n.contacts
+	}
+
+	// Sessions of users sharing a conversation, then those subscribed by name
+	targets := make(map[uuid.UUID][]*Session)
+	subscribers := p.getPresenceSubscribers(ctx, userID)
+	for _, uid := range subscribers {
+		for _, sess := range p.hub.GetUserSessions(uid) {
+			if p.interested(sess.ID(), userID, userConvs) {
+				targets[uid] = append(targets[uid], sess)
+			}
+		}
+	}
+	for _, sessID := range p.watching(userID) {
+		sess := p.hub.GetSession(sessID)
+		if sess == nil || sess.UserID() == userID {
+			continue
+		}
+		// Subscribing needed a relation; it must still hold, so blocking,
+		// removing a contact or leaving the last shared room ends the updates
+		uid := sess.UserID()
+		if !contacts[uid] && !slices.Contains(subscribers, uid) {
 			continue
 		}
-		for _, memberID := range members {
-			if memberID != userID {
-				subscribers[memberID] = true
+		if !slices.Contains(targets[uid], sess) {
+			targets[uid] = append(targets[uid], sess)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	users := make([]uuid.UUID, 0, len(targets))
+	for uid := range targets {
+		users = append(users, uid)
+	}
+	visible := p.graph.audience(ctx, userID, users)
+
+	presMsg := &ServerMessage{Pres: pres}
+	for uid, sessions := range targets {
+		msg := presMsg
+		if !visible[uid] {
+			if hidden == nil {
+				continue
 			}
+			msg = &ServerMessage{Pres: hidden}
+		}
+		for _, sess := range sessions {
+			sess.Send(msg)
+		}
+	}
+}
+
+// ConversationJoined updates the presence graph for users joining a
+// conversation, including the two sides of a new DM.
+func (p *PresenceManager) ConversationJoined(convID uuid.UUID, userIDs ...uuid.UUID) {
+	p.graph.joined(convID, userIDs...)
+}
+
+// ConversationLeft updates the presence graph for a user leaving or being
+// removed from a conversation.
+func (p *PresenceManager) ConversationLeft(convID, userID uuid.UUID) {
+	p.graph.left(convID, userID)
+}
+
+// RelationsChanged drops cached presence relations for users whose blocks or
+// contacts changed.
+func (p *PresenceManager) RelationsChanged(userIDs ...uuid.UUID) {
+	p.graph.invalidate(userIDs...)
+}
+
+// HandlePubSubMessage applies presence graph changes published by other nodes.
+func (p *PresenceManager) HandlePubSubMessage(msg *redis.Message) {
+	var change presenceGraphChange
+	if err := json.Unmarshal(msg.Payload, &change); err != nil {
+		log.Printf("presence: failed to unmarshal graph change: %v", err)
+		return
+	}
+	p.graph.drop(change)
+}
+
+// load returns an online user's presence record, or nil. Callers hold p.mu.
+func (p *PresenceManager) load(ctx context.Context, userID uuid.UUID) *livePresence {
+	if p.redis == nil {
+		if lp := p.live[userID]; lp != nil {
+			cp := *lp
+			return &cp
 		}
+		return nil
 	}
+	var lp livePresence
+	found, err := p.redis.GetPresence(ctx, userID.String(), &lp)
+	if err != nil {
+		log.Printf("presence: failed to load presence for user %s: %v", shortID(userID), err)
+		return nil
+	}
+	if !found {
+		return nil
+	}
+	return &lp
+}
 
-	// Convert map to slice
-	result := make([]uuid.UUID, 0, len(subscribers))
-	for uid := range subscribers {
-		result = append(result, uid)
+// save stores an online user's presence record. Callers hold p.mu.
+func (p *PresenceManager) save(ctx context.Context, userID uuid.UUID, lp *livePresence) {
+	if p.redis == nil {
+		cp := *lp
+		p.live[userID] = &cp
+		return
+	}
+	if err := p.redis.SetPresence(ctx, userID.String(), lp); err != nil {
+		log.Printf("presence: failed to save presence for user %s: %v", shortID(userID), err)
 	}
-	return result
+}
+
+// forget drops a user's presence record. Callers hold p.mu.
+func (p *PresenceManager) forget(ctx context.Context, userID uuid.UUID) {
+	if p.redis == nil {
+		delete(p.live, userID)
+		return
+	}
+	if err := p.redis.DeletePresence(ctx, userID.String()); err != nil {
+		log.Printf("presence: failed to delete presence for user %s: %v", shortID(userID), err)
+	}
+}
+
+// getPresenceSubscribers returns all users who should receive presence updates for a user.
+// This includes DM partners and group members, from the presence graph.
+func (p *PresenceManager) getPresenceSubscribers(ctx context.Context, userID uuid.UUID) []uuid.UUID {
+	subscribers, err := p.graph.subscribers(ctx, userID)
+	if err != nil {
+		log.Printf("presence: failed to load subscribers for user %s: %v", shortID(userID), err)
+		return nil
+	}
+	return subscribers
+}
+
+// related keeps the IDs of users userID shares a conversation with or has as
+// a contact, so presence can't be looked up for strangers.
+func (p *PresenceManager) related(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) []uuid.UUID {
+	n, err := p.graph.node(ctx, userID)
+	if err != nil || n == nil {
+		return nil
+	}
+	peers := setOf(p.getPresenceSubscribers(ctx, userID))
+
+	var kept []uuid.UUID
+	for _, id := range ids {
+		if id == userID || peers[id] || n.contacts[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
 }
 
 // SendPresenceProbe sends current online status of requested users.
-// Called when a client wants to know who's online.
-func (p *PresenceManager) SendPresenceProbe(s *Session, userIDs []uuid.UUID) {
+// Called when a client wants to know who's online. Users the session's user
+// shares no conversation with and doesn't have as a contact are skipped, as
+// unknown users are.
+func (p *PresenceManager) SendPresenceProbe(s SessionInterface, userIDs []uuid.UUID) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	userIDs = p.related(ctx, s.UserID(), userIDs)
+	visible := presenceAudience(ctx, p.db, s.UserID(), userIDs)
 	for _, uid := range userIDs {
 		user, err := p.db.GetUserByID(ctx, uid)
 		if err != nil || user == nil {
 			continue
 		}
+		if !visible[uid] {
+			s.Send(&ServerMessage{Pres: offlinePres(uid, user.Presence, nil)})
+			continue
+		}
+		s.Send(&ServerMessage{Pres: p.presenceOf(ctx, user)})
+	}
+}
 
-		var presMsg *ServerMessage
-		if p.IsOnline(ctx, uid) {
-			presMsg = &ServerMessage{
-				Pres: &MsgServerPres{
-					UserID: uid.String(),
-					What:   "on",
-				},
-			}
-		} else {
-			presMsg = &ServerMessage{
-				Pres: &MsgServerPres{
-					UserID:   uid.String(),
-					What:     "off",
-					LastSeen: user.LastSeen,
-				},
-			}
+// presenceOf returns a user's presence as users allowed to see it see it.
+func (p *PresenceManager) presenceOf(ctx context.Context, user *store.User) *MsgServerPres {
+	if invisible(user.Presence) || !p.IsOnline(ctx, user.ID) {
+		return offlinePres(user.ID, user.Presence, user.LastSeen)
+	}
+
+	p.mu.Lock()
+	lp := p.load(ctx, user.ID)
+	p.mu.Unlock()
+	if lp == nil {
+		// Online elsewhere before its record was written
+		lp = &livePresence{}
+		if user.Presence != nil {
+			lp.Presence = *user.Presence
 		}
-		s.Send(presMsg)
 	}
+	return onlinePres(user.ID, lp)
 }
 
 // IsOnline checks if a user is online (locally or via Redis).
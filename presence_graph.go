@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/redis"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// presenceChannel is the Redis pub/sub channel presence graph changes are
+// shared between nodes on.
+const presenceChannel = "presence"
+
+// presenceGraphMaxAge bounds how long a cached entry is trusted, in case a
+// change published by another node was missed.
+const presenceGraphMaxAge = 15 * time.Minute
+
+// presenceNode is the cached presence view of one user. Entries are never
+// modified once stored; changes replace them.
+type presenceNode struct {
+	// Conversations presence flows through (blocked DMs excluded)
+	convs    map[uuid.UUID]bool
+	contacts map[uuid.UUID]bool
+	privacy  *store.PresencePrivacy
+	loadedAt time.Time
+}
+
+// presenceConv is the cached member set of one conversation. Entries are
+// never modified once stored; changes replace them.
+type presenceConv struct {
+	members  map[uuid.UUID]bool
+	loadedAt time.Time
+}
+
+// presenceGraphChange names graph entries another node changed.
+type presenceGraphChange struct {
+	Users []uuid.UUID `json:"users,omitempty"`
+	Convs []uuid.UUID `json:"convs,omitempty"`
+}
+
+// presenceGraph caches who follows whose presence, so presence changes fan
+// out without database queries. Entries load on first use and are updated in
+// place as conversations gain and lose members; blocking, contact and privacy
+// changes drop the users involved so they reload. With Redis, every change is
+// published so other nodes drop their copies.
+type presenceGraph struct {
+	db    store.Store
+	redis *redis.Client
+
+	mu sync.Mutex
+	// Bumped on every change, so loads that raced with one aren't cached
+	gen   uint64
+	nodes map[uuid.UUID]*presenceNode
+	convs map[uuid.UUID]*presenceConv
+}
+
+func newPresenceGraph(db store.Store, r *redis.Client) *presenceGraph {
+	return &presenceGraph{
+		db:    db,
+		redis: r,
+		nodes: make(map[uuid.UUID]*presenceNode),
+		convs: make(map[uuid.UUID]*presenceConv),
+	}
+}
+
+// setOf returns the IDs as a set.
+func setOf(ids []uuid.UUID) map[uuid.UUID]bool {
+	set := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// node returns a user's entry, loading it if needed. Returns nil for
+// unknown users.
+func (g *presenceGraph) node(ctx context.Context, userID uuid.UUID) (*presenceNode, error) {
+	g.mu.Lock()
+	n, gen := g.nodes[userID], g.gen
+	g.mu.Unlock()
+	if n != nil && time.Since(n.loadedAt) < presenceGraphMaxAge {
+		return n, nil
+	}
+
+	loaded, err := g.db.GetPresenceNode(ctx, userID)
+	if err != nil || loaded == nil {
+		return nil, err
+	}
+	n = &presenceNode{
+		convs:    setOf(loaded.Conversations),
+		contacts: setOf(loaded.Contacts),
+		privacy:  loaded.Privacy,
+		loadedAt: time.Now(),
+	}
+
+	g.mu.Lock()
+	if g.gen == gen {
+		g.nodes[userID] = n
+	}
+	g.mu.Unlock()
+	return n, nil
+}
+
+// conv returns a conversation's entry, loading it if needed.
+func (g *presenceGraph) conv(ctx context.Context, convID uuid.UUID) (*presenceConv, error) {
+	g.mu.Lock()
+	c, gen := g.convs[convID], g.gen
+	g.mu.Unlock()
+	if c != nil && time.Since(c.loadedAt) < presenceGraphMaxAge {
+		return c, nil
+	}
+
+	members, err := g.db.GetConversationMembers(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	c = &presenceConv{members: setOf(members), loadedAt: time.Now()}
+
+	g.mu.Lock()
+	if g.gen == gen {
+		g.convs[convID] = c
+	}
+	g.mu.Unlock()
+	return c, nil
+}
+
+// subscribers returns the users who share a presence conversation with userID.
+func (g *presenceGraph) subscribers(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	n, err := g.node(ctx, userID)
+	if err != nil || n == nil {
+		return nil, err
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for convID := range n.convs {
+		c, err := g.conv(ctx, convID)
+		if err != nil {
+			return nil, err
+		}
+		for memberID := range c.members {
+			if memberID != userID {
+				seen[memberID] = true
+			}
+		}
+	}
+
+	result := make([]uuid.UUID, 0, len(seen))
+	for uid := range seen {
+		result = append(result, uid)
+	}
+	return result, nil
+}
+
+// audience is presenceAudience answered from the graph.
+func (g *presenceGraph) audience(ctx context.Context, userID uuid.UUID, others []uuid.UUID) map[uuid.UUID]bool {
+	visible := make(map[uuid.UUID]bool, len(others))
+	own, err := g.node(ctx, userID)
+	if err != nil || own == nil {
+		return visible
+	}
+	for _, id := range others {
+		if id == userID {
+			visible[id] = true
+			continue
+		}
+		peer, err := g.node(ctx, id)
+		if err != nil || peer == nil {
+			continue
+		}
+		visible[id] = presenceMutual(userID, own.privacy, own.contacts[id], id, peer.privacy, peer.contacts[userID])
+	}
+	return visible
+}
+
+// joined records users joining a conversation.
+func (g *presenceGraph) joined(convID uuid.UUID, userIDs ...uuid.UUID) {
+	g.mu.Lock()
+	g.gen++
+	for _, uid := range userIDs {
+		if n := g.nodes[uid]; n != nil {
+			updated := *n
+			updated.convs = maps.Clone(n.convs)
+			updated.convs[convID] = true
+			g.nodes[uid] = &updated
+		}
+	}
+	if c := g.convs[convID]; c != nil {
+		updated := *c
+		updated.members = maps.Clone(c.members)
+		for _, uid := range userIDs {
+			updated.members[uid] = true
+		}
+		g.convs[convID] = &updated
+	}
+	g.mu.Unlock()
+
+	g.publish(presenceGraphChange{Users: userIDs, Convs: []uuid.UUID{convID}})
+}
+
+// left records a user leaving or being removed from a conversation.
+func (g *presenceGraph) left(convID, userID uuid.UUID) {
+	g.mu.Lock()
+	g.gen++
+	if n := g.nodes[userID]; n != nil {
+		updated := *n
+		updated.convs = maps.Clone(n.convs)
+		delete(updated.convs, convID)
+		g.nodes[userID] = &updated
+	}
+	if c := g.convs[convID]; c != nil {
+		updated := *c
+		updated.members = maps.Clone(c.members)
+		delete(updated.members, userID)
+		g.convs[convID] = &updated
+	}
+	g.mu.Unlock()
+
+	g.publish(presenceGraphChange{Users: []uuid.UUID{userID}, Convs: []uuid.UUID{convID}})
+}
+
+// invalidate drops users' entries here and on other nodes, for changes
+// that aren't tracked in place.
+func (g *presenceGraph) invalidate(userIDs ...uuid.UUID) {
+	change := presenceGraphChange{Users: userIDs}
+	g.drop(change)
+	g.publish(change)
+}
+
+// drop removes the named entries from this node.
+func (g *presenceGraph) drop(change presenceGraphChange) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gen++
+	for _, uid := range change.Users {
+		delete(g.nodes, uid)
+	}
+	for _, convID := range change.Convs {
+		delete(g.convs, convID)
+	}
+}
+
+// forget evicts a user who went offline, along with conversations no other
+// cached user is in.
+func (g *presenceGraph) forget(userID uuid.UUID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.nodes[userID]
+	if n == nil {
+		return
+	}
+	delete(g.nodes, userID)
+	for convID := range n.convs {
+		c := g.convs[convID]
+		if c == nil {
+			continue
+		}
+		inUse := false
+		for memberID := range c.members {
+			if g.nodes[memberID] != nil {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			delete(g.convs, convID)
+		}
+	}
+}
+
+// publish tells other nodes to drop the changed entries.
+func (g *presenceGraph) publish(change presenceGraphChange) {
+	if g.redis == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.redis.Publish(ctx, presenceChannel, "graph", change); err != nil {
+		log.Printf("presence: failed to publish graph change: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/store"
+)
+
+// graphFixture is a presence graph over one room, counting store queries.
+type graphFixture struct {
+	graph             *presenceGraph
+	room              uuid.UUID
+	alice, bob, carol uuid.UUID
+	members           []uuid.UUID
+	nodeLoads         int
+	convLoads         int
+}
+
+func newGraphFixture() *graphFixture {
+	f := &graphFixture{room: uuid.New(), alice: uuid.New(), bob: uuid.New(), carol: uuid.New()}
+	f.members = []uuid.UUID{f.alice, f.bob}
+	mockStore := &store.MockStore{
+		GetPresenceNodeFn: func(ctx context.Context, userID uuid.UUID) (*store.PresenceNode, error) {
+			f.nodeLoads++
+			node := &store.PresenceNode{}
+			if slices.Contains(f.members, userID) {
+				node.Conversations = []uuid.UUID{f.room}
+			}
+			return node, nil
+		},
+		GetConversationMembersFn: func(ctx context.Context, convID uuid.UUID) ([]uuid.UUID, error) {
+			f.convLoads++
+			return slices.Clone(f.members), nil
+		},
+	}
+	f.graph = newPresenceGraph(mockStore, nil)
+	return f
+}
+
+func (f *graphFixture) subscribers(t *testing.T, userID uuid.UUID) []uuid.UUID {
+	t.Helper()
+	subs, err := f.graph.subscribers(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(subs, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	return subs
+}
+
+func TestPresenceGraph_Cached(t *testing.T) {
+	f := newGraphFixture()
+	for i := 0; i < 3; i++ {
+		if subs := f.subscribers(t, f.alice); !slices.Equal(subs, []uuid.UUID{f.bob}) {
+			t.Fatalf("expected bob, got %v", subs)
+		}
+	}
+	if f.nodeLoads != 1 || f.convLoads != 1 {
+		t.Errorf("expected one load each, got %d node and %d conv loads", f.nodeLoads, f.convLoads)
+	}
+}
+
+func TestPresenceGraph_JoinedAndLeft(t *testing.T) {
+	f := newGraphFixture()
+	f.subscribers(t, f.alice)
+	f.subscribers(t, f.carol)
+
+	f.graph.joined(f.room, f.carol)
+	if subs := f.subscribers(t, f.alice); !slices.Contains(subs, f.carol) {
+		t.Errorf("expected carol after joining, got %v", subs)
+	}
+	if subs := f.subscribers(t, f.carol); !slices.Contains(subs, f.alice) {
+		t.Errorf("expected carol to follow alice, got %v", subs)
+	}
+
+	f.graph.left(f.room, f.bob)
+	if subs := f.subscribers(t, f.alice); slices.Contains(subs, f.bob) {
+		t.Errorf("expected no bob after leaving, got %v", subs)
+	}
+	if f.nodeLoads != 2 || f.convLoads != 1 {
+		t.Errorf("expected membership changes without queries, got %d node and %d conv loads", f.nodeLoads, f.convLoads)
+	}
+}
+
+func TestPresenceGraph_Invalidate(t *testing.T) {
+	f := newGraphFixture()
+	f.subscribers(t, f.carol)
+
+	// Carol joined somewhere this node didn't see
+	f.members = append(f.members, f.carol)
+	f.graph.drop(presenceGraphChange{Users: []uuid.UUID{f.carol}, Convs: []uuid.UUID{f.room}})
+	if subs := f.subscribers(t, f.carol); len(subs) != 2 {
+		t.Errorf("expected alice and bob after reloading, got %v", subs)
+	}
+
+	f.graph.invalidate(f.carol)
+	f.subscribers(t, f.carol)
+	if f.nodeLoads != 3 {
+		t.Errorf("expected carol to reload after each change, got %d loads", f.nodeLoads)
+	}
+}
+
+func TestPresenceGraph_Forget(t *testing.T) {
+	f := newGraphFixture()
+	f.subscribers(t, f.alice)
+	f.subscribers(t, f.bob)
+
+	f.graph.forget(f.alice)
+	if f.graph.nodes[f.alice] != nil || f.graph.convs[f.room] == nil {
+		t.Fatal("expected alice evicted and the room kept for bob")
+	}
+	f.graph.forget(f.bob)
+	if len(f.graph.nodes) != 0 || len(f.graph.convs) != 0 {
+		t.Errorf("expected an empty graph, got %d nodes and %d convs", len(f.graph.nodes), len(f.graph.convs))
+	}
+}
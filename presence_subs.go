@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// maxPresenceSubs caps the users and conversations one session can follow.
+const maxPresenceSubs = 500
+
+var errTooManyPresenceSubs = errors.New("too many presence subscriptions")
+
+// presenceSubs is a session's explicit presence subscriptions. A session
+// without one gets presence for everyone it shares a conversation with;
+// once it subscribes, only for the users and conversation members it named.
+type presenceSubs struct {
+	users map[uuid.UUID]bool
+	convs map[uuid.UUID]bool
+}
+
+// Subscribe adds presence subscriptions for a session.
+func (p *PresenceManager) Subscribe(sessID string, users, convs []uuid.UUID) error {
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+
+	subs := p.subs[sessID]
+	if subs == nil {
+		subs = &presenceSubs{users: make(map[uuid.UUID]bool), convs: make(map[uuid.UUID]bool)}
+	}
+	added := 0
+	for _, id := range users {
+		if !subs.users[id] {
+			added++
+		}
+	}
+	for _, id := range convs {
+		if !subs.convs[id] {
+			added++
+		}
+	}
+	if len(subs.users)+len(subs.convs)+added > maxPresenceSubs {
+		return errTooManyPresenceSubs
+	}
+
+	p.subs[sessID] = subs
+	for _, id := range users {
+		subs.users[id] = true
+		if p.watchers[id] == nil {
+			p.watchers[id] = make(map[string]bool)
+		}
+		p.watchers[id][sessID] = true
+	}
+	for _, id := range convs {
+		subs.convs[id] = true
+	}
+	return nil
+}
+
+// Unsubscribe removes presence subscriptions for a session. The session
+// stays in explicit mode even with none left.
+func (p *PresenceManager) Unsubscribe(sessID string, users, convs []uuid.UUID) {
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+
+	subs := p.subs[sessID]
+	if subs == nil {
+		subs = &presenceSubs{users: make(map[uuid.UUID]bool), convs: make(map[uuid.UUID]bool)}
+		p.subs[sessID] = subs
+	}
+	for _, id := range users {
+		delete(subs.users, id)
+		p.unwatch(id, sessID)
+	}
+	for _, id := range convs {
+		delete(subs.convs, id)
+	}
+}
+
+// Subscriptions returns a session's explicit subscriptions, and false if it
+// has not made any.
+func (p *PresenceManager) Subscriptions(sessID string) (users, convs []uuid.UUID, explicit bool) {
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+
+	subs := p.subs[sessID]
+	if subs == nil {
+		return nil, nil, false
+	}
+	for id := range subs.users {
+		users = append(users, id)
+	}
+	for id := range subs.convs {
+		convs = append(convs, id)
+	}
+	return users, convs, true
+}
+
+// SessionClosed drops a closed session's subscriptions.
+func (p *PresenceManager) SessionClosed(sessID string) {
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+
+	subs := p.subs[sessID]
+	if subs == nil {
+		return
+	}
+	for id := range subs.users {
+		p.unwatch(id, sessID)
+	}
+	delete(p.subs, sessID)
+}
+
+// unwatch removes a session from a user's watchers. Callers hold p.subsMu.
+func (p *PresenceManager) unwatch(userID uuid.UUID, sessID string) {
+	delete(p.watchers[userID], sessID)
+	if len(p.watchers[userID]) == 0 {
+		delete(p.watchers, userID)
+	}
+}
+
+// watching returns the sessions subscribed to a user by name.
+func (p *PresenceManager) watching(userID uuid.UUID) []string {
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+
+	ids := make([]string, 0, len(p.watchers[userID]))
+	for id := range p.watchers[userID] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// interested reports whether a session of a user sharing a conversation with
+// userID wants userID's presence. userConvs are userID's conversations.
+func (p *PresenceManager) interested(sessID string, userID uuid.UUID, userConvs map[uuid.UUID]bool) bool {
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+
+	subs := p.subs[sessID]
+	if subs == nil || subs.users[userID] {
+		return true
+	}
+	for convID := range subs.convs {
+		if userConvs[convID] {
+			return true
+		}
+	}
+	return false
+}
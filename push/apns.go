@@ -0,0 +1,169 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APNs endpoints.
+const (
+	APNsProduction = "https://api.push.apple.com"
+	APNsSandbox    = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenLifetime is how long a provider token is reused. Apple rejects
+// tokens older than an hour and throttles refreshing more than every 20 minutes.
+const apnsTokenLifetime = 40 * time.Minute
+
+// APNsConfig holds token-based APNs credentials.
+type APNsConfig struct {
+	// Signing key ID and team ID from the Apple developer account
+	KeyID  string
+	TeamID string
+	// App bundle ID
+	Topic string
+	// PEM-encoded .p8 signing key
+	Key []byte
+	// Defaults to APNsProduction
+	Endpoint string
+	Client   *http.Client
+}
+
+// APNs sends notifications through Apple's HTTP/2 provider API.
+type APNs struct {
+	cfg    APNsConfig
+	key    *ecdsa.PrivateKey
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	tokenAt time.Time
+}
+
+// NewAPNs creates an APNs provider.
+func NewAPNs(cfg APNsConfig) (*APNs, error) {
+	if cfg.KeyID == "" || cfg.TeamID == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("apns: key id, team id and topic are required")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("apns: invalid signing key: %w", err)
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = APNsProduction
+	}
+	return &APNs{cfg: cfg, key: key, client: httpClient(cfg.Client)}, nil
+}
+
+type apnsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type apnsAps struct {
+	Alert apnsAlert `json:"alert"`
+	Sound string    `json:"sound,omitempty"`
+}
+
+// Send delivers a notification to one device.
+func (a *APNs) Send(ctx context.Context, n *Notification) error {
+	payload := map[string]any{
+		"aps": apnsAps{
+			Alert: apnsAlert{Title: n.Title, Body: n.Body},
+			Sound: "default",
+		},
+	}
+	for k, v := range n.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	bearer, err := a.bearer()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		a.cfg.Endpoint+"/3/device/"+url.PathEscape(n.Token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+bearer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-topic", a.cfg.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	if n.CollapseKey != "" {
+		req.Header.Set("apns-collapse-id", n.CollapseKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("apns: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reply struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reply)
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		reply.Reason == "BadDeviceToken",
+		reply.Reason == "DeviceTokenNotForTopic",
+		reply.Reason == "Unregistered":
+		return ErrUnregistered
+	case reply.Reason == "ExpiredProviderToken" || reply.Reason == "InvalidProviderToken":
+		a.resetToken()
+	}
+	return fmt.Errorf("apns: status %d: %s", resp.StatusCode, reply.Reason)
+}
+
+// bearer returns the current provider token, signing a new one when due.
+func (a *APNs) bearer() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if a.token != "" && now.Sub(a.tokenAt) < apnsTokenLifetime {
+		return a.token, nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": a.cfg.TeamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = a.cfg.KeyID
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		return "", fmt.Errorf("apns: sign provider token: %w", err)
+	}
+	a.token = signed
+	a.tokenAt = now
+	return signed, nil
+}
+
+func (a *APNs) resetToken() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
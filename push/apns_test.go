@@ -0,0 +1,135 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testAPNsKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestAPNs_Send(t *testing.T) {
+	key, keyPEM := testAPNsKey(t)
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/3/device/device-token" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("apns-topic") != "app.clingy" || r.Header.Get("apns-collapse-id") != "conv-1" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "bearer ")
+		token, err := jwt.Parse(bearer, func(tok *jwt.Token) (any, error) {
+			if tok.Header["kid"] != "KEY123" {
+				t.Errorf("unexpected kid %v", tok.Header["kid"])
+			}
+			return &key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"ES256"}))
+		if err != nil {
+			t.Errorf("invalid provider token: %v", err)
+		} else if iss, _ := token.Claims.GetIssuer(); iss != "TEAM123" {
+			t.Errorf("unexpected issuer %q", iss)
+		}
+
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		alert := payload["aps"].(map[string]any)["alert"].(map[string]any)
+		if alert["body"] != "You have a new message" || payload["conv"] != "conv-1" {
+			t.Errorf("unexpected payload: %v", payload)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	apns, err := NewAPNs(APNsConfig{KeyID: "KEY123", TeamID: "TEAM123", Topic: "app.clingy", Key: keyPEM, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := &Notification{
+		Token:       "device-token",
+		Body:        "You have a new message",
+		Data:        map[string]string{"conv": "conv-1"},
+		CollapseKey: "conv-1",
+	}
+	for i := 0; i < 2; i++ {
+		if err := apns.Send(context.Background(), n); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestAPNs_Errors(t *testing.T) {
+	_, keyPEM := testAPNsKey(t)
+
+	tests := []struct {
+		name         string
+		status       int
+		reason       string
+		unregistered bool
+	}{
+		{"gone", http.StatusGone, "Unregistered", true},
+		{"bad token", http.StatusBadRequest, "BadDeviceToken", true},
+		{"wrong topic", http.StatusBadRequest, "DeviceTokenNotForTopic", true},
+		{"throttled", http.StatusTooManyRequests, "TooManyRequests", false},
+		{"server error", http.StatusServiceUnavailable, "ServiceUnavailable", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(map[string]string{"reason": tt.reason})
+			}))
+			defer srv.Close()
+
+			apns, err := NewAPNs(APNsConfig{KeyID: "K", TeamID: "T", Topic: "app", Key: keyPEM, Endpoint: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = apns.Send(context.Background(), &Notification{Token: "tok"})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if errors.Is(err, ErrUnregistered) != tt.unregistered {
+				t.Errorf("unregistered = %v, want %v (%v)", !tt.unregistered, tt.unregistered, err)
+			}
+		})
+	}
+}
+
+func TestNewAPNs_InvalidKey(t *testing.T) {
+	_, err := NewAPNs(APNsConfig{KeyID: "K", TeamID: "T", Topic: "app", Key: []byte("not a key")})
+	if err == nil {
+		t.Error("expected error for invalid key")
+	}
+}
@@ -0,0 +1,217 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// FCMEndpoint is the FCM HTTP v1 API base URL.
+const FCMEndpoint = "https://fcm.googleapis.com"
+
+const (
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+	fcmTokenURI = "https://oauth2.googleapis.com/token"
+)
+
+// FCMConfig holds FCM credentials.
+type FCMConfig struct {
+	// Service account JSON key from the Firebase console
+	Credentials []byte
+	// Defaults to FCMEndpoint
+	Endpoint string
+	Client   *http.Client
+}
+
+// serviceAccount is the subset of a Google service account key FCM needs.
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCM sends notifications through the FCM HTTP v1 API.
+type FCM struct {
+	account  serviceAccount
+	key      *rsa.PrivateKey
+	endpoint string
+	client   *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCM creates an FCM provider.
+func NewFCM(cfg FCMConfig) (*FCM, error) {
+	var account serviceAccount
+	if err := json.Unmarshal(cfg.Credentials, &account); err != nil {
+		return nil, fmt.Errorf("fcm: invalid credentials: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, fmt.Errorf("fcm: credentials missing project_id or client_email")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("fcm: invalid private key: %w", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = fcmTokenURI
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = FCMEndpoint
+	}
+	return &FCM{account: account, key: key, endpoint: endpoint, client: httpClient(cfg.Client)}, nil
+}
+
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type fcmAndroid struct {
+	Priority    string `json:"priority"`
+	CollapseKey string `json:"collapse_key,omitempty"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      fcmAndroid        `json:"android"`
+}
+
+// Send delivers a notification to one device.
+func (f *FCM) Send(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(map[string]any{
+		"message": fcmMessage{
+			Token:        n.Token,
+			Notification: fcmNotification{Title: n.Title, Body: n.Body},
+			Data:         n.Data,
+			Android:      fcmAndroid{Priority: "HIGH", CollapseKey: n.CollapseKey},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		f.endpoint+"/v1/projects/"+url.PathEscape(f.account.ProjectID)+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fcm: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reply struct {
+		Error struct {
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reply)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnregistered
+	}
+	for _, d := range reply.Error.Details {
+		if d.ErrorCode == "UNREGISTERED" {
+			return ErrUnregistered
+		}
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		f.resetToken()
+	}
+	return fmt.Errorf("fcm: status %d: %s", resp.StatusCode, reply.Error.Status)
+}
+
+// token returns a cached OAuth2 access token, exchanging a signed service
+// account assertion for a new one when it is about to expire.
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.accessToken != "" && now.Add(time.Minute).Before(f.expiresAt) {
+		return f.accessToken, nil
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", fmt.Errorf("fcm: sign assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fcm: token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fcm: token exchange: status %d", resp.StatusCode)
+	}
+	var reply struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", fmt.Errorf("fcm: token exchange: %w", err)
+	}
+	if reply.AccessToken == "" {
+		return "", fmt.Errorf("fcm: token exchange: no access token")
+	}
+
+	f.accessToken = reply.AccessToken
+	f.expiresAt = now.Add(time.Duration(reply.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+func (f *FCM) resetToken() {
+	f.mu.Lock()
+	f.accessToken = ""
+	f.mu.Unlock()
+}
@@ -0,0 +1,141 @@
+package push
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fcmStandIn serves the OAuth2 token exchange and the messages:send API.
+func fcmStandIn(t *testing.T, key *rsa.PrivateKey, send http.HandlerFunc) (*httptest.Server, *int) {
+	t.Helper()
+	exchanges := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		exchanges++
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("unexpected grant type %q", r.Form.Get("grant_type"))
+		}
+		_, err := jwt.Parse(r.Form.Get("assertion"), func(*jwt.Token) (any, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}))
+		if err != nil {
+			t.Errorf("invalid assertion: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access-1", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/projects/clingy-test/messages:send", send)
+	return httptest.NewServer(mux), &exchanges
+}
+
+func testFCM(t *testing.T, send http.HandlerFunc) (*FCM, *int, func()) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, exchanges := fcmStandIn(t, key, send)
+
+	creds, _ := json.Marshal(map[string]string{
+		"project_id":   "clingy-test",
+		"client_email": "push@clingy-test.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL + "/token",
+	})
+	fcm, err := NewFCM(FCMConfig{Credentials: creds, Endpoint: srv.URL})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return fcm, exchanges, srv.Close
+}
+
+func TestFCM_Send(t *testing.T) {
+	fcm, exchanges, closeSrv := testFCM(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		var body struct {
+			Message fcmMessage `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Message.Token != "device-token" || body.Message.Data["conv"] != "conv-1" ||
+			body.Message.Android.CollapseKey != "conv-1" || body.Message.Notification.Body != "You have a new message" {
+			t.Errorf("unexpected message: %+v", body.Message)
+		}
+		w.Write([]byte(`{"name":"projects/clingy-test/messages/1"}`))
+	})
+	defer closeSrv()
+
+	n := &Notification{
+		Token:       "device-token",
+		Body:        "You have a new message",
+		Data:        map[string]string{"conv": "conv-1"},
+		CollapseKey: "conv-1",
+	}
+	for i := 0; i < 2; i++ {
+		if err := fcm.Send(context.Background(), n); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if *exchanges != 1 {
+		t.Errorf("expected the access token to be reused, got %d exchanges", *exchanges)
+	}
+}
+
+func TestFCM_Errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		unregistered bool
+	}{
+		{"not found", http.StatusNotFound, `{"error":{"status":"NOT_FOUND"}}`, true},
+		{"unregistered", http.StatusBadRequest,
+			`{"error":{"status":"INVALID_ARGUMENT","details":[{"errorCode":"UNREGISTERED"}]}}`, true},
+		{"quota", http.StatusTooManyRequests, `{"error":{"status":"RESOURCE_EXHAUSTED"}}`, false},
+		{"unavailable", http.StatusServiceUnavailable, `{"error":{"status":"UNAVAILABLE"}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fcm, _, closeSrv := testFCM(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			defer closeSrv()
+
+			err := fcm.Send(context.Background(), &Notification{Token: "tok"})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if errors.Is(err, ErrUnregistered) != tt.unregistered {
+				t.Errorf("unregistered = %v, want %v (%v)", !tt.unregistered, tt.unregistered, err)
+			}
+		})
+	}
+}
+
+func TestService_UnsupportedPlatform(t *testing.T) {
+	s := New()
+	if s.Supports(PlatformFCM) {
+		t.Error("expected no providers")
+	}
+	if err := s.Send(context.Background(), PlatformFCM, &Notification{}); err == nil {
+		t.Error("expected error for unsupported platform")
+	}
+}
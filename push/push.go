@@ -0,0 +1,89 @@
+// Package push delivers notifications to mobile devices through the Apple
+// Push Notification service (APNs) and Firebase Cloud Messaging (FCM), and
+// to browsers through Web Push.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Platforms a device token can belong to.
+const (
+	PlatformAPNs    = "apns"
+	PlatformFCM     = "fcm"
+	PlatformWebPush = "webpush"
+)
+
+// ErrUnregistered is returned when a provider reports that a device token is
+// no longer valid. The token should be forgotten rather than retried.
+var ErrUnregistered = errors.New("device token unregistered")
+
+// requestTimeout bounds a single request to a provider.
+const requestTimeout = 10 * time.Second
+
+// Notification is one push to one device.
+type Notification struct {
+	// Device token, or the subscription endpoint for Web Push
+	Token string
+	// Web Push subscription keys (base64url)
+	P256DH string
+	Auth   string
+	Title  string
+	Body   string
+	// Key/value data delivered to the app alongside the alert
+	Data map[string]string
+	// Notifications with the same collapse key replace each other on the device
+	CollapseKey string
+}
+
+// Provider sends notifications for one platform.
+type Provider interface {
+	Send(ctx context.Context, n *Notification) error
+}
+
+// Service routes notifications to the provider for each platform.
+type Service struct {
+	providers map[string]Provider
+}
+
+// New creates a push service with no providers.
+func New() *Service {
+	return &Service{providers: make(map[string]Provider)}
+}
+
+// Register sets the provider for a platform.
+func (s *Service) Register(platform string, p Provider) {
+	s.providers[platform] = p
+}
+
+// Supports reports whether a provider is registered for the platform.
+func (s *Service) Supports(platform string) bool {
+	_, ok := s.providers[platform]
+	return ok
+}
+
+// Provider returns the provider registered for a platform, or nil.
+func (s *Service) Provider(platform string) Provider {
+	return s.providers[platform]
+}
+
+// Send delivers a notification through the platform's provider.
+func (s *Service) Send(ctx context.Context, platform string, n *Notification) error {
+	p, ok := s.providers[platform]
+	if !ok {
+		return fmt.Errorf("push: unsupported platform %q", platform)
+	}
+	return p.Send(ctx, n)
+}
+
+// httpClient returns c, or a client with the default request timeout.
+func httpClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return &http.Client{Timeout: requestTimeout}
+}
@@ -0,0 +1,370 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// webPushTTL is how long the push service keeps an undelivered message.
+	webPushTTL = 24 * time.Hour
+	// vapidTokenLifetime is the expiry of VAPID tokens (RFC 8292 allows up to 24h).
+	vapidTokenLifetime = 12 * time.Hour
+	// webPushRecordSize is the aes128gcm record size; payloads fit in one record.
+	webPushRecordSize = 4096
+	// maxWebPushPayload is the largest plaintext push services must accept.
+	maxWebPushPayload = 3993
+	// maxTopicLength is the longest Topic header push services accept.
+	maxTopicLength = 32
+)
+
+// WebPushConfig holds VAPID credentials.
+type WebPushConfig struct {
+	// Base64url-encoded P-256 key pair from GenerateVAPIDKeys
+	PublicKey  string
+	PrivateKey string
+	// Contact for the push service operator: a mailto: or https: URL
+	Subject string
+	// Accept http:// subscription endpoints and private or loopback hosts
+	// (e.g., a local stand-in for testing)
+	AllowInsecure bool
+	// Defaults to a client that only connects to public addresses
+	Client *http.Client
+}
+
+// errPrivateEndpoint is returned for endpoints on private, loopback or
+// link-local addresses, which subscriptions could otherwise use to reach
+// internal services.
+var errPrivateEndpoint = errors.New("endpoint must be a public host")
+
+// WebPush sends notifications to browsers through their push service
+// (RFC 8030), with payloads encrypted for the subscription (RFC 8291) and
+// the sender identified by VAPID (RFC 8292).
+type WebPush struct {
+	cfg       WebPushConfig
+	key       *ecdsa.PrivateKey
+	publicKey string
+	client    *http.Client
+}
+
+// GenerateVAPIDKeys creates a VAPID key pair, base64url-encoded. The public
+// key is what browsers expect as the applicationServerKey.
+func GenerateVAPIDKeys() (publicKey, privateKey string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		return "", "", err
+	}
+	priv, err := key.Bytes()
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(pub), base64.RawURLEncoding.EncodeToString(priv), nil
+}
+
+// NewWebPush creates a Web Push provider.
+func NewWebPush(cfg WebPushConfig) (*WebPush, error) {
+	if cfg.Subject == "" {
+		return nil, fmt.Errorf("webpush: subject is required")
+	}
+	raw, err := decodeBase64URL(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid private key: %w", err)
+	}
+	key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid private key: %w", err)
+	}
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	publicKey := base64.RawURLEncoding.EncodeToString(pub)
+	if cfg.PublicKey != "" && strings.TrimRight(cfg.PublicKey, "=") != publicKey {
+		return nil, fmt.Errorf("webpush: public key does not match private key")
+	}
+	client := cfg.Client
+	if client == nil && !cfg.AllowInsecure {
+		client = publicOnlyClient()
+	}
+	return &WebPush{cfg: cfg, key: key, publicKey: publicKey, client: httpClient(client)}, nil
+}
+
+// publicOnlyClient returns a client that refuses to connect to non-public
+// addresses, checked after DNS resolution so a public name can't point it
+// at an internal host. Endpoints are dialed directly, not through a proxy.
+func publicOnlyClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout: requestTimeout,
+		Control: dialPublicOnly,
+	}).DialContext
+	return &http.Client{Timeout: requestTimeout, Transport: transport}
+}
+
+// dialPublicOnly is a net.Dialer Control function rejecting non-public addresses.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(ip) {
+		return errPrivateEndpoint
+	}
+	return nil
+}
+
+// publicAddr reports whether an address is globally routable.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddrSpace.Contains(ip)
+}
+
+// sharedAddrSpace is carrier-grade NAT space (RFC 6598), private in practice.
+var sharedAddrSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicKey returns the VAPID public key clients subscribe with.
+func (w *WebPush) PublicKey() string {
+	return w.publicKey
+}
+
+// ValidateSubscription checks a subscription before it is stored: the
+// endpoint must be an absolute https URL on a host name (http and any host
+// if AllowInsecure) and the keys must be a P-256 public key and a 16-byte
+// auth secret. Push services are always named, so IP literals and local
+// names are rejected.
+func (w *WebPush) ValidateSubscription(endpoint, p256dh, auth string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid endpoint")
+	}
+	if u.Scheme != "https" && !(w.cfg.AllowInsecure && u.Scheme == "http") {
+		return errors.New("endpoint must use https")
+	}
+	if !w.cfg.AllowInsecure && !publicHostName(u.Hostname()) {
+		return errPrivateEndpoint
+	}
+	if _, err := subscriptionKey(p256dh); err != nil {
+		return err
+	}
+	if secret, err := decodeBase64URL(auth); err != nil || len(secret) != 16 {
+		return errors.New("invalid auth secret")
+	}
+	return nil
+}
+
+// publicHostName reports whether a host is a name that could be public:
+// not an IP literal, localhost or a single label.
+func publicHostName(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if _, err := netip.ParseAddr(host); err == nil {
+		return false
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") {
+		return false
+	}
+	return strings.Contains(host, ".")
+}
+
+// webPushMessage is the JSON the service worker receives.
+type webPushMessage struct {
+	Title string            `json:"title,omitempty"`
+	Body  string            `json:"body,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+	Tag   string            `json:"tag,omitempty"`
+}
+
+// Send delivers a notification to one subscription. The token is the
+// subscription endpoint.
+func (w *WebPush) Send(ctx context.Context, n *Notification) error {
+	if err := w.ValidateSubscription(n.Token, n.P256DH, n.Auth); err != nil {
+		return fmt.Errorf("webpush: %w: %w", ErrUnregistered, err)
+	}
+
+	plaintext, err := json.Marshal(webPushMessage{Title: n.Title, Body: n.Body, Data: n.Data, Tag: n.CollapseKey})
+	if err != nil {
+		return err
+	}
+	uaPublic, _ := subscriptionKey(n.P256DH)
+	authSecret, _ := decodeBase64URL(n.Auth)
+	body, err := encryptWebPush(plaintext, uaPublic, authSecret)
+	if err != nil {
+		return fmt.Errorf("webpush: %w", err)
+	}
+
+	vapid, err := w.vapidToken(n.Token)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "vapid t="+vapid+", k="+w.publicKey)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+	if topic := webPushTopic(n.CollapseKey); topic != "" {
+		req.Header.Set("Topic", topic)
+	}
+
+	resp, err := w.client.Do(req)
+	if errors.Is(err, errPrivateEndpoint) {
+		return fmt.Errorf("webpush: %w: %w", ErrUnregistered, err)
+	}
+	if err != nil {
+		return fmt.Errorf("webpush: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrUnregistered
+	}
+	return fmt.Errorf("webpush: status %d", resp.StatusCode)
+}
+
+// vapidToken signs a VAPID JWT for the endpoint's push service.
+func (w *WebPush) vapidToken(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidTokenLifetime).Unix(),
+		"sub": w.cfg.Subject,
+	}).SignedString(w.key)
+	if err != nil {
+		return "", fmt.Errorf("webpush: sign vapid token: %w", err)
+	}
+	return signed, nil
+}
+
+// encryptWebPush encrypts a payload for a subscription as a single
+// aes128gcm record (RFC 8291, RFC 8188).
+func encryptWebPush(plaintext []byte, uaPublic *ecdh.PublicKey, authSecret []byte) ([]byte, error) {
+	if len(plaintext) > maxWebPushPayload {
+		return nil, errors.New("payload too large")
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	// Combine the ECDH secret with the subscription's auth secret
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, ecdhSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key id (the sender's public key)
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// 0x02 marks the last (only) record
+	padded := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(header, nonce, padded, nil), nil
+}
+
+// subscriptionKey parses a subscription's p256dh key.
+func subscriptionKey(p256dh string) (*ecdh.PublicKey, error) {
+	raw, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, errors.New("invalid p256dh key")
+	}
+	key, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, errors.New("invalid p256dh key")
+	}
+	return key, nil
+}
+
+// webPushTopic turns a collapse key into a Topic header value, which is
+// limited to 32 base64url characters. UUID keys lose their hyphens.
+func webPushTopic(key string) string {
+	topic := strings.ReplaceAll(key, "-", "")
+	if len(topic) > maxTopicLength {
+		return ""
+	}
+	for _, c := range topic {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return ""
+		}
+	}
+	return topic
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers
+// and libraries differ.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,241 @@
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testSubscription is the browser side of a Web Push subscription.
+type testSubscription struct {
+	key    *ecdh.PrivateKey
+	auth   []byte
+	p256dh string
+	secret string
+}
+
+func newTestSubscription(t *testing.T) *testSubscription {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &testSubscription{
+		key:    key,
+		auth:   auth,
+		p256dh: base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		secret: base64.RawURLEncoding.EncodeToString(auth),
+	}
+}
+
+// decrypt reverses encryptWebPush the way a browser would.
+func (s *testSubscription) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != webPushRecordSize {
+		t.Fatalf("unexpected record size %d", rs)
+	}
+	idlen := int(body[20])
+	asPublic, err := ecdh.P256().NewPublicKey(body[21 : 21+idlen])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdhSecret, err := s.key.ECDH(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyInfo := "WebPush: info\x00" + string(s.key.PublicKey().Bytes()) + string(asPublic.Bytes())
+	ikm, _ := hkdf.Key(sha256.New, ecdhSecret, s.auth, keyInfo, 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	padded, err := gcm.Open(nil, nonce, body[21+idlen:], nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if padded[len(padded)-1] != 0x02 {
+		t.Fatal("missing last record delimiter")
+	}
+	return padded[:len(padded)-1]
+}
+
+func testWebPush(t *testing.T, allowInsecure bool) (*WebPush, *ecdsa.PublicKey) {
+	t.Helper()
+	pub, priv, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wp, err := NewWebPush(WebPushConfig{PublicKey: pub, PrivateKey: priv, Subject: "mailto:ops@example.com", AllowInsecure: allowInsecure})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(pub)
+	key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wp, key
+}
+
+func TestWebPush_Send(t *testing.T) {
+	sub := newTestSubscription(t)
+	wp, vapidKey := testWebPush(t, true)
+
+	var received webPushMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if r.Header.Get("Topic") != "0f8fad5bd9cb469fa16570867728950e" {
+			t.Errorf("unexpected topic %q", r.Header.Get("Topic"))
+		}
+
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "vapid ")
+		var token, k string
+		for _, part := range strings.Split(auth, ", ") {
+			if v, ok := strings.CutPrefix(part, "t="); ok {
+				token = v
+			} else if v, ok := strings.CutPrefix(part, "k="); ok {
+				k = v
+			}
+		}
+		if k != wp.PublicKey() {
+			t.Errorf("unexpected vapid key %q", k)
+		}
+		parsed, err := jwt.Parse(token, func(*jwt.Token) (any, error) {
+			return vapidKey, nil
+		}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience("http://"+r.Host))
+		if err != nil {
+			t.Errorf("invalid vapid token: %v", err)
+		} else if sub, _ := parsed.Claims.GetSubject(); sub != "mailto:ops@example.com" {
+			t.Errorf("unexpected subject %q", sub)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(sub.decrypt(t, body), &received)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	err := wp.Send(context.Background(), &Notification{
+		Token:       srv.URL + "/push/sub-1",
+		P256DH:      sub.p256dh,
+		Auth:        sub.secret,
+		Body:        "You have a new message",
+		Data:        map[string]string{"conv": "0f8fad5b-d9cb-469f-a165-70867728950e"},
+		CollapseKey: "0f8fad5b-d9cb-469f-a165-70867728950e",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Body != "You have a new message" || received.Data["conv"] != "0f8fad5b-d9cb-469f-a165-70867728950e" {
+		t.Errorf("unexpected message: %+v", received)
+	}
+}
+
+func TestWebPush_Gone(t *testing.T) {
+	sub := newTestSubscription(t)
+	wp, _ := testWebPush(t, true)
+
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		err := wp.Send(context.Background(), &Notification{Token: srv.URL, P256DH: sub.p256dh, Auth: sub.secret})
+		srv.Close()
+		if !errors.Is(err, ErrUnregistered) {
+			t.Errorf("status %d: expected ErrUnregistered, got %v", status, err)
+		}
+	}
+}
+
+func TestWebPush_ValidateSubscription(t *testing.T) {
+	sub := newTestSubscription(t)
+	secure, _ := testWebPush(t, false)
+	insecure, _ := testWebPush(t, true)
+
+	if err := secure.ValidateSubscription("https://push.example.com/sub", sub.p256dh, sub.secret); err != nil {
+		t.Errorf("expected valid subscription, got %v", err)
+	}
+	if err := secure.ValidateSubscription("http://localhost:8080/sub", sub.p256dh, sub.secret); err == nil {
+		t.Error("expected http endpoint to be rejected")
+	}
+	if err := insecure.ValidateSubscription("http://localhost:8080/sub", sub.p256dh, sub.secret); err != nil {
+		t.Errorf("expected http endpoint to be allowed, got %v", err)
+	}
+	for _, endpoint := range []string{
+		"https://127.0.0.1/sub",
+		"https://10.0.0.8/sub",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/sub",
+		"https://localhost/sub",
+		"https://metadata/sub",
+		"https://printer.local/sub",
+	} {
+		if err := secure.ValidateSubscription(endpoint, sub.p256dh, sub.secret); err == nil {
+			t.Errorf("expected %s to be rejected", endpoint)
+		}
+	}
+	if err := insecure.ValidateSubscription("http://127.0.0.1:8080/sub", sub.p256dh, sub.secret); err != nil {
+		t.Errorf("expected local endpoint to be allowed, got %v", err)
+	}
+	if err := secure.ValidateSubscription("https://push.example.com/sub", "bad", sub.secret); err == nil {
+		t.Error("expected invalid p256dh to be rejected")
+	}
+	if err := secure.ValidateSubscription("https://push.example.com/sub", sub.p256dh, "c2hvcnQ"); err == nil {
+		t.Error("expected short auth secret to be rejected")
+	}
+}
+
+func TestWebPush_DialPublicOnly(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"142.250.80.10:443":        true,
+		"[2607:f8b0:4004::8a]:443": true,
+		"127.0.0.1:443":            false,
+		"10.1.2.3:443":             false,
+		"192.168.1.1:443":          false,
+		"172.16.0.1:443":           false,
+		"100.64.0.1:443":           false,
+		"169.254.169.254:80":       false,
+		"0.0.0.0:443":              false,
+		"[::1]:443":                false,
+		"[fe80::1]:443":            false,
+		"[fd00::1]:443":            false,
+		"[::ffff:127.0.0.1]:443":   false,
+	} {
+		if err := dialPublicOnly("tcp", addr, nil); (err == nil) != public {
+			t.Errorf("%s: public %v, got %v", addr, public, err)
+		}
+	}
+}
+
+func TestNewWebPush_KeyMismatch(t *testing.T) {
+	pub, _, _ := GenerateVAPIDKeys()
+	_, priv, _ := GenerateVAPIDKeys()
+	if _, err := NewWebPush(WebPushConfig{PublicKey: pub, PrivateKey: priv, Subject: "mailto:ops@example.com"}); err == nil {
+		t.Error("expected error for mismatched keys")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -102,10 +103,75 @@ func (c *Client) GetOnlineNode(ctx context.Context, userID string) (string, erro
 	return node, err
 }
 
-// RefreshOnline extends the TTL for a user's online status.
+// RefreshOnline extends the TTL for a user's online status and presence.
 func (c *Client) RefreshOnline(ctx context.Context, userID string) error {
-	key := c.key("online:" + userID)
-	return c.rdb.Expire(ctx, key, 2*time.Minute).Err()
+	pipe := c.rdb.Pipeline()
+	pipe.Expire(ctx, c.key("online:"+userID), 2*time.Minute)
+	pipe.Expire(ctx, c.key("presence:"+userID), 2*time.Minute)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetPresence stores an online user's presence record, shared by all nodes.
+// It expires along with the online status unless refreshed.
+func (c *Client) SetPresence(ctx context.Context, userID string, presence any) error {
+	data, err := json.Marshal(presence)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, c.key("presence:"+userID), data, 2*time.Minute).Err()
+}
+
+// GetPresence loads a user's presence record into dest.
+// Returns false if the user has none.
+func (c *Client) GetPresence(ctx context.Context, userID string, dest any) (bool, error) {
+	data, err := c.rdb.Get(ctx, c.key("presence:"+userID)).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, dest)
+}
+
+// DeletePresence removes a user's presence record.
+func (c *Client) DeletePresence(ctx context.Context, userID string) error {
+	return c.rdb.Del(ctx, c.key("presence:"+userID)).Err()
+}
+
+// ============================================================================
+// Typing
+// ============================================================================
+
+// SetTyping records a member as active in a conversation until expires,
+// shared by all nodes.
+func (c *Client) SetTyping(ctx context.Context, convID, userID string, expires time.Time) error {
+	key := c.key("typing:" + convID)
+	pipe := c.rdb.Pipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(expires.UnixMilli()), Member: userID})
+	pipe.ExpireAt(ctx, key, expires)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ClearTyping removes a member's activity in a conversation.
+func (c *Client) ClearTyping(ctx context.Context, convID, userID string) error {
+	return c.rdb.ZRem(ctx, c.key("typing:"+convID), userID).Err()
+}
+
+// GetTyping returns how many members are active in a conversation and up to
+// limit of their IDs, soonest to expire first. Expired entries are dropped.
+func (c *Client) GetTyping(ctx context.Context, convID string, limit int) (int, []string, error) {
+	key := c.key("typing:" + convID)
+	pipe := c.rdb.Pipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	count := pipe.ZCard(ctx, key)
+	users := pipe.ZRange(ctx, key, 0, int64(limit-1))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, nil, err
+	}
+	return int(count.Val()), users.Val(), nil
 }
 
 // ============================================================================
@@ -290,3 +356,9 @@ func (c *Client) SetNX(ctx context.Context, key string, value any, ttl time.Dura
 	}
 	return c.rdb.SetNX(ctx, c.key(key), data, ttl).Result()
 }
+
+// TTL returns the remaining time to live of a key.
+// Returns a negative duration if the key does not exist or has no expiry.
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.rdb.PTTL(ctx, c.key(key)).Result()
+}
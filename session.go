@@ -44,6 +44,7 @@ type Session struct {
 	deviceID  string
 	lang      string
 	ver       string
+	idle      bool
 
 	// Closing state
 	closing int32
@@ -119,6 +120,20 @@ func (s *Session) DeviceID() string {
 	return s.deviceID
 }
 
+// Idle reports whether the client said this session is idle.
+func (s *Session) Idle() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.idle
+}
+
+// SetIdle records the client-reported idleness of this session.
+func (s *Session) SetIdle(idle bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idle = idle
+}
+
 // Lang returns the session's language.
 func (s *Session) Lang() string {
 	s.mu.RLock()
@@ -310,6 +325,24 @@ func (s *Session) dispatch(msg *ClientMessage) {
 	if msg.Pin != nil {
 		typeCount++
 	}
+	if msg.Vote != nil {
+		typeCount++
+	}
+	if msg.Scheduled != nil {
+		typeCount++
+	}
+	if msg.Forward != nil {
+		typeCount++
+	}
+	if msg.Save != nil {
+		typeCount++
+	}
+	if msg.Device != nil {
+		typeCount++
+	}
+	if msg.Pres != nil {
+		typeCount++
+	}
 
 	if typeCount == 0 {
 		s.Send(CtrlError(msg.ID, CodeBadRequest, "missing message type"))
@@ -365,6 +398,18 @@ func (s *Session) dispatch(msg *ClientMessage) {
 		s.handleContact(msg)
 	case msg.Pin != nil:
 		s.handlePin(msg)
+	case msg.Vote != nil:
+		s.handleVote(msg)
+	case msg.Scheduled != nil:
+		s.handleScheduled(msg)
+	case msg.Forward != nil:
+		s.handleForward(msg)
+	case msg.Save != nil:
+		s.handleSave(msg)
+	case msg.Device != nil:
+		s.handleDevice(msg)
+	case msg.Pres != nil:
+		s.handlePres(msg)
 	}
 }
 
@@ -379,11 +424,18 @@ func (s *Session) handleHi(msg *ClientMessage) {
 	s.lang = hi.Lang
 	s.mu.Unlock()
 
-	s.Send(CtrlSuccess(msg.ID, CodeOK, map[string]any{
+	params := map[string]any{
 		"ver":   "0.1.0",
 		"build": buildstamp,
 		"sid":   s.id,
-	}))
+	}
+	// Browsers need the VAPID key before they can subscribe to Web Push
+	if s.handlers != nil {
+		if key := s.handlers.vapidPublicKey(); key != "" {
+			params["vapidKey"] = key
+		}
+	}
+	s.Send(CtrlSuccess(msg.ID, CodeOK, params))
 }
 
 func (s *Session) handleLogin(msg *ClientMessage) {
@@ -457,3 +509,27 @@ func (s *Session) handleContact(msg *ClientMessage) {
 func (s *Session) handlePin(msg *ClientMessage) {
 	s.handlers.HandlePin(s, msg)
 }
+
+func (s *Session) handleVote(msg *ClientMessage) {
+	s.handlers.HandleVote(s, msg)
+}
+
+func (s *Session) handleScheduled(msg *ClientMessage) {
+	s.handlers.HandleScheduled(s, msg)
+}
+
+func (s *Session) handleForward(msg *ClientMessage) {
+	s.handlers.HandleForward(s, msg)
+}
+
+func (s *Session) handleSave(msg *ClientMessage) {
+	s.handlers.HandleSave(s, msg)
+}
+
+func (s *Session) handleDevice(msg *ClientMessage) {
+	s.handlers.HandleDevice(s, msg)
+}
+
+func (s *Session) handlePres(msg *ClientMessage) {
+	s.handlers.HandlePres(s, msg)
+}
@@ -8,6 +8,7 @@ type SessionInterface interface {
 	ID() string
 	UserID() uuid.UUID
 	UserAgent() string
+	DeviceID() string
 	IsAuthenticated() bool
 	RequireAuth(msgID string) bool
 	Send(msg *ServerMessage)
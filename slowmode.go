@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/redis"
+)
+
+// validSlowModeIntervals are the allowed slow mode settings in seconds (0 disables).
+var validSlowModeIntervals = map[int]bool{0: true, 5: true, 10: true, 30: true, 60: true, 300: true, 900: true, 3600: true}
+
+// SlowModeTracker enforces the per-member send interval in slow mode rooms.
+// When Redis is enabled, the markers are shared so the interval holds across
+// all nodes; otherwise they are kept in memory on this node.
+type SlowModeTracker struct {
+	mu          sync.Mutex
+	until       map[string]time.Time // "conv:user" -> time the member may send again
+	redis       *redis.Client
+	lastCleanup time.Time
+}
+
+// NewSlowModeTracker creates a new slow mode tracker.
+// Pass a nil Redis client for single-node operation.
+func NewSlowModeTracker(redisClient *redis.Client) *SlowModeTracker {
+	return &SlowModeTracker{
+		until:       make(map[string]time.Time),
+		redis:       redisClient,
+		lastCleanup: time.Now(),
+	}
+}
+
+// Acquire records a send by userID in convID if the interval has elapsed since
+// their previous send. Returns zero when the send is allowed, or the remaining
+// wait otherwise.
+func (t *SlowModeTracker) Acquire(ctx context.Context, convID, userID uuid.UUID, interval time.Duration) time.Duration {
+	key := "slowmode:" + convID.String() + ":" + userID.String()
+
+	if t.redis != nil {
+		wait, err := t.acquireRedis(ctx, key, interval)
+		if err == nil {
+			return wait
+		}
+		slog.Warn("slow mode redis unavailable, tracking locally", "conv", convID, "error", err)
+	}
+
+	return t.acquireLocal(key, interval)
+}
+
+// Release clears the marker for userID in convID, e.g. when the send failed
+// after the slot was acquired.
+func (t *SlowModeTracker) Release(ctx context.Context, convID, userID uuid.UUID) {
+	key := "slowmode:" + convID.String() + ":" + userID.String()
+
+	if t.redis != nil {
+		if err := t.redis.Delete(ctx, key); err != nil {
+			slog.Error("release slow mode slot failed", "conv", convID, "user", userID, "error", err)
+		}
+	}
+
+	t.mu.Lock()
+	delete(t.until, key)
+	t.mu.Unlock()
+}
+
+func (t *SlowModeTracker) acquireRedis(ctx context.Context, key string, interval time.Duration) (time.Duration, error) {
+	ok, err := t.redis.SetNX(ctx, key, 1, interval)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return 0, nil
+	}
+	remaining, err := t.redis.TTL(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if remaining <= 0 {
+		// Marker expired between SETNX and PTTL; let the send through
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+func (t *SlowModeTracker) acquireLocal(key string, interval time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+
+	// Periodic cleanup of expired markers
+	if now.Sub(t.lastCleanup) > time.Minute {
+		for k, until := range t.until {
+			if !now.Before(until) {
+				delete(t.until, k)
+			}
+		}
+		t.lastCleanup = now
+	}
+
+	if until, ok := t.until[key]; ok && now.Before(until) {
+		return until.Sub(now)
+	}
+
+	t.until[key] = now.Add(interval)
+	return 0
+}
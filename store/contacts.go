@@ -15,6 +15,8 @@ type Contact struct {
 	Nickname  *string
 	InviteID  *uuid.UUID
 	CreatedAt time.Time
+	// Notifications from this contact ignore the user's quiet hours
+	BypassQuiet bool
 }
 
 // AddContact adds a contact relationship (bidirectional).
@@ -53,7 +55,7 @@ func (db *DB) AddContact(ctx context.Context, userID, contactID uuid.UUID, sourc
 // GetContacts returns all contacts for a user.
 func (db *DB) GetContacts(ctx context.Context, userID uuid.UUID) ([]Contact, error) {
 	rows, err := db.pool.Query(ctx, `
-		SELECT user_id, contact_id, source, nickname, invite_id, created_at
+		SELECT user_id, contact_id, source, nickname, invite_id, created_at, bypass_quiet
 		FROM contacts
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -66,7 +68,7 @@ func (db *DB) GetContacts(ctx context.Context, userID uuid.UUID) ([]Contact, err
 	var contacts []Contact
 	for rows.Next() {
 		var c Contact
-		if err := rows.Scan(&c.UserID, &c.ContactID, &c.Source, &c.Nickname, &c.InviteID, &c.CreatedAt); err != nil {
+		if err := rows.Scan(&c.UserID, &c.ContactID, &c.Source, &c.Nickname, &c.InviteID, &c.CreatedAt, &c.BypassQuiet); err != nil {
 			return nil, err
 		}
 		contacts = append(contacts, c)
@@ -95,6 +97,19 @@ func (db *DB) UpdateContactNickname(ctx context.Context, userID, contactID uuid.
 	return err
 }
 
+// SetContactBypassQuiet sets whether a contact's messages notify the user
+// during quiet hours. Returns false if they aren't the user's contact.
+func (db *DB) SetContactBypassQuiet(ctx context.Context, userID, contactID uuid.UUID, bypass bool) (bool, error) {
+	result, err := db.pool.Exec(ctx, `
+		UPDATE contacts SET bypass_quiet = $3
+		WHERE user_id = $1 AND contact_id = $2
+	`, userID, contactID, bypass)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
 // RemoveContact removes a contact relationship (bidirectional).
 func (db *DB) RemoveContact(ctx context.Context, userID, contactID uuid.UUID) error {
 	_, err := db.pool.Exec(ctx, `
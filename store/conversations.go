@@ -23,12 +23,21 @@ type Conversation struct {
 	DelID     int             `json:"delId"`
 	// Disappearing messages TTL in seconds (nil = disabled)
 	DisappearingTTL *int `json:"disappearingTTL,omitempty"`
-	// Pinned message info
+	// Top pinned message info (resolved from pinned_messages)
 	PinnedMessageID *uuid.UUID `json:"pinnedMessageId,omitempty"`
+	PinnedSeq       *int       `json:"pinnedSeq,omitempty"`
 	PinnedAt        *time.Time `json:"pinnedAt,omitempty"`
 	PinnedBy        *uuid.UUID `json:"pinnedBy,omitempty"`
+	// Number of pinned messages (computed, not stored)
+	PinCount int `json:"pinCount"`
 	// No-screenshots flag (set by owner/admin for rooms)
 	NoScreenshots bool `json:"noScreenshots,omitempty"`
+	// Slow mode interval in seconds between sends per member (0 = disabled)
+	SlowMode int `json:"slowMode,omitempty"`
+	// Per-room member cap (0 = server-wide limit applies)
+	MaxMembers int `json:"maxMembers,omitempty"`
+	// Number of active members (computed, not stored)
+	MemberCount int `json:"memberCount"`
 }
 
 // Member represents a user's membership in a conversation.
@@ -43,6 +52,8 @@ type Member struct {
 	ClearSeq       int             `json:"clearSeq"`
 	Favorite       bool            `json:"favorite"`
 	Muted          bool            `json:"muted"`
+	MutedUntil     *time.Time      `json:"mutedUntil,omitempty"`
+	Notify         *string         `json:"notify,omitempty"`
 	Blocked        bool            `json:"blocked"`
 	Private        json.RawMessage `json:"private,omitempty"`
 	DeletedAt      *time.Time      `json:"deletedAt,omitempty"`
@@ -60,12 +71,14 @@ type ConversationWithMember struct {
 	ClearSeq        int             `json:"clearSeq"`
 	Favorite        bool            `json:"favorite"`
 	Muted           bool            `json:"muted"`
+	MutedUntil      *time.Time      `json:"mutedUntil,omitempty"`
+	Notify          *string         `json:"notify,omitempty"`
 	Blocked         bool            `json:"blocked"`
 	Private         json.RawMessage `json:"private,omitempty"`
+	// Thread replies after ReadSeq, which threaded clients leave out of unread
+	UnreadReplies int `json:"-"`
 	// For DMs: the other user's info
 	OtherUser *User `json:"otherUser,omitempty"`
-	// Pinned message seq (resolved from pinned_message_id)
-	PinnedSeq *int `json:"pinnedSeq,omitempty"`
 }
 
 // CreateDM creates a new DM conversation between two users.
@@ -186,16 +199,33 @@ func (db *DB) CreateRoom(ctx context.Context, ownerID uuid.UUID, public json.Raw
 	}, nil
 }
 
+// topPinJoin resolves a conversation's top pinned message as "tp".
+const topPinJoin = `
+		LEFT JOIN LATERAL (
+			SELECT pm.message_id, pm.pinned_at, pm.pinned_by, pmsg.seq
+			FROM pinned_messages pm
+			JOIN messages pmsg ON pmsg.id = pm.message_id AND pmsg.deleted_at IS NULL
+			WHERE pm.conversation_id = c.id
+			ORDER BY pm.position, pm.pinned_at DESC
+			LIMIT 1
+		) tp ON TRUE`
+
 // GetConversationByID retrieves a conversation by ID.
 func (db *DB) GetConversationByID(ctx context.Context, id uuid.UUID) (*Conversation, error) {
 	var conv Conversation
 	err := db.pool.QueryRow(ctx, `
-		SELECT id, created_at, updated_at, type, owner_id, public, last_seq, last_msg_at, del_id,
-			disappearing_ttl, pinned_message_id, pinned_at, pinned_by, no_screenshots
-		FROM conversations WHERE id = $1
+		SELECT c.id, c.created_at, c.updated_at, c.type, c.owner_id, c.public, c.last_seq, c.last_msg_at, c.del_id,
+			c.disappearing_ttl, tp.message_id, tp.seq, tp.pinned_at, tp.pinned_by, c.no_screenshots, c.slow_mode,
+			c.max_members,
+			(SELECT COUNT(*) FROM members WHERE conversation_id = c.id AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM pinned_messages WHERE conversation_id = c.id)
+		FROM conversations c
+		`+topPinJoin+`
+		WHERE c.id = $1
 	`, id).Scan(&conv.ID, &conv.CreatedAt, &conv.UpdatedAt, &conv.Type, &conv.OwnerID, &conv.Public,
 		&conv.LastSeq, &conv.LastMsgAt, &conv.DelID,
-		&conv.DisappearingTTL, &conv.PinnedMessageID, &conv.PinnedAt, &conv.PinnedBy, &conv.NoScreenshots)
+		&conv.DisappearingTTL, &conv.PinnedMessageID, &conv.PinnedSeq, &conv.PinnedAt, &conv.PinnedBy,
+		&conv.NoScreenshots, &conv.SlowMode, &conv.MaxMembers, &conv.MemberCount, &conv.PinCount)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
@@ -211,10 +241,10 @@ func (db *DB) GetMember(ctx context.Context, convID, userID uuid.UUID) (*Member,
 	var m Member
 	err := db.pool.QueryRow(ctx, `
 		SELECT conversation_id, user_id, created_at, updated_at, role,
-			read_seq, recv_seq, clear_seq, favorite, muted, blocked, private, deleted_at
+			read_seq, recv_seq, clear_seq, favorite, muted, muted_until, notify, blocked, private, deleted_at
 		FROM members WHERE conversation_id = $1 AND user_id = $2
 	`, convID, userID).Scan(&m.ConversationID, &m.UserID, &m.CreatedAt, &m.UpdatedAt, &m.Role,
-		&m.ReadSeq, &m.RecvSeq, &m.ClearSeq, &m.Favorite, &m.Muted, &m.Blocked, &m.Private, &m.DeletedAt)
+		&m.ReadSeq, &m.RecvSeq, &m.ClearSeq, &m.Favorite, &m.Muted, &m.MutedUntil, &m.Notify, &m.Blocked, &m.Private, &m.DeletedAt)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
@@ -232,13 +262,15 @@ func (db *DB) GetUserConversations(ctx context.Context, userID uuid.UUID) ([]Con
 	rows, err := db.pool.Query(ctx, `
 		SELECT
 			c.id, c.created_at, c.updated_at, c.type, c.owner_id, c.public, c.last_seq, c.last_msg_at, c.del_id,
-			c.disappearing_ttl, c.pinned_message_id, c.pinned_at, c.pinned_by, c.no_screenshots,
-			m.created_at, m.updated_at, m.role, m.read_seq, m.recv_seq, m.clear_seq, m.favorite, m.muted, m.blocked, m.private,
+			c.disappearing_ttl, tp.message_id, tp.seq, tp.pinned_at, tp.pinned_by, c.no_screenshots, c.slow_mode,
+			c.max_members,
+			(SELECT COUNT(*) FROM members mc WHERE mc.conversation_id = c.id AND mc.deleted_at IS NULL),
+			(SELECT COUNT(*) FROM pinned_messages pc WHERE pc.conversation_id = c.id),
+			m.created_at, m.updated_at, m.role, m.read_seq, m.recv_seq, m.clear_seq, m.favorite, m.muted, m.muted_until, m.notify, m.blocked, m.private,
+			(SELECT COUNT(*) FROM messages tm WHERE tm.conversation_id = c.id AND tm.thread_seq IS NOT NULL AND tm.seq > m.read_seq),
 			-- DM other user fields (NULL for rooms)
 			ou.id, ou.created_at, ou.updated_at, ou.state, ou.public, ou.last_seen, ou.user_agent,
-			ou.must_change_password, ou.email, ou.email_verified,
-			-- Pinned message seq (NULL if no pinned message)
-			pm.seq
+			ou.must_change_password, ou.email, ou.email_verified, ou.presence
 		FROM conversations c
 		JOIN members m ON c.id = m.conversation_id
 		-- LEFT JOIN to get other user for DMs
@@ -247,8 +279,8 @@ func (db *DB) GetUserConversations(ctx context.Context, userID uuid.UUID) ([]Con
 			WHEN dp.user1_id = $1 THEN dp.user2_id
 			ELSE dp.user1_id
 		END AND ou.state != 'deleted'
-		-- LEFT JOIN to get pinned message seq
-		LEFT JOIN messages pm ON pm.id = c.pinned_message_id
+		-- LEFT JOIN to get the top pinned message
+		`+topPinJoin+`
 		WHERE m.user_id = $1 AND m.deleted_at IS NULL
 		ORDER BY COALESCE(c.last_msg_at, c.created_at) DESC
 	`, userID)
@@ -272,22 +304,24 @@ func (db *DB) GetUserConversations(ctx context.Context, userID uuid.UUID) ([]Con
 			ouMustChangePassword *bool
 			ouEmail              *string
 			ouEmailVerified      *bool
+			ouPresence           *Presence
 		)
 
 		if err := rows.Scan(
 			&cwm.Conversation.ID, &cwm.Conversation.CreatedAt, &cwm.Conversation.UpdatedAt,
 			&cwm.Conversation.Type, &cwm.Conversation.OwnerID, &cwm.Conversation.Public,
 			&cwm.Conversation.LastSeq, &cwm.Conversation.LastMsgAt, &cwm.Conversation.DelID,
-			&cwm.Conversation.DisappearingTTL, &cwm.Conversation.PinnedMessageID,
+			&cwm.Conversation.DisappearingTTL, &cwm.Conversation.PinnedMessageID, &cwm.Conversation.PinnedSeq,
 			&cwm.Conversation.PinnedAt, &cwm.Conversation.PinnedBy, &cwm.Conversation.NoScreenshots,
+			&cwm.Conversation.SlowMode, &cwm.Conversation.MaxMembers, &cwm.Conversation.MemberCount,
+			&cwm.Conversation.PinCount,
 			&cwm.MemberCreatedAt, &cwm.MemberUpdatedAt, &cwm.Role,
 			&cwm.ReadSeq, &cwm.RecvSeq, &cwm.ClearSeq,
-			&cwm.Favorite, &cwm.Muted, &cwm.Blocked, &cwm.Private,
+			&cwm.Favorite, &cwm.Muted, &cwm.MutedUntil, &cwm.Notify, &cwm.Blocked, &cwm.Private,
+			&cwm.UnreadReplies,
 			// Other user fields (nullable)
 			&ouID, &ouCreatedAt, &ouUpdatedAt, &ouState, &ouPublic,
-			&ouLastSeen, &ouUserAgent, &ouMustChangePassword, &ouEmail, &ouEmailVerified,
-			// Pinned message seq
-			&cwm.PinnedSeq,
+			&ouLastSeen, &ouUserAgent, &ouMustChangePassword, &ouEmail, &ouEmailVerified, &ouPresence,
 		); err != nil {
 			return nil, err
 		}
@@ -301,6 +335,7 @@ func (db *DB) GetUserConversations(ctx context.Context, userID uuid.UUID) ([]Con
 				State:     *ouState,
 				Public:    ouPublic,
 				LastSeen:  ouLastSeen,
+				Presence:  ouPresence,
 			}
 			if ouUserAgent != nil {
 				cwm.OtherUser.UserAgent = *ouUserAgent
@@ -360,13 +395,17 @@ func (db *DB) GetConversationMembers(ctx context.Context, convID uuid.UUID) ([]u
 // MemberSettings holds updateable member settings.
 type MemberSettings struct {
 	Favorite *bool
-	Muted    *bool
-	Blocked  *bool
-	Private  json.RawMessage
+	// Setting Muted (either way) also clears a timed mute
+	Muted      *bool
+	MutedUntil *time.Time
+	// Notification level; "" resets to the user's default
+	Notify  *string
+	Blocked *bool
+	Private json.RawMessage
 }
 
-// UpdateMemberSettings updates a member's settings (favorite, muted, blocked, private).
-// Only non-nil fields are updated.
+// UpdateMemberSettings updates a member's settings (favorite, muted, notify,
+// blocked, private). Only non-nil fields are updated.
 func (db *DB) UpdateMemberSettings(ctx context.Context, convID, userID uuid.UUID, settings MemberSettings) error {
 	now := time.Now().UTC()
 
@@ -374,19 +413,38 @@ func (db *DB) UpdateMemberSettings(ctx context.Context, convID, userID uuid.UUID
 		UPDATE members SET
 			favorite = COALESCE($3, favorite),
 			muted = COALESCE($4, muted),
+			muted_until = CASE
+				WHEN $8::timestamptz IS NOT NULL THEN $8
+				WHEN $4::boolean IS NOT NULL THEN NULL
+				ELSE muted_until
+			END,
+			notify = CASE WHEN $9::text IS NULL THEN notify ELSE NULLIF($9, '') END,
 			blocked = COALESCE($5, blocked),
 			private = COALESCE($6, private),
 			updated_at = $7
 		WHERE conversation_id = $1 AND user_id = $2
-	`, convID, userID, settings.Favorite, settings.Muted, settings.Blocked, settings.Private, now)
+	`, convID, userID, settings.Favorite, settings.Muted, settings.Blocked, settings.Private, now,
+		settings.MutedUntil, settings.Notify)
 	return err
 }
 
-// UpdateReadSeq updates a member's read sequence.
+// UpdateReadSeq updates a member's read sequence. When it advances, the
+// time is recorded as a receipt for per-message status.
 func (db *DB) UpdateReadSeq(ctx context.Context, convID, userID uuid.UUID, seq int) error {
 	_, err := db.pool.Exec(ctx, `
-		UPDATE members SET read_seq = $3, recv_seq = GREATEST(recv_seq, $3), updated_at = $4
-		WHERE conversation_id = $1 AND user_id = $2
+		WITH prev AS (
+			SELECT read_seq FROM members
+			WHERE conversation_id = $1 AND user_id = $2
+			FOR UPDATE
+		), updated AS (
+			UPDATE members SET read_seq = $3, recv_seq = GREATEST(recv_seq, $3), updated_at = $4
+			WHERE conversation_id = $1 AND user_id = $2
+		)
+		INSERT INTO receipts (conversation_id, user_id, seq, recv_at, read_at)
+		SELECT $1, $2, $3, $4, $4 FROM prev WHERE prev.read_seq < $3
+		ON CONFLICT (conversation_id, user_id, seq) DO UPDATE SET
+			recv_at = COALESCE(receipts.recv_at, EXCLUDED.recv_at),
+			read_at = COALESCE(receipts.read_at, EXCLUDED.read_at)
 	`, convID, userID, seq, time.Now().UTC())
 	return err
 }
@@ -395,8 +453,18 @@ func (db *DB) UpdateReadSeq(ctx context.Context, convID, userID uuid.UUID, seq i
 // This indicates the user's device has received messages up to this seq.
 func (db *DB) UpdateRecvSeq(ctx context.Context, convID, userID uuid.UUID, seq int) error {
 	_, err := db.pool.Exec(ctx, `
-		UPDATE members SET recv_seq = GREATEST(recv_seq, $3), updated_at = $4
-		WHERE conversation_id = $1 AND user_id = $2
+		WITH prev AS (
+			SELECT recv_seq FROM members
+			WHERE conversation_id = $1 AND user_id = $2
+			FOR UPDATE
+		), updated AS (
+			UPDATE members SET recv_seq = GREATEST(recv_seq, $3), updated_at = $4
+			WHERE conversation_id = $1 AND user_id = $2
+		)
+		INSERT INTO receipts (conversation_id, user_id, seq, recv_at)
+		SELECT $1, $2, $3, $4 FROM prev WHERE prev.recv_seq < $3
+		ON CONFLICT (conversation_id, user_id, seq) DO UPDATE SET
+			recv_at = COALESCE(receipts.recv_at, EXCLUDED.recv_at)
 	`, convID, userID, seq, time.Now().UTC())
 	return err
 }
@@ -416,14 +484,17 @@ type ReadReceipt struct {
 	UserID  uuid.UUID
 	ReadSeq int
 	RecvSeq int
+	// The user has turned off read receipts
+	HideReadReceipts bool
 }
 
 // GetReadReceipts returns read receipts for all members of a conversation.
 func (db *DB) GetReadReceipts(ctx context.Context, convID uuid.UUID) ([]ReadReceipt, error) {
 	rows, err := db.pool.Query(ctx, `
-		SELECT user_id, read_seq, recv_seq
-		FROM members
-		WHERE conversation_id = $1 AND deleted_at IS NULL
+		SELECT m.user_id, m.read_seq, m.recv_seq, u.hide_read_receipts
+		FROM members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL
 	`, convID)
 	if err != nil {
 		return nil, err
@@ -433,7 +504,7 @@ func (db *DB) GetReadReceipts(ctx context.Context, convID uuid.UUID) ([]ReadRece
 	var receipts []ReadReceipt
 	for rows.Next() {
 		var r ReadReceipt
-		if err := rows.Scan(&r.UserID, &r.ReadSeq, &r.RecvSeq); err != nil {
+		if err := rows.Scan(&r.UserID, &r.ReadSeq, &r.RecvSeq, &r.HideReadReceipts); err != nil {
 			return nil, err
 		}
 		receipts = append(receipts, r)
@@ -466,11 +537,54 @@ func (db *DB) IsBlocked(ctx context.Context, convID, blockerID, blockedID uuid.U
 	return blocked, err
 }
 
+// ErrRoomFull is returned when adding a member would exceed the room's member limit.
+var ErrRoomFull = errors.New("room is full")
+
 // AddRoomMember adds a user to a room with the specified role.
-// If the user is already a member (including soft-deleted), this is a no-op.
-func (db *DB) AddRoomMember(ctx context.Context, convID, userID uuid.UUID, role string) error {
+// If the user is already a member (including soft-deleted), their membership is
+// restored with the new role. The member limit is the smaller of the room's own
+// max_members (when set) and maxMembers; a limit of 0 means no server-wide cap.
+// Returns ErrRoomFull if the room has no room for another member.
+func (db *DB) AddRoomMember(ctx context.Context, convID, userID uuid.UUID, role string, maxMembers int) error {
 	now := time.Now().UTC()
-	_, err := db.pool.Exec(ctx, `
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the conversation row so concurrent joins are serialized
+	var roomMax int
+	err = tx.QueryRow(ctx, `
+		SELECT max_members FROM conversations WHERE id = $1 FOR UPDATE
+	`, convID).Scan(&roomMax)
+	if err != nil {
+		return err
+	}
+
+	limit := maxMembers
+	if roomMax > 0 && (limit <= 0 || roomMax < limit) {
+		limit = roomMax
+	}
+
+	if limit > 0 {
+		var count int
+		var alreadyMember bool
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(*), COALESCE(BOOL_OR(user_id = $2), false)
+			FROM members
+			WHERE conversation_id = $1 AND deleted_at IS NULL
+		`, convID, userID).Scan(&count, &alreadyMember)
+		if err != nil {
+			return err
+		}
+		if !alreadyMember && count >= limit {
+			return ErrRoomFull
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
 		INSERT INTO members (conversation_id, user_id, created_at, updated_at, role)
 		VALUES ($1, $2, $3, $3, $4)
 		ON CONFLICT (conversation_id, user_id) DO UPDATE SET
@@ -478,7 +592,11 @@ func (db *DB) AddRoomMember(ctx context.Context, convID, userID uuid.UUID, role
 			role = EXCLUDED.role,
 			updated_at = EXCLUDED.updated_at
 	`, convID, userID, now, role)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 // RemoveMember soft-deletes a member from a conversation.
@@ -515,45 +633,6 @@ func (db *DB) UpdateRoomPublic(ctx context.Context, convID uuid.UUID, public jso
 	return err
 }
 
-// SetPinnedMessage sets or clears the pinned message for a conversation.
-// Pass messageID as nil to unpin.
-func (db *DB) SetPinnedMessage(ctx context.Context, convID uuid.UUID, messageID *uuid.UUID, pinnedBy uuid.UUID) error {
-	now := time.Now().UTC()
-	if messageID == nil {
-		// Unpin
-		_, err := db.pool.Exec(ctx, `
-			UPDATE conversations
-			SET pinned_message_id = NULL, pinned_at = NULL, pinned_by = NULL, updated_at = $2
-			WHERE id = $1
-		`, convID, now)
-		return err
-	}
-	// Pin
-	_, err := db.pool.Exec(ctx, `
-		UPDATE conversations
-		SET pinned_message_id = $2, pinned_at = $3, pinned_by = $4, updated_at = $3
-		WHERE id = $1
-	`, convID, messageID, now, pinnedBy)
-	return err
-}
-
-// GetPinnedMessageSeq returns the seq of the pinned message, or nil if no message is pinned.
-func (db *DB) GetPinnedMessageSeq(ctx context.Context, convID uuid.UUID) (*int, error) {
-	var seq *int
-	err := db.pool.QueryRow(ctx, `
-		SELECT m.seq FROM conversations c
-		JOIN messages m ON m.id = c.pinned_message_id
-		WHERE c.id = $1
-	`, convID).Scan(&seq)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return seq, nil
-}
-
 // UpdateConversationDisappearingTTL sets or clears the disappearing messages TTL.
 // Pass ttl as nil to disable disappearing messages.
 func (db *DB) UpdateConversationDisappearingTTL(ctx context.Context, convID uuid.UUID, ttl *int) error {
@@ -586,3 +665,25 @@ func (db *DB) UpdateConversationNoScreenshots(ctx context.Context, convID uuid.U
 	`, convID, noScreenshots, now)
 	return err
 }
+
+// UpdateConversationSlowMode sets the slow mode interval (in seconds) for a room.
+// Pass 0 to disable slow mode.
+func (db *DB) UpdateConversationSlowMode(ctx context.Context, convID uuid.UUID, seconds int) error {
+	now := time.Now().UTC()
+	_, err := db.pool.Exec(ctx, `
+		UPDATE conversations SET slow_mode = $2, updated_at = $3
+		WHERE id = $1 AND type = 'room'
+	`, convID, seconds, now)
+	return err
+}
+
+// UpdateConversationMaxMembers sets the per-room member cap.
+// Pass 0 to fall back to the server-wide limit.
+func (db *DB) UpdateConversationMaxMembers(ctx context.Context, convID uuid.UUID, maxMembers int) error {
+	now := time.Now().UTC()
+	_, err := db.pool.Exec(ctx, `
+		UPDATE conversations SET max_members = $2, updated_at = $3
+		WHERE id = $1 AND type = 'room'
+	`, convID, maxMembers, now)
+	return err
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB connects to the database in MVCHAT2_TEST_DATABASE_URL and sets up a
+// fresh schema with schema.sql and every later migration, dropped when the
+// test ends. The test is skipped when the variable isn't set.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("MVCHAT2_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("MVCHAT2_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+		admin.Close(ctx)
+	})
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	db := &DB{pool: pool}
+
+	// InitSchema looks for schema_version in any schema, so apply it directly
+	base, err := schemaFS.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, string(base)); err != nil {
+		t.Fatalf("schema.sql: %v", err)
+	}
+	version, err := db.GetSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir("migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		n, err := strconv.Atoi(strings.SplitN(e.Name(), "_", 2)[0])
+		if err != nil || n <= version {
+			continue
+		}
+		migration, err := os.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, string(migration)); err != nil {
+			t.Fatalf("%s: %v", e.Name(), err)
+		}
+	}
+	return db
+}
+
+// expiryFixture is a DM in which Alice sent Bob a view-once message.
+type expiryFixture struct {
+	db         *DB
+	alice, bob uuid.UUID
+	convID     uuid.UUID
+	msg        *Message
+}
+
+func newExpiryFixture(t *testing.T) *expiryFixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &expiryFixture{db: testDB(t)}
+
+	var err error
+	for _, id := range []*uuid.UUID{&f.alice, &f.bob} {
+		if *id, err = f.db.CreateUser(ctx, json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conv, _, err := f.db.CreateDM(ctx, f.alice, f.bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.convID = conv.ID
+	ttl := 10
+	f.msg, err = f.db.CreateMessageWithViewOnce(ctx, f.convID, f.alice, []byte("secret"), nil, true, &ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// read records Bob reading the message.
+func (f *expiryFixture) read(t *testing.T) {
+	t.Helper()
+	if _, err := f.db.RecordMessageRead(context.Background(), f.msg.ID, f.bob); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expire moves Bob's read expiry into the past, as if the TTL ran out. The
+// expired flag is left unset.
+func (f *expiryFixture) expire(t *testing.T) {
+	t.Helper()
+	_, err := f.db.pool.Exec(context.Background(), `
+		UPDATE message_reads SET expires_at = NOW() - INTERVAL '1 second'
+		WHERE message_id = $1 AND user_id = $2
+	`, f.msg.ID, f.bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveExpiredPins(t *testing.T) {
+	f := newExpiryFixture(t)
+	ctx := context.Background()
+	if err := f.db.PinMessage(ctx, f.convID, f.msg.ID, f.alice, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read but not yet expired
+	f.read(t)
+	if pins, err := f.db.RemoveExpiredPins(ctx); err != nil || len(pins) != 0 {
+		t.Fatalf("expected no pins removed before expiry, got %v (%v)", pins, err)
+	}
+	if pins, err := f.db.GetPinnedMessages(ctx, f.convID, f.bob, 0); err != nil || len(pins) != 1 {
+		t.Fatalf("expected the pin visible to bob, got %v (%v)", pins, err)
+	}
+
+	f.expire(t)
+	if pins, err := f.db.GetPinnedMessages(ctx, f.convID, f.bob, 0); err != nil || len(pins) != 0 {
+		t.Errorf("expected the pin hidden from bob once expired, got %v (%v)", pins, err)
+	}
+	pins, err := f.db.RemoveExpiredPins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].ID != f.msg.ID || pins[0].Seq != f.msg.Seq {
+		t.Errorf("expected the expired message unpinned, got %v", pins)
+	}
+}
+
+func TestRemoveUnavailableSavedMessages_Expired(t *testing.T) {
+	f := newExpiryFixture(t)
+	ctx := context.Background()
+	if err := f.db.SaveMessage(ctx, f.bob, f.msg.ID, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	f.read(t)
+	if n, err := f.db.RemoveUnavailableSavedMessages(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing removed before expiry, got %d (%v)", n, err)
+	}
+
+	f.expire(t)
+	if n, err := f.db.RemoveUnavailableSavedMessages(ctx); err != nil || n != 1 {
+		t.Errorf("expected the expired message unsaved, got %d (%v)", n, err)
+	}
+}
+
+func TestPurgeExpiredMessageIndex(t *testing.T) {
+	f := newExpiryFixture(t)
+	ctx := context.Background()
+
+	// View-once messages aren't indexed, so use a disappearing one
+	ttl := 60
+	if err := f.db.UpdateConversationDisappearingTTL(ctx, f.convID, &ttl); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if f.msg, err = f.db.CreateMessage(ctx, f.convID, f.alice, []byte("secret"), nil); err != nil {
+		t.Fatal(err)
+	}
+	tokens := [][]byte{[]byte("token")}
+	if err := f.db.IndexMessage(ctx, f.msg.ID, f.convID, tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	f.read(t)
+	if n, err := f.db.PurgeExpiredMessageIndex(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing purged before expiry, got %d (%v)", n, err)
+	}
+	if found, err := f.db.SearchMessages(ctx, f.bob, nil, tokens, 10); err != nil || len(found) != 1 {
+		t.Fatalf("expected bob to find the message, got %v (%v)", found, err)
+	}
+
+	f.expire(t)
+	if found, err := f.db.SearchMessages(ctx, f.bob, nil, tokens, 10); err != nil || len(found) != 0 {
+		t.Errorf("expected the expired message hidden from bob, got %v (%v)", found, err)
+	}
+	if n, err := f.db.PurgeExpiredMessageIndex(ctx); err != nil || n != 1 {
+		t.Errorf("expected the expired message unindexed, got %d (%v)", n, err)
+	}
+}
@@ -210,7 +210,8 @@ func (db *DB) DeleteFile(ctx context.Context, fileID uuid.UUID) error {
 // 2. File is referenced in a message in a conversation the user is a member of
 func (db *DB) CanAccessFile(ctx context.Context, fileID, userID uuid.UUID) (bool, error) {
 	// Check if user is the uploader OR if file is in a message in a conversation they're a member of
-	// File references are stored in message content (Irido format) as media[].ref = file UUID
+	// File references are stored in message content (Irido format) as media[].ref = file UUID,
+	// and in head.files since content is encrypted
 	var hasAccess bool
 	err := db.pool.QueryRow(ctx, `
 		SELECT EXISTS(
@@ -24,6 +24,13 @@ type Store interface {
 	UpdateUserPublic(ctx context.Context, userID uuid.UUID, public json.RawMessage) error
 	UpdateUserEmail(ctx context.Context, userID uuid.UUID, email *string) error
 	UpdateUserLang(ctx context.Context, userID uuid.UUID, lang *string) error
+	UpdateUserReadReceipts(ctx context.Context, userID uuid.UUID, enabled bool) error
+	UpdateUserNotifyDefault(ctx context.Context, userID uuid.UUID, level string) error
+	UpdateUserQuietHours(ctx context.Context, userID uuid.UUID, quiet *QuietHours) error
+	UpdateUserPresence(ctx context.Context, userID uuid.UUID, presence *Presence) error
+	UpdateUserPresencePrivacy(ctx context.Context, userID uuid.UUID, privacy *PresencePrivacy) error
+	GetPresencePeers(ctx context.Context, userID uuid.UUID, others []uuid.UUID) (map[uuid.UUID]PresencePeer, error)
+	GetPresenceNode(ctx context.Context, userID uuid.UUID) (*PresenceNode, error)
 	SearchUsers(ctx context.Context, query string, limit int) ([]User, error)
 
 	// Auth
@@ -57,7 +64,9 @@ type Store interface {
 	UpdateRecvSeq(ctx context.Context, convID, userID uuid.UUID, seq int) error
 	UpdateClearSeq(ctx context.Context, convID, userID uuid.UUID, seq int) error
 	GetReadReceipts(ctx context.Context, convID uuid.UUID) ([]ReadReceipt, error)
-	AddRoomMember(ctx context.Context, convID, userID uuid.UUID, role string) error
+	GetMessageStatus(ctx context.Context, convID uuid.UUID, seq int) ([]MessageStatus, error)
+	GetNotifySettings(ctx context.Context, convID, senderID uuid.UUID) ([]NotifySetting, error)
+	AddRoomMember(ctx context.Context, convID, userID uuid.UUID, role string, maxMembers int) error
 	RemoveMember(ctx context.Context, convID, userID uuid.UUID) error
 	GetMemberRole(ctx context.Context, convID, userID uuid.UUID) (string, error)
 
@@ -65,8 +74,12 @@ type Store interface {
 	UpdateRoomPublic(ctx context.Context, convID uuid.UUID, public json.RawMessage) error
 
 	// Pinned messages
-	SetPinnedMessage(ctx context.Context, convID uuid.UUID, messageID *uuid.UUID, pinnedBy uuid.UUID) error
-	GetPinnedMessageSeq(ctx context.Context, convID uuid.UUID) (*int, error)
+	PinMessage(ctx context.Context, convID, messageID, pinnedBy uuid.UUID, maxPins int) error
+	UnpinMessage(ctx context.Context, convID, messageID uuid.UUID) (bool, error)
+	UnpinAllMessages(ctx context.Context, convID uuid.UUID) error
+	ReorderPinnedMessages(ctx context.Context, convID uuid.UUID, seqs []int) error
+	GetPinnedMessages(ctx context.Context, convID, userID uuid.UUID, clearSeq int) ([]PinnedMessage, error)
+	RemoveExpiredPins(ctx context.Context) ([]PinnedMessage, error)
 
 	// Disappearing messages
 	UpdateConversationDisappearingTTL(ctx context.Context, convID uuid.UUID, ttl *int) error
@@ -75,18 +88,77 @@ type Store interface {
 	// No-screenshots
 	UpdateConversationNoScreenshots(ctx context.Context, convID uuid.UUID, noScreenshots bool) error
 
+	// Slow mode
+	UpdateConversationSlowMode(ctx context.Context, convID uuid.UUID, seconds int) error
+
+	// Member limits
+	UpdateConversationMaxMembers(ctx context.Context, convID uuid.UUID, maxMembers int) error
+
 	// Messages
 	CreateMessage(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*Message, error)
 	GetMessages(ctx context.Context, convID, userID uuid.UUID, before, limit int, clearSeq int) ([]Message, error)
 	GetMessageBySeq(ctx context.Context, convID uuid.UUID, seq int) (*Message, error)
-	EditMessage(ctx context.Context, convID uuid.UUID, seq int, content []byte) error
+	GetVisibleMessageBySeq(ctx context.Context, convID, userID uuid.UUID, seq int, clearSeq int) (*Message, error)
+	EditMessage(ctx context.Context, convID uuid.UUID, seq int, content []byte, files []string) error
 	UnsendMessage(ctx context.Context, convID uuid.UUID, seq int) error
 	DeleteMessageForEveryone(ctx context.Context, convID uuid.UUID, seq int) error
 	DeleteMessageForUser(ctx context.Context, msgID, userID uuid.UUID) error
-	AddReaction(ctx context.Context, convID uuid.UUID, seq int, userID uuid.UUID, emoji string) error
 	GetEditCount(ctx context.Context, convID uuid.UUID, seq int) (int, error)
 	GetMessagesMentioningUser(ctx context.Context, userID uuid.UUID, limit int) ([]Message, error)
 
+	// Threads
+	CreateThreadReply(ctx context.Context, convID, fromUserID uuid.UUID, rootSeq int, content []byte, head json.RawMessage) (*Message, error)
+	GetThreadMessages(ctx context.Context, convID, userID uuid.UUID, rootSeq, before, limit int, clearSeq int) ([]Message, error)
+	UpdateThreadReadSeq(ctx context.Context, convID, userID uuid.UUID, rootSeq, seq int) error
+	GetThreadReadSeq(ctx context.Context, convID, userID uuid.UUID, rootSeq int) (int, error)
+	CountThreadReplies(ctx context.Context, convID uuid.UUID, afterSeq int) (int, error)
+	CountThreadUnread(ctx context.Context, convID uuid.UUID, rootSeq, afterSeq int) (int, error)
+
+	// Polls
+	CreatePollMessage(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage, poll *Poll) (*Message, error)
+	GetPoll(ctx context.Context, convID uuid.UUID, seq int) (*Poll, error)
+	CastVote(ctx context.Context, messageID, userID uuid.UUID, options []int) error
+	GetPollVotes(ctx context.Context, messageID uuid.UUID) ([]PollVote, error)
+	ClosePoll(ctx context.Context, messageID uuid.UUID) error
+	CloseDuePolls(ctx context.Context) ([]Poll, error)
+
+	// Scheduled messages
+	CreateScheduledMessage(ctx context.Context, convID, userID uuid.UUID, sendAt time.Time, payload []byte, maxPending int) (*ScheduledMessage, error)
+	GetScheduledMessage(ctx context.Context, id uuid.UUID) (*ScheduledMessage, error)
+	GetUserScheduledMessages(ctx context.Context, userID uuid.UUID, convID *uuid.UUID) ([]ScheduledMessage, error)
+	UpdateScheduledMessage(ctx context.Context, id, userID uuid.UUID, sendAt time.Time, payload []byte) (bool, error)
+	CancelScheduledMessage(ctx context.Context, id, userID uuid.UUID) (bool, error)
+	ClaimDueScheduledMessages(ctx context.Context, limit int, lease time.Duration) ([]ScheduledMessage, error)
+	GetScheduledMessageSeq(ctx context.Context, id uuid.UUID) (int, error)
+	MarkScheduledSent(ctx context.Context, id uuid.UUID, seq int) error
+	RetryScheduledMessage(ctx context.Context, id uuid.UUID, at time.Time) error
+	MarkScheduledFailed(ctx context.Context, id uuid.UUID, reason string) error
+
+	// Push notifications
+	RegisterPushDevice(ctx context.Context, userID uuid.UUID, dev *PushDevice) error
+	UnregisterPushDevice(ctx context.Context, userID uuid.UUID, deviceID string) (bool, error)
+	RemovePushDevice(ctx context.Context, id int64) error
+	EnqueuePush(ctx context.Context, convID uuid.UUID, userIDs []uuid.UUID, payload []byte) (int, error)
+	ClaimPushes(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error)
+	CompletePush(ctx context.Context, id int64) error
+	RetryPush(ctx context.Context, id int64, at time.Time) error
+
+	// Saved messages
+	SaveMessage(ctx context.Context, userID, messageID uuid.UUID, note []byte, maxSaved int) error
+	UnsaveMessage(ctx context.Context, userID, messageID uuid.UUID) (bool, error)
+	GetSavedMessages(ctx context.Context, userID uuid.UUID, before int64, limit int) ([]SavedMessage, error)
+	RemoveUnavailableSavedMessages(ctx context.Context) (int64, error)
+
+	// Message search (blind index)
+	IndexMessage(ctx context.Context, messageID, convID uuid.UUID, tokens [][]byte) error
+	SearchMessages(ctx context.Context, userID uuid.UUID, convID *uuid.UUID, tokens [][]byte, limit int) ([]Message, error)
+	PurgeExpiredMessageIndex(ctx context.Context) (int64, error)
+
+	// Reactions
+	ToggleReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string, maxEmojis int) (bool, int, error)
+	GetReactionCounts(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID][]ReactionCount, error)
+	GetReactions(ctx context.Context, messageID uuid.UUID, emoji string, before int64, limit int) ([]Reaction, error)
+
 	// View-once and message reads
 	CreateMessageWithViewOnce(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage, viewOnce bool, viewOnceTTL *int) (*Message, error)
 	RecordMessageRead(ctx context.Context, messageID, userID uuid.UUID) (*MessageRead, error)
@@ -125,6 +197,7 @@ type Store interface {
 	GetContacts(ctx context.Context, userID uuid.UUID) ([]Contact, error)
 	IsContact(ctx context.Context, userID, contactID uuid.UUID) (bool, error)
 	UpdateContactNickname(ctx context.Context, userID, contactID uuid.UUID, nickname *string) error
+	SetContactBypassQuiet(ctx context.Context, userID, contactID uuid.UUID, bypass bool) (bool, error)
 	RemoveContact(ctx context.Context, userID, contactID uuid.UUID) error
 }
 
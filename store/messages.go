@@ -24,6 +24,8 @@ type Message struct {
 	// View-once message support
 	ViewOnce    bool `json:"viewOnce,omitempty"`
 	ViewOnceTTL *int `json:"viewOnceTTL,omitempty"` // seconds: 10, 30, 60, 300, 3600, 86400, 604800
+	// Thread root seq for thread replies (nil for main timeline messages)
+	ThreadSeq *int `json:"threadSeq,omitempty"`
 }
 
 // MessageDeletion represents a soft delete for a specific user.
@@ -94,7 +96,7 @@ func (db *DB) GetMessages(ctx context.Context, convID, userID uuid.UUID, before,
 
 	if before > 0 {
 		query = `
-			SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl
+			SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq
 			FROM messages m
 			LEFT JOIN message_deletions md ON m.id = md.message_id AND md.user_id = $2
 			LEFT JOIN message_reads mr ON m.id = mr.message_id AND mr.user_id = $2
@@ -108,7 +110,7 @@ func (db *DB) GetMessages(ctx context.Context, convID, userID uuid.UUID, before,
 		args = []any{convID, userID, limit, before, clearSeq}
 	} else {
 		query = `
-			SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl
+			SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq
 			FROM messages m
 			LEFT JOIN message_deletions md ON m.id = md.message_id AND md.user_id = $2
 			LEFT JOIN message_reads mr ON m.id = mr.message_id AND mr.user_id = $2
@@ -132,7 +134,7 @@ func (db *DB) GetMessages(ctx context.Context, convID, userID uuid.UUID, before,
 		var msg Message
 		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Seq, &msg.FromUserID,
 			&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt,
-			&msg.ViewOnce, &msg.ViewOnceTTL); err != nil {
+			&msg.ViewOnce, &msg.ViewOnceTTL, &msg.ThreadSeq); err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
@@ -144,11 +146,40 @@ func (db *DB) GetMessages(ctx context.Context, convID, userID uuid.UUID, before,
 func (db *DB) GetMessageBySeq(ctx context.Context, convID uuid.UUID, seq int) (*Message, error) {
 	var msg Message
 	err := db.pool.QueryRow(ctx, `
-		SELECT id, conversation_id, seq, from_user_id, created_at, updated_at, content, head, deleted_at, view_once, view_once_ttl
+		SELECT id, conversation_id, seq, from_user_id, created_at, updated_at, content, head, deleted_at, view_once, view_once_ttl, thread_seq
 		FROM messages WHERE conversation_id = $1 AND seq = $2
 	`, convID, seq).Scan(&msg.ID, &msg.ConversationID, &msg.Seq, &msg.FromUserID,
 		&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt,
-		&msg.ViewOnce, &msg.ViewOnceTTL)
+		&msg.ViewOnce, &msg.ViewOnceTTL, &msg.ThreadSeq)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetVisibleMessageBySeq retrieves a message by seq if it is visible to userID:
+// after their clear_seq, not deleted for them, and not expired for them.
+// Unsent and deleted-for-everyone messages are returned with DeletedAt set.
+// Returns nil if the message doesn't exist or isn't visible.
+func (db *DB) GetVisibleMessageBySeq(ctx context.Context, convID, userID uuid.UUID, seq int, clearSeq int) (*Message, error) {
+	var msg Message
+	err := db.pool.QueryRow(ctx, `
+		SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq
+		FROM messages m
+		LEFT JOIN message_deletions md ON m.id = md.message_id AND md.user_id = $2
+		LEFT JOIN message_reads mr ON m.id = mr.message_id AND mr.user_id = $2
+		WHERE m.conversation_id = $1
+		AND m.seq = $3
+		AND m.seq > $4
+		AND md.message_id IS NULL
+		AND (mr.expired IS NULL OR mr.expired = FALSE)
+	`, convID, userID, seq, clearSeq).Scan(&msg.ID, &msg.ConversationID, &msg.Seq, &msg.FromUserID,
+		&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt,
+		&msg.ViewOnce, &msg.ViewOnceTTL, &msg.ThreadSeq)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
@@ -160,14 +191,17 @@ func (db *DB) GetMessageBySeq(ctx context.Context, convID uuid.UUID, seq int) (*
 }
 
 // EditMessage updates a message's content and increments edit count.
-func (db *DB) EditMessage(ctx context.Context, convID uuid.UUID, seq int, content []byte) error {
+// files replaces head.files, the attachment refs file access is granted by.
+func (db *DB) EditMessage(ctx context.Context, convID uuid.UUID, seq int, content []byte, files []string) error {
 	now := time.Now().UTC()
 	_, err := db.pool.Exec(ctx, `
 		UPDATE messages 
 		SET content = $3, updated_at = $4,
-			head = COALESCE(head, '{}'::jsonb) || jsonb_build_object('edit_count', COALESCE((head->>'edit_count')::int, 0) + 1, 'edited_at', $4::timestamptz)
+			head = (COALESCE(head, '{}'::jsonb) - 'files')
+				|| CASE WHEN cardinality($5::text[]) > 0 THEN jsonb_build_object('files', $5::text[]) ELSE '{}'::jsonb END
+				|| jsonb_build_object('edit_count', COALESCE((head->>'edit_count')::int, 0) + 1, 'edited_at', $4::timestamptz)
 		WHERE conversation_id = $1 AND seq = $2 AND deleted_at IS NULL
-	`, convID, seq, content, now)
+	`, convID, seq, content, now, files)
 	return err
 }
 
@@ -175,117 +209,82 @@ func (db *DB) EditMessage(ctx context.Context, convID uuid.UUID, seq int, conten
 // Only usable within the unsend time window. Content is preserved for audit.
 func (db *DB) UnsendMessage(ctx context.Context, convID uuid.UUID, seq int) error {
 	now := time.Now().UTC()
-	_, err := db.pool.Exec(ctx, `
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
 		UPDATE messages SET deleted_at = $3, updated_at = $3,
 			head = COALESCE(head, '{}'::jsonb) || '{"unsent": true}'::jsonb
 		WHERE conversation_id = $1 AND seq = $2
 	`, convID, seq, now)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := unpinBySeq(ctx, tx, convID, seq); err != nil {
+		return err
+	}
+	if err := unindexBySeq(ctx, tx, convID, seq); err != nil {
+		return err
+	}
+	if err := resummarizeThread(ctx, tx, convID, seq); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 // DeleteMessageForEveryone marks a message as deleted for all participants (soft delete).
 // No time limit. Content is preserved for audit.
 func (db *DB) DeleteMessageForEveryone(ctx context.Context, convID uuid.UUID, seq int) error {
 	now := time.Now().UTC()
-	_, err := db.pool.Exec(ctx, `
-		UPDATE messages SET deleted_at = $3, updated_at = $3
-		WHERE conversation_id = $1 AND seq = $2
-	`, convID, seq, now)
-	return err
-}
-
-// DeleteMessageForUser creates a soft delete entry for a specific user.
-func (db *DB) DeleteMessageForUser(ctx context.Context, msgID, userID uuid.UUID) error {
-	now := time.Now().UTC()
-	_, err := db.pool.Exec(ctx, `
-		INSERT INTO message_deletions (message_id, user_id, deleted_at)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (message_id, user_id) DO NOTHING
-	`, msgID, userID, now)
-	return err
-}
-
-// AddReaction adds or toggles a reaction on a message.
-// Uses SELECT FOR UPDATE to prevent race conditions when multiple users react simultaneously.
-func (db *DB) AddReaction(ctx context.Context, convID uuid.UUID, seq int, userID uuid.UUID, emoji string) error {
-	now := time.Now().UTC()
-	userIDStr := userID.String()
-
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	// Lock the row while we modify it to prevent race conditions
-	var head json.RawMessage
-	err = tx.QueryRow(ctx, `
-		SELECT COALESCE(head, '{}'::jsonb) FROM messages
+	_, err = tx.Exec(ctx, `
+		UPDATE messages SET deleted_at = $3, updated_at = $3
 		WHERE conversation_id = $1 AND seq = $2
-		FOR UPDATE
-	`, convID, seq).Scan(&head)
+	`, convID, seq, now)
 	if err != nil {
 		return err
 	}
-
-	// Parse and update reactions
-	var headMap map[string]any
-	if err := json.Unmarshal(head, &headMap); err != nil {
-		headMap = make(map[string]any)
-	}
-
-	reactions, ok := headMap["reactions"].(map[string]any)
-	if !ok {
-		reactions = make(map[string]any)
-	}
-
-	emojiUsers, ok := reactions[emoji].([]any)
-	if !ok {
-		emojiUsers = []any{}
-	}
-
-	// Toggle: remove if exists, add if not
-	found := false
-	newUsers := []any{}
-	for _, u := range emojiUsers {
-		if u == userIDStr {
-			found = true
-		} else {
-			newUsers = append(newUsers, u)
-		}
-	}
-	if !found {
-		newUsers = append(newUsers, userIDStr)
-	}
-
-	if len(newUsers) == 0 {
-		delete(reactions, emoji)
-	} else {
-		reactions[emoji] = newUsers
-	}
-
-	if len(reactions) == 0 {
-		delete(headMap, "reactions")
-	} else {
-		headMap["reactions"] = reactions
+	if err := unpinBySeq(ctx, tx, convID, seq); err != nil {
+		return err
 	}
-
-	newHead, err := json.Marshal(headMap)
-	if err != nil {
+	if err := unindexBySeq(ctx, tx, convID, seq); err != nil {
 		return err
 	}
-
-	_, err = tx.Exec(ctx, `
-		UPDATE messages SET head = $3, updated_at = $4
-		WHERE conversation_id = $1 AND seq = $2
-	`, convID, seq, newHead, now)
-	if err != nil {
+	if err := resummarizeThread(ctx, tx, convID, seq); err != nil {
 		return err
 	}
-
 	return tx.Commit(ctx)
 }
 
+// unpinBySeq removes a message from the conversation's pin list.
+func unpinBySeq(ctx context.Context, tx pgx.Tx, convID uuid.UUID, seq int) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM pinned_messages
+		WHERE conversation_id = $1
+		AND message_id = (SELECT id FROM messages WHERE conversation_id = $1 AND seq = $2)
+	`, convID, seq)
+	return err
+}
+
+// DeleteMessageForUser creates a soft delete entry for a specific user.
+func (db *DB) DeleteMessageForUser(ctx context.Context, msgID, userID uuid.UUID) error {
+	now := time.Now().UTC()
+	_, err := db.pool.Exec(ctx, `
+		INSERT INTO message_deletions (message_id, user_id, deleted_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`, msgID, userID, now)
+	return err
+}
+
 // GetEditCount returns the edit count for a message.
 func (db *DB) GetEditCount(ctx context.Context, convID uuid.UUID, seq int) (int, error) {
 	var head json.RawMessage
@@ -440,6 +439,10 @@ func (db *DB) GetMessageRead(ctx context.Context, messageID, userID uuid.UUID) (
 	return &mr, nil
 }
 
+// readExpired matches a read record (mr) that has expired. The expiry time is
+// compared with the clock, so it holds before ExpireReadMessages flags the row.
+const readExpired = `(mr.expired OR COALESCE(mr.expires_at <= NOW(), FALSE))`
+
 // ExpireReadMessages marks messages as expired for users whose TTL has passed.
 // Returns the number of messages expired.
 func (db *DB) ExpireReadMessages(ctx context.Context) (int64, error) {
@@ -477,10 +480,10 @@ func (db *DB) IsMessageExpiredForUser(ctx context.Context, messageID, userID uui
 func (db *DB) GetMessageByID(ctx context.Context, messageID uuid.UUID) (*Message, error) {
 	var msg Message
 	err := db.pool.QueryRow(ctx, `
-		SELECT id, conversation_id, seq, from_user_id, created_at, updated_at, content, head, deleted_at, view_once, view_once_ttl
+		SELECT id, conversation_id, seq, from_user_id, created_at, updated_at, content, head, deleted_at, view_once, view_once_ttl, thread_seq
 		FROM messages WHERE id = $1
 	`, messageID).Scan(&msg.ID, &msg.ConversationID, &msg.Seq, &msg.FromUserID,
-		&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt, &msg.ViewOnce, &msg.ViewOnceTTL)
+		&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt, &msg.ViewOnce, &msg.ViewOnceTTL, &msg.ThreadSeq)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
@@ -499,7 +502,7 @@ func (db *DB) GetMessagesMentioningUser(ctx context.Context, userID uuid.UUID, l
 	}
 
 	rows, err := db.pool.Query(ctx, `
-		SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl
+		SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq
 		FROM messages m
 		JOIN members mem ON m.conversation_id = mem.conversation_id AND mem.user_id = $1 AND mem.deleted_at IS NULL
 		WHERE m.head->'mentions' @> $2::jsonb
@@ -516,7 +519,7 @@ func (db *DB) GetMessagesMentioningUser(ctx context.Context, userID uuid.UUID, l
 	for rows.Next() {
 		var msg Message
 		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Seq, &msg.FromUserID,
-			&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt, &msg.ViewOnce, &msg.ViewOnceTTL); err != nil {
+			&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt, &msg.ViewOnce, &msg.ViewOnceTTL, &msg.ThreadSeq); err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
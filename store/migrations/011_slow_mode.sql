@@ -0,0 +1,8 @@
+-- Migration 011: Slow mode for rooms
+-- Minimum interval in seconds between messages from the same member (0 = disabled).
+-- Owners and admins are exempt; enforcement happens at send time.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS slow_mode INT NOT NULL DEFAULT 0;
+
+-- Update schema version
+UPDATE schema_version SET version = 11 WHERE version = 10;
+INSERT INTO schema_version (version) SELECT 11 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 11);
@@ -0,0 +1,8 @@
+-- Migration 012: Room member limits
+-- Per-room member cap (0 = use the server-wide limits.max_subscriber_count).
+-- The cap is enforced transactionally when members are added.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS max_members INT NOT NULL DEFAULT 0;
+
+-- Update schema version
+UPDATE schema_version SET version = 12 WHERE version = 11;
+INSERT INTO schema_version (version) SELECT 12 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 12);
@@ -0,0 +1,23 @@
+-- Migration 013: Message threads
+-- Replies in a thread point at the root message by seq (same conversation).
+-- Reply count and last reply time are kept in the root message's head under "thread".
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_seq INT;
+
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(conversation_id, thread_seq, seq)
+    WHERE thread_seq IS NOT NULL;
+
+-- Per-user read position within each thread
+CREATE TABLE IF NOT EXISTS thread_reads (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    root_seq INT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    read_seq INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (conversation_id, root_seq, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_reads_user ON thread_reads(user_id);
+
+-- Update schema version
+UPDATE schema_version SET version = 13 WHERE version = 12;
+INSERT INTO schema_version (version) SELECT 13 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 13);
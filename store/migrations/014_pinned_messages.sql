@@ -0,0 +1,26 @@
+-- Migration 014: Multiple ordered pinned messages per conversation
+--
+-- Replaces the single conversations.pinned_message_id with a list of pins.
+-- Position 0 is the top pin; the legacy pinned_* columns are no longer written.
+
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    pinned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    pinned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (conversation_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_position ON pinned_messages(conversation_id, position);
+
+-- Carry over existing single pins
+INSERT INTO pinned_messages (conversation_id, message_id, position, pinned_by, pinned_at)
+SELECT id, pinned_message_id, 0, pinned_by, COALESCE(pinned_at, NOW())
+FROM conversations
+WHERE pinned_message_id IS NOT NULL
+ON CONFLICT (conversation_id, message_id) DO NOTHING;
+
+-- Update schema version
+UPDATE schema_version SET version = 14 WHERE version = 13;
+INSERT INTO schema_version (version) SELECT 14 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 14);
@@ -0,0 +1,32 @@
+-- Migration 015: Polls
+-- Poll question and options live in the encrypted message content; this table
+-- keeps what the server needs to validate and tally votes.
+CREATE TABLE IF NOT EXISTS polls (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    option_count INT NOT NULL,
+    multi BOOLEAN NOT NULL DEFAULT FALSE,
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMPTZ,
+    closed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_polls_conv_seq ON polls(conversation_id, seq);
+CREATE INDEX IF NOT EXISTS idx_polls_closes_at ON polls(closes_at)
+    WHERE closed_at IS NULL AND closes_at IS NOT NULL;
+
+-- One row per selected option; single-choice polls have at most one row per user
+CREATE TABLE IF NOT EXISTS poll_votes (
+    message_id UUID NOT NULL REFERENCES polls(message_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    option_index INT NOT NULL,
+    voted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, option_index)
+);
+
+-- Update schema version
+UPDATE schema_version SET version = 15 WHERE version = 14;
+INSERT INTO schema_version (version) SELECT 15 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 15);
@@ -0,0 +1,24 @@
+-- Migration 016: Scheduled messages
+-- The send request (content, reply, thread, view-once) is stored encrypted and
+-- replayed through the normal send path when due. Dispatchers claim due rows
+-- with FOR UPDATE SKIP LOCKED so each message is sent by exactly one node.
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id UUID PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    send_at TIMESTAMPTZ NOT NULL,
+    payload BYTEA NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending, sending, sent, failed
+    seq INT,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(send_at)
+    WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_user ON scheduled_messages(user_id, send_at);
+
+-- Update schema version
+UPDATE schema_version SET version = 16 WHERE version = 15;
+INSERT INTO schema_version (version) SELECT 16 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 16);
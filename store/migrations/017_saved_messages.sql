@@ -0,0 +1,19 @@
+-- Migration 017: Saved messages
+-- A private per-user collection of bookmarked messages with an optional
+-- encrypted note. Rows are removed when the message is deleted or the user
+-- loses access to it (left, cleared, deleted for them, expired).
+CREATE TABLE IF NOT EXISTS saved_messages (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    note BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_messages_user ON saved_messages(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_saved_messages_message ON saved_messages(message_id);
+
+-- Update schema version
+UPDATE schema_version SET version = 17 WHERE version = 16;
+INSERT INTO schema_version (version) SELECT 17 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 17);
@@ -0,0 +1,17 @@
+-- Migration 018: Blind keyword index for message search
+-- Message content is encrypted, so each message's words are stored as keyed
+-- hashes (HMAC tokens). Searches hash their terms the same way and match on
+-- the tokens; the words themselves never reach the database. View-once
+-- messages are not indexed; tokens are purged on unsend, delete and expiry.
+CREATE TABLE IF NOT EXISTS message_tokens (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    token BYTEA NOT NULL,
+    PRIMARY KEY (message_id, token)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_tokens_token ON message_tokens(token, conversation_id);
+
+-- Update schema version
+UPDATE schema_version SET version = 18 WHERE version = 17;
+INSERT INTO schema_version (version) SELECT 18 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 18);
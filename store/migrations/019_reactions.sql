@@ -0,0 +1,32 @@
+-- Migration 019: Reactions table
+-- Reactions move out of messages.head so reacting no longer locks the message
+-- row and "who reacted" is an indexed query. Existing head reactions
+-- ({"reactions": {"emoji": ["user-id", ...]}}) are copied over and removed.
+CREATE TABLE IF NOT EXISTS reactions (
+    id BIGSERIAL PRIMARY KEY,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (message_id, user_id, emoji)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_message_emoji ON reactions(message_id, emoji, id DESC);
+
+-- Carry over head reactions; entries that aren't known users are dropped
+INSERT INTO reactions (message_id, user_id, emoji, created_at)
+SELECT m.id, u.id, r.key, m.updated_at
+FROM messages m
+CROSS JOIN LATERAL jsonb_each(m.head->'reactions') AS r
+CROSS JOIN LATERAL jsonb_array_elements_text(
+    CASE WHEN jsonb_typeof(r.value) = 'array' THEN r.value ELSE '[]'::jsonb END
+) AS ru(user_id)
+JOIN users u ON u.id::text = ru.user_id
+WHERE jsonb_typeof(m.head->'reactions') = 'object'
+ON CONFLICT (message_id, user_id, emoji) DO NOTHING;
+
+UPDATE messages SET head = head - 'reactions' WHERE head ? 'reactions';
+
+-- Update schema version
+UPDATE schema_version SET version = 19 WHERE version = 18;
+INSERT INTO schema_version (version) SELECT 19 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 19);
@@ -0,0 +1,21 @@
+-- Migration 020: Per-message delivery and read status
+-- members.recv_seq/read_seq only say how far a member has got, not when.
+-- Each time a member's position advances, a receipt row records when it
+-- reached that seq, so the time a given message was delivered or read is
+-- the earliest receipt at or after its seq.
+CREATE TABLE IF NOT EXISTS receipts (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    recv_at TIMESTAMPTZ,
+    read_at TIMESTAMPTZ,
+    PRIMARY KEY (conversation_id, user_id, seq)
+);
+
+-- Read receipt privacy: when set, the user's reads are not broadcast to or
+-- listed for other members
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_read_receipts BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Update schema version
+UPDATE schema_version SET version = 20 WHERE version = 19;
+INSERT INTO schema_version (version) SELECT 20 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 20);
@@ -0,0 +1,13 @@
+-- Migration 021: Notification levels and timed mute
+-- members.notify overrides the user's default level for one conversation:
+-- 'all', 'mentions' or 'none' (NULL = use users.notify_default).
+-- members.muted_until mutes a conversation until a point in time; the mute
+-- lapses on its own once that time has passed.
+ALTER TABLE members ADD COLUMN IF NOT EXISTS notify VARCHAR(16);
+ALTER TABLE members ADD COLUMN IF NOT EXISTS muted_until TIMESTAMPTZ;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_default VARCHAR(16) NOT NULL DEFAULT 'all';
+
+-- Update schema version
+UPDATE schema_version SET version = 21 WHERE version = 20;
+INSERT INTO schema_version (version) SELECT 21 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 21);
@@ -0,0 +1,34 @@
+-- Migration 022: Push notifications
+-- Each device a user signs in from (MsgClientHi.DeviceID) can register one push
+-- token. A token belongs to a single device: registering it again from another
+-- account moves it there, so a shared or resold phone never receives alerts
+-- for its previous owner.
+CREATE TABLE IF NOT EXISTS push_devices (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(64) NOT NULL,
+    platform VARCHAR(16) NOT NULL, -- apns, fcm
+    token TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, device_id),
+    UNIQUE (platform, token)
+);
+
+-- Delivery queue. The payload is the encrypted notification; senders claim due
+-- rows with FOR UPDATE SKIP LOCKED and push next_attempt_at forward as a lease,
+-- so a node that dies mid-delivery leaves the row to be retried.
+CREATE TABLE IF NOT EXISTS push_queue (
+    id BIGSERIAL PRIMARY KEY,
+    device_id BIGINT NOT NULL REFERENCES push_devices(id) ON DELETE CASCADE,
+    payload BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_queue_due ON push_queue(next_attempt_at);
+
+-- Update schema version
+UPDATE schema_version SET version = 22 WHERE version = 21;
+INSERT INTO schema_version (version) SELECT 22 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 22);
@@ -0,0 +1,9 @@
+-- Migration 023: Web Push subscriptions
+-- A browser subscription is stored as a push device whose token is the push
+-- service endpoint, plus the keys its payloads are encrypted for (RFC 8291).
+ALTER TABLE push_devices ADD COLUMN IF NOT EXISTS p256dh TEXT NOT NULL DEFAULT '';
+ALTER TABLE push_devices ADD COLUMN IF NOT EXISTS auth TEXT NOT NULL DEFAULT '';
+
+-- Update schema version
+UPDATE schema_version SET version = 23 WHERE version = 22;
+INSERT INTO schema_version (version) SELECT 23 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 23);
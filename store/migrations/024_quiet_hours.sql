@@ -0,0 +1,10 @@
+-- Migration 024: Quiet hours
+-- A daily window in the user's time zone ({"start":1320,"end":420,"tz":"..."},
+-- minutes after midnight) during which offline notifications are held back.
+-- Contacts on the user's bypass list, and urgent messages, still get through.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS quiet_hours JSONB;
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS bypass_quiet BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Update schema version
+UPDATE schema_version SET version = 24 WHERE version = 23;
+INSERT INTO schema_version (version) SELECT 24 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 24);
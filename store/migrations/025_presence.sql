@@ -0,0 +1,9 @@
+-- Migration 025: Rich presence
+-- The presence a user has chosen ({"state":"dnd","status":"...","statusExpires":"..."}).
+-- Kept in the database so invisible mode and custom statuses survive restarts;
+-- the live view, including client-reported idleness, lives in Redis or memory.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS presence JSONB;
+
+-- Update schema version
+UPDATE schema_version SET version = 25 WHERE version = 24;
+INSERT INTO schema_version (version) SELECT 25 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 25);
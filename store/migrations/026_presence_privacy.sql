@@ -0,0 +1,9 @@
+-- Migration 026: Presence privacy
+-- Who may see a user online and their last seen time
+-- ({"level":"contacts","exceptions":["user-uuid"]}); NULL is everyone.
+-- Enforced both ways: users who hide theirs can't see others'.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS presence_privacy JSONB;
+
+-- Update schema version
+UPDATE schema_version SET version = 26 WHERE version = 25;
+INSERT INTO schema_version (version) SELECT 26 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 26);
@@ -0,0 +1,12 @@
+-- Migration 027: Scheduled message attempts
+-- Dispatchers count their claims so that messages stuck in sending after a
+-- node died, or put back after a temporary error, are retried a bounded
+-- number of times. Stuck rows are found by their updated_at.
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sending ON scheduled_messages(updated_at)
+    WHERE status = 'sending';
+
+-- Update schema version
+UPDATE schema_version SET version = 27 WHERE version = 26;
+INSERT INTO schema_version (version) SELECT 27 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 27);
@@ -0,0 +1,10 @@
+-- Migration 028: Link sent messages to their scheduled message
+-- A scheduled message is sent with its id in head.scheduled. The unique index
+-- stops a reclaimed row from being sent twice, and lets the dispatcher find
+-- the message an earlier attempt sent before its node died.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_scheduled ON messages((head->>'scheduled'))
+    WHERE head->>'scheduled' IS NOT NULL;
+
+-- Update schema version
+UPDATE schema_version SET version = 28 WHERE version = 27;
+INSERT INTO schema_version (version) SELECT 28 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 28);
@@ -0,0 +1,9 @@
+-- Migration 029: Record the conversation of queued notifications
+-- Lets the sender drop a notification whose recipient left, blocked or muted
+-- the conversation while it was queued. Entries queued before this migration
+-- have none and are sent as they are.
+ALTER TABLE push_queue ADD COLUMN IF NOT EXISTS conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE;
+
+-- Update schema version
+UPDATE schema_version SET version = 29 WHERE version = 28;
+INSERT INTO schema_version (version) SELECT 29 WHERE NOT EXISTS (SELECT 1 FROM schema_version WHERE version = 29);
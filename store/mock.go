@@ -12,15 +12,22 @@ import (
 // Each method field can be set to a custom function to control behavior.
 type MockStore struct {
 	// Users
-	CreateUserFn            func(ctx context.Context, public json.RawMessage) (uuid.UUID, error)
-	CreateUserWithOptionsFn func(ctx context.Context, public json.RawMessage, mustChangePassword bool, email *string, emailVerified bool) (uuid.UUID, error)
-	GetUserByIDFn           func(ctx context.Context, id uuid.UUID) (*User, error)
-	GetUserByEmailFn        func(ctx context.Context, email string) (*User, error)
-	UpdateUserLastSeenFn    func(ctx context.Context, userID uuid.UUID, userAgent string) error
-	UpdateUserPublicFn      func(ctx context.Context, userID uuid.UUID, public json.RawMessage) error
-	UpdateUserEmailFn       func(ctx context.Context, userID uuid.UUID, email *string) error
-	UpdateUserLangFn        func(ctx context.Context, userID uuid.UUID, lang *string) error
-	SearchUsersFn           func(ctx context.Context, query string, limit int) ([]User, error)
+	CreateUserFn                func(ctx context.Context, public json.RawMessage) (uuid.UUID, error)
+	CreateUserWithOptionsFn     func(ctx context.Context, public json.RawMessage, mustChangePassword bool, email *string, emailVerified bool) (uuid.UUID, error)
+	GetUserByIDFn               func(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserByEmailFn            func(ctx context.Context, email string) (*User, error)
+	UpdateUserLastSeenFn        func(ctx context.Context, userID uuid.UUID, userAgent string) error
+	UpdateUserPublicFn          func(ctx context.Context, userID uuid.UUID, public json.RawMessage) error
+	UpdateUserEmailFn           func(ctx context.Context, userID uuid.UUID, email *string) error
+	UpdateUserLangFn            func(ctx context.Context, userID uuid.UUID, lang *string) error
+	UpdateUserReadReceiptsFn    func(ctx context.Context, userID uuid.UUID, enabled bool) error
+	UpdateUserNotifyDefaultFn   func(ctx context.Context, userID uuid.UUID, level string) error
+	UpdateUserQuietHoursFn      func(ctx context.Context, userID uuid.UUID, quiet *QuietHours) error
+	UpdateUserPresenceFn        func(ctx context.Context, userID uuid.UUID, presence *Presence) error
+	UpdateUserPresencePrivacyFn func(ctx context.Context, userID uuid.UUID, privacy *PresencePrivacy) error
+	GetPresencePeersFn          func(ctx context.Context, userID uuid.UUID, others []uuid.UUID) (map[uuid.UUID]PresencePeer, error)
+	GetPresenceNodeFn           func(ctx context.Context, userID uuid.UUID) (*PresenceNode, error)
+	SearchUsersFn               func(ctx context.Context, query string, limit int) ([]User, error)
 
 	// Auth
 	CreateAuthRecordFn        func(ctx context.Context, userID uuid.UUID, scheme, secret string, uname *string) error
@@ -53,7 +60,9 @@ type MockStore struct {
 	UpdateRecvSeqFn        func(ctx context.Context, convID, userID uuid.UUID, seq int) error
 	UpdateClearSeqFn       func(ctx context.Context, convID, userID uuid.UUID, seq int) error
 	GetReadReceiptsFn      func(ctx context.Context, convID uuid.UUID) ([]ReadReceipt, error)
-	AddRoomMemberFn        func(ctx context.Context, convID, userID uuid.UUID, role string) error
+	GetMessageStatusFn     func(ctx context.Context, convID uuid.UUID, seq int) ([]MessageStatus, error)
+	GetNotifySettingsFn    func(ctx context.Context, convID, senderID uuid.UUID) ([]NotifySetting, error)
+	AddRoomMemberFn        func(ctx context.Context, convID, userID uuid.UUID, role string, maxMembers int) error
 	RemoveMemberFn         func(ctx context.Context, convID, userID uuid.UUID) error
 	GetMemberRoleFn        func(ctx context.Context, convID, userID uuid.UUID) (string, error)
 
@@ -61,8 +70,12 @@ type MockStore struct {
 	UpdateRoomPublicFn func(ctx context.Context, convID uuid.UUID, public json.RawMessage) error
 
 	// Pinned messages
-	SetPinnedMessageFn    func(ctx context.Context, convID uuid.UUID, messageID *uuid.UUID, pinnedBy uuid.UUID) error
-	GetPinnedMessageSeqFn func(ctx context.Context, convID uuid.UUID) (*int, error)
+	PinMessageFn            func(ctx context.Context, convID, messageID, pinnedBy uuid.UUID, maxPins int) error
+	UnpinMessageFn          func(ctx context.Context, convID, messageID uuid.UUID) (bool, error)
+	UnpinAllMessagesFn      func(ctx context.Context, convID uuid.UUID) error
+	ReorderPinnedMessagesFn func(ctx context.Context, convID uuid.UUID, seqs []int) error
+	GetPinnedMessagesFn     func(ctx context.Context, convID, userID uuid.UUID, clearSeq int) ([]PinnedMessage, error)
+	RemoveExpiredPinsFn     func(ctx context.Context) ([]PinnedMessage, error)
 
 	// Disappearing messages
 	UpdateConversationDisappearingTTLFn func(ctx context.Context, convID uuid.UUID, ttl *int) error
@@ -71,17 +84,76 @@ type MockStore struct {
 	// No-screenshots
 	UpdateConversationNoScreenshotsFn func(ctx context.Context, convID uuid.UUID, noScreenshots bool) error
 
+	// Slow mode
+	UpdateConversationSlowModeFn func(ctx context.Context, convID uuid.UUID, seconds int) error
+
+	// Member limits
+	UpdateConversationMaxMembersFn func(ctx context.Context, convID uuid.UUID, maxMembers int) error
+
 	// Messages
-	CreateMessageFn            func(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*Message, error)
-	GetMessagesFn              func(ctx context.Context, convID, userID uuid.UUID, before, limit int, clearSeq int) ([]Message, error)
-	GetMessageBySeqFn          func(ctx context.Context, convID uuid.UUID, seq int) (*Message, error)
-	EditMessageFn              func(ctx context.Context, convID uuid.UUID, seq int, content []byte) error
-	UnsendMessageFn            func(ctx context.Context, convID uuid.UUID, seq int) error
-	DeleteMessageForEveryoneFn func(ctx context.Context, convID uuid.UUID, seq int) error
-	DeleteMessageForUserFn     func(ctx context.Context, msgID, userID uuid.UUID) error
-	AddReactionFn              func(ctx context.Context, convID uuid.UUID, seq int, userID uuid.UUID, emoji string) error
-	GetEditCountFn                 func(ctx context.Context, convID uuid.UUID, seq int) (int, error)
-	GetMessagesMentioningUserFn    func(ctx context.Context, userID uuid.UUID, limit int) ([]Message, error)
+	CreateMessageFn             func(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*Message, error)
+	GetMessagesFn               func(ctx context.Context, convID, userID uuid.UUID, before, limit int, clearSeq int) ([]Message, error)
+	GetMessageBySeqFn           func(ctx context.Context, convID uuid.UUID, seq int) (*Message, error)
+	GetVisibleMessageBySeqFn    func(ctx context.Context, convID, userID uuid.UUID, seq int, clearSeq int) (*Message, error)
+	EditMessageFn               func(ctx context.Context, convID uuid.UUID, seq int, content []byte, files []string) error
+	UnsendMessageFn             func(ctx context.Context, convID uuid.UUID, seq int) error
+	DeleteMessageForEveryoneFn  func(ctx context.Context, convID uuid.UUID, seq int) error
+	DeleteMessageForUserFn      func(ctx context.Context, msgID, userID uuid.UUID) error
+	GetEditCountFn              func(ctx context.Context, convID uuid.UUID, seq int) (int, error)
+	GetMessagesMentioningUserFn func(ctx context.Context, userID uuid.UUID, limit int) ([]Message, error)
+
+	// Threads
+	CreateThreadReplyFn   func(ctx context.Context, convID, fromUserID uuid.UUID, rootSeq int, content []byte, head json.RawMessage) (*Message, error)
+	GetThreadMessagesFn   func(ctx context.Context, convID, userID uuid.UUID, rootSeq, before, limit int, clearSeq int) ([]Message, error)
+	UpdateThreadReadSeqFn func(ctx context.Context, convID, userID uuid.UUID, rootSeq, seq int) error
+	GetThreadReadSeqFn    func(ctx context.Context, convID, userID uuid.UUID, rootSeq int) (int, error)
+	CountThreadRepliesFn  func(ctx context.Context, convID uuid.UUID, afterSeq int) (int, error)
+	CountThreadUnreadFn   func(ctx context.Context, convID uuid.UUID, rootSeq, afterSeq int) (int, error)
+
+	// Polls
+	CreatePollMessageFn func(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage, poll *Poll) (*Message, error)
+	GetPollFn           func(ctx context.Context, convID uuid.UUID, seq int) (*Poll, error)
+	CastVoteFn          func(ctx context.Context, messageID, userID uuid.UUID, options []int) error
+	GetPollVotesFn      func(ctx context.Context, messageID uuid.UUID) ([]PollVote, error)
+	ClosePollFn         func(ctx context.Context, messageID uuid.UUID) error
+	CloseDuePollsFn     func(ctx context.Context) ([]Poll, error)
+
+	// Scheduled messages
+	CreateScheduledMessageFn    func(ctx context.Context, convID, userID uuid.UUID, sendAt time.Time, payload []byte, maxPending int) (*ScheduledMessage, error)
+	GetScheduledMessageFn       func(ctx context.Context, id uuid.UUID) (*ScheduledMessage, error)
+	GetUserScheduledMessagesFn  func(ctx context.Context, userID uuid.UUID, convID *uuid.UUID) ([]ScheduledMessage, error)
+	UpdateScheduledMessageFn    func(ctx context.Context, id, userID uuid.UUID, sendAt time.Time, payload []byte) (bool, error)
+	CancelScheduledMessageFn    func(ctx context.Context, id, userID uuid.UUID) (bool, error)
+	ClaimDueScheduledMessagesFn func(ctx context.Context, limit int, lease time.Duration) ([]ScheduledMessage, error)
+	GetScheduledMessageSeqFn    func(ctx context.Context, id uuid.UUID) (int, error)
+	MarkScheduledSentFn         func(ctx context.Context, id uuid.UUID, seq int) error
+	RetryScheduledMessageFn     func(ctx context.Context, id uuid.UUID, at time.Time) error
+	MarkScheduledFailedFn       func(ctx context.Context, id uuid.UUID, reason string) error
+
+	// Push notifications
+	RegisterPushDeviceFn   func(ctx context.Context, userID uuid.UUID, dev *PushDevice) error
+	UnregisterPushDeviceFn func(ctx context.Context, userID uuid.UUID, deviceID string) (bool, error)
+	RemovePushDeviceFn     func(ctx context.Context, id int64) error
+	EnqueuePushFn          func(ctx context.Context, convID uuid.UUID, userIDs []uuid.UUID, payload []byte) (int, error)
+	ClaimPushesFn          func(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error)
+	CompletePushFn         func(ctx context.Context, id int64) error
+	RetryPushFn            func(ctx context.Context, id int64, at time.Time) error
+
+	// Saved messages
+	SaveMessageFn                    func(ctx context.Context, userID, messageID uuid.UUID, note []byte, maxSaved int) error
+	UnsaveMessageFn                  func(ctx context.Context, userID, messageID uuid.UUID) (bool, error)
+	GetSavedMessagesFn               func(ctx context.Context, userID uuid.UUID, before int64, limit int) ([]SavedMessage, error)
+	RemoveUnavailableSavedMessagesFn func(ctx context.Context) (int64, error)
+
+	// Message search (blind index)
+	IndexMessageFn             func(ctx context.Context, messageID, convID uuid.UUID, tokens [][]byte) error
+	SearchMessagesFn           func(ctx context.Context, userID uuid.UUID, convID *uuid.UUID, tokens [][]byte, limit int) ([]Message, error)
+	PurgeExpiredMessageIndexFn func(ctx context.Context) (int64, error)
+
+	// Reactions
+	ToggleReactionFn    func(ctx context.Context, messageID, userID uuid.UUID, emoji string, maxEmojis int) (bool, int, error)
+	GetReactionCountsFn func(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID][]ReactionCount, error)
+	GetReactionsFn      func(ctx context.Context, messageID uuid.UUID, emoji string, before int64, limit int) ([]Reaction, error)
 
 	// View-once and message reads
 	CreateMessageWithViewOnceFn func(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage, viewOnce bool, viewOnceTTL *int) (*Message, error)
@@ -121,6 +193,7 @@ type MockStore struct {
 	GetContactsFn           func(ctx context.Context, userID uuid.UUID) ([]Contact, error)
 	IsContactFn             func(ctx context.Context, userID, contactID uuid.UUID) (bool, error)
 	UpdateContactNicknameFn func(ctx context.Context, userID, contactID uuid.UUID, nickname *string) error
+	SetContactBypassQuietFn func(ctx context.Context, userID, contactID uuid.UUID, bypass bool) (bool, error)
 	RemoveContactFn         func(ctx context.Context, userID, contactID uuid.UUID) error
 }
 
@@ -185,6 +258,55 @@ func (m *MockStore) UpdateUserLang(ctx context.Context, userID uuid.UUID, lang *
 	return nil
 }
 
+func (m *MockStore) UpdateUserReadReceipts(ctx context.Context, userID uuid.UUID, enabled bool) error {
+	if m.UpdateUserReadReceiptsFn != nil {
+		return m.UpdateUserReadReceiptsFn(ctx, userID, enabled)
+	}
+	return nil
+}
+
+func (m *MockStore) UpdateUserNotifyDefault(ctx context.Context, userID uuid.UUID, level string) error {
+	if m.UpdateUserNotifyDefaultFn != nil {
+		return m.UpdateUserNotifyDefaultFn(ctx, userID, level)
+	}
+	return nil
+}
+
+func (m *MockStore) UpdateUserQuietHours(ctx context.Context, userID uuid.UUID, quiet *QuietHours) error {
+	if m.UpdateUserQuietHoursFn != nil {
+		return m.UpdateUserQuietHoursFn(ctx, userID, quiet)
+	}
+	return nil
+}
+
+func (m *MockStore) UpdateUserPresence(ctx context.Context, userID uuid.UUID, presence *Presence) error {
+	if m.UpdateUserPresenceFn != nil {
+		return m.UpdateUserPresenceFn(ctx, userID, presence)
+	}
+	return nil
+}
+
+func (m *MockStore) UpdateUserPresencePrivacy(ctx context.Context, userID uuid.UUID, privacy *PresencePrivacy) error {
+	if m.UpdateUserPresencePrivacyFn != nil {
+		return m.UpdateUserPresencePrivacyFn(ctx, userID, privacy)
+	}
+	return nil
+}
+
+func (m *MockStore) GetPresencePeers(ctx context.Context, userID uuid.UUID, others []uuid.UUID) (map[uuid.UUID]PresencePeer, error) {
+	if m.GetPresencePeersFn != nil {
+		return m.GetPresencePeersFn(ctx, userID, others)
+	}
+	return map[uuid.UUID]PresencePeer{}, nil
+}
+
+func (m *MockStore) GetPresenceNode(ctx context.Context, userID uuid.UUID) (*PresenceNode, error) {
+	if m.GetPresenceNodeFn != nil {
+		return m.GetPresenceNodeFn(ctx, userID)
+	}
+	return nil, nil
+}
+
 func (m *MockStore) SearchUsers(ctx context.Context, query string, limit int) ([]User, error) {
 	if m.SearchUsersFn != nil {
 		return m.SearchUsersFn(ctx, query, limit)
@@ -360,9 +482,23 @@ func (m *MockStore) GetReadReceipts(ctx context.Context, convID uuid.UUID) ([]Re
 	return nil, nil
 }
 
-func (m *MockStore) AddRoomMember(ctx context.Context, convID, userID uuid.UUID, role string) error {
+func (m *MockStore) GetMessageStatus(ctx context.Context, convID uuid.UUID, seq int) ([]MessageStatus, error) {
+	if m.GetMessageStatusFn != nil {
+		return m.GetMessageStatusFn(ctx, convID, seq)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) GetNotifySettings(ctx context.Context, convID, senderID uuid.UUID) ([]NotifySetting, error) {
+	if m.GetNotifySettingsFn != nil {
+		return m.GetNotifySettingsFn(ctx, convID, senderID)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) AddRoomMember(ctx context.Context, convID, userID uuid.UUID, role string, maxMembers int) error {
 	if m.AddRoomMemberFn != nil {
-		return m.AddRoomMemberFn(ctx, convID, userID, role)
+		return m.AddRoomMemberFn(ctx, convID, userID, role, maxMembers)
 	}
 	return nil
 }
@@ -388,16 +524,44 @@ func (m *MockStore) UpdateRoomPublic(ctx context.Context, convID uuid.UUID, publ
 	return nil
 }
 
-func (m *MockStore) SetPinnedMessage(ctx context.Context, convID uuid.UUID, messageID *uuid.UUID, pinnedBy uuid.UUID) error {
-	if m.SetPinnedMessageFn != nil {
-		return m.SetPinnedMessageFn(ctx, convID, messageID, pinnedBy)
+func (m *MockStore) PinMessage(ctx context.Context, convID, messageID, pinnedBy uuid.UUID, maxPins int) error {
+	if m.PinMessageFn != nil {
+		return m.PinMessageFn(ctx, convID, messageID, pinnedBy, maxPins)
+	}
+	return nil
+}
+
+func (m *MockStore) UnpinMessage(ctx context.Context, convID, messageID uuid.UUID) (bool, error) {
+	if m.UnpinMessageFn != nil {
+		return m.UnpinMessageFn(ctx, convID, messageID)
+	}
+	return true, nil
+}
+
+func (m *MockStore) UnpinAllMessages(ctx context.Context, convID uuid.UUID) error {
+	if m.UnpinAllMessagesFn != nil {
+		return m.UnpinAllMessagesFn(ctx, convID)
+	}
+	return nil
+}
+
+func (m *MockStore) ReorderPinnedMessages(ctx context.Context, convID uuid.UUID, seqs []int) error {
+	if m.ReorderPinnedMessagesFn != nil {
+		return m.ReorderPinnedMessagesFn(ctx, convID, seqs)
 	}
 	return nil
 }
 
-func (m *MockStore) GetPinnedMessageSeq(ctx context.Context, convID uuid.UUID) (*int, error) {
-	if m.GetPinnedMessageSeqFn != nil {
-		return m.GetPinnedMessageSeqFn(ctx, convID)
+func (m *MockStore) GetPinnedMessages(ctx context.Context, convID, userID uuid.UUID, clearSeq int) ([]PinnedMessage, error) {
+	if m.GetPinnedMessagesFn != nil {
+		return m.GetPinnedMessagesFn(ctx, convID, userID, clearSeq)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) RemoveExpiredPins(ctx context.Context) ([]PinnedMessage, error) {
+	if m.RemoveExpiredPinsFn != nil {
+		return m.RemoveExpiredPinsFn(ctx)
 	}
 	return nil, nil
 }
@@ -423,6 +587,20 @@ func (m *MockStore) UpdateConversationNoScreenshots(ctx context.Context, convID
 	return nil
 }
 
+func (m *MockStore) UpdateConversationSlowMode(ctx context.Context, convID uuid.UUID, seconds int) error {
+	if m.UpdateConversationSlowModeFn != nil {
+		return m.UpdateConversationSlowModeFn(ctx, convID, seconds)
+	}
+	return nil
+}
+
+func (m *MockStore) UpdateConversationMaxMembers(ctx context.Context, convID uuid.UUID, maxMembers int) error {
+	if m.UpdateConversationMaxMembersFn != nil {
+		return m.UpdateConversationMaxMembersFn(ctx, convID, maxMembers)
+	}
+	return nil
+}
+
 func (m *MockStore) CreateMessage(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage) (*Message, error) {
 	if m.CreateMessageFn != nil {
 		return m.CreateMessageFn(ctx, convID, fromUserID, content, head)
@@ -444,9 +622,16 @@ func (m *MockStore) GetMessageBySeq(ctx context.Context, convID uuid.UUID, seq i
 	return nil, nil
 }
 
-func (m *MockStore) EditMessage(ctx context.Context, convID uuid.UUID, seq int, content []byte) error {
+func (m *MockStore) GetVisibleMessageBySeq(ctx context.Context, convID, userID uuid.UUID, seq int, clearSeq int) (*Message, error) {
+	if m.GetVisibleMessageBySeqFn != nil {
+		return m.GetVisibleMessageBySeqFn(ctx, convID, userID, seq, clearSeq)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) EditMessage(ctx context.Context, convID uuid.UUID, seq int, content []byte, files []string) error {
 	if m.EditMessageFn != nil {
-		return m.EditMessageFn(ctx, convID, seq, content)
+		return m.EditMessageFn(ctx, convID, seq, content, files)
 	}
 	return nil
 }
@@ -472,13 +657,6 @@ func (m *MockStore) DeleteMessageForUser(ctx context.Context, msgID, userID uuid
 	return nil
 }
 
-func (m *MockStore) AddReaction(ctx context.Context, convID uuid.UUID, seq int, userID uuid.UUID, emoji string) error {
-	if m.AddReactionFn != nil {
-		return m.AddReactionFn(ctx, convID, seq, userID, emoji)
-	}
-	return nil
-}
-
 func (m *MockStore) GetEditCount(ctx context.Context, convID uuid.UUID, seq int) (int, error) {
 	if m.GetEditCountFn != nil {
 		return m.GetEditCountFn(ctx, convID, seq)
@@ -493,6 +671,279 @@ func (m *MockStore) GetMessagesMentioningUser(ctx context.Context, userID uuid.U
 	return nil, nil
 }
 
+func (m *MockStore) CreateThreadReply(ctx context.Context, convID, fromUserID uuid.UUID, rootSeq int, content []byte, head json.RawMessage) (*Message, error) {
+	if m.CreateThreadReplyFn != nil {
+		return m.CreateThreadReplyFn(ctx, convID, fromUserID, rootSeq, content, head)
+	}
+	return &Message{ID: uuid.New(), ConversationID: convID, FromUserID: fromUserID, Seq: rootSeq + 1, ThreadSeq: &rootSeq}, nil
+}
+
+func (m *MockStore) GetThreadMessages(ctx context.Context, convID, userID uuid.UUID, rootSeq, before, limit int, clearSeq int) ([]Message, error) {
+	if m.GetThreadMessagesFn != nil {
+		return m.GetThreadMessagesFn(ctx, convID, userID, rootSeq, before, limit, clearSeq)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) UpdateThreadReadSeq(ctx context.Context, convID, userID uuid.UUID, rootSeq, seq int) error {
+	if m.UpdateThreadReadSeqFn != nil {
+		return m.UpdateThreadReadSeqFn(ctx, convID, userID, rootSeq, seq)
+	}
+	return nil
+}
+
+func (m *MockStore) GetThreadReadSeq(ctx context.Context, convID, userID uuid.UUID, rootSeq int) (int, error) {
+	if m.GetThreadReadSeqFn != nil {
+		return m.GetThreadReadSeqFn(ctx, convID, userID, rootSeq)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) CountThreadReplies(ctx context.Context, convID uuid.UUID, afterSeq int) (int, error) {
+	if m.CountThreadRepliesFn != nil {
+		return m.CountThreadRepliesFn(ctx, convID, afterSeq)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) CountThreadUnread(ctx context.Context, convID uuid.UUID, rootSeq, afterSeq int) (int, error) {
+	if m.CountThreadUnreadFn != nil {
+		return m.CountThreadUnreadFn(ctx, convID, rootSeq, afterSeq)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) CreatePollMessage(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage, poll *Poll) (*Message, error) {
+	if m.CreatePollMessageFn != nil {
+		return m.CreatePollMessageFn(ctx, convID, fromUserID, content, head, poll)
+	}
+	return &Message{ID: uuid.New(), ConversationID: convID, FromUserID: fromUserID, Seq: 1}, nil
+}
+
+func (m *MockStore) GetPoll(ctx context.Context, convID uuid.UUID, seq int) (*Poll, error) {
+	if m.GetPollFn != nil {
+		return m.GetPollFn(ctx, convID, seq)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) CastVote(ctx context.Context, messageID, userID uuid.UUID, options []int) error {
+	if m.CastVoteFn != nil {
+		return m.CastVoteFn(ctx, messageID, userID, options)
+	}
+	return nil
+}
+
+func (m *MockStore) GetPollVotes(ctx context.Context, messageID uuid.UUID) ([]PollVote, error) {
+	if m.GetPollVotesFn != nil {
+		return m.GetPollVotesFn(ctx, messageID)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) ClosePoll(ctx context.Context, messageID uuid.UUID) error {
+	if m.ClosePollFn != nil {
+		return m.ClosePollFn(ctx, messageID)
+	}
+	return nil
+}
+
+func (m *MockStore) CloseDuePolls(ctx context.Context) ([]Poll, error) {
+	if m.CloseDuePollsFn != nil {
+		return m.CloseDuePollsFn(ctx)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) CreateScheduledMessage(ctx context.Context, convID, userID uuid.UUID, sendAt time.Time, payload []byte, maxPending int) (*ScheduledMessage, error) {
+	if m.CreateScheduledMessageFn != nil {
+		return m.CreateScheduledMessageFn(ctx, convID, userID, sendAt, payload, maxPending)
+	}
+	return &ScheduledMessage{ID: uuid.New(), ConversationID: convID, UserID: userID, SendAt: sendAt, Payload: payload, Status: ScheduledPending}, nil
+}
+
+func (m *MockStore) GetScheduledMessage(ctx context.Context, id uuid.UUID) (*ScheduledMessage, error) {
+	if m.GetScheduledMessageFn != nil {
+		return m.GetScheduledMessageFn(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) GetUserScheduledMessages(ctx context.Context, userID uuid.UUID, convID *uuid.UUID) ([]ScheduledMessage, error) {
+	if m.GetUserScheduledMessagesFn != nil {
+		return m.GetUserScheduledMessagesFn(ctx, userID, convID)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) UpdateScheduledMessage(ctx context.Context, id, userID uuid.UUID, sendAt time.Time, payload []byte) (bool, error) {
+	if m.UpdateScheduledMessageFn != nil {
+		return m.UpdateScheduledMessageFn(ctx, id, userID, sendAt, payload)
+	}
+	return true, nil
+}
+
+func (m *MockStore) CancelScheduledMessage(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	if m.CancelScheduledMessageFn != nil {
+		return m.CancelScheduledMessageFn(ctx, id, userID)
+	}
+	return true, nil
+}
+
+func (m *MockStore) ClaimDueScheduledMessages(ctx context.Context, limit int, lease time.Duration) ([]ScheduledMessage, error) {
+	if m.ClaimDueScheduledMessagesFn != nil {
+		return m.ClaimDueScheduledMessagesFn(ctx, limit, lease)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) GetScheduledMessageSeq(ctx context.Context, id uuid.UUID) (int, error) {
+	if m.GetScheduledMessageSeqFn != nil {
+		return m.GetScheduledMessageSeqFn(ctx, id)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) MarkScheduledSent(ctx context.Context, id uuid.UUID, seq int) error {
+	if m.MarkScheduledSentFn != nil {
+		return m.MarkScheduledSentFn(ctx, id, seq)
+	}
+	return nil
+}
+
+func (m *MockStore) RetryScheduledMessage(ctx context.Context, id uuid.UUID, at time.Time) error {
+	if m.RetryScheduledMessageFn != nil {
+		return m.RetryScheduledMessageFn(ctx, id, at)
+	}
+	return nil
+}
+
+func (m *MockStore) MarkScheduledFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	if m.MarkScheduledFailedFn != nil {
+		return m.MarkScheduledFailedFn(ctx, id, reason)
+	}
+	return nil
+}
+
+func (m *MockStore) RegisterPushDevice(ctx context.Context, userID uuid.UUID, dev *PushDevice) error {
+	if m.RegisterPushDeviceFn != nil {
+		return m.RegisterPushDeviceFn(ctx, userID, dev)
+	}
+	return nil
+}
+
+func (m *MockStore) UnregisterPushDevice(ctx context.Context, userID uuid.UUID, deviceID string) (bool, error) {
+	if m.UnregisterPushDeviceFn != nil {
+		return m.UnregisterPushDeviceFn(ctx, userID, deviceID)
+	}
+	return false, nil
+}
+
+func (m *MockStore) RemovePushDevice(ctx context.Context, id int64) error {
+	if m.RemovePushDeviceFn != nil {
+		return m.RemovePushDeviceFn(ctx, id)
+	}
+	return nil
+}
+
+func (m *MockStore) EnqueuePush(ctx context.Context, convID uuid.UUID, userIDs []uuid.UUID, payload []byte) (int, error) {
+	if m.EnqueuePushFn != nil {
+		return m.EnqueuePushFn(ctx, convID, userIDs, payload)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) ClaimPushes(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error) {
+	if m.ClaimPushesFn != nil {
+		return m.ClaimPushesFn(ctx, limit, lease)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) CompletePush(ctx context.Context, id int64) error {
+	if m.CompletePushFn != nil {
+		return m.CompletePushFn(ctx, id)
+	}
+	return nil
+}
+
+func (m *MockStore) RetryPush(ctx context.Context, id int64, at time.Time) error {
+	if m.RetryPushFn != nil {
+		return m.RetryPushFn(ctx, id, at)
+	}
+	return nil
+}
+
+func (m *MockStore) SaveMessage(ctx context.Context, userID, messageID uuid.UUID, note []byte, maxSaved int) error {
+	if m.SaveMessageFn != nil {
+		return m.SaveMessageFn(ctx, userID, messageID, note, maxSaved)
+	}
+	return nil
+}
+
+func (m *MockStore) UnsaveMessage(ctx context.Context, userID, messageID uuid.UUID) (bool, error) {
+	if m.UnsaveMessageFn != nil {
+		return m.UnsaveMessageFn(ctx, userID, messageID)
+	}
+	return true, nil
+}
+
+func (m *MockStore) GetSavedMessages(ctx context.Context, userID uuid.UUID, before int64, limit int) ([]SavedMessage, error) {
+	if m.GetSavedMessagesFn != nil {
+		return m.GetSavedMessagesFn(ctx, userID, before, limit)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) RemoveUnavailableSavedMessages(ctx context.Context) (int64, error) {
+	if m.RemoveUnavailableSavedMessagesFn != nil {
+		return m.RemoveUnavailableSavedMessagesFn(ctx)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) IndexMessage(ctx context.Context, messageID, convID uuid.UUID, tokens [][]byte) error {
+	if m.IndexMessageFn != nil {
+		return m.IndexMessageFn(ctx, messageID, convID, tokens)
+	}
+	return nil
+}
+
+func (m *MockStore) SearchMessages(ctx context.Context, userID uuid.UUID, convID *uuid.UUID, tokens [][]byte, limit int) ([]Message, error) {
+	if m.SearchMessagesFn != nil {
+		return m.SearchMessagesFn(ctx, userID, convID, tokens, limit)
+	}
+	return nil, nil
+}
+
+func (m *MockStore) PurgeExpiredMessageIndex(ctx context.Context) (int64, error) {
+	if m.PurgeExpiredMessageIndexFn != nil {
+		return m.PurgeExpiredMessageIndexFn(ctx)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) ToggleReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string, maxEmojis int) (bool, int, error) {
+	if m.ToggleReactionFn != nil {
+		return m.ToggleReactionFn(ctx, messageID, userID, emoji, maxEmojis)
+	}
+	return true, 1, nil
+}
+
+func (m *MockStore) GetReactionCounts(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID][]ReactionCount, error) {
+	if m.GetReactionCountsFn != nil {
+		return m.GetReactionCountsFn(ctx, messageIDs, userID)
+	}
+	return map[uuid.UUID][]ReactionCount{}, nil
+}
+
+func (m *MockStore) GetReactions(ctx context.Context, messageID uuid.UUID, emoji string, before int64, limit int) ([]Reaction, error) {
+	if m.GetReactionsFn != nil {
+		return m.GetReactionsFn(ctx, messageID, emoji, before, limit)
+	}
+	return nil, nil
+}
+
 func (m *MockStore) CreateMessageWithViewOnce(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage, viewOnce bool, viewOnceTTL *int) (*Message, error) {
 	if m.CreateMessageWithViewOnceFn != nil {
 		return m.CreateMessageWithViewOnceFn(ctx, convID, fromUserID, content, head, viewOnce, viewOnceTTL)
@@ -710,6 +1161,13 @@ func (m *MockStore) UpdateContactNickname(ctx context.Context, userID, contactID
 	return nil
 }
 
+func (m *MockStore) SetContactBypassQuiet(ctx context.Context, userID, contactID uuid.UUID, bypass bool) (bool, error) {
+	if m.SetContactBypassQuietFn != nil {
+		return m.SetContactBypassQuietFn(ctx, userID, contactID, bypass)
+	}
+	return false, nil
+}
+
 func (m *MockStore) RemoveContact(ctx context.Context, userID, contactID uuid.UUID) error {
 	if m.RemoveContactFn != nil {
 		return m.RemoveContactFn(ctx, userID, contactID)
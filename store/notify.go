@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotifySetting is a member's notification settings for a conversation.
+type NotifySetting struct {
+	UserID uuid.UUID
+	// The conversation's level, or the user's default if it has none
+	Level      string
+	Muted      bool
+	MutedUntil *time.Time
+	// For DMs: the member has blocked the other user
+	Blocked    bool
+	QuietHours *QuietHours
+	// The sender is on the member's quiet hours bypass list
+	BypassQuiet bool
+}
+
+// GetNotifySettings returns the notification settings of every current
+// member of a conversation for a message from senderID.
+func (db *DB) GetNotifySettings(ctx context.Context, convID, senderID uuid.UUID) ([]NotifySetting, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT m.user_id, COALESCE(m.notify, u.notify_default), m.muted, m.muted_until, m.blocked,
+		       u.quiet_hours, COALESCE(c.bypass_quiet, FALSE)
+		FROM members m
+		JOIN users u ON u.id = m.user_id
+		LEFT JOIN contacts c ON c.user_id = m.user_id AND c.contact_id = $2
+		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL AND u.state != 'deleted'
+	`, convID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settings []NotifySetting
+	for rows.Next() {
+		var ns NotifySetting
+		if err := rows.Scan(&ns.UserID, &ns.Level, &ns.Muted, &ns.MutedUntil, &ns.Blocked,
+			&ns.QuietHours, &ns.BypassQuiet); err != nil {
+			return nil, err
+		}
+		settings = append(settings, ns)
+	}
+	return settings, rows.Err()
+}
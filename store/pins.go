@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrAlreadyPinned is returned when pinning a message that is already pinned.
+	ErrAlreadyPinned = errors.New("message already pinned")
+	// ErrPinLimitReached is returned when a conversation already has the maximum number of pins.
+	ErrPinLimitReached = errors.New("pin limit reached")
+	// ErrInvalidPinOrder is returned when a reorder request doesn't list exactly the pinned messages.
+	ErrInvalidPinOrder = errors.New("invalid pin order")
+)
+
+// PinnedMessage is a message pinned in a conversation.
+// Position 0 is the top pin.
+type PinnedMessage struct {
+	Message
+	Position int        `json:"position"`
+	PinnedBy *uuid.UUID `json:"pinnedBy,omitempty"`
+	PinnedAt time.Time  `json:"pinnedAt"`
+}
+
+// PinMessage pins a message at the top of a conversation's pin list.
+// maxPins of 0 means unlimited.
+func (db *DB) PinMessage(ctx context.Context, convID, messageID, pinnedBy uuid.UUID, maxPins int) error {
+	now := time.Now().UTC()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the conversation so concurrent pins see a consistent count
+	_, err = tx.Exec(ctx, `SELECT 1 FROM conversations WHERE id = $1 FOR UPDATE`, convID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	var pinned bool
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(BOOL_OR(message_id = $2), FALSE)
+		FROM pinned_messages WHERE conversation_id = $1
+	`, convID, messageID).Scan(&count, &pinned)
+	if err != nil {
+		return err
+	}
+	if pinned {
+		return ErrAlreadyPinned
+	}
+	if maxPins > 0 && count >= maxPins {
+		return ErrPinLimitReached
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE pinned_messages SET position = position + 1 WHERE conversation_id = $1
+	`, convID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO pinned_messages (conversation_id, message_id, position, pinned_by, pinned_at)
+		VALUES ($1, $2, 0, $3, $4)
+	`, convID, messageID, pinnedBy, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UnpinMessage removes a message from a conversation's pin list.
+// Returns false if the message wasn't pinned.
+func (db *DB) UnpinMessage(ctx context.Context, convID, messageID uuid.UUID) (bool, error) {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM pinned_messages WHERE conversation_id = $1 AND message_id = $2
+	`, convID, messageID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// UnpinAllMessages clears a conversation's pin list.
+func (db *DB) UnpinAllMessages(ctx context.Context, convID uuid.UUID) error {
+	_, err := db.pool.Exec(ctx, `
+		DELETE FROM pinned_messages WHERE conversation_id = $1
+	`, convID)
+	return err
+}
+
+// ReorderPinnedMessages sets the pin order. seqs must list every pinned message
+// exactly once, top pin first.
+func (db *DB) ReorderPinnedMessages(ctx context.Context, convID uuid.UUID, seqs []int) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT pm.message_id, m.seq FROM pinned_messages pm
+		JOIN messages m ON m.id = pm.message_id
+		WHERE pm.conversation_id = $1
+		FOR UPDATE OF pm
+	`, convID)
+	if err != nil {
+		return err
+	}
+	bySeq := make(map[int]uuid.UUID)
+	for rows.Next() {
+		var id uuid.UUID
+		var seq int
+		if err := rows.Scan(&id, &seq); err != nil {
+			rows.Close()
+			return err
+		}
+		bySeq[seq] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(seqs) != len(bySeq) {
+		return ErrInvalidPinOrder
+	}
+	seen := make(map[int]bool, len(seqs))
+	for _, seq := range seqs {
+		if _, ok := bySeq[seq]; !ok || seen[seq] {
+			return ErrInvalidPinOrder
+		}
+		seen[seq] = true
+	}
+
+	for pos, seq := range seqs {
+		_, err = tx.Exec(ctx, `
+			UPDATE pinned_messages SET position = $3 WHERE conversation_id = $1 AND message_id = $2
+		`, convID, bySeq[seq], pos)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPinnedMessages returns a conversation's pinned messages in pin order,
+// leaving out those the user can't see: cleared from their history, deleted
+// for them, or expired after they read them.
+func (db *DB) GetPinnedMessages(ctx context.Context, convID, userID uuid.UUID, clearSeq int) ([]PinnedMessage, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head,
+			m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq,
+			pm.position, pm.pinned_by, pm.pinned_at
+		FROM pinned_messages pm
+		JOIN messages m ON m.id = pm.message_id
+		LEFT JOIN message_deletions md ON md.message_id = m.id AND md.user_id = $2
+		LEFT JOIN message_reads mr ON mr.message_id = m.id AND mr.user_id = $2
+		WHERE pm.conversation_id = $1
+		AND m.deleted_at IS NULL
+		AND m.seq > $3
+		AND md.message_id IS NULL
+		AND (mr.message_id IS NULL OR NOT `+readExpired+`)
+		ORDER BY pm.position, pm.pinned_at DESC
+	`, convID, userID, clearSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []PinnedMessage
+	for rows.Next() {
+		var p PinnedMessage
+		if err := rows.Scan(&p.ID, &p.ConversationID, &p.Seq, &p.FromUserID,
+			&p.CreatedAt, &p.UpdatedAt, &p.Content, &p.Head,
+			&p.DeletedAt, &p.ViewOnce, &p.ViewOnceTTL, &p.ThreadSeq,
+			&p.Position, &p.PinnedBy, &p.PinnedAt); err != nil {
+			return nil, err
+		}
+		pins = append(pins, p)
+	}
+	return pins, rows.Err()
+}
+
+// RemoveExpiredPins unpins messages that have expired for every member other
+// than the sender. Returns the removed pins (conversation, message id and seq only).
+func (db *DB) RemoveExpiredPins(ctx context.Context) ([]PinnedMessage, error) {
+	rows, err := db.pool.Query(ctx, `
+		DELETE FROM pinned_messages pm
+		USING messages m
+		WHERE m.id = pm.message_id
+		AND EXISTS (
+			SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND `+readExpired+`
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM members mb
+			LEFT JOIN message_reads mr ON mr.message_id = m.id AND mr.user_id = mb.user_id
+			WHERE mb.conversation_id = m.conversation_id
+			AND mb.deleted_at IS NULL
+			AND mb.user_id != m.from_user_id
+			AND (mr.message_id IS NULL OR NOT `+readExpired+`)
+		)
+		RETURNING pm.conversation_id, pm.message_id, m.seq
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []PinnedMessage
+	for rows.Next() {
+		var p PinnedMessage
+		if err := rows.Scan(&p.ConversationID, &p.ID, &p.Seq); err != nil {
+			return nil, err
+		}
+		pins = append(pins, p)
+	}
+	return pins, rows.Err()
+}
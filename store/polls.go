@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrPollNotFound is returned when voting on a poll that doesn't exist.
+	ErrPollNotFound = errors.New("poll not found")
+	// ErrPollClosed is returned when voting on or closing a poll that is already closed.
+	ErrPollClosed = errors.New("poll closed")
+)
+
+// Poll holds the server-side state of a poll message.
+// The question and option text live in the message content.
+type Poll struct {
+	MessageID      uuid.UUID  `json:"messageId"`
+	ConversationID uuid.UUID  `json:"conversationId"`
+	Seq            int        `json:"seq"`
+	CreatedBy      *uuid.UUID `json:"createdBy,omitempty"`
+	Options        int        `json:"options"`
+	Multi          bool       `json:"multi,omitempty"`
+	Anonymous      bool       `json:"anonymous,omitempty"`
+	ClosesAt       *time.Time `json:"closesAt,omitempty"`
+	ClosedAt       *time.Time `json:"closedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// IsClosed reports whether voting has ended, either explicitly or by deadline.
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !p.ClosesAt.After(now))
+}
+
+// PollVote is one selected option by one user.
+type PollVote struct {
+	UserID  uuid.UUID `json:"userId"`
+	Option  int       `json:"option"`
+	VotedAt time.Time `json:"votedAt"`
+}
+
+// CreatePollMessage creates a message and its poll in the same transaction.
+// poll.Options, Multi, Anonymous and ClosesAt are used; the rest is filled in.
+func (db *DB) CreatePollMessage(ctx context.Context, convID, fromUserID uuid.UUID, content []byte, head json.RawMessage, poll *Poll) (*Message, error) {
+	now := time.Now().UTC()
+	msgID := uuid.New()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Get next sequence number and update conversation
+	var seq int
+	err = tx.QueryRow(ctx, `
+		UPDATE conversations
+		SET last_seq = last_seq + 1, last_msg_at = $2, updated_at = $2
+		WHERE id = $1
+		RETURNING last_seq
+	`, convID, now).Scan(&seq)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO messages (id, conversation_id, seq, from_user_id, created_at, updated_at, content, head)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, msgID, convID, seq, fromUserID, now, now, content, head)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO polls (message_id, conversation_id, seq, created_by, option_count, multi, anonymous, closes_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, msgID, convID, seq, fromUserID, poll.Options, poll.Multi, poll.Anonymous, poll.ClosesAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	poll.MessageID = msgID
+	poll.ConversationID = convID
+	poll.Seq = seq
+	poll.CreatedBy = &fromUserID
+	poll.CreatedAt = now
+
+	return &Message{
+		ID:             msgID,
+		ConversationID: convID,
+		Seq:            seq,
+		FromUserID:     fromUserID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Content:        content,
+		Head:           head,
+	}, nil
+}
+
+const pollColumns = `p.message_id, p.conversation_id, p.seq, p.created_by, p.option_count, p.multi, p.anonymous, p.closes_at, p.closed_at, p.created_at`
+
+func scanPoll(row pgx.Row) (*Poll, error) {
+	var p Poll
+	err := row.Scan(&p.MessageID, &p.ConversationID, &p.Seq, &p.CreatedBy, &p.Options,
+		&p.Multi, &p.Anonymous, &p.ClosesAt, &p.ClosedAt, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPoll returns the poll attached to a message, or nil if there is none
+// or the message was deleted.
+func (db *DB) GetPoll(ctx context.Context, convID uuid.UUID, seq int) (*Poll, error) {
+	p, err := scanPoll(db.pool.QueryRow(ctx, `
+		SELECT `+pollColumns+`
+		FROM polls p
+		JOIN messages m ON m.id = p.message_id
+		WHERE p.conversation_id = $1 AND p.seq = $2 AND m.deleted_at IS NULL
+	`, convID, seq))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+// CastVote replaces a user's votes in a poll with the given options.
+// An empty list retracts the user's vote. Option indexes must already be
+// validated against the poll.
+func (db *DB) CastVote(ctx context.Context, messageID, userID uuid.UUID, options []int) error {
+	now := time.Now().UTC()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the poll so closing and voting don't interleave
+	p, err := scanPoll(tx.QueryRow(ctx, `
+		SELECT `+pollColumns+` FROM polls p WHERE p.message_id = $1 FOR UPDATE
+	`, messageID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPollNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if p.IsClosed(now) {
+		return ErrPollClosed
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM poll_votes WHERE message_id = $1 AND user_id = $2
+	`, messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, option := range options {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO poll_votes (message_id, user_id, option_index, voted_at)
+			VALUES ($1, $2, $3, $4)
+		`, messageID, userID, option, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPollVotes returns all votes in a poll, oldest first.
+func (db *DB) GetPollVotes(ctx context.Context, messageID uuid.UUID) ([]PollVote, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT user_id, option_index, voted_at FROM poll_votes
+		WHERE message_id = $1
+		ORDER BY voted_at, option_index
+	`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []PollVote
+	for rows.Next() {
+		var v PollVote
+		if err := rows.Scan(&v.UserID, &v.Option, &v.VotedAt); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+// ClosePoll ends voting on a poll. Returns ErrPollClosed if it was already closed.
+func (db *DB) ClosePoll(ctx context.Context, messageID uuid.UUID) error {
+	result, err := db.pool.Exec(ctx, `
+		UPDATE polls SET closed_at = $2
+		WHERE message_id = $1 AND closed_at IS NULL AND (closes_at IS NULL OR closes_at > $2)
+	`, messageID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPollClosed
+	}
+	return nil
+}
+
+// CloseDuePolls closes polls whose deadline has passed and returns them.
+func (db *DB) CloseDuePolls(ctx context.Context) ([]Poll, error) {
+	rows, err := db.pool.Query(ctx, `
+		UPDATE polls p SET closed_at = p.closes_at
+		WHERE p.closed_at IS NULL AND p.closes_at <= NOW()
+		RETURNING `+pollColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []Poll
+	for rows.Next() {
+		p, err := scanPoll(rows)
+		if err != nil {
+			return nil, err
+		}
+		polls = append(polls, *p)
+	}
+	return polls, rows.Err()
+}
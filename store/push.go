@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PushDevice is a device's push registration.
+type PushDevice struct {
+	// From MsgClientHi.DeviceID
+	DeviceID string
+	Platform string
+	// Provider device token, or the endpoint of a Web Push subscription
+	Token string
+	// Web Push subscription keys (base64url)
+	P256DH string
+	Auth   string
+}
+
+// PushDelivery is a claimed push queue entry with its device's token.
+// Payload is the encrypted notification; the store doesn't interpret it.
+type PushDelivery struct {
+	ID       int64
+	DeviceID int64
+	Platform string
+	Token    string
+	P256DH   string
+	Auth     string
+	Payload  []byte
+	// Including the current one
+	Attempts int
+}
+
+// RegisterPushDevice sets the push token for one of a user's devices. The
+// token is removed from any other device it was registered to first.
+func (db *DB) RegisterPushDevice(ctx context.Context, userID uuid.UUID, dev *PushDevice) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM push_devices
+		WHERE platform = $1 AND token = $2 AND NOT (user_id = $3 AND device_id = $4)
+	`, dev.Platform, dev.Token, userID, dev.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO push_devices (user_id, device_id, platform, token, p256dh, auth)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, device_id) DO UPDATE
+		SET platform = EXCLUDED.platform, token = EXCLUDED.token,
+		    p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth, updated_at = NOW()
+	`, userID, dev.DeviceID, dev.Platform, dev.Token, dev.P256DH, dev.Auth)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UnregisterPushDevice removes the push token for one of a user's devices.
+// Returns false if the device had none.
+func (db *DB) UnregisterPushDevice(ctx context.Context, userID uuid.UUID, deviceID string) (bool, error) {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM push_devices WHERE user_id = $1 AND device_id = $2
+	`, userID, deviceID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// RemovePushDevice removes a device whose token the provider has rejected.
+// Its queued notifications go with it.
+func (db *DB) RemovePushDevice(ctx context.Context, id int64) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM push_devices WHERE id = $1`, id)
+	return err
+}
+
+// EnqueuePush queues a notification about a conversation for every
+// registered device of the given users. Returns the number of entries queued.
+func (db *DB) EnqueuePush(ctx context.Context, convID uuid.UUID, userIDs []uuid.UUID, payload []byte) (int, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	result, err := db.pool.Exec(ctx, `
+		INSERT INTO push_queue (device_id, conversation_id, payload)
+		SELECT id, $2, $3 FROM push_devices WHERE user_id = ANY($1)
+	`, userIDs, convID, payload)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// ClaimPushes counts an attempt against up to limit due entries and hides
+// them from other senders for lease. Rows locked by another node are skipped,
+// and an entry whose sender dies is retried once the lease runs out.
+//
+// Due entries whose recipient has since left, blocked or muted the
+// conversation, or turned its notifications off, are dropped first.
+func (db *DB) ClaimPushes(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error) {
+	_, err := db.pool.Exec(ctx, `
+		DELETE FROM push_queue q
+		USING push_devices d
+		WHERE d.id = q.device_id AND q.next_attempt_at <= NOW() AND q.conversation_id IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM members m
+			JOIN users u ON u.id = m.user_id
+			WHERE m.conversation_id = q.conversation_id AND m.user_id = d.user_id
+			  AND m.deleted_at IS NULL AND u.state != 'deleted'
+			  AND NOT m.blocked AND NOT m.muted
+			  AND (m.muted_until IS NULL OR m.muted_until <= NOW())
+			  AND COALESCE(m.notify, u.notify_default) != 'none'
+		  )
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.pool.Query(ctx, `
+		UPDATE push_queue q
+		SET attempts = q.attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		FROM push_devices d
+		WHERE d.id = q.device_id AND q.id IN (
+			SELECT id FROM push_queue
+			WHERE next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING q.id, q.device_id, d.platform, d.token, d.p256dh, d.auth, q.payload, q.attempts
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []PushDelivery
+	for rows.Next() {
+		var p PushDelivery
+		if err := rows.Scan(&p.ID, &p.DeviceID, &p.Platform, &p.Token, &p.P256DH, &p.Auth, &p.Payload, &p.Attempts); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, p)
+	}
+	return deliveries, rows.Err()
+}
+
+// CompletePush removes a delivered or abandoned queue entry.
+func (db *DB) CompletePush(ctx context.Context, id int64) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM push_queue WHERE id = $1`, id)
+	return err
+}
+
+// RetryPush schedules another attempt for a queue entry.
+func (db *DB) RetryPush(ctx context.Context, id int64, at time.Time) error {
+	_, err := db.pool.Exec(ctx, `UPDATE push_queue SET next_attempt_at = $2 WHERE id = $1`, id, at)
+	return err
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestClaimPushes_DropsIneligible(t *testing.T) {
+	yes, none := true, "none"
+	tests := []struct {
+		name   string
+		change func(f *expiryFixture) error
+		want   int
+	}{
+		{"eligible", func(f *expiryFixture) error { return nil }, 1},
+		{"blocked", func(f *expiryFixture) error {
+			return f.db.UpdateMemberSettings(context.Background(), f.convID, f.bob, MemberSettings{Blocked: &yes})
+		}, 0},
+		{"muted", func(f *expiryFixture) error {
+			return f.db.UpdateMemberSettings(context.Background(), f.convID, f.bob, MemberSettings{Muted: &yes})
+		}, 0},
+		{"mute running", func(f *expiryFixture) error {
+			until := time.Now().Add(time.Hour)
+			return f.db.UpdateMemberSettings(context.Background(), f.convID, f.bob, MemberSettings{MutedUntil: &until})
+		}, 0},
+		{"notify none", func(f *expiryFixture) error {
+			return f.db.UpdateMemberSettings(context.Background(), f.convID, f.bob, MemberSettings{Notify: &none})
+		}, 0},
+		{"left", func(f *expiryFixture) error {
+			return f.db.RemoveMember(context.Background(), f.convID, f.bob)
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newExpiryFixture(t)
+			ctx := context.Background()
+			dev := &PushDevice{DeviceID: "phone", Platform: "fcm", Token: "tok"}
+			if err := f.db.RegisterPushDevice(ctx, f.bob, dev); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := f.db.EnqueuePush(ctx, f.convID, []uuid.UUID{f.bob}, []byte("payload")); err != nil || n != 1 {
+				t.Fatalf("expected one entry queued, got %d (%v)", n, err)
+			}
+
+			if err := tt.change(f); err != nil {
+				t.Fatal(err)
+			}
+			due, err := f.db.ClaimPushes(ctx, 10, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(due) != tt.want {
+				t.Errorf("expected %d entries claimed, got %d", tt.want, len(due))
+			}
+			var queued int
+			if err := f.db.pool.QueryRow(ctx, `SELECT COUNT(*) FROM push_queue`).Scan(&queued); err != nil {
+				t.Fatal(err)
+			}
+			if queued != tt.want {
+				t.Errorf("expected %d entries left queued, got %d", tt.want, queued)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrReactionLimitReached is returned when adding a new emoji to a message
+// that already has the maximum number of distinct emojis.
+var ErrReactionLimitReached = errors.New("reaction limit reached")
+
+// Reaction is one user's emoji reaction to a message.
+type Reaction struct {
+	ID        int64     `json:"id"`
+	MessageID uuid.UUID `json:"messageId"`
+	UserID    uuid.UUID `json:"userId"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ReactionCount is the number of reactions with one emoji on a message.
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	// Whether the requesting user reacted with this emoji
+	Mine bool `json:"mine,omitempty"`
+}
+
+// ToggleReaction adds the user's reaction, or removes it if already present.
+// It returns whether the reaction was added and the emoji's new count.
+// maxEmojis of 0 means unlimited distinct emojis per message.
+func (db *DB) ToggleReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string, maxEmojis int) (bool, int, error) {
+	now := time.Now().UTC()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		DELETE FROM reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3
+	`, messageID, userID, emoji)
+	if err != nil {
+		return false, 0, err
+	}
+	added := result.RowsAffected() == 0
+
+	if added {
+		var exists bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM reactions WHERE message_id = $1 AND emoji = $2)
+		`, messageID, emoji).Scan(&exists)
+		if err != nil {
+			return false, 0, err
+		}
+
+		// Only a new emoji can hit the limit; serialize those per message
+		if !exists && maxEmojis > 0 {
+			_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1::text))`, messageID)
+			if err != nil {
+				return false, 0, err
+			}
+			var distinct int
+			err = tx.QueryRow(ctx, `
+				SELECT COUNT(DISTINCT emoji) FROM reactions WHERE message_id = $1
+			`, messageID).Scan(&distinct)
+			if err != nil {
+				return false, 0, err
+			}
+			if distinct >= maxEmojis {
+				return false, 0, ErrReactionLimitReached
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO reactions (message_id, user_id, emoji, created_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+		`, messageID, userID, emoji, now)
+		if err != nil {
+			return false, 0, err
+		}
+	}
+
+	var count int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM reactions WHERE message_id = $1 AND emoji = $2
+	`, messageID, emoji).Scan(&count)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, 0, err
+	}
+	return added, count, nil
+}
+
+// GetReactionCounts returns per-emoji reaction counts for each message,
+// ordered by first use. Mine is set for emojis userID reacted with.
+func (db *DB) GetReactionCounts(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID][]ReactionCount, error) {
+	counts := make(map[uuid.UUID][]ReactionCount)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := db.pool.Query(ctx, `
+		SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+		FROM reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(id)
+	`, messageIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID uuid.UUID
+		var c ReactionCount
+		if err := rows.Scan(&messageID, &c.Emoji, &c.Count, &c.Mine); err != nil {
+			return nil, err
+		}
+		counts[messageID] = append(counts[messageID], c)
+	}
+	return counts, rows.Err()
+}
+
+// GetReactions returns who reacted to a message with an emoji, most recent
+// first. Pass before > 0 to page by reaction ID.
+func (db *DB) GetReactions(ctx context.Context, messageID uuid.UUID, emoji string, before int64, limit int) ([]Reaction, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT id, message_id, user_id, emoji, created_at
+		FROM reactions
+		WHERE message_id = $1 AND emoji = $2
+		AND ($3::bigint = 0 OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4
+	`, messageID, emoji, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []Reaction
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.ID, &r.MessageID, &r.UserID, &r.Emoji, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
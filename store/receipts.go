@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageStatus is one member's delivery and read status for a message.
+type MessageStatus struct {
+	UserID uuid.UUID
+	Read   bool
+	// When the message was delivered and read; nil for positions reached
+	// before receipts were recorded
+	RecvAt *time.Time
+	ReadAt *time.Time
+	// The user has turned off read receipts
+	HideReadReceipts bool
+}
+
+// GetMessageStatus returns the status of the message at seq for each current
+// member who has received it, read or not.
+func (db *DB) GetMessageStatus(ctx context.Context, convID uuid.UUID, seq int) ([]MessageStatus, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT m.user_id, m.read_seq >= $2, u.hide_read_receipts,
+			(SELECT MIN(r.recv_at) FROM receipts r
+			 WHERE r.conversation_id = m.conversation_id AND r.user_id = m.user_id AND r.seq >= $2),
+			(SELECT MIN(r.read_at) FROM receipts r
+			 WHERE r.conversation_id = m.conversation_id AND r.user_id = m.user_id AND r.seq >= $2)
+		FROM members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL AND m.recv_seq >= $2
+		ORDER BY m.user_id
+	`, convID, seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []MessageStatus
+	for rows.Next() {
+		var st MessageStatus
+		if err := rows.Scan(&st.UserID, &st.Read, &st.HideReadReceipts, &st.RecvAt, &st.ReadAt); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, rows.Err()
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSavedLimitReached is returned when a user already has the maximum
+// number of saved messages.
+var ErrSavedLimitReached = errors.New("saved limit reached")
+
+// SavedMessage is a message in a user's saved collection, with the
+// conversation it belongs to.
+type SavedMessage struct {
+	Message
+	SavedID    int64           `json:"savedId"`
+	Note       []byte          `json:"note,omitempty"` // Encrypted
+	SavedAt    time.Time       `json:"savedAt"`
+	ConvType   string          `json:"convType"`
+	ConvPublic json.RawMessage `json:"convPublic,omitempty"`
+}
+
+// savedUnavailable matches saved rows (sm) whose message (m) the user can no
+// longer see: deleted, not a member, cleared, deleted for them or expired.
+const savedUnavailable = `(
+	m.deleted_at IS NOT NULL
+	OR NOT EXISTS (
+		SELECT 1 FROM members mb
+		WHERE mb.conversation_id = m.conversation_id
+		AND mb.user_id = sm.user_id
+		AND mb.deleted_at IS NULL
+		AND m.seq > mb.clear_seq
+	)
+	OR EXISTS (
+		SELECT 1 FROM message_deletions md
+		WHERE md.message_id = m.id AND md.user_id = sm.user_id
+	)
+	OR EXISTS (
+		SELECT 1 FROM message_reads mr
+		WHERE mr.message_id = m.id AND mr.user_id = sm.user_id AND ` + readExpired + `
+	)
+)`
+
+// SaveMessage adds a message to a user's saved collection, or replaces the
+// note if it is already saved. maxSaved of 0 means unlimited.
+func (db *DB) SaveMessage(ctx context.Context, userID, messageID uuid.UUID, note []byte, maxSaved int) error {
+	now := time.Now().UTC()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user so concurrent saves see a consistent count
+	_, err = tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+
+	if maxSaved > 0 {
+		var count int
+		var saved bool
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(*), COALESCE(BOOL_OR(message_id = $2), FALSE)
+			FROM saved_messages WHERE user_id = $1
+		`, userID, messageID).Scan(&count, &saved)
+		if err != nil {
+			return err
+		}
+		if !saved && count >= maxSaved {
+			return ErrSavedLimitReached
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO saved_messages (user_id, message_id, note, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, message_id) DO UPDATE SET note = EXCLUDED.note
+	`, userID, messageID, note, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UnsaveMessage removes a message from a user's saved collection.
+// Returns false if it wasn't saved.
+func (db *DB) UnsaveMessage(ctx context.Context, userID, messageID uuid.UUID) (bool, error) {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM saved_messages WHERE user_id = $1 AND message_id = $2
+	`, userID, messageID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// GetSavedMessages returns a user's saved messages that are still visible to
+// them, most recently saved first. Pass before > 0 to page by saved ID.
+func (db *DB) GetSavedMessages(ctx context.Context, userID uuid.UUID, before int64, limit int) ([]SavedMessage, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at,
+			m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq,
+			sm.id, sm.note, sm.created_at, c.type, c.public
+		FROM saved_messages sm
+		JOIN messages m ON m.id = sm.message_id
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE sm.user_id = $1
+		AND ($2::bigint = 0 OR sm.id < $2)
+		AND NOT `+savedUnavailable+`
+		ORDER BY sm.id DESC
+		LIMIT $3
+	`, userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var saved []SavedMessage
+	for rows.Next() {
+		var s SavedMessage
+		if err := rows.Scan(&s.ID, &s.ConversationID, &s.Seq, &s.FromUserID, &s.CreatedAt, &s.UpdatedAt,
+			&s.Content, &s.Head, &s.DeletedAt, &s.ViewOnce, &s.ViewOnceTTL, &s.ThreadSeq,
+			&s.SavedID, &s.Note, &s.SavedAt, &s.ConvType, &s.ConvPublic); err != nil {
+			return nil, err
+		}
+		saved = append(saved, s)
+	}
+	return saved, rows.Err()
+}
+
+// RemoveUnavailableSavedMessages deletes saved messages their users can no
+// longer see. Returns the number removed.
+func (db *DB) RemoveUnavailableSavedMessages(ctx context.Context) (int64, error) {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM saved_messages sm
+		USING messages m
+		WHERE m.id = sm.message_id
+		AND `+savedUnavailable+`
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
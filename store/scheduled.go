@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Scheduled message statuses.
+const (
+	ScheduledPending = "pending"
+	ScheduledSending = "sending"
+	ScheduledSent    = "sent"
+	ScheduledFailed  = "failed"
+)
+
+// ErrScheduleLimitReached is returned when a user already has the maximum
+// number of pending scheduled messages.
+var ErrScheduleLimitReached = errors.New("schedule limit reached")
+
+// ScheduledMessage is a send request waiting to be dispatched.
+// Payload is the encrypted request; the store doesn't interpret it.
+type ScheduledMessage struct {
+	ID             uuid.UUID `json:"id"`
+	ConversationID uuid.UUID `json:"conversationId"`
+	UserID         uuid.UUID `json:"userId"`
+	SendAt         time.Time `json:"sendAt"`
+	Payload        []byte    `json:"payload"`
+	Status         string    `json:"status"`
+	Seq            *int      `json:"seq,omitempty"`
+	Error          *string   `json:"error,omitempty"`
+	Attempts       int       `json:"attempts"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+const scheduledColumns = `id, conversation_id, user_id, send_at, payload, status, seq, error, attempts, created_at, updated_at`
+
+func scanScheduled(row pgx.Row) (*ScheduledMessage, error) {
+	var m ScheduledMessage
+	err := row.Scan(&m.ID, &m.ConversationID, &m.UserID, &m.SendAt, &m.Payload,
+		&m.Status, &m.Seq, &m.Error, &m.Attempts, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// CreateScheduledMessage stores a send request for later dispatch.
+// maxPending of 0 means unlimited.
+func (db *DB) CreateScheduledMessage(ctx context.Context, convID, userID uuid.UUID, sendAt time.Time, payload []byte, maxPending int) (*ScheduledMessage, error) {
+	now := time.Now().UTC()
+	m := &ScheduledMessage{
+		ID:             uuid.New(),
+		ConversationID: convID,
+		UserID:         userID,
+		SendAt:         sendAt.UTC(),
+		Payload:        payload,
+		Status:         ScheduledPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user so concurrent requests see a consistent count
+	_, err = tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxPending > 0 {
+		var count int
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM scheduled_messages WHERE user_id = $1 AND status = $2
+		`, userID, ScheduledPending).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count >= maxPending {
+			return nil, ErrScheduleLimitReached
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO scheduled_messages (id, conversation_id, user_id, send_at, payload, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, m.ID, convID, userID, m.SendAt, payload, m.Status, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetScheduledMessage returns a scheduled message by ID, or nil if not found.
+func (db *DB) GetScheduledMessage(ctx context.Context, id uuid.UUID) (*ScheduledMessage, error) {
+	m, err := scanScheduled(db.pool.QueryRow(ctx, `
+		SELECT `+scheduledColumns+` FROM scheduled_messages WHERE id = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return m, err
+}
+
+// GetUserScheduledMessages returns a user's pending and failed scheduled
+// messages, soonest first. A nil convID returns all conversations.
+func (db *DB) GetUserScheduledMessages(ctx context.Context, userID uuid.UUID, convID *uuid.UUID) ([]ScheduledMessage, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT `+scheduledColumns+` FROM scheduled_messages
+		WHERE user_id = $1 AND ($2::uuid IS NULL OR conversation_id = $2)
+		AND status IN ($3, $4)
+		ORDER BY send_at
+	`, userID, convID, ScheduledPending, ScheduledFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ScheduledMessage
+	for rows.Next() {
+		m, err := scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+	return messages, rows.Err()
+}
+
+// UpdateScheduledMessage replaces the payload and send time of a pending
+// scheduled message. Returns false if it isn't the user's or is no longer pending.
+func (db *DB) UpdateScheduledMessage(ctx context.Context, id, userID uuid.UUID, sendAt time.Time, payload []byte) (bool, error) {
+	result, err := db.pool.Exec(ctx, `
+		UPDATE scheduled_messages SET send_at = $3, payload = $4, updated_at = $5
+		WHERE id = $1 AND user_id = $2 AND status = $6
+	`, id, userID, sendAt.UTC(), payload, time.Now().UTC(), ScheduledPending)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// CancelScheduledMessage deletes a pending or failed scheduled message.
+// Returns false if it isn't the user's or has already been dispatched.
+func (db *DB) CancelScheduledMessage(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM scheduled_messages
+		WHERE id = $1 AND user_id = $2 AND status IN ($3, $4)
+	`, id, userID, ScheduledPending, ScheduledFailed)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ClaimDueScheduledMessages marks up to limit due messages as sending,
+// counts the attempt and returns them. Messages left sending for longer than
+// lease, because the node dispatching them died, are claimed again. Rows
+// locked by another node are skipped, so each claim goes to one node.
+func (db *DB) ClaimDueScheduledMessages(ctx context.Context, limit int, lease time.Duration) ([]ScheduledMessage, error) {
+	rows, err := db.pool.Query(ctx, `
+		UPDATE scheduled_messages SET status = $2, attempts = attempts + 1, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE (status = $1 AND send_at <= NOW())
+			OR (status = $2 AND updated_at <= NOW() - $4 * INTERVAL '1 second')
+			ORDER BY send_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+scheduledColumns, ScheduledPending, ScheduledSending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ScheduledMessage
+	for rows.Next() {
+		m, err := scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+	return messages, rows.Err()
+}
+
+// GetScheduledMessageSeq returns the seq of the message a scheduled message
+// was sent as, or 0 if it hasn't been sent.
+func (db *DB) GetScheduledMessageSeq(ctx context.Context, id uuid.UUID) (int, error) {
+	var seq int
+	err := db.pool.QueryRow(ctx, `
+		SELECT seq FROM messages WHERE head->>'scheduled' = $1
+	`, id.String()).Scan(&seq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// MarkScheduledSent records that a claimed message was sent with the given seq.
+func (db *DB) MarkScheduledSent(ctx context.Context, id uuid.UUID, seq int) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE scheduled_messages SET status = $2, seq = $3, payload = ''::bytea, updated_at = NOW()
+		WHERE id = $1
+	`, id, ScheduledSent, seq)
+	return err
+}
+
+// RetryScheduledMessage puts a claimed message back as pending, to be sent at
+// the given time.
+func (db *DB) RetryScheduledMessage(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE scheduled_messages SET status = $2, send_at = $3, updated_at = NOW()
+		WHERE id = $1
+	`, id, ScheduledPending, at.UTC())
+	return err
+}
+
+// MarkScheduledFailed records why a claimed message could not be sent.
+func (db *DB) MarkScheduledFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE scheduled_messages SET status = $2, error = $3, updated_at = NOW()
+		WHERE id = $1
+	`, id, ScheduledFailed, reason)
+	return err
+}
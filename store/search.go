@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// IndexMessage replaces a message's blind index tokens.
+// An empty token list just removes the message from the index.
+func (db *DB) IndexMessage(ctx context.Context, messageID, convID uuid.UUID, tokens [][]byte) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM message_tokens WHERE message_id = $1`, messageID)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) > 0 {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO message_tokens (message_id, conversation_id, token)
+			SELECT $1, $2, t FROM unnest($3::bytea[]) AS t
+			ON CONFLICT DO NOTHING
+		`, messageID, convID, tokens)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// unindexBySeq removes a message from the search index.
+func unindexBySeq(ctx context.Context, tx pgx.Tx, convID uuid.UUID, seq int) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM message_tokens
+		WHERE message_id = (SELECT id FROM messages WHERE conversation_id = $1 AND seq = $2)
+	`, convID, seq)
+	return err
+}
+
+// SearchMessages returns messages visible to the user that contain every
+// token, newest first. A nil convID searches all of the user's conversations.
+// Cleared, deleted, expired and view-once messages are never returned.
+func (db *DB) SearchMessages(ctx context.Context, userID uuid.UUID, convID *uuid.UUID, tokens [][]byte, limit int) ([]Message, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.pool.Query(ctx, `
+		WITH matches AS (
+			SELECT t.message_id
+			FROM message_tokens t
+			JOIN members mb ON mb.conversation_id = t.conversation_id
+				AND mb.user_id = $1 AND mb.deleted_at IS NULL
+			WHERE t.token = ANY($3::bytea[])
+			AND ($2::uuid IS NULL OR t.conversation_id = $2)
+			GROUP BY t.message_id
+			HAVING COUNT(DISTINCT t.token) = $4
+		)
+		SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at,
+			m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq
+		FROM matches
+		JOIN messages m ON m.id = matches.message_id
+		JOIN members mb ON mb.conversation_id = m.conversation_id AND mb.user_id = $1
+		LEFT JOIN message_deletions md ON md.message_id = m.id AND md.user_id = $1
+		LEFT JOIN message_reads mr ON mr.message_id = m.id AND mr.user_id = $1
+		WHERE m.seq > mb.clear_seq
+		AND m.deleted_at IS NULL
+		AND NOT m.view_once
+		AND md.message_id IS NULL
+		AND (mr.message_id IS NULL OR NOT `+readExpired+`)
+		ORDER BY m.created_at DESC
+		LIMIT $5
+	`, userID, convID, tokens, len(tokens), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Seq, &m.FromUserID, &m.CreatedAt, &m.UpdatedAt,
+			&m.Content, &m.Head, &m.DeletedAt, &m.ViewOnce, &m.ViewOnceTTL, &m.ThreadSeq); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// PurgeExpiredMessageIndex removes index tokens of messages that have
+// expired for every recipient. Returns the number of tokens removed.
+func (db *DB) PurgeExpiredMessageIndex(ctx context.Context) (int64, error) {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM message_tokens t
+		USING messages m
+		WHERE m.id = t.message_id
+		AND EXISTS (
+			SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND `+readExpired+`
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM members mb
+			LEFT JOIN message_reads mr ON mr.message_id = m.id AND mr.user_id = mb.user_id
+			WHERE mb.conversation_id = m.conversation_id
+			AND mb.deleted_at IS NULL
+			AND mb.user_id != m.from_user_id
+			AND (mr.message_id IS NULL OR NOT `+readExpired+`)
+		)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
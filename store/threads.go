@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrThreadRootNotFound is returned when a thread reply targets a message that
+// does not exist, was deleted, or is itself a thread reply.
+var ErrThreadRootNotFound = errors.New("thread root not found")
+
+// ThreadSummary is the per-thread summary kept in the root message's head under "thread".
+type ThreadSummary struct {
+	Replies int       `json:"replies"`
+	LastSeq int       `json:"last_seq"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// CreateThreadReply creates a reply in the thread rooted at rootSeq and updates
+// the root's reply count and last-reply timestamp in the same transaction.
+func (db *DB) CreateThreadReply(ctx context.Context, convID, fromUserID uuid.UUID, rootSeq int, content []byte, head json.RawMessage) (*Message, error) {
+	now := time.Now().UTC()
+	msgID := uuid.New()
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the root so concurrent replies update the summary in order
+	var rootID uuid.UUID
+	var rootHead json.RawMessage
+	err = tx.QueryRow(ctx, `
+		SELECT id, COALESCE(head, '{}'::jsonb) FROM messages
+		WHERE conversation_id = $1 AND seq = $2 AND deleted_at IS NULL AND thread_seq IS NULL
+		FOR UPDATE
+	`, convID, rootSeq).Scan(&rootID, &rootHead)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrThreadRootNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Get next sequence number and update conversation
+	var seq int
+	err = tx.QueryRow(ctx, `
+		UPDATE conversations
+		SET last_seq = last_seq + 1, last_msg_at = $2, updated_at = $2
+		WHERE id = $1
+		RETURNING last_seq
+	`, convID, now).Scan(&seq)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO messages (id, conversation_id, seq, from_user_id, created_at, updated_at, content, head, thread_seq)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, msgID, convID, seq, fromUserID, now, now, content, head, rootSeq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update the thread summary on the root
+	var headMap map[string]json.RawMessage
+	if err := json.Unmarshal(rootHead, &headMap); err != nil || headMap == nil {
+		headMap = make(map[string]json.RawMessage)
+	}
+	var summary ThreadSummary
+	if raw, ok := headMap["thread"]; ok {
+		_ = json.Unmarshal(raw, &summary)
+	}
+	summary.Replies++
+	summary.LastSeq = seq
+	summary.LastAt = now
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	headMap["thread"] = summaryJSON
+	newHead, err := json.Marshal(headMap)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE messages SET head = $2 WHERE id = $1
+	`, rootID, newHead)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	threadSeq := rootSeq
+	return &Message{
+		ID:             msgID,
+		ConversationID: convID,
+		Seq:            seq,
+		FromUserID:     fromUserID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Content:        content,
+		Head:           head,
+		ThreadSeq:      &threadSeq,
+	}, nil
+}
+
+// resummarizeThread recomputes the thread summary on the root of the reply at
+// seq from its remaining replies, after the reply was deleted. The summary is
+// removed when none are left. Does nothing if seq isn't a thread reply.
+func resummarizeThread(ctx context.Context, tx pgx.Tx, convID uuid.UUID, seq int) error {
+	var rootSeq *int
+	err := tx.QueryRow(ctx, `
+		SELECT thread_seq FROM messages WHERE conversation_id = $1 AND seq = $2
+	`, convID, seq).Scan(&rootSeq)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && rootSeq == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Lock the root first, as CreateThreadReply does, so the count includes
+	// replies committed meanwhile
+	_, err = tx.Exec(ctx, `
+		SELECT 1 FROM messages WHERE conversation_id = $1 AND seq = $2 FOR UPDATE
+	`, convID, *rootSeq)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE messages m SET head = CASE
+			WHEN s.replies = 0 THEN COALESCE(m.head, '{}'::jsonb) - 'thread'
+			ELSE COALESCE(m.head, '{}'::jsonb) || jsonb_build_object('thread', jsonb_build_object(
+				'replies', s.replies, 'last_seq', s.last_seq, 'last_at', s.last_at))
+		END
+		FROM (
+			SELECT COUNT(*) AS replies, MAX(seq) AS last_seq, MAX(created_at) AS last_at
+			FROM messages
+			WHERE conversation_id = $1 AND thread_seq = $2 AND deleted_at IS NULL
+		) s
+		WHERE m.conversation_id = $1 AND m.seq = $2
+	`, convID, *rootSeq)
+	return err
+}
+
+// GetThreadMessages retrieves replies in a thread with pagination.
+// Returns replies with seq < before (if before > 0), ordered by seq DESC.
+// Applies the same visibility rules as GetMessages.
+func (db *DB) GetThreadMessages(ctx context.Context, convID, userID uuid.UUID, rootSeq, before, limit int, clearSeq int) ([]Message, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if before <= 0 {
+		before = math.MaxInt32
+	}
+
+	rows, err := db.pool.Query(ctx, `
+		SELECT m.id, m.conversation_id, m.seq, m.from_user_id, m.created_at, m.updated_at, m.content, m.head, m.deleted_at, m.view_once, m.view_once_ttl, m.thread_seq
+		FROM messages m
+		LEFT JOIN message_deletions md ON m.id = md.message_id AND md.user_id = $2
+		LEFT JOIN message_reads mr ON m.id = mr.message_id AND mr.user_id = $2
+		WHERE m.conversation_id = $1
+		AND m.thread_seq = $3
+		AND m.seq > $6
+		AND m.seq < $4
+		AND md.message_id IS NULL
+		AND (mr.expired IS NULL OR mr.expired = FALSE)
+		ORDER BY m.seq DESC LIMIT $5
+	`, convID, userID, rootSeq, before, limit, clearSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Seq, &msg.FromUserID,
+			&msg.CreatedAt, &msg.UpdatedAt, &msg.Content, &msg.Head, &msg.DeletedAt,
+			&msg.ViewOnce, &msg.ViewOnceTTL, &msg.ThreadSeq); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// UpdateThreadReadSeq advances a user's read position within a thread.
+func (db *DB) UpdateThreadReadSeq(ctx context.Context, convID, userID uuid.UUID, rootSeq, seq int) error {
+	now := time.Now().UTC()
+	_, err := db.pool.Exec(ctx, `
+		INSERT INTO thread_reads (conversation_id, root_seq, user_id, read_seq, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (conversation_id, root_seq, user_id) DO UPDATE SET
+			read_seq = GREATEST(thread_reads.read_seq, EXCLUDED.read_seq),
+			updated_at = EXCLUDED.updated_at
+	`, convID, rootSeq, userID, seq, now)
+	return err
+}
+
+// GetThreadReadSeq returns a user's read position within a thread (0 if never read).
+func (db *DB) GetThreadReadSeq(ctx context.Context, convID, userID uuid.UUID, rootSeq int) (int, error) {
+	var seq int
+	err := db.pool.QueryRow(ctx, `
+		SELECT read_seq FROM thread_reads
+		WHERE conversation_id = $1 AND root_seq = $2 AND user_id = $3
+	`, convID, rootSeq, userID).Scan(&seq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// CountThreadReplies returns the number of thread replies in a conversation with seq > afterSeq.
+// Used to keep thread replies out of the main unread count.
+func (db *DB) CountThreadReplies(ctx context.Context, convID uuid.UUID, afterSeq int) (int, error) {
+	var count int
+	err := db.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM messages
+		WHERE conversation_id = $1 AND thread_seq IS NOT NULL AND seq > $2
+	`, convID, afterSeq).Scan(&count)
+	return count, err
+}
+
+// CountThreadUnread returns the number of replies in a thread with seq > afterSeq.
+func (db *DB) CountThreadUnread(ctx context.Context, convID uuid.UUID, rootSeq, afterSeq int) (int, error) {
+	var count int
+	err := db.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM messages
+		WHERE conversation_id = $1 AND thread_seq = $2 AND seq > $3 AND deleted_at IS NULL
+	`, convID, rootSeq, afterSeq).Scan(&count)
+	return count, err
+}
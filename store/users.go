@@ -23,6 +23,67 @@ type User struct {
 	Email              *string         `json:"email,omitempty"`
 	EmailVerified      bool            `json:"emailVerified,omitempty"`
 	Lang               *string         `json:"lang,omitempty"`
+	HideReadReceipts   bool            `json:"hideReadReceipts,omitempty"`
+	// Notification level for conversations without their own
+	NotifyDefault string `json:"notifyDefault,omitempty"`
+	// Nil when the user has no quiet hours
+	QuietHours *QuietHours `json:"quietHours,omitempty"`
+	// Chosen presence state and custom status; nil when never set
+	Presence *Presence `json:"presence,omitempty"`
+	// Who may see the user online and their last seen time; nil is everyone
+	PresencePrivacy *PresencePrivacy `json:"presencePrivacy,omitempty"`
+}
+
+// Presence is the presence a user has chosen for themselves. An empty State
+// means available; the custom Status clears itself at StatusExpires.
+type Presence struct {
+	State         string     `json:"state,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	StatusExpires *time.Time `json:"statusExpires,omitempty"`
+}
+
+// QuietHours is a daily window during which offline notifications are held
+// back. Start and End are minutes after midnight in TZ (an IANA zone name);
+// a window that ends before it starts runs past midnight.
+type QuietHours struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	TZ    string `json:"tz"`
+}
+
+// Presence privacy levels.
+const (
+	PresenceEveryone = "everyone"
+	PresenceContacts = "contacts"
+	PresenceNobody   = "nobody"
+)
+
+// PresencePrivacy is who may see a user's online status and last seen time.
+// Exceptions invert the level for the listed users: they are hidden from
+// under "everyone" and shown to under "contacts" or "nobody".
+type PresencePrivacy struct {
+	Level      string      `json:"level"`
+	Exceptions []uuid.UUID `json:"exceptions,omitempty"`
+}
+
+// PresencePeer is what deciding presence visibility between a user and one
+// other user needs.
+type PresencePeer struct {
+	// The other user's privacy settings; nil is everyone
+	Privacy *PresencePrivacy
+	// The user has the other user as a contact
+	IsContact bool
+	// The other user has the user as a contact
+	ContactOf bool
+}
+
+// PresenceNode is what presence fan-out needs to know about one user.
+type PresenceNode struct {
+	// Conversations presence flows through: all of the user's, except DMs
+	// either side has blocked
+	Conversations []uuid.UUID
+	Contacts      []uuid.UUID
+	Privacy       *PresencePrivacy
 }
 
 // AuthRecord represents an authentication record.
@@ -68,9 +129,9 @@ func (db *DB) CreateUserWithOptions(ctx context.Context, public json.RawMessage,
 func (db *DB) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
 	var user User
 	err := db.pool.QueryRow(ctx, `
-		SELECT id, created_at, updated_at, state, public, last_seen, user_agent, must_change_password, email, email_verified, lang
+		SELECT id, created_at, updated_at, state, public, last_seen, user_agent, must_change_password, email, email_verified, lang, hide_read_receipts, notify_default, quiet_hours, presence, presence_privacy
 		FROM users WHERE id = $1 AND state != 'deleted'
-	`, id).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.State, &user.Public, &user.LastSeen, &user.UserAgent, &user.MustChangePassword, &user.Email, &user.EmailVerified, &user.Lang)
+	`, id).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.State, &user.Public, &user.LastSeen, &user.UserAgent, &user.MustChangePassword, &user.Email, &user.EmailVerified, &user.Lang, &user.HideReadReceipts, &user.NotifyDefault, &user.QuietHours, &user.Presence, &user.PresencePrivacy)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
@@ -172,9 +233,9 @@ func (db *DB) UpdateUserEmail(ctx context.Context, userID uuid.UUID, email *stri
 func (db *DB) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	var user User
 	err := db.pool.QueryRow(ctx, `
-		SELECT id, created_at, updated_at, state, public, last_seen, user_agent, must_change_password, email, email_verified, lang
+		SELECT id, created_at, updated_at, state, public, last_seen, user_agent, must_change_password, email, email_verified, lang, hide_read_receipts, notify_default, quiet_hours, presence, presence_privacy
 		FROM users WHERE email = $1 AND state != 'deleted'
-	`, email).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.State, &user.Public, &user.LastSeen, &user.UserAgent, &user.MustChangePassword, &user.Email, &user.EmailVerified, &user.Lang)
+	`, email).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.State, &user.Public, &user.LastSeen, &user.UserAgent, &user.MustChangePassword, &user.Email, &user.EmailVerified, &user.Lang, &user.HideReadReceipts, &user.NotifyDefault, &user.QuietHours, &user.Presence, &user.PresencePrivacy)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
@@ -222,7 +283,7 @@ func (db *DB) SearchUsers(ctx context.Context, query string, limit int) ([]User,
 	}
 
 	rows, err := db.pool.Query(ctx, `
-		SELECT id, created_at, updated_at, state, public, last_seen, user_agent, must_change_password, email, email_verified, lang
+		SELECT id, created_at, updated_at, state, public, last_seen, user_agent, must_change_password, email, email_verified, lang, hide_read_receipts, notify_default, quiet_hours, presence, presence_privacy
 		FROM users
 		WHERE state = 'ok'
 		AND public->>'fn' ILIKE '%' || $1 || '%'
@@ -237,7 +298,7 @@ func (db *DB) SearchUsers(ctx context.Context, query string, limit int) ([]User,
 	var users []User
 	for rows.Next() {
 		var user User
-		if err := rows.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.State, &user.Public, &user.LastSeen, &user.UserAgent, &user.MustChangePassword, &user.Email, &user.EmailVerified, &user.Lang); err != nil {
+		if err := rows.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.State, &user.Public, &user.LastSeen, &user.UserAgent, &user.MustChangePassword, &user.Email, &user.EmailVerified, &user.Lang, &user.HideReadReceipts, &user.NotifyDefault, &user.QuietHours, &user.Presence, &user.PresencePrivacy); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -254,6 +315,128 @@ func (db *DB) UpdateUserLang(ctx context.Context, userID uuid.UUID, lang *string
 	return err
 }
 
+// UpdateUserReadReceipts sets whether the user's reads are shared with
+// other members as read receipts.
+func (db *DB) UpdateUserReadReceipts(ctx context.Context, userID uuid.UUID, enabled bool) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE users SET hide_read_receipts = $2, updated_at = $3
+		WHERE id = $1
+	`, userID, !enabled, time.Now().UTC())
+	return err
+}
+
+// UpdateUserNotifyDefault sets the user's default notification level.
+func (db *DB) UpdateUserNotifyDefault(ctx context.Context, userID uuid.UUID, level string) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE users SET notify_default = $2, updated_at = $3
+		WHERE id = $1
+	`, userID, level, time.Now().UTC())
+	return err
+}
+
+// UpdateUserQuietHours sets the user's quiet hours. Nil turns them off.
+func (db *DB) UpdateUserQuietHours(ctx context.Context, userID uuid.UUID, quiet *QuietHours) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE users SET quiet_hours = $2, updated_at = $3
+		WHERE id = $1
+	`, userID, quiet, time.Now().UTC())
+	return err
+}
+
+// UpdateUserPresence sets the user's chosen presence. Nil resets it.
+func (db *DB) UpdateUserPresence(ctx context.Context, userID uuid.UUID, presence *Presence) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE users SET presence = $2, updated_at = $3
+		WHERE id = $1
+	`, userID, presence, time.Now().UTC())
+	return err
+}
+
+// UpdateUserPresencePrivacy sets who may see the user's presence. Nil is everyone.
+func (db *DB) UpdateUserPresencePrivacy(ctx context.Context, userID uuid.UUID, privacy *PresencePrivacy) error {
+	_, err := db.pool.Exec(ctx, `
+		UPDATE users SET presence_privacy = $2, updated_at = $3
+		WHERE id = $1
+	`, userID, privacy, time.Now().UTC())
+	return err
+}
+
+// GetPresencePeers returns, for each of others, their presence privacy and
+// the contact relationship in each direction with userID.
+func (db *DB) GetPresencePeers(ctx context.Context, userID uuid.UUID, others []uuid.UUID) (map[uuid.UUID]PresencePeer, error) {
+	peers := make(map[uuid.UUID]PresencePeer, len(others))
+	if len(others) == 0 {
+		return peers, nil
+	}
+	rows, err := db.pool.Query(ctx, `
+		SELECT u.id, u.presence_privacy,
+			EXISTS (SELECT 1 FROM contacts c WHERE c.user_id = $1 AND c.contact_id = u.id),
+			EXISTS (SELECT 1 FROM contacts c WHERE c.user_id = u.id AND c.contact_id = $1)
+		FROM users u
+		WHERE u.id = ANY($2)
+	`, userID, others)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var peer PresencePeer
+		if err := rows.Scan(&id, &peer.Privacy, &peer.IsContact, &peer.ContactOf); err != nil {
+			return nil, err
+		}
+		peers[id] = peer
+	}
+	return peers, rows.Err()
+}
+
+// GetPresenceNode loads a user's presence conversations, contacts and
+// presence privacy. Returns nil if the user doesn't exist.
+func (db *DB) GetPresenceNode(ctx context.Context, userID uuid.UUID) (*PresenceNode, error) {
+	var node PresenceNode
+	err := db.pool.QueryRow(ctx, `
+		SELECT presence_privacy FROM users WHERE id = $1 AND state != 'deleted'
+	`, userID).Scan(&node.Privacy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.pool.Query(ctx, `
+		SELECT 'conv', m.conversation_id
+		FROM members m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE m.user_id = $1 AND m.deleted_at IS NULL
+			AND NOT (c.type = 'dm' AND EXISTS (
+				SELECT 1 FROM members b
+				WHERE b.conversation_id = c.id AND b.blocked AND b.deleted_at IS NULL
+			))
+		UNION ALL
+		SELECT 'contact', contact_id FROM contacts WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var id uuid.UUID
+		if err := rows.Scan(&kind, &id); err != nil {
+			return nil, err
+		}
+		if kind == "conv" {
+			node.Conversations = append(node.Conversations, id)
+		} else {
+			node.Contacts = append(node.Contacts, id)
+		}
+	}
+	return &node, rows.Err()
+}
+
 // SetEmailVerificationToken sets a verification token for a user's email.
 // Returns the generated token.
 func (db *DB) SetEmailVerificationToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) error {
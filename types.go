@@ -12,25 +12,31 @@ type ClientMessage struct {
 	ID string `json:"id,omitempty"`
 
 	// Only one of these should be set
-	Hi      *MsgClientHi      `json:"hi,omitempty"`
-	Login   *MsgClientLogin   `json:"login,omitempty"`
-	Acc     *MsgClientAcc     `json:"acc,omitempty"`
-	Search  *MsgClientSearch  `json:"search,omitempty"`
-	DM      *MsgClientDM      `json:"dm,omitempty"`
-	Room    *MsgClientRoom    `json:"room,omitempty"`
-	Send    *MsgClientSend    `json:"send,omitempty"`
-	Get     *MsgClientGet     `json:"get,omitempty"`
-	Edit    *MsgClientEdit    `json:"edit,omitempty"`
-	Unsend  *MsgClientUnsend  `json:"unsend,omitempty"`
-	Delete  *MsgClientDelete  `json:"delete,omitempty"`
-	React   *MsgClientReact   `json:"react,omitempty"`
-	Typing  *MsgClientTyping  `json:"typing,omitempty"`
-	Read    *MsgClientRead    `json:"read,omitempty"`
-	Recv    *MsgClientRecv    `json:"recv,omitempty"`
-	Clear   *MsgClientClear   `json:"clear,omitempty"`
-	Invite  *MsgClientInvite  `json:"invite,omitempty"`
-	Contact *MsgClientContact `json:"contact,omitempty"`
-	Pin     *MsgClientPin     `json:"pin,omitempty"`
+	Hi        *MsgClientHi        `json:"hi,omitempty"`
+	Login     *MsgClientLogin     `json:"login,omitempty"`
+	Acc       *MsgClientAcc       `json:"acc,omitempty"`
+	Search    *MsgClientSearch    `json:"search,omitempty"`
+	DM        *MsgClientDM        `json:"dm,omitempty"`
+	Room      *MsgClientRoom      `json:"room,omitempty"`
+	Send      *MsgClientSend      `json:"send,omitempty"`
+	Get       *MsgClientGet       `json:"get,omitempty"`
+	Edit      *MsgClientEdit      `json:"edit,omitempty"`
+	Unsend    *MsgClientUnsend    `json:"unsend,omitempty"`
+	Delete    *MsgClientDelete    `json:"delete,omitempty"`
+	React     *MsgClientReact     `json:"react,omitempty"`
+	Typing    *MsgClientTyping    `json:"typing,omitempty"`
+	Read      *MsgClientRead      `json:"read,omitempty"`
+	Recv      *MsgClientRecv      `json:"recv,omitempty"`
+	Clear     *MsgClientClear     `json:"clear,omitempty"`
+	Invite    *MsgClientInvite    `json:"invite,omitempty"`
+	Contact   *MsgClientContact   `json:"contact,omitempty"`
+	Pin       *MsgClientPin       `json:"pin,omitempty"`
+	Vote      *MsgClientVote      `json:"vote,omitempty"`
+	Scheduled *MsgClientScheduled `json:"scheduled,omitempty"`
+	Forward   *MsgClientForward   `json:"forward,omitempty"`
+	Save      *MsgClientSave      `json:"save,omitempty"`
+	Device    *MsgClientDevice    `json:"device,omitempty"`
+	Pres      *MsgClientPres      `json:"pres,omitempty"`
 }
 
 // ServerMessage is a message from server to client.
@@ -77,6 +83,32 @@ type MsgClientAcc struct {
 	Email *string `json:"email,omitempty"`
 	// For account update: preferred language (e.g., "en", "es", "fr")
 	Lang *string `json:"lang,omitempty"`
+	// For account update: false to stop sharing read receipts
+	ReadReceipts *bool `json:"readReceipts,omitempty"`
+	// For account update: default notification level ("all", "mentions", "none")
+	Notify *string `json:"notify,omitempty"`
+	// For account update: quiet hours (empty start and end turn them off)
+	QuietHours *MsgQuietHours `json:"quietHours,omitempty"`
+	// For account update: who may see when the user is online or last seen
+	PresencePrivacy *MsgPresencePrivacy `json:"presencePrivacy,omitempty"`
+}
+
+// MsgPresencePrivacy is who may see a user's online status and last seen time.
+type MsgPresencePrivacy struct {
+	// "everyone" (default), "contacts" or "nobody"
+	Level string `json:"level,omitempty"`
+	// User IDs the level is inverted for: hidden from under "everyone",
+	// shown to under "contacts" or "nobody"
+	Exceptions []string `json:"exceptions,omitempty"`
+}
+
+// MsgQuietHours is a daily window without offline notifications.
+type MsgQuietHours struct {
+	// Local times "HH:MM"; an end before the start runs past midnight
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// IANA time zone (e.g., "America/Chicago"); default UTC
+	TZ string `json:"tz,omitempty"`
 }
 
 // MsgSetDesc is public/private data for account or conversation.
@@ -85,10 +117,14 @@ type MsgSetDesc struct {
 	Private json.RawMessage `json:"private,omitempty"`
 }
 
-// MsgClientSearch is for user search.
+// MsgClientSearch is for user and message search.
 type MsgClientSearch struct {
+	// What to search: "users" (default) or "messages"
+	What  string `json:"what,omitempty"`
 	Query string `json:"query"`
-	Limit int    `json:"limit,omitempty"`
+	// For messages: limit to one conversation (default: all of the user's)
+	ConversationID string `json:"conv,omitempty"`
+	Limit          int    `json:"limit,omitempty"`
 }
 
 // MsgClientDM is for starting/managing DMs.
@@ -102,6 +138,10 @@ type MsgClientDM struct {
 	Muted    *bool           `json:"muted,omitempty"`
 	Blocked  *bool           `json:"blocked,omitempty"`
 	Private  json.RawMessage `json:"private,omitempty"`
+	// Notification settings: mute until a time (replaces an indefinite mute),
+	// and level "all", "mentions", "none" or "" for the account default
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"`
+	Notify     *string    `json:"notify,omitempty"`
 	// Disappearing messages TTL in seconds (nil = no change, 0 = disable)
 	DisappearingTTL *int `json:"disappearingTTL,omitempty"`
 }
@@ -110,7 +150,7 @@ type MsgClientDM struct {
 type MsgClientRoom struct {
 	// Create: "new", Join/Leave/Manage: room ID
 	ID string `json:"id"`
-	// Action: "create", "join", "leave", "invite", "kick", "update"
+	// Action: "create", "join", "leave", "invite", "kick", "update", "settings"
 	Action string `json:"action"`
 	// For invite/kick
 	User string `json:"user,omitempty"`
@@ -120,6 +160,14 @@ type MsgClientRoom struct {
 	DisappearingTTL *int `json:"disappearingTTL,omitempty"`
 	// No-screenshots flag (nil = no change)
 	NoScreenshots *bool `json:"noScreenshots,omitempty"`
+	// Slow mode interval in seconds (nil = no change, 0 = disable)
+	SlowMode *int `json:"slowMode,omitempty"`
+	// Member limit (nil = no change, 0 = use the server-wide limit)
+	MaxMembers *int `json:"maxMembers,omitempty"`
+	// For settings: the member's own notification settings, as for DMs
+	Muted      *bool      `json:"muted,omitempty"`
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"`
+	Notify     *string    `json:"notify,omitempty"`
 }
 
 // MsgClientSend is for sending a message.
@@ -132,17 +180,34 @@ type MsgClientSend struct {
 	ViewOnce bool `json:"viewOnce,omitempty"`
 	// TTL in seconds after viewing: 10, 30, 60, 300, 3600, 86400, 604800
 	ViewOnceTTL int `json:"viewOnceTTL,omitempty"`
+	// Optional: post as a reply in the thread rooted at this seq
+	Thread int `json:"thread,omitempty"`
+	// Optional: send at this future time instead of now
+	SendAt *time.Time `json:"sendAt,omitempty"`
+	// Optional: recipients may not forward this message
+	NoForward bool `json:"noForward,omitempty"`
+	// Optional: notify recipients even during their quiet hours (room owners
+	// and admins, or a contact of the other DM member)
+	Urgent bool `json:"urgent,omitempty"`
+	// Optional: deliver without any server-generated notification
+	Silent bool `json:"silent,omitempty"`
 }
 
 // MsgClientGet is for fetching data.
 type MsgClientGet struct {
-	// What to get: "conversations", "conversation", "messages", "members", "receipts", "contacts", "user"
+	// What to get: "conversations", "conversation", "messages", "members", "receipts", "contacts", "user", "mentions", "thread", "pins", "poll", "scheduled", "saved", "reactions", "status"
 	What string `json:"what"`
-	// For messages/members/receipts/conversation: conversation ID
+	// For messages/members/receipts/conversation/thread: conversation ID (optional filter for scheduled)
 	ConversationID string `json:"conv,omitempty"`
 	// For user: user ID
 	User string `json:"user,omitempty"`
-	// Pagination
+	// For thread: seq of the thread root; for poll/reactions: seq of the message
+	Seq int `json:"seq,omitempty"`
+	// For reactions: list who reacted with this emoji (omit for counts)
+	Emoji string `json:"emoji,omitempty"`
+	// For conversations/conversation: thread mode keeps thread replies out of the unread count
+	Threads bool `json:"threads,omitempty"`
+	// Pagination (for saved/reactions: before is a saved/reaction ID)
 	Before int `json:"before,omitempty"`
 	Limit  int `json:"limit,omitempty"`
 }
@@ -168,7 +233,8 @@ type MsgClientDelete struct {
 	ForEveryone bool `json:"forEveryone,omitempty"`
 }
 
-// MsgClientReact is for adding/removing reactions.
+// MsgClientReact is for adding/removing reactions. Reacting again with the
+// same emoji removes the reaction.
 type MsgClientReact struct {
 	ConversationID string `json:"conv"`
 	Seq            int    `json:"seq"`
@@ -178,12 +244,18 @@ type MsgClientReact struct {
 // MsgClientTyping is the typing indicator.
 type MsgClientTyping struct {
 	ConversationID string `json:"conv"`
+	// "typing" (default), "recording" (a voice message) or "uploading"
+	Activity string `json:"activity,omitempty"`
+	// The activity ended without sending
+	Stop bool `json:"stop,omitempty"`
 }
 
 // MsgClientRead is the read receipt.
 type MsgClientRead struct {
 	ConversationID string `json:"conv"`
 	Seq            int    `json:"seq"`
+	// Optional: mark replies read within the thread rooted at this seq
+	Thread int `json:"thread,omitempty"`
 }
 
 // MsgClientRecv is the delivery receipt (message received by client).
@@ -228,18 +300,52 @@ type MsgServerInfo struct {
 	From           string          `json:"from"`
 	What           string          `json:"what"` // "typing", "read", "edit", "unsend", "react", "member_joined", "member_left", "member_kicked", etc.
 	Seq            int             `json:"seq,omitempty"`
-	Content        json.RawMessage `json:"content,omitempty"` // For edit, room_updated
-	Emoji          string          `json:"emoji,omitempty"`   // For react
-	User           string          `json:"user,omitempty"`    // For member_joined, member_kicked (the affected user)
-	TTL            *int            `json:"ttl,omitempty"`     // For disappearing_updated
+	Content        json.RawMessage `json:"content,omitempty"`   // For edit, room_updated
+	Emoji          string          `json:"emoji,omitempty"`     // For react
+	Count          *int            `json:"count,omitempty"`     // For react: the emoji's new count
+	Removed        bool            `json:"removed,omitempty"`   // For react: the reaction was removed
+	User           string          `json:"user,omitempty"`      // For member_joined, member_kicked (the affected user)
+	TTL            *int            `json:"ttl,omitempty"`       // For disappearing_updated
+	SlowMode       *int            `json:"slowMode,omitempty"`  // For slowmode_updated
+	Thread         int             `json:"thread,omitempty"`    // For read within a thread
+	Poll           *PollResults    `json:"poll,omitempty"`      // For poll_updated
+	Scheduled      string          `json:"scheduled,omitempty"` // For scheduled_sent, scheduled_failed
+	Activity       string          `json:"activity,omitempty"`  // For typing
+	Typing         *TypingSummary  `json:"typing,omitempty"`    // For typing_summary
 	Ts             time.Time       `json:"ts"`
 }
 
+// TypingSummary is who is active in a big room.
+type TypingSummary struct {
+	// Number of members typing, recording or uploading
+	Count int `json:"count"`
+	// Some of them, to name in "Ann, Bob and 3 others are typing"
+	Users []string `json:"users,omitempty"`
+}
+
+// PollResults is the current tally of a poll.
+type PollResults struct {
+	// Vote count per option, by option index
+	Counts []int `json:"counts"`
+	// Number of distinct voters
+	Voters int `json:"voters"`
+	// Voter IDs per option, by option index (omitted for anonymous polls)
+	Votes [][]string `json:"votes,omitempty"`
+	// Whether voting has ended
+	Closed   bool       `json:"closed,omitempty"`
+	ClosesAt *time.Time `json:"closesAt,omitempty"`
+}
+
 // MsgServerPres is a presence notification.
 type MsgServerPres struct {
 	UserID   string     `json:"user"`
 	What     string     `json:"what"` // "on", "off"
 	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	// While online: "available", "away", "busy" or "dnd"
+	State string `json:"state,omitempty"`
+	// Custom status text and when it clears
+	Status        string     `json:"status,omitempty"`
+	StatusExpires *time.Time `json:"statusExpires,omitempty"`
 }
 
 // MsgClientInvite is for invite code management.
@@ -269,13 +375,109 @@ type MsgClientContact struct {
 	// Update nickname for a contact
 	User     string  `json:"user,omitempty"`
 	Nickname *string `json:"nickname,omitempty"`
+	// Let the contact's messages through during quiet hours
+	BypassQuiet *bool `json:"bypassQuiet,omitempty"`
 }
 
-// MsgClientPin is for pinning/unpinning messages.
+// MsgClientPin is for pinning, unpinning and reordering pinned messages.
 type MsgClientPin struct {
 	ConversationID string `json:"conv"`
-	// Seq of message to pin (0 or omit to unpin)
+	// Action: "pin", "unpin", "reorder". If omitted, Seq > 0 pins and Seq 0 unpins all.
+	Action string `json:"action,omitempty"`
+	// Seq of message to pin or unpin (0 with "unpin" clears all pins)
 	Seq int `json:"seq,omitempty"`
+	// Seqs lists every pinned message in the new order, top first (for "reorder")
+	Seqs []int `json:"seqs,omitempty"`
+}
+
+// MsgClientVote is for voting in or closing a poll.
+type MsgClientVote struct {
+	ConversationID string `json:"conv"`
+	// Seq of the poll message
+	Seq int `json:"seq"`
+	// Selected option indexes; replaces any earlier vote (empty retracts it)
+	Options []int `json:"options,omitempty"`
+	// Close the poll instead of voting (poll creator only)
+	Close bool `json:"close,omitempty"`
+}
+
+// MsgClientScheduled is for editing or cancelling a scheduled message.
+type MsgClientScheduled struct {
+	// Scheduled message ID
+	ID string `json:"id"`
+	// Action: "edit", "cancel"
+	Action string `json:"action"`
+	// For edit: new content and/or send time (nil = no change)
+	Content json.RawMessage `json:"content,omitempty"`
+	SendAt  *time.Time      `json:"sendAt,omitempty"`
+}
+
+// MsgClientForward is for copying messages into other conversations.
+type MsgClientForward struct {
+	// Source conversation
+	ConversationID string `json:"conv"`
+	// Seqs of the messages to forward, in the order they should appear
+	Seqs []int `json:"seqs"`
+	// Target conversation IDs
+	To []string `json:"to"`
+	// Leave the original sender out of the forwarded_from metadata
+	HideSender bool `json:"hideSender,omitempty"`
+}
+
+// MsgClientSave is for bookmarking messages in the user's saved collection.
+type MsgClientSave struct {
+	ConversationID string `json:"conv"`
+	Seq            int    `json:"seq"`
+	// Optional private note; saving again replaces it
+	Note string `json:"note,omitempty"`
+	// Remove the message from the saved collection
+	Remove bool `json:"remove,omitempty"`
+}
+
+// MsgClientDevice registers the session's device (from hi.dev) for push
+// notifications while the user is offline.
+type MsgClientDevice struct {
+	// Platform: "apns", "fcm" or "webpush"
+	Platform string `json:"platform,omitempty"`
+	// Provider device token (apns, fcm)
+	Token string `json:"token,omitempty"`
+	// Browser push subscription (webpush), as from PushSubscription.toJSON()
+	Subscription *WebPushSubscription `json:"subscription,omitempty"`
+	// Stop push notifications to this device
+	Remove bool `json:"remove,omitempty"`
+}
+
+// WebPushSubscription is a browser's push subscription.
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256DH string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// MsgClientPres sets the user's presence. Unset fields are left unchanged.
+type MsgClientPres struct {
+	// "available", "away", "busy", "dnd" or "invisible"
+	State string `json:"state,omitempty"`
+	// Custom status text; empty clears it
+	Status *string `json:"status,omitempty"`
+	// Seconds until the custom status clears (0 = never)
+	StatusTTL int `json:"statusTtl,omitempty"`
+	// This session has been idle; the user shows as away once all are
+	Idle *bool `json:"idle,omitempty"`
+	// User IDs to send current presence for
+	Probe []string `json:"probe,omitempty"`
+	// Follow presence of these users and conversation members only
+	Sub *MsgPresenceTargets `json:"sub,omitempty"`
+	// Stop following presence of these users and conversations
+	Unsub *MsgPresenceTargets `json:"unsub,omitempty"`
+}
+
+// MsgPresenceTargets names users and conversations to follow presence for.
+type MsgPresenceTargets struct {
+	Users []string `json:"users,omitempty"`
+	Convs []string `json:"convs,omitempty"`
 }
 
 // ============================================================================
@@ -307,6 +509,19 @@ func CtrlError(id string, code int, text string) *ServerMessage {
 	}
 }
 
+// CtrlErrorWithParams creates an error response carrying extra details.
+func CtrlErrorWithParams(id string, code int, text string, params map[string]any) *ServerMessage {
+	return &ServerMessage{
+		Ctrl: &MsgServerCtrl{
+			ID:     id,
+			Code:   code,
+			Text:   text,
+			Params: params,
+			Ts:     time.Now().UTC(),
+		},
+	}
+}
+
 // Common error codes
 const (
 	CodeOK              = 200
@@ -347,14 +562,26 @@ type ConversationInfo struct {
 	LastMsgAt *time.Time      `json:"lastMsgAt,omitempty"`
 	Favorite  bool            `json:"favorite,omitempty"`
 	Muted     bool            `json:"muted,omitempty"`
+	// Timed mute end, while it is still running
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"`
+	// Notification level, if not the user's default
+	Notify string `json:"notify,omitempty"`
 	// For DMs: the other user
 	User *UserInfo `json:"user,omitempty"`
 	// Disappearing messages TTL in seconds (nil = disabled)
 	DisappearingTTL *int `json:"disappearingTTL,omitempty"`
-	// Pinned message info
+	// Top pinned message info
 	PinnedSeq *int       `json:"pinnedSeq,omitempty"`
 	PinnedAt  *time.Time `json:"pinnedAt,omitempty"`
 	PinnedBy  *string    `json:"pinnedBy,omitempty"`
+	// Number of pinned messages
+	PinCount int `json:"pinCount,omitempty"`
 	// No-screenshots flag
 	NoScreenshots bool `json:"noScreenshots,omitempty"`
+	// Slow mode interval in seconds (rooms only, omitted when disabled)
+	SlowMode int `json:"slowMode,omitempty"`
+	// Number of active members
+	MemberCount int `json:"memberCount"`
+	// Effective member limit for rooms (omitted when unlimited)
+	MaxMembers int `json:"maxMembers,omitempty"`
 }
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scalecode-solutions/mvchat2/redis"
+)
+
+// Typing activities.
+const (
+	typingText      = "typing"
+	typingRecording = "recording"
+	typingUploading = "uploading"
+)
+
+const (
+	// typingTimeout is how long an activity lasts unless the client repeats it.
+	typingTimeout = 6 * time.Second
+	// typingThrottle is the least time between relaying the same activity
+	// from one member again.
+	typingThrottle = 3 * time.Second
+	// typingAggregateMembers is the room size above which members get one
+	// summary instead of an event per typist.
+	typingAggregateMembers = 20
+	// typingSummaryInterval is the least time between summaries for a room.
+	typingSummaryInterval = 2 * time.Second
+	// typingSummaryUsers is how many typists a summary names.
+	typingSummaryUsers = 3
+)
+
+type typingKey struct {
+	convID, userID uuid.UUID
+}
+
+// typist is one member's current activity in a conversation.
+type typist struct {
+	activity  string
+	aggregate bool
+	// The session that reported it, which isn't told about it
+	sessID string
+	// When the activity was last relayed, and when it ends
+	sent    time.Time
+	expires time.Time
+	// Ends the activity if it isn't repeated
+	timer *time.Timer
+}
+
+// typingRoom is the summary state of an aggregated room.
+type typingRoom struct {
+	// When the last summary went out, and what it said
+	sent time.Time
+	last *TypingSummary
+	// A flush is scheduled or running
+	pending bool
+	// Activity changed since the running flush counted it
+	dirty bool
+}
+
+// TypingTracker relays typing activity: members' starts are throttled and
+// expire unless repeated, stops are sent when an activity ends, and big
+// rooms get a periodic summary instead. When Redis is enabled, summaries
+// count typists on all nodes and one node at a time sends them; otherwise
+// they count only this node's.
+type TypingTracker struct {
+	redis *redis.Client
+	// Delivers an info message to a conversation's members, except the
+	// session skipSession
+	send func(convID uuid.UUID, info *MsgServerInfo, skipSession string)
+
+	mu      sync.Mutex
+	typists map[typingKey]*typist
+	rooms   map[uuid.UUID]*typingRoom
+}
+
+// NewTypingTracker creates a new typing tracker.
+// Pass a nil Redis client for single-node operation.
+func NewTypingTracker(redisClient *redis.Client, send func(convID uuid.UUID, info *MsgServerInfo, skipSession string)) *TypingTracker {
+	return &TypingTracker{
+		redis:   redisClient,
+		send:    send,
+		typists: make(map[typingKey]*typist),
+		rooms:   make(map[uuid.UUID]*typingRoom),
+	}
+}
+
+// Refresh extends a member's activity if it was relayed too recently to be
+// relayed again. Returns false if Start should be called instead.
+func (t *TypingTracker) Refresh(convID, userID uuid.UUID, activity string) bool {
+	key := typingKey{convID, userID}
+
+	t.mu.Lock()
+	tp := t.typists[key]
+	if tp == nil || tp.activity != activity || time.Since(tp.sent) >= typingThrottle {
+		t.mu.Unlock()
+		return false
+	}
+	tp.expires = time.Now().Add(typingTimeout)
+	tp.timer.Reset(typingTimeout)
+	aggregate := tp.aggregate
+	t.mu.Unlock()
+
+	if aggregate {
+		t.share(convID, userID)
+	}
+	return true
+}
+
+// Start records a member's activity, reported by session sessID, and relays
+// it. aggregate is whether the conversation is big enough for summaries.
+func (t *TypingTracker) Start(convID, userID uuid.UUID, sessID, activity string, aggregate bool) {
+	key := typingKey{convID, userID}
+
+	t.mu.Lock()
+	tp := t.typists[key]
+	if tp == nil {
+		created := &typist{}
+		created.timer = time.AfterFunc(typingTimeout, func() { t.expire(key, created) })
+		t.typists[key] = created
+		tp = created
+	} else {
+		tp.timer.Reset(typingTimeout)
+	}
+	now := time.Now()
+	tp.activity, tp.aggregate, tp.sessID = activity, aggregate, sessID
+	tp.sent, tp.expires = now, now.Add(typingTimeout)
+	t.mu.Unlock()
+
+	if aggregate {
+		t.share(convID, userID)
+		t.summarize(convID)
+		return
+	}
+	t.send(convID, &MsgServerInfo{
+		ConversationID: convID.String(),
+		From:           userID.String(),
+		What:           "typing",
+		Activity:       activity,
+		Ts:             time.Now().UTC(),
+	}, sessID)
+}
+
+// Stop ends a member's activity, if any, and relays that.
+func (t *TypingTracker) Stop(convID, userID uuid.UUID) {
+	key := typingKey{convID, userID}
+	if tp := t.remove(key); tp != nil {
+		t.stopped(key, tp)
+	}
+}
+
+// MessageSent ends a member's activity when their message goes out. Members
+// clear the typist's indicator on the message itself, so only summaries are
+// updated.
+func (t *TypingTracker) MessageSent(convID, userID uuid.UUID) {
+	key := typingKey{convID, userID}
+	if tp := t.remove(key); tp != nil && tp.aggregate {
+		t.stopped(key, tp)
+	}
+}
+
+// remove forgets a member's activity, returning it if there was one.
+func (t *TypingTracker) remove(key typingKey) *typist {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := t.typists[key]
+	if tp != nil {
+		tp.timer.Stop()
+		delete(t.typists, key)
+	}
+	return tp
+}
+
+// expire ends an activity that wasn't repeated in time.
+func (t *TypingTracker) expire(key typingKey, tp *typist) {
+	t.mu.Lock()
+	// Gone, or repeated while the timer fired
+	if t.typists[key] != tp || time.Now().Before(tp.expires) {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.typists, key)
+	t.mu.Unlock()
+
+	t.stopped(key, tp)
+}
+
+// stopped relays the end of an activity.
+func (t *TypingTracker) stopped(key typingKey, tp *typist) {
+	if tp.aggregate {
+		if t.redis != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := t.redis.ClearTyping(ctx, key.convID.String(), key.userID.String()); err != nil {
+				log.Printf("typing: failed to clear activity in %s: %v", shortID(key.convID), err)
+			}
+			cancel()
+		}
+		t.summarize(key.convID)
+		return
+	}
+	t.send(key.convID, &MsgServerInfo{
+		ConversationID: key.convID.String(),
+		From:           key.userID.String(),
+		What:           "typing_stop",
+		Ts:             time.Now().UTC(),
+	}, tp.sessID)
+}
+
+// share records an aggregated member's activity for other nodes.
+func (t *TypingTracker) share(convID, userID uuid.UUID) {
+	if t.redis == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.redis.SetTyping(ctx, convID.String(), userID.String(), time.Now().Add(typingTimeout)); err != nil {
+		log.Printf("typing: failed to share activity in %s: %v", shortID(convID), err)
+	}
+}
+
+// summarize sends a room's summary, at most once per typingSummaryInterval;
+// changes within the interval go out together at its end.
+func (t *TypingTracker) summarize(convID uuid.UUID) {
+	t.mu.Lock()
+	room := t.rooms[convID]
+	if room == nil {
+		room = &typingRoom{}
+		t.rooms[convID] = room
+	}
+	room.dirty = true
+	if room.pending {
+		t.mu.Unlock()
+		return
+	}
+	room.pending = true
+	wait := typingSummaryInterval - time.Since(room.sent)
+	t.mu.Unlock()
+
+	if wait > 0 {
+		time.AfterFunc(wait, func() { t.flush(convID) })
+		return
+	}
+	t.flush(convID)
+}
+
+// flush sends a room's current summary if it changed, and schedules another
+// if activity changed meanwhile.
+func (t *TypingTracker) flush(convID uuid.UUID) {
+	t.mu.Lock()
+	room := t.rooms[convID]
+	if room == nil {
+		t.mu.Unlock()
+		return
+	}
+	room.dirty = false
+	last := room.last
+	t.mu.Unlock()
+
+	summary := t.summary(convID)
+	changed := last == nil || last.Count != summary.Count || !slices.Equal(last.Users, summary.Users)
+	send, out := changed, changed
+	if changed {
+		send, out = t.claimSummary(convID, summary)
+	}
+
+	t.mu.Lock()
+	if out {
+		room.sent, room.last = time.Now(), summary
+	}
+	// Another node sent a different summary; send ours once its interval ends
+	again := room.dirty || (changed && !out)
+	room.pending = again
+	if !again && summary.Count == 0 {
+		delete(t.rooms, convID)
+	}
+	t.mu.Unlock()
+
+	if send {
+		t.send(convID, &MsgServerInfo{
+			ConversationID: convID.String(),
+			What:           "typing_summary",
+			Typing:         summary,
+			Ts:             time.Now().UTC(),
+		}, "")
+	}
+	if again {
+		time.AfterFunc(typingSummaryInterval, func() { t.flush(convID) })
+	}
+}
+
+// claimSummary decides whether this node sends a room's summary. Every node
+// delivers to all members, so with Redis the first node to take the room's
+// lease sends for the interval. send is whether to send it; out is whether
+// members have it, from this node or another.
+func (t *TypingTracker) claimSummary(convID uuid.UUID, summary *TypingSummary) (send, out bool) {
+	if t.redis == nil {
+		return true, true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key := "typing:summary:" + convID.String()
+	ok, err := t.redis.SetNX(ctx, key, summary, typingSummaryInterval)
+	if err != nil {
+		log.Printf("typing: redis unavailable, sending summary for %s: %v", shortID(convID), err)
+		return true, true
+	}
+	if ok {
+		return true, true
+	}
+	var sent TypingSummary
+	if err := t.redis.Get(ctx, key, &sent); err != nil {
+		// The lease ran out meanwhile; try again next round
+		return false, false
+	}
+	same := sent.Count == summary.Count && slices.Equal(sent.Users, summary.Users)
+	return false, same
+}
+
+// summary counts a room's typists, on all nodes when Redis is enabled.
+func (t *TypingTracker) summary(convID uuid.UUID) *TypingSummary {
+	if t.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		count, users, err := t.redis.GetTyping(ctx, convID.String(), typingSummaryUsers)
+		if err == nil {
+			return &TypingSummary{Count: count, Users: users}
+		}
+		log.Printf("typing: redis unavailable, summarizing local activity: %v", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var users []string
+	for key := range t.typists {
+		if key.convID == convID {
+			users = append(users, key.userID.String())
+		}
+	}
+	slices.Sort(users)
+	summary := &TypingSummary{Count: len(users)}
+	if len(users) > typingSummaryUsers {
+		users = users[:typingSummaryUsers]
+	}
+	summary.Users = users
+	return summary
+}
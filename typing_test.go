@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// typingRecorder collects what a typing tracker relays.
+type typingRecorder struct {
+	mu    sync.Mutex
+	infos []*MsgServerInfo
+	skips []string
+}
+
+func (r *typingRecorder) send(convID uuid.UUID, info *MsgServerInfo, skipSession string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.infos = append(r.infos, info)
+	r.skips = append(r.skips, skipSession)
+}
+
+// take returns what was relayed since the last call.
+func (r *typingRecorder) take() []*MsgServerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := r.infos
+	r.infos, r.skips = nil, nil
+	return infos
+}
+
+func TestTypingTracker_StartThrottleStop(t *testing.T) {
+	rec := &typingRecorder{}
+	tracker := NewTypingTracker(nil, rec.send)
+	convID, userID := uuid.New(), uuid.New()
+
+	tracker.Start(convID, userID, "sess-1", typingText, false)
+	if len(rec.skips) != 1 || rec.skips[0] != "sess-1" {
+		t.Errorf("expected only the typist's session to be skipped, got %v", rec.skips)
+	}
+	infos := rec.take()
+	if len(infos) != 1 || infos[0].What != "typing" || infos[0].Activity != typingText || infos[0].From != userID.String() {
+		t.Fatalf("expected one typing event, got %+v", infos)
+	}
+
+	// Repeats within the throttle are absorbed; a new activity is relayed
+	if !tracker.Refresh(convID, userID, typingText) {
+		t.Error("expected a repeat to be absorbed")
+	}
+	if tracker.Refresh(convID, userID, typingRecording) {
+		t.Error("expected a new activity to be relayed")
+	}
+	tracker.Start(convID, userID, "sess-1", typingRecording, false)
+	if infos := rec.take(); len(infos) != 1 || infos[0].Activity != typingRecording {
+		t.Fatalf("expected recording, got %+v", infos)
+	}
+
+	tracker.Stop(convID, userID)
+	if len(rec.skips) != 1 || rec.skips[0] != "sess-1" {
+		t.Errorf("expected the stop to skip the typist's session, got %v", rec.skips)
+	}
+	if infos := rec.take(); len(infos) != 1 || infos[0].What != "typing_stop" {
+		t.Fatalf("expected a stop, got %+v", infos)
+	}
+	tracker.Stop(convID, userID)
+	if infos := rec.take(); len(infos) != 0 {
+		t.Errorf("expected nothing for a second stop, got %+v", infos)
+	}
+}
+
+func TestTypingTracker_Expiry(t *testing.T) {
+	rec := &typingRecorder{}
+	tracker := NewTypingTracker(nil, rec.send)
+	convID, userID := uuid.New(), uuid.New()
+	key := typingKey{convID, userID}
+
+	tracker.Start(convID, userID, "sess-1", typingUploading, false)
+	rec.take()
+	tp := tracker.typists[key]
+
+	// A timer firing just after a refresh leaves the activity alone
+	tracker.expire(key, tp)
+	if tracker.typists[key] == nil {
+		t.Fatal("expected the refreshed activity to survive")
+	}
+
+	tracker.mu.Lock()
+	tp.expires = time.Now().Add(-time.Second)
+	tracker.mu.Unlock()
+	tracker.expire(key, tp)
+	if infos := rec.take(); len(infos) != 1 || infos[0].What != "typing_stop" {
+		t.Fatalf("expected a stop on expiry, got %+v", infos)
+	}
+	if len(tracker.typists) != 0 {
+		t.Error("expected the activity to be forgotten")
+	}
+}
+
+func TestTypingTracker_MessageSent(t *testing.T) {
+	rec := &typingRecorder{}
+	tracker := NewTypingTracker(nil, rec.send)
+	convID, userID := uuid.New(), uuid.New()
+
+	tracker.Start(convID, userID, "sess-1", typingText, false)
+	rec.take()
+	tracker.MessageSent(convID, userID)
+	if infos := rec.take(); len(infos) != 0 {
+		t.Errorf("expected the message itself to end typing, got %+v", infos)
+	}
+	if len(tracker.typists) != 0 {
+		t.Error("expected the activity to be forgotten")
+	}
+}
+
+func TestTypingTracker_Summary(t *testing.T) {
+	rec := &typingRecorder{}
+	tracker := NewTypingTracker(nil, rec.send)
+	convID := uuid.New()
+	users := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+
+	tracker.Start(convID, users[0], "sess-1", typingText, true)
+	if len(rec.skips) != 1 || rec.skips[0] != "" {
+		t.Errorf("expected the summary to go to every session, got %v", rec.skips)
+	}
+	infos := rec.take()
+	if len(infos) != 1 || infos[0].What != "typing_summary" || infos[0].Typing.Count != 1 || infos[0].From != "" {
+		t.Fatalf("expected a summary of one, got %+v", infos)
+	}
+
+	// Starts within the interval wait for one summary at its end
+	for _, u := range users[1:] {
+		tracker.Start(convID, u, "sess-1", typingText, true)
+	}
+	if infos := rec.take(); len(infos) != 0 {
+		t.Fatalf("expected no summary within the interval, got %+v", infos)
+	}
+	tracker.flush(convID)
+	infos = rec.take()
+	if len(infos) != 1 || infos[0].Typing.Count != 4 || len(infos[0].Typing.Users) != typingSummaryUsers {
+		t.Fatalf("expected a summary of four naming three, got %+v", infos)
+	}
+
+	// A flush with nothing new sends nothing
+	tracker.flush(convID)
+	if infos := rec.take(); len(infos) != 0 {
+		t.Errorf("expected no repeat summary, got %+v", infos)
+	}
+
+	for _, u := range users {
+		tracker.Stop(convID, u)
+	}
+	tracker.flush(convID)
+	if infos := rec.take(); len(infos) != 1 || infos[0].Typing.Count != 0 {
+		t.Fatalf("expected an empty summary, got %+v", infos)
+	}
+	if len(tracker.rooms) != 0 {
+		t.Error("expected the room to be forgotten once nobody is typing")
+	}
+}